@@ -36,7 +36,7 @@ export const roleService = {
   },
 
   async searchUsers(companyId) {
-    const response = await api.get(`/users/search?companyId=${companyId}`);
+    const response = await api.get(`/users/search?company_id=${companyId}`);
     return response.data;
   },
 
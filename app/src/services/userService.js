@@ -7,7 +7,7 @@ export const userService = {
     if (!id) {
       throw new Error('Company ID is required');
     }
-    const response = await api.get(`/users/search?companyId=${id}`);
+    const response = await api.get(`/users/search?company_id=${id}`);
     return response.data || [];
   },
 
@@ -18,7 +18,7 @@ export const userService = {
       throw new Error('Company ID is required');
     }
     const response = await api.get(`/users/search`, {
-      params: { companyId: id, q: query }
+      params: { company_id: id, q: query }
     });
     return response.data || [];
   },
@@ -29,7 +29,7 @@ export const userService = {
     if (!id) {
       throw new Error('Company ID is required');
     }
-    const response = await api.post(`/company-users/register`, { ...userData, company_id: parseInt(id) });
+    const response = await api.post(`/company-users/${id}/users`, userData);
     return response.data;
   },
 
@@ -2,6 +2,7 @@
 package main
 
 import (
+	"context"
 	"net/http"
 	"time"
 
@@ -10,23 +11,40 @@ import (
 	"github.com/go-chi/cors"
 	"go.uber.org/zap"
 
+	"gobizmanager/internal/audit"
 	"gobizmanager/internal/auth"
+	"gobizmanager/internal/auth/ldap"
+	"gobizmanager/internal/auth/oidc"
 	"gobizmanager/internal/company"
 	"gobizmanager/internal/company_user"
+	"gobizmanager/internal/invitation"
 	"gobizmanager/internal/rbac"
+	"gobizmanager/internal/service_account"
 	"gobizmanager/internal/user"
-	"gobizmanager/pkg/context"
+	appcontext "gobizmanager/pkg/context"
+	"gobizmanager/pkg/encryption"
 	"gobizmanager/pkg/language"
 	"gobizmanager/pkg/logger"
+	"gobizmanager/pkg/mailer"
 	"gobizmanager/pkg/migration"
 	"gobizmanager/platform/config"
 	"gobizmanager/platform/database"
+	"gobizmanager/platform/middleware/permission"
 	"gobizmanager/platform/middleware/ratelimit"
 )
 
+const (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 24 * time.Hour
+)
+
 func main() {
 	// Load configuration
-	cfg := config.New()
+	cfg, err := config.New()
+	if err != nil {
+		panic(err)
+	}
+	encryption.SetPasswordHasher(encryption.NewPasswordHasher(cfg.PasswordHashing, cfg.PasswordPepper))
 
 	// Initialize logger first
 	if err := logger.InitLogger("bin/logs/app.log"); err != nil {
@@ -57,22 +75,105 @@ func main() {
 	// Initialize message store
 	msgStore := language.NewMessageStore()
 
-	// Initialize JWT manager
-	jwtManager := auth.NewJWTManager(cfg.JWTSecret, 15*time.Minute, 24*time.Hour)
+	// Initialize signing keys and JWT manager. Retired keys verify for as long
+	// as the longest-lived token, the refresh token.
+	tokenRepo := auth.NewRepository(db)
+	keyManager, err := auth.NewKeyManager(tokenRepo, cfg, refreshTokenTTL)
+	if err != nil {
+		logger.Error("Failed to initialize signing keys", zap.Error(err))
+		return
+	}
+	keyManager.StartRotation(context.Background(), time.Hour)
+	jwtManager := auth.NewJWTManager(keyManager, accessTokenTTL, refreshTokenTTL)
+
+	// Initialize mailer, falling back to files on disk when no SMTP relay is configured
+	var mail mailer.Mailer
+	if cfg.SMTPHost != "" {
+		mail = mailer.NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom)
+	} else {
+		mail = mailer.NewFileMailer(cfg.MailDir, cfg.MailFrom)
+	}
 
 	// Initialize repositories
 	userRepo := user.NewRepository(db, cfg)
 	rbacRepo := rbac.NewRepository(db)
+	authorizer := rbac.NewAuthorizer(rbacRepo, cfg.PermissionCacheTTL, cfg.PermissionCacheSize)
 	companyRepo := company.NewRepository(db, cfg, rbacRepo)
 	companyUserRepo := company_user.NewRepository(db, cfg)
+	serviceAccountRepo := service_account.NewRepository(db, cfg)
+	oidcRepo := oidc.NewRepository(db, cfg)
+	invitationRepo := invitation.NewRepository(db, cfg, userRepo)
+	auditRepo := audit.NewRepository(db)
+
+	// Initialize authenticators. Local passwords are checked first, then the
+	// directory when one is configured.
+	authenticators := []auth.Authenticator{auth.NewPasswordAuthenticator(userRepo)}
+	if cfg.LDAP.URL != "" {
+		authenticators = append(authenticators, ldap.NewAuthenticator(cfg.LDAP, ldap.NewRepository(db, cfg, authorizer)))
+	}
 
 	// Initialize handlers
-	authHandler := auth.NewHandler(userRepo, jwtManager, msgStore)
-	companyHandler := company.NewHandler(companyRepo, rbacRepo, userRepo, msgStore)
-	roleHandler := rbac.NewRoleHandler(rbacRepo, msgStore)
-	permissionHandler := rbac.NewPermissionHandler(rbacRepo, msgStore)
-	companyUserHandler := company_user.NewHandler(companyUserRepo, rbacRepo, msgStore)
+	loginGuard := auth.NewLoginGuard(tokenRepo, auditRepo)
+	authHandler := auth.NewHandler(userRepo, tokenRepo, rbacRepo, authenticators, loginGuard, auditRepo, jwtManager, cfg, mail, msgStore)
+	companyHandler := company.NewHandler(companyRepo, rbacRepo, authorizer, userRepo, msgStore)
+	roleHandler := rbac.NewRoleHandler(rbacRepo, authorizer, msgStore)
+	permissionHandler := rbac.NewPermissionHandler(rbacRepo, authorizer, msgStore)
+	permissionGroupHandler := rbac.NewPermissionGroupHandler(rbacRepo, authorizer, msgStore)
+	permissionDenyHandler := rbac.NewPermissionDenyHandler(rbacRepo, authorizer, msgStore)
+	companyUserHandler := company_user.NewHandler(companyUserRepo, rbacRepo, authorizer, tokenRepo, msgStore)
 	userHandler := user.NewHandler(userRepo)
+	rbacGuard := rbac.NewBaseHandler(rbacRepo, authorizer, msgStore)
+	sessionHandler := auth.NewSessionHandler(tokenRepo, msgStore)
+	apiKeyHandler := auth.NewAPIKeyHandler(tokenRepo, rbacRepo, msgStore)
+	serviceAccountHandler := service_account.NewHandler(serviceAccountRepo, rbacRepo, authorizer, tokenRepo, msgStore)
+	invitationHandler := invitation.NewHandler(invitationRepo, userRepo, jwtManager, mail, cfg, msgStore)
+
+	// Allow creating the first ROOT user when there is none
+	if err := authHandler.PrepareSetup(); err != nil {
+		logger.Error("Failed to check for a root user", zap.Error(err))
+		return
+	}
+
+	// Initialize external identity providers
+	oidcProviders := make([]*oidc.Provider, 0, len(cfg.OIDCProviders))
+	for _, providerCfg := range cfg.OIDCProviders {
+		oidcProviders = append(oidcProviders, oidc.NewProvider(providerCfg, nil))
+	}
+	oidcHandler := oidc.NewHandler(oidcProviders, oidcRepo, userRepo, authHandler, msgStore)
+
+	// Every protected route must declare the permission it requires. The
+	// routes are checked on a router of their own before being served.
+	protectedRoutes := func(r chi.Router) {
+		r.Mount("/companies", company.Routes(companyHandler, rbacGuard, msgStore))
+		r.Mount("/companies/{companyID}/service-accounts", service_account.Routes(serviceAccountHandler, rbacGuard))
+		r.Mount("/companies/{companyID}/invitations", invitation.Routes(invitationHandler, rbacGuard))
+		r.Mount("/rbac", rbac.Routes(roleHandler, permissionHandler, permissionGroupHandler, permissionDenyHandler, rbacGuard))
+		r.Mount("/company-users", company_user.Routes(companyUserHandler, rbacGuard))
+		r.Mount("/users", user.Routes(userHandler, rbacGuard))
+		r.With(rbacGuard.RequireAuthentication()).Get("/users/me/permissions", permissionHandler.GetMyPermissions)
+
+		// Credentials, sessions and tokens stay out of reach of impersonation.
+		// The ROOT-only routes check the caller's role themselves.
+		r.Group(func(r chi.Router) {
+			r.Use(auth.RejectImpersonation(msgStore))
+			r.With(rbacGuard.RequireAuthentication()).Post("/auth/logout-all", authHandler.LogoutAll)
+			r.With(rbacGuard.RequireAuthentication()).Post("/auth/switch-company", authHandler.SwitchCompany)
+			r.With(rbacGuard.RequireAuthentication()).Post("/auth/mfa/disable", authHandler.DisableMFA)
+			r.With(rbacGuard.RequireAuthentication()).Post("/auth/mfa/recovery-codes", authHandler.RegenerateRecoveryCodes)
+			r.Mount("/users/me/sessions", auth.SessionRoutes(sessionHandler, rbacGuard))
+			r.Mount("/users/me/api-keys", auth.APIKeyRoutes(apiKeyHandler, rbacGuard))
+			r.With(rbacGuard.RequireAuthentication()).Put("/users/me/password", authHandler.ChangePassword)
+			r.With(rbacGuard.RequireAuthentication()).Put("/users/me/email", authHandler.ChangeEmail)
+			r.With(rbacGuard.RequireAuthentication()).Post("/users/{userID}/unlock", authHandler.AdminUnlockAccount)
+			r.With(rbacGuard.RequireAuthentication()).Post("/admin/impersonate", authHandler.Impersonate)
+		})
+	}
+	checkedRoutes := chi.NewRouter()
+	protectedRoutes(checkedRoutes)
+	if err := permission.Check(checkedRoutes); err != nil {
+		logger.Error("Route permission check failed", zap.Error(err))
+		return
+	}
 
 	// Create router
 	r := chi.NewRouter()
@@ -82,7 +183,7 @@ func main() {
 		AllowedOrigins:   []string{"http://localhost:5173"},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		ExposedHeaders:   []string{"Link", auth.ImpersonationHeader},
 		AllowCredentials: true,
 		MaxAge:           300, // Maximum value not ignored by any of major browsers
 	})
@@ -91,23 +192,21 @@ func main() {
 	// Add other middleware
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.Logger)
-	r.Use(context.LanguageMiddleware())
+	r.Use(appcontext.LanguageMiddleware())
 	r.Use(ratelimit.New(cfg.RateLimit))
 
 	// Public routes
 	r.Group(func(r chi.Router) {
-		r.Post("/auth/register", authHandler.Register)
-		r.Post("/auth/login", authHandler.Login)
-		r.Post("/auth/refresh", authHandler.RefreshToken)
+		r.Get("/.well-known/jwks.json", authHandler.JWKS)
+		r.Mount("/auth", auth.Routes(authHandler, msgStore))
+		r.Mount("/auth/oidc", oidc.Routes(oidcHandler))
+		r.Post("/invitations/accept", invitationHandler.AcceptInvitation)
 	})
 
 	// Protected routes
 	r.Group(func(r chi.Router) {
-		r.Use(auth.Middleware(jwtManager, msgStore))
-		r.Mount("/companies", company.Routes(companyHandler, msgStore))
-		r.Mount("/rbac", rbac.Routes(roleHandler, permissionHandler))
-		r.Mount("/company-users", company_user.Routes(companyUserHandler))
-		r.Mount("/users", user.Routes(userHandler))
+		r.Use(auth.Middleware(jwtManager, tokenRepo, msgStore))
+		protectedRoutes(r)
 	})
 
 	// Start server
@@ -13,7 +13,7 @@ const PermissionManager = ({ role, onClose }) => {
 
   const fetchUsers = async () => {
     try {
-      const response = await axios.get(`/api/users/search?companyId=${role.company_id}`);
+      const response = await axios.get(`/api/users/search?company_id=${role.company_id}`);
       setUsers(response.data);
     } catch (error) {
       message.error('Failed to fetch users');
@@ -0,0 +1,33 @@
+package audit
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Event types
+const (
+	EventAccountLocked   = "auth.account_locked"
+	EventAccountUnlocked = "auth.account_unlocked"
+	EventIPBlocked       = "auth.ip_blocked"
+
+	EventRootCreated          = "admin.root_created"
+	EventImpersonationStarted = "admin.impersonation_started"
+)
+
+// Event records a security relevant action. UserID is the account affected
+// and ActorID the user who acted, when they differ or are known.
+type Event struct {
+	ID        int64         `json:"id"`
+	Type      string        `json:"type"`
+	UserID    sql.NullInt64 `json:"user_id"`
+	ActorID   sql.NullInt64 `json:"actor_id"`
+	CompanyID sql.NullInt64 `json:"company_id"`
+	IPAddress string        `json:"ip_address"`
+	Details   string        `json:"details"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+func (Event) TableName() string {
+	return "audit_events"
+}
@@ -0,0 +1,41 @@
+package audit
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"gobizmanager/pkg/logger"
+)
+
+type Repository struct {
+	db *gorm.DB
+}
+
+func NewRepository(db *gorm.DB) *Repository {
+	return &Repository{db: db}
+}
+
+// Record stores an event. Details are encoded as JSON. Failures are logged
+// rather than returned so that auditing never breaks the action it records.
+func (r *Repository) Record(event *Event, details map[string]interface{}) {
+	if len(details) > 0 {
+		b, err := json.Marshal(details)
+		if err == nil {
+			event.Details = string(b)
+		}
+	}
+	event.CreatedAt = time.Now()
+
+	if err := r.db.Create(event).Error; err != nil {
+		logger.Error("Failed to record audit event", zap.String("type", event.Type), zap.Error(err))
+	}
+}
+
+// ID wraps an optional ID for an event field; zero means none
+func ID(id int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: id, Valid: id != 0}
+}
@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"go.uber.org/zap"
+
+	types "gobizmanager/internal/types"
+	appcontext "gobizmanager/pkg/context"
+	"gobizmanager/pkg/language"
+	"gobizmanager/pkg/logger"
+	"gobizmanager/pkg/mailer"
+	"gobizmanager/pkg/passwordpolicy"
+	"gobizmanager/pkg/utils"
+)
+
+const (
+	passwordResetTTL     = time.Hour
+	emailVerificationTTL = 24 * time.Hour
+	mailSendTimeout      = 30 * time.Second
+)
+
+// ForgotPassword emails a password reset link. The response is the same
+// whether or not the account exists so it cannot be used to probe for users.
+func (h *Handler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req types.ForgotPasswordRequest
+	if err := utils.ParseRequest(r, &req); err != nil {
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+
+	if err := h.Validator.Struct(req); err != nil {
+		utils.ValidationError(w, r, err, h.MsgStore)
+		return
+	}
+
+	lang := appcontext.GetLanguage(r.Context())
+	if u, err := h.UserRepo.GetUserByEmail(req.Username); err == nil && !u.IsServiceAccount {
+		token, err := h.JWTManager.GenerateChallengeToken(u.ID, PasswordResetTokenType, passwordResetTTL)
+		if err != nil {
+			logger.Error("Failed to generate password reset token", zap.Error(err))
+		} else {
+			h.sendEmail(lang, u.Email, language.EmailPasswordResetSubject, language.EmailPasswordResetBody, map[string]interface{}{
+				"Link":    h.appLink("/reset-password", token),
+				"Minutes": int(passwordResetTTL.Minutes()),
+			})
+		}
+	}
+
+	msg, httpStatus := h.MsgStore.GetMessage(lang, language.AuthPasswordResetRequested)
+	utils.JSON(w, httpStatus, msg)
+}
+
+// ResetPassword sets a new password from a reset link and ends every session
+// of the user
+func (h *Handler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req types.ResetPasswordRequest
+	if err := utils.ParseRequest(r, &req); err != nil {
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+
+	if err := h.Validator.Struct(req); err != nil {
+		utils.ValidationError(w, r, err, h.MsgStore)
+		return
+	}
+
+	// Check the password before the link is used up so that a rejected
+	// password can be corrected
+	claims, err := h.verifyActionToken(req.Token, PasswordResetTokenType)
+	if err != nil {
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+	if !h.checkPassword(w, r, claims.UserID, req.Password) {
+		return
+	}
+
+	userID, err := h.consumeActionToken(req.Token, PasswordResetTokenType)
+	if err != nil {
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+
+	if err := h.UserRepo.UpdatePassword(userID, req.Password); err != nil {
+		logger.Error("Failed to reset password", zap.Error(err))
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthPasswordResetFailed))
+		return
+	}
+
+	if err := h.TokenRepo.RevokeUserRefreshTokens(userID); err != nil {
+		logger.Error("Failed to revoke sessions after password reset", zap.Error(err))
+	}
+
+	msg, httpStatus := h.MsgStore.GetMessage(appcontext.GetLanguage(r.Context()), language.AuthPasswordReset)
+	utils.JSON(w, httpStatus, msg)
+}
+
+// VerifyEmail confirms the user's address from a verification link
+func (h *Handler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req types.VerifyEmailRequest
+	if err := utils.ParseRequest(r, &req); err != nil {
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+
+	if err := h.Validator.Struct(req); err != nil {
+		utils.ValidationError(w, r, err, h.MsgStore)
+		return
+	}
+
+	userID, err := h.consumeActionToken(req.Token, EmailVerificationTokenType)
+	if err != nil {
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+
+	if err := h.UserRepo.MarkEmailVerified(userID); err != nil {
+		logger.Error("Failed to verify email", zap.Error(err))
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthEmailVerifyFailed))
+		return
+	}
+
+	msg, httpStatus := h.MsgStore.GetMessage(appcontext.GetLanguage(r.Context()), language.AuthEmailVerified)
+	utils.JSON(w, httpStatus, msg)
+}
+
+// sendVerificationEmail emails a verification link for the user's address
+func (h *Handler) sendVerificationEmail(lang string, userID int64, email string) {
+	token, err := h.JWTManager.GenerateChallengeToken(userID, EmailVerificationTokenType, emailVerificationTTL)
+	if err != nil {
+		logger.Error("Failed to generate email verification token", zap.Error(err))
+		return
+	}
+
+	h.sendEmail(lang, email, language.EmailVerificationSubject, language.EmailVerificationBody, map[string]interface{}{
+		"Link": h.appLink("/verify-email", token),
+	})
+}
+
+// consumeActionToken verifies a single-use emailed token and marks it used.
+// The returned error carries a language message key.
+func (h *Handler) consumeActionToken(token, tokenType string) (int64, error) {
+	claims, err := h.verifyActionToken(token, tokenType)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := h.TokenRepo.ConsumeToken(claims.ID, claims.UserID, tokenType, claims.ExpiresAt.Time); err != nil {
+		if !errors.Is(err, ErrTokenAlreadyUsed) {
+			logger.Error("Failed to record used token", zap.Error(err))
+		}
+		return 0, errors.New(language.AuthInvalidActionToken)
+	}
+
+	return claims.UserID, nil
+}
+
+// verifyActionToken checks an action token without using it up
+func (h *Handler) verifyActionToken(token, tokenType string) (*Claims, error) {
+	claims, err := h.JWTManager.VerifyToken(token)
+	if err != nil || claims.TokenType != tokenType || claims.ID == "" {
+		return nil, errors.New(language.AuthInvalidActionToken)
+	}
+	return claims, nil
+}
+
+// sendEmail renders a localized template and delivers it in the background so
+// that response times do not depend on the mail transport
+func (h *Handler) sendEmail(lang, to, subjectKey, bodyKey string, data interface{}) {
+	subject, _ := h.MsgStore.GetMessage(lang, subjectKey)
+	tmpl, _ := h.MsgStore.GetMessage(lang, bodyKey)
+
+	body, err := mailer.Render(tmpl, data)
+	if err != nil {
+		logger.Error("Failed to render email", zap.String("template", bodyKey), zap.Error(err))
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mailSendTimeout)
+		defer cancel()
+
+		if err := h.Mailer.Send(ctx, mailer.Message{To: to, Subject: subject, Body: body}); err != nil {
+			logger.Error("Failed to send email", zap.String("template", bodyKey), zap.Error(err))
+		}
+	}()
+}
+
+// appLink builds a frontend URL carrying a token
+func (h *Handler) appLink(path, token string) string {
+	return h.Config.AppURL + path + "?token=" + url.QueryEscape(token)
+}
+
+// checkPassword applies the password policies to a new password of the user,
+// who is zero when registering. It responds and returns false when the
+// password is rejected.
+func (h *Handler) checkPassword(w http.ResponseWriter, r *http.Request, userID int64, password string) bool {
+	err := h.UserRepo.ValidatePassword(userID, 0, password)
+	if err == nil {
+		return true
+	}
+
+	var violation *passwordpolicy.Violation
+	if errors.As(err, &violation) {
+		utils.RespondError(w, r, h.MsgStore, violation)
+	} else {
+		logger.Error("Failed to check password policy", zap.Error(err))
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.PasswordCheckFailed))
+	}
+	return false
+}
@@ -0,0 +1,245 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"gobizmanager/internal/audit"
+	types "gobizmanager/internal/types"
+	"gobizmanager/internal/user"
+	appcontext "gobizmanager/pkg/context"
+	"gobizmanager/pkg/language"
+	"gobizmanager/pkg/logger"
+	"gobizmanager/pkg/utils"
+	"gobizmanager/platform/middleware"
+)
+
+// setupState guards the one-time setup token. The token is cleared once the
+// first ROOT user exists.
+type setupState struct {
+	mu    sync.Mutex
+	token string
+}
+
+// ImpersonationToken is the access token returned by Impersonate. There is no
+// refresh token; a new one must be requested once it expires.
+type ImpersonationToken struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+	UserID      int64  `json:"user_id"`
+	CompanyID   int64  `json:"company_id"`
+}
+
+// PrepareSetup enables POST /auth/setup when no ROOT user exists yet. The
+// configured setup token is used, or a random one is generated and logged.
+func (h *Handler) PrepareSetup() error {
+	exists, err := h.UserRepo.HasRootUser()
+	if err != nil || exists {
+		return err
+	}
+
+	token := h.Config.SetupToken
+	if token == "" {
+		if token, err = NewTokenID(); err != nil {
+			return err
+		}
+		logger.Warn("No ROOT user exists; create one with POST /auth/setup", zap.String("setupToken", token))
+	} else {
+		logger.Warn("No ROOT user exists; create one with POST /auth/setup and SETUP_TOKEN")
+	}
+
+	h.setup.mu.Lock()
+	h.setup.token = token
+	h.setup.mu.Unlock()
+	return nil
+}
+
+// Setup creates the first ROOT user with the setup token. It is closed for
+// good once a ROOT user exists.
+func (h *Handler) Setup(w http.ResponseWriter, r *http.Request) {
+	var req types.SetupRequest
+	if err := utils.ParseRequest(r, &req); err != nil {
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+
+	if err := h.Validator.Struct(req); err != nil {
+		utils.ValidationError(w, r, err, h.MsgStore)
+		return
+	}
+
+	// Held until the user exists so concurrent requests cannot both succeed
+	h.setup.mu.Lock()
+	defer h.setup.mu.Unlock()
+
+	if h.setup.token == "" {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthRegistrationClosed))
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(req.Token), []byte(h.setup.token)) != 1 {
+		logger.Warn("Invalid setup token", zap.String("ip", middleware.GetReqIP(r)))
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthSetupTokenInvalid))
+		return
+	}
+
+	if _, err := h.UserRepo.GetUserByEmail(req.Username); err == nil {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthUsernameExists))
+		return
+	}
+	if !h.checkPassword(w, r, 0, req.Password) {
+		return
+	}
+
+	userID, err := h.UserRepo.RegisterRootUser(req.Username, req.Password)
+	if err != nil {
+		if errors.Is(err, user.ErrRootExists) {
+			h.setup.token = ""
+			utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthRegistrationClosed))
+			return
+		}
+		logger.Error("Failed to create root user", zap.Error(err))
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthCreateUserFailed))
+		return
+	}
+	h.setup.token = ""
+
+	h.Audit.Record(&audit.Event{
+		Type:      audit.EventRootCreated,
+		UserID:    audit.ID(userID),
+		IPAddress: middleware.GetReqIP(r),
+	}, nil)
+
+	tokens, err := h.issueTokens(r, userID)
+	if err != nil {
+		logger.Error("Failed to generate tokens", zap.Error(err))
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthTokenGenFailed))
+		return
+	}
+
+	h.sendVerificationEmail(appcontext.GetLanguage(r.Context()), userID, req.Username)
+
+	logger.Info("Root user created", zap.Int64("userID", userID))
+	utils.JSON(w, http.StatusCreated, tokens)
+}
+
+// Impersonate lets a ROOT user act as a member of a company. The token is
+// scoped to the company, carries the caller in its act claim and is bound to
+// the caller's session.
+func (h *Handler) Impersonate(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := GetUserID(r.Context())
+	if !ok {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthUnauthorized))
+		return
+	}
+	sessionID, ok := GetSessionID(r.Context())
+	if !ok {
+		// API keys have no session to bind the token to
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthPermissionDenied))
+		return
+	}
+
+	isRoot, err := h.UserRepo.IsRoot(callerID)
+	if err != nil {
+		logger.Error("Failed to check root role", zap.Error(err))
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthDatabaseError))
+		return
+	}
+	if !isRoot {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthPermissionDenied))
+		return
+	}
+
+	var req types.ImpersonateRequest
+	if err := utils.ParseRequest(r, &req); err != nil {
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+
+	if err := h.Validator.Struct(req); err != nil {
+		utils.ValidationError(w, r, err, h.MsgStore)
+		return
+	}
+
+	target, err := h.UserRepo.GetUserByID(req.UserID)
+	if err != nil {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthUserNotFound))
+		return
+	}
+	targetIsRoot, err := h.UserRepo.IsRoot(target.ID)
+	if err != nil {
+		logger.Error("Failed to check root role", zap.Error(err))
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthDatabaseError))
+		return
+	}
+	if targetIsRoot {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthImpersonationTargetInvalid))
+		return
+	}
+
+	scope, ok, err := h.companyScope(target.ID, req.CompanyID)
+	if err != nil {
+		logger.Error("Failed to load company permissions", zap.Error(err))
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.PermissionCheckFailed))
+		return
+	}
+	if !ok {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthImpersonationTargetInvalid))
+		return
+	}
+
+	tokenVersion, err := h.TokenRepo.GetTokenVersion(target.ID)
+	if err != nil {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthDatabaseError))
+		return
+	}
+
+	accessToken, err := h.JWTManager.GenerateImpersonationToken(callerID, sessionID, target.ID, tokenVersion, scope)
+	if err != nil {
+		logger.Error("Failed to generate impersonation token", zap.Error(err))
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthTokenGenFailed))
+		return
+	}
+
+	ttl := h.JWTManager.AccessTokenTTL()
+	h.Audit.Record(&audit.Event{
+		Type:      audit.EventImpersonationStarted,
+		UserID:    audit.ID(target.ID),
+		ActorID:   audit.ID(callerID),
+		CompanyID: audit.ID(req.CompanyID),
+		IPAddress: middleware.GetReqIP(r),
+	}, map[string]interface{}{
+		"reason":     req.Reason,
+		"session_id": sessionID,
+		"expires_at": time.Now().Add(ttl),
+	})
+
+	logger.Warn("Impersonation started",
+		zap.Int64("actorID", callerID),
+		zap.Int64("userID", target.ID),
+		zap.Int64("companyID", req.CompanyID))
+	utils.JSON(w, http.StatusOK, ImpersonationToken{
+		AccessToken: accessToken,
+		ExpiresIn:   int(ttl.Seconds()),
+		UserID:      target.ID,
+		CompanyID:   req.CompanyID,
+	})
+}
+
+// RejectImpersonation keeps impersonation tokens away from routes that manage
+// credentials, sessions or issue other tokens
+func RejectImpersonation(msgStore *language.MessageStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := GetActorID(r.Context()); ok {
+				utils.RespondError(w, r, msgStore, errors.New(language.AuthImpersonationNotAllowed))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
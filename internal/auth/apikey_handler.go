@@ -0,0 +1,241 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+	"go.uber.org/zap"
+
+	types "gobizmanager/internal/types"
+	appcontext "gobizmanager/pkg/context"
+	"gobizmanager/pkg/language"
+	"gobizmanager/pkg/logger"
+	"gobizmanager/pkg/utils"
+)
+
+const (
+	// APIKeyScheme is the Authorization scheme API keys are sent with
+	APIKeyScheme = "ApiKey"
+
+	apiKeyPrefix         = "gbm"
+	apiKeySecretSize     = 32
+	defaultAPIKeyTTLDays = 90
+)
+
+// CreatedAPIKey is returned once when a key is created; the plain key cannot
+// be retrieved again
+type CreatedAPIKey struct {
+	*APIKey
+	Key string `json:"key"`
+}
+
+// APIKeyHandler lets users manage API keys for their integrations
+type APIKeyHandler struct {
+	TokenRepo *Repository
+	Companies CompanyPermissionSource
+	Validator *validator.Validate
+	MsgStore  *language.MessageStore
+}
+
+func NewAPIKeyHandler(tokenRepo *Repository, companies CompanyPermissionSource, msgStore *language.MessageStore) *APIKeyHandler {
+	return &APIKeyHandler{
+		TokenRepo: tokenRepo,
+		Companies: companies,
+		Validator: validator.New(),
+		MsgStore:  msgStore,
+	}
+}
+
+// CreateAPIKey issues a key limited to a company and a subset of the caller's
+// module actions there
+func (h *APIKeyHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	var req types.CreateAPIKeyRequest
+	if err := utils.ParseRequest(r, &req); err != nil {
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+
+	if err := h.Validator.Struct(req); err != nil {
+		utils.ValidationError(w, r, err, h.MsgStore)
+		return
+	}
+
+	created, err := IssueAPIKey(h.TokenRepo, h.Companies, userID, req)
+	if err != nil {
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusCreated, created)
+}
+
+// ListAPIKeys returns the caller's active API keys
+func (h *APIKeyHandler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	keys, err := h.TokenRepo.ListActiveAPIKeys(userID)
+	if err != nil {
+		logger.Error("Failed to list API keys", zap.Error(err))
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.APIKeyListFailed))
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, keys)
+}
+
+// RevokeAPIKey revokes one of the caller's API keys
+func (h *APIKeyHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	keyID, err := strconv.ParseInt(chi.URLParam(r, "keyID"), 10, 64)
+	if err != nil {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.ValidationInvalidID))
+		return
+	}
+
+	if err := RevokeUserAPIKey(h.TokenRepo, userID, keyID); err != nil {
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+
+	msg, httpStatus := h.MsgStore.GetMessage(appcontext.GetLanguage(r.Context()), language.APIKeyRevoked)
+	utils.JSON(w, httpStatus, msg)
+}
+
+// IssueAPIKey creates a key for the user limited to a company and a subset of
+// the user's module actions there. The returned error carries a language
+// message key.
+func IssueAPIKey(tokenRepo *Repository, companies CompanyPermissionSource, userID int64, req types.CreateAPIKeyRequest) (*CreatedAPIKey, error) {
+	hasAccess, err := companies.HasCompanyAccess(userID, req.CompanyID)
+	if err != nil {
+		logger.Error("Failed to check company access", zap.Error(err))
+		return nil, errors.New(language.PermissionCheckFailed)
+	}
+	if !hasAccess {
+		return nil, errors.New(language.PermissionDenied)
+	}
+
+	held, err := companies.GetUserCompanyModuleActionIDs(userID, req.CompanyID)
+	if err != nil {
+		logger.Error("Failed to load company permissions", zap.Error(err))
+		return nil, errors.New(language.PermissionCheckFailed)
+	}
+	if !isSubset(req.ModuleActionIDs, held) {
+		return nil, errors.New(language.APIKeyScopeExceeded)
+	}
+
+	plain, prefix, err := generateAPIKey()
+	if err != nil {
+		logger.Error("Failed to generate API key", zap.Error(err))
+		return nil, errors.New(language.APIKeyCreateFailed)
+	}
+
+	days := req.ExpiresInDays
+	if days == 0 {
+		days = defaultAPIKeyTTLDays
+	}
+
+	key := &APIKey{
+		UserID:          userID,
+		CompanyID:       req.CompanyID,
+		Name:            req.Name,
+		Prefix:          prefix,
+		KeyHash:         HashToken(plain),
+		ModuleActionIDs: uniqueIDs(req.ModuleActionIDs),
+		ExpiresAt:       time.Now().AddDate(0, 0, days),
+	}
+	if err := tokenRepo.CreateAPIKey(key); err != nil {
+		logger.Error("Failed to create API key", zap.Error(err))
+		return nil, errors.New(language.APIKeyCreateFailed)
+	}
+
+	return &CreatedAPIKey{APIKey: key, Key: plain}, nil
+}
+
+// RevokeUserAPIKey revokes a key after checking it belongs to the user.
+// The returned error carries a language message key.
+func RevokeUserAPIKey(tokenRepo *Repository, userID, keyID int64) error {
+	key, err := tokenRepo.GetAPIKeyByID(keyID)
+	if err != nil || key.UserID != userID || key.RevokedAt.Valid {
+		return errors.New(language.APIKeyNotFound)
+	}
+
+	if err := tokenRepo.RevokeAPIKey(key.ID); err != nil {
+		logger.Error("Failed to revoke API key", zap.Error(err))
+		return errors.New(language.APIKeyRevokeFailed)
+	}
+	return nil
+}
+
+// requireSession returns the caller when authenticated with a login session.
+// API keys may not be used to manage API keys.
+func (h *APIKeyHandler) requireSession(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	userID, ok := GetUserID(r.Context())
+	if !ok {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthUnauthorized))
+		return 0, false
+	}
+	if _, ok := GetAPIKeyID(r.Context()); ok {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.APIKeySessionRequired))
+		return 0, false
+	}
+	return userID, true
+}
+
+// generateAPIKey returns a new key in the form gbm_<prefix>_<secret> and its prefix
+func generateAPIKey() (string, string, error) {
+	id, err := NewTokenID()
+	if err != nil {
+		return "", "", err
+	}
+	prefix := id[:8]
+
+	secret := make([]byte, apiKeySecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+
+	return apiKeyPrefix + "_" + prefix + "_" + base64.RawURLEncoding.EncodeToString(secret), prefix, nil
+}
+
+func isSubset(ids, of []int64) bool {
+	set := make(map[int64]bool, len(of))
+	for _, id := range of {
+		set[id] = true
+	}
+	for _, id := range ids {
+		if !set[id] {
+			return false
+		}
+	}
+	return true
+}
+
+func uniqueIDs(ids []int64) []int64 {
+	seen := make(map[int64]bool, len(ids))
+	unique := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
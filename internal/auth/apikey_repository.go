@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"fmt"
+	"time"
+
+	model "gobizmanager/internal/models"
+)
+
+// apiKeyTouchInterval limits how often last_used_at is written for an API key
+const apiKeyTouchInterval = time.Minute
+
+// CreateAPIKey stores the key together with its module actions
+func (r *Repository) CreateAPIKey(key *APIKey) error {
+	tx := r.db.Begin()
+	if tx.Error != nil {
+		return fmt.Errorf("failed to begin transaction: %w", tx.Error)
+	}
+	defer tx.Rollback()
+
+	if err := tx.Model(&model.User{}).Where("id = ?", key.UserID).Select("token_version").Scan(&key.TokenVersion).Error; err != nil {
+		return fmt.Errorf("failed to load token version: %w", err)
+	}
+
+	now := time.Now()
+	key.CreatedAt = now
+	key.UpdatedAt = now
+	if err := tx.Create(key).Error; err != nil {
+		return fmt.Errorf("failed to create API key: %w", err)
+	}
+
+	for _, moduleActionID := range key.ModuleActionIDs {
+		if err := tx.Create(&APIKeyModuleAction{APIKeyID: key.ID, ModuleActionID: moduleActionID}).Error; err != nil {
+			return fmt.Errorf("failed to grant API key module action: %w", err)
+		}
+	}
+
+	return tx.Commit().Error
+}
+
+// GetAPIKeyByHash returns the key with its module actions
+func (r *Repository) GetAPIKeyByHash(keyHash string) (*APIKey, error) {
+	var key APIKey
+	if err := r.db.Where("key_hash = ?", keyHash).First(&key).Error; err != nil {
+		return nil, err
+	}
+	if err := r.loadAPIKeyModuleActions(&key); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (r *Repository) GetAPIKeyByID(id int64) (*APIKey, error) {
+	var key APIKey
+	if err := r.db.First(&key, id).Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// ListActiveAPIKeys returns the user's keys that are neither revoked nor expired
+func (r *Repository) ListActiveAPIKeys(userID int64) ([]APIKey, error) {
+	var keys []APIKey
+	if err := r.db.
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("created_at DESC").
+		Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	for i := range keys {
+		if err := r.loadAPIKeyModuleActions(&keys[i]); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+func (r *Repository) RevokeAPIKey(id int64) error {
+	now := time.Now()
+	return r.db.Model(&APIKey{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Updates(map[string]interface{}{"revoked_at": now, "updated_at": now}).Error
+}
+
+// TouchAPIKey records use of a key, writing at most once per apiKeyTouchInterval
+func (r *Repository) TouchAPIKey(key *APIKey) error {
+	now := time.Now()
+	if key.LastUsedAt.Valid && now.Sub(key.LastUsedAt.Time) < apiKeyTouchInterval {
+		return nil
+	}
+	return r.db.Model(&APIKey{}).
+		Where("id = ?", key.ID).
+		Updates(map[string]interface{}{"last_used_at": now, "updated_at": now}).Error
+}
+
+func (r *Repository) loadAPIKeyModuleActions(key *APIKey) error {
+	return r.db.Model(&APIKeyModuleAction{}).
+		Where("api_key_id = ?", key.ID).
+		Order("module_action_id").
+		Pluck("module_action_id", &key.ModuleActionIDs).Error
+}
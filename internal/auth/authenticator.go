@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+
+	model "gobizmanager/internal/models"
+	user "gobizmanager/internal/user"
+	"gobizmanager/pkg/encryption"
+)
+
+var (
+	// ErrUnknownUser means the authenticator has no such user and the next one
+	// should be tried
+	ErrUnknownUser = errors.New("unknown user")
+	// ErrInvalidCredentials means the user exists but the password is wrong
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Authenticator checks a username and password against a credential store
+// and returns the local user they belong to. Login tries each configured
+// authenticator in turn until one accepts the credentials.
+type Authenticator interface {
+	Name() string
+	Authenticate(ctx context.Context, username, password string) (*model.User, error)
+}
+
+// PasswordAuthenticator checks passwords against the hashes in the users table
+type PasswordAuthenticator struct {
+	UserRepo *user.Repository
+}
+
+func NewPasswordAuthenticator(userRepo *user.Repository) *PasswordAuthenticator {
+	return &PasswordAuthenticator{UserRepo: userRepo}
+}
+
+func (a *PasswordAuthenticator) Name() string {
+	return "password"
+}
+
+func (a *PasswordAuthenticator) Authenticate(ctx context.Context, username, password string) (*model.User, error) {
+	u, err := a.UserRepo.GetUserByEmail(username)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUnknownUser
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Service accounts authenticate with API keys only
+	if u.IsServiceAccount || !encryption.CheckPassword(password, u.Password) {
+		return nil, ErrInvalidCredentials
+	}
+	return u, nil
+}
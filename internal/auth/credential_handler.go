@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	model "gobizmanager/internal/models"
+	types "gobizmanager/internal/types"
+	"gobizmanager/internal/user"
+	appcontext "gobizmanager/pkg/context"
+	"gobizmanager/pkg/encryption"
+	"gobizmanager/pkg/language"
+	"gobizmanager/pkg/logger"
+	"gobizmanager/pkg/utils"
+	"gobizmanager/platform/middleware"
+)
+
+const emailChangeTTL = 24 * time.Hour
+
+// ChangePassword replaces the caller's password after checking the current
+// one. Every other session is signed out and the caller gets new tokens.
+func (h *Handler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	u, ok := h.credentialOwner(w, r)
+	if !ok {
+		return
+	}
+
+	var req types.ChangePasswordRequest
+	if err := utils.ParseRequest(r, &req); err != nil {
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+
+	if err := h.Validator.Struct(req); err != nil {
+		utils.ValidationError(w, r, err, h.MsgStore)
+		return
+	}
+
+	if !h.checkCurrentPassword(w, r, u, req.CurrentPassword) {
+		return
+	}
+	if !h.checkPassword(w, r, u.ID, req.NewPassword) {
+		return
+	}
+
+	if err := h.UserRepo.UpdatePassword(u.ID, req.NewPassword); err != nil {
+		logger.Error("Failed to change password", zap.Error(err))
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthPasswordChangeFailed))
+		return
+	}
+
+	if err := h.TokenRepo.RevokeUserRefreshTokens(u.ID); err != nil {
+		logger.Error("Failed to revoke sessions after password change", zap.Error(err))
+	}
+
+	h.sendEmail(appcontext.GetLanguage(r.Context()), u.Email, language.EmailPasswordChangedSubject, language.EmailPasswordChangedBody, nil)
+
+	tokens, err := h.issueTokens(r, u.ID)
+	if err != nil {
+		logger.Error("Failed to generate tokens", zap.Error(err))
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthTokenGenFailed))
+		return
+	}
+
+	logger.Info("Password changed", zap.Int64("userID", u.ID))
+	utils.JSON(w, http.StatusOK, tokens)
+}
+
+// ChangeEmail starts moving the caller to a new email address. The address
+// only changes once the link sent to it is followed.
+func (h *Handler) ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	u, ok := h.credentialOwner(w, r)
+	if !ok {
+		return
+	}
+
+	var req types.ChangeEmailRequest
+	if err := utils.ParseRequest(r, &req); err != nil {
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+
+	if err := h.Validator.Struct(req); err != nil {
+		utils.ValidationError(w, r, err, h.MsgStore)
+		return
+	}
+
+	if !h.checkCurrentPassword(w, r, u, req.Password) {
+		return
+	}
+
+	if _, err := h.UserRepo.GetUserByEmail(req.Email); err == nil {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthUsernameExists))
+		return
+	}
+
+	token, err := h.JWTManager.GenerateEmailChangeToken(u.ID, req.Email, emailChangeTTL)
+	if err != nil {
+		logger.Error("Failed to generate email change token", zap.Error(err))
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthEmailChangeFailed))
+		return
+	}
+
+	lang := appcontext.GetLanguage(r.Context())
+	h.sendEmail(lang, req.Email, language.EmailChangeConfirmSubject, language.EmailChangeConfirmBody, map[string]interface{}{
+		"Link":  h.appLink("/confirm-email-change", token),
+		"Hours": int(emailChangeTTL.Hours()),
+	})
+
+	msg, httpStatus := h.MsgStore.GetMessage(lang, language.AuthEmailChangeRequested)
+	utils.JSON(w, httpStatus, msg)
+}
+
+// ConfirmEmailChange swaps in the new email address from the link sent to it
+// and notifies the old address
+func (h *Handler) ConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	var req types.ConfirmEmailChangeRequest
+	if err := utils.ParseRequest(r, &req); err != nil {
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+
+	if err := h.Validator.Struct(req); err != nil {
+		utils.ValidationError(w, r, err, h.MsgStore)
+		return
+	}
+
+	claims, err := h.verifyActionToken(req.Token, EmailChangeTokenType)
+	if err != nil || claims.Email == "" {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthInvalidActionToken))
+		return
+	}
+
+	u, err := h.UserRepo.GetUserByID(claims.UserID)
+	if err != nil {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthInvalidActionToken))
+		return
+	}
+
+	if _, err := h.consumeActionToken(req.Token, EmailChangeTokenType); err != nil {
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+
+	if err := h.UserRepo.ChangeEmail(u.ID, claims.Email); err != nil {
+		if errors.Is(err, user.ErrEmailTaken) {
+			utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthUsernameExists))
+			return
+		}
+		logger.Error("Failed to change email", zap.Error(err))
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthEmailChangeFailed))
+		return
+	}
+
+	lang := appcontext.GetLanguage(r.Context())
+	h.sendEmail(lang, u.Email, language.EmailEmailChangedSubject, language.EmailEmailChangedBody, map[string]interface{}{
+		"Email": claims.Email,
+	})
+
+	logger.Info("Email changed", zap.Int64("userID", u.ID))
+	msg, httpStatus := h.MsgStore.GetMessage(lang, language.AuthEmailChanged)
+	utils.JSON(w, httpStatus, msg)
+}
+
+// credentialOwner returns the caller when they may change their own
+// credentials. API keys and service accounts cannot.
+func (h *Handler) credentialOwner(w http.ResponseWriter, r *http.Request) (*model.User, bool) {
+	userID, ok := GetUserID(r.Context())
+	if !ok {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthUnauthorized))
+		return nil, false
+	}
+	if _, viaAPIKey := GetAPIKeyID(r.Context()); viaAPIKey {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthPermissionDenied))
+		return nil, false
+	}
+
+	u, err := h.UserRepo.GetUserByID(userID)
+	if err != nil {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthUserNotFound))
+		return nil, false
+	}
+	if u.IsServiceAccount {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthPermissionDenied))
+		return nil, false
+	}
+	return u, true
+}
+
+// checkCurrentPassword re-authenticates the caller before a credential
+// change. Wrong passwords count towards the login lockout of the account.
+func (h *Handler) checkCurrentPassword(w http.ResponseWriter, r *http.Request, u *model.User, password string) bool {
+	ip := middleware.GetReqIP(r)
+	if key, retryAfter := h.Guard.Check(ip, u.Email); key != "" {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		utils.RespondError(w, r, h.MsgStore, errors.New(key))
+		return false
+	}
+
+	if !encryption.CheckPassword(password, u.Password) {
+		h.loginFailed(r, ip, u.Email)
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthInvalidCredentials))
+		return false
+	}
+	return true
+}
@@ -2,35 +2,61 @@
 package auth
 
 import (
-	"database/sql"
+	"context"
 	"encoding/json"
 	"errors"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 	"go.uber.org/zap"
 
+	"gobizmanager/internal/audit"
+	model "gobizmanager/internal/models"
 	types "gobizmanager/internal/types"
 	user "gobizmanager/internal/user"
+	appcontext "gobizmanager/pkg/context"
 	"gobizmanager/pkg/encryption"
 	"gobizmanager/pkg/language"
 	"gobizmanager/pkg/logger"
+	"gobizmanager/pkg/mailer"
 	"gobizmanager/pkg/utils"
+	"gobizmanager/platform/config"
+	"gobizmanager/platform/middleware"
 )
 
 type Handler struct {
-	UserRepo   *user.Repository
-	JWTManager *JWTManager
-	Validator  *validator.Validate
-	MsgStore   *language.MessageStore
+	UserRepo       *user.Repository
+	TokenRepo      *Repository
+	Companies      CompanyPermissionSource
+	Authenticators []Authenticator
+	Guard          *LoginGuard
+	Audit          *audit.Repository
+	JWTManager     *JWTManager
+	Config         *config.Config
+	Mailer         mailer.Mailer
+	Validator      *validator.Validate
+	MsgStore       *language.MessageStore
+
+	// setup holds the one-time token creating the first ROOT user
+	setup setupState
 }
 
-func NewHandler(userRepo *user.Repository, jwtManager *JWTManager, msgStore *language.MessageStore) *Handler {
+func NewHandler(userRepo *user.Repository, tokenRepo *Repository, companies CompanyPermissionSource, authenticators []Authenticator, guard *LoginGuard, auditLog *audit.Repository, jwtManager *JWTManager, cfg *config.Config, mail mailer.Mailer, msgStore *language.MessageStore) *Handler {
 	return &Handler{
-		UserRepo:   userRepo,
-		JWTManager: jwtManager,
-		Validator:  validator.New(),
-		MsgStore:   msgStore,
+		UserRepo:       userRepo,
+		TokenRepo:      tokenRepo,
+		Companies:      companies,
+		Authenticators: authenticators,
+		Guard:          guard,
+		Audit:          auditLog,
+		JWTManager:     jwtManager,
+		Config:         cfg,
+		Mailer:         mail,
+		Validator:      validator.New(),
+		MsgStore:       msgStore,
 	}
 }
 
@@ -56,6 +82,10 @@ func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !h.checkPassword(w, r, 0, req.Password) {
+		return
+	}
+
 	// Register user
 	userID, err := h.UserRepo.RegisterUser(req.Username, req.Password, req.Phone)
 	if err != nil {
@@ -65,13 +95,15 @@ func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Generate tokens
-	tokens, err := h.JWTManager.GenerateTokenPair(userID)
+	tokens, err := h.issueTokens(r, userID)
 	if err != nil {
 		logger.Error("Failed to generate tokens", zap.Error(err))
 		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthTokenGenFailed))
 		return
 	}
 
+	h.sendVerificationEmail(appcontext.GetLanguage(r.Context()), userID, req.Username)
+
 	logger.Info("New user registered successfully", zap.Int64("userID", userID))
 	utils.JSON(w, http.StatusCreated, tokens)
 }
@@ -88,25 +120,80 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get user by username
-	u, err := h.UserRepo.GetUserByEmail(req.Username)
+	ip := middleware.GetReqIP(r)
+	if key, retryAfter := h.Guard.Check(ip, req.Username); key != "" {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		utils.RespondError(w, r, h.MsgStore, errors.New(key))
+		return
+	}
+
+	u, authenticator, err := h.authenticate(r.Context(), req.Username, req.Password)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if errors.Is(err, ErrInvalidCredentials) {
+			h.loginFailed(r, ip, req.Username)
 			utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthInvalidCredentials))
 		} else {
 			utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthDatabaseError))
 		}
 		return
 	}
+	h.Guard.Succeed(req.Username)
+
+	// Upgrade the stored hash while the plain password is at hand
+	if _, ok := authenticator.(*PasswordAuthenticator); ok && encryption.PasswordNeedsRehash(u.Password) {
+		if err := h.UserRepo.RehashPassword(u.ID, u.Password, req.Password); err != nil {
+			logger.Error("Failed to rehash password", zap.Int64("userID", u.ID), zap.Error(err))
+		}
+	}
 
-	// Check password
-	if !encryption.CheckPassword(req.Password, u.Password) {
-		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthInvalidCredentials))
+	expired, err := h.UserRepo.PasswordExpired(u)
+	if err != nil {
+		logger.Error("Failed to check password age", zap.Error(err))
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthDatabaseError))
+		return
+	}
+	if expired {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.PasswordExpired))
 		return
 	}
 
-	// Generate tokens
-	tokens, err := h.JWTManager.GenerateTokenPair(u.ID)
+	h.CompleteLogin(w, r, u.ID)
+}
+
+// authenticate tries each authenticator in turn and returns the user and the
+// authenticator that accepted the credentials. A wrong password for one store
+// does not stop the others, since a user may exist in several.
+func (h *Handler) authenticate(ctx context.Context, username, password string) (*model.User, Authenticator, error) {
+	for _, authenticator := range h.Authenticators {
+		u, err := authenticator.Authenticate(ctx, username, password)
+		if err == nil {
+			return u, authenticator, nil
+		}
+		if errors.Is(err, ErrUnknownUser) || errors.Is(err, ErrInvalidCredentials) {
+			continue
+		}
+		logger.Error("Authenticator failed", zap.String("authenticator", authenticator.Name()), zap.Error(err))
+		return nil, nil, err
+	}
+	return nil, nil, ErrInvalidCredentials
+}
+
+// CompleteLogin finishes a login for a user whose primary credential has been
+// checked, by password or by an external identity provider. It answers with an
+// MFA challenge when a second factor is required and with tokens otherwise.
+func (h *Handler) CompleteLogin(w http.ResponseWriter, r *http.Request, userID int64) {
+	challenge, err := h.mfaChallenge(userID)
+	if err != nil {
+		logger.Error("Failed to check MFA status", zap.Error(err))
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthDatabaseError))
+		return
+	}
+	if challenge != nil {
+		utils.JSON(w, http.StatusOK, challenge)
+		return
+	}
+
+	tokens, err := h.issueTokens(r, userID)
 	if err != nil {
 		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthTokenGenFailed))
 		return
@@ -128,23 +215,179 @@ func (h *Handler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 	}
 
 	claims, err := h.JWTManager.VerifyToken(req.RefreshToken)
-	if err != nil {
+	if err != nil || claims.TokenType != RefreshTokenType {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthInvalidRefreshToken))
+		return
+	}
+
+	stored, err := h.TokenRepo.GetRefreshTokenByHash(HashToken(req.RefreshToken))
+	if err != nil || stored.UserID != claims.UserID {
 		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthInvalidRefreshToken))
 		return
 	}
 
-	_, err = h.UserRepo.GetUserByID(claims.UserID)
+	// A revoked token being presented again means it was copied: kill the family
+	if stored.RevokedAt.Valid {
+		h.revokeReusedFamily(w, r, stored)
+		return
+	}
+
+	u, err := h.UserRepo.GetUserByID(claims.UserID)
 	if err != nil {
 		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthUserNotFound))
 		return
 	}
+	if claims.TokenVersion != u.TokenVersion {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthSessionRevoked))
+		return
+	}
+
+	session, err := h.TokenRepo.GetSessionByFamily(stored.FamilyID)
+	if err != nil || session.RevokedAt.Valid {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthSessionRevoked))
+		return
+	}
+
+	// Keep the active company, recomputing its permissions. Tokens fall back to
+	// unscoped when the user has left the company.
+	var scope TokenScope
+	if claims.CompanyID != 0 {
+		scope, _, err = h.companyScope(claims.UserID, claims.CompanyID)
+		if err != nil {
+			logger.Error("Failed to load company permissions", zap.Error(err))
+			utils.RespondError(w, r, h.MsgStore, errors.New(language.PermissionCheckFailed))
+			return
+		}
+	}
 
 	// Generate new token pair
-	tokens, err := h.JWTManager.GenerateTokenPair(claims.UserID)
+	tokens, err := h.JWTManager.GenerateScopedTokenPair(claims.UserID, session.ID, u.TokenVersion, scope)
 	if err != nil {
 		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthTokenGenFailed))
 		return
 	}
 
+	next := h.newRefreshToken(r, claims.UserID, stored.FamilyID, tokens.RefreshToken)
+	if err := h.TokenRepo.RotateRefreshToken(stored.ID, next); err != nil {
+		if errors.Is(err, ErrRefreshTokenReused) {
+			h.revokeReusedFamily(w, r, stored)
+			return
+		}
+		logger.Error("Failed to rotate refresh token", zap.Error(err))
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthTokenGenFailed))
+		return
+	}
+
 	utils.JSON(w, http.StatusOK, tokens)
 }
+
+// Logout revokes the refresh token family of the presented token
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	var req types.RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthInvalidRequest))
+		return
+	}
+
+	if err := h.Validator.Struct(req); err != nil {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthValidationFailed))
+		return
+	}
+
+	stored, err := h.TokenRepo.GetRefreshTokenByHash(HashToken(req.RefreshToken))
+	if err != nil {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthInvalidRefreshToken))
+		return
+	}
+
+	if err := h.TokenRepo.RevokeRefreshTokenFamily(stored.FamilyID); err != nil {
+		logger.Error("Failed to revoke refresh token family", zap.Error(err))
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthLogoutFailed))
+		return
+	}
+
+	msg, httpStatus := h.MsgStore.GetMessage(appcontext.GetLanguage(r.Context()), language.AuthLoggedOut)
+	utils.JSON(w, httpStatus, msg)
+}
+
+// LogoutAll revokes every refresh token of the authenticated user
+func (h *Handler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserID(r.Context())
+	if !ok {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthUnauthorized))
+		return
+	}
+
+	if err := h.TokenRepo.RevokeUserRefreshTokens(userID); err != nil {
+		logger.Error("Failed to revoke user refresh tokens", zap.Error(err))
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthLogoutFailed))
+		return
+	}
+
+	msg, httpStatus := h.MsgStore.GetMessage(appcontext.GetLanguage(r.Context()), language.AuthLoggedOut)
+	utils.JSON(w, httpStatus, msg)
+}
+
+// JWKS publishes the public keys tokens are signed with so that other
+// services can verify them
+func (h *Handler) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	utils.JSON(w, http.StatusOK, h.JWTManager.JWKS())
+}
+
+// issueTokens opens a session for a new login, generates its token pair and
+// records the refresh token
+func (h *Handler) issueTokens(r *http.Request, userID int64) (*TokenPair, error) {
+	familyID, err := NewTokenID()
+	if err != nil {
+		return nil, err
+	}
+
+	session := &Session{
+		UserID:    userID,
+		FamilyID:  familyID,
+		IPAddress: middleware.GetReqIP(r),
+		UserAgent: r.UserAgent(),
+		ExpiresAt: time.Now().Add(h.JWTManager.RefreshTokenTTL()),
+	}
+	if err := h.TokenRepo.CreateSession(session); err != nil {
+		return nil, err
+	}
+
+	tokenVersion, err := h.TokenRepo.GetTokenVersion(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := h.JWTManager.GenerateTokenPair(userID, session.ID, tokenVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.TokenRepo.CreateRefreshToken(h.newRefreshToken(r, userID, familyID, tokens.RefreshToken)); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+func (h *Handler) newRefreshToken(r *http.Request, userID int64, familyID, token string) *RefreshToken {
+	return &RefreshToken{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: HashToken(token),
+		Device:    r.UserAgent(),
+		ExpiresAt: time.Now().Add(h.JWTManager.RefreshTokenTTL()),
+	}
+}
+
+func (h *Handler) revokeReusedFamily(w http.ResponseWriter, r *http.Request, stored *RefreshToken) {
+	logger.Warn("Refresh token reuse detected",
+		zap.Int64("userID", stored.UserID),
+		zap.String("familyID", stored.FamilyID))
+
+	if err := h.TokenRepo.RevokeRefreshTokenFamily(stored.FamilyID); err != nil {
+		logger.Error("Failed to revoke refresh token family", zap.Error(err))
+	}
+	utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthRefreshTokenReused))
+}
@@ -1,8 +1,9 @@
 package auth
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
-	"fmt"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -14,7 +15,7 @@ var (
 )
 
 type JWTManager struct {
-	secretKey       string
+	keys            *KeyManager
 	accessTokenTTL  time.Duration
 	refreshTokenTTL time.Duration
 }
@@ -24,26 +25,87 @@ type TokenPair struct {
 	RefreshToken string `json:"refresh_token"`
 }
 
+// Token types carried in Claims.TokenType
+const (
+	AccessTokenType        = "access"
+	RefreshTokenType       = "refresh"
+	MFAChallengeTokenType  = "mfa_challenge"
+	MFAEnrollmentTokenType = "mfa_enrollment"
+
+	// Single-use tokens sent by email
+	PasswordResetTokenType     = "password_reset"
+	EmailVerificationTokenType = "email_verification"
+	AccountUnlockTokenType     = "account_unlock"
+	EmailChangeTokenType       = "email_change"
+	InvitationTokenType        = "invitation"
+)
+
 type Claims struct {
-	UserID int64 `json:"user_id"`
+	UserID    int64  `json:"user_id"`
+	SessionID int64  `json:"sid,omitempty"`
+	TokenType string `json:"token_type"`
+	// CompanyID is the active company of a company-scoped token and
+	// Permissions the digest of the module actions held there
+	CompanyID   int64  `json:"cid,omitempty"`
+	Permissions string `json:"perms,omitempty"`
+	// TokenVersion must match the user's current token version
+	TokenVersion int64 `json:"ver,omitempty"`
+	// Email is the new address confirmed by an email change token
+	Email string `json:"email,omitempty"`
+	// InvitationID is the company invitation an invitation token accepts
+	InvitationID int64 `json:"inv,omitempty"`
+	// Act names the ROOT user acting as UserID in an impersonation token
+	Act *Actor `json:"act,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func NewJWTManager(secretKey string, accessTTL, refreshTTL time.Duration) *JWTManager {
+// Actor is the "act" claim of RFC 8693, identifying the user by ID like the
+// rest of the claims
+type Actor struct {
+	UserID int64 `json:"user_id"`
+}
+
+// TokenScope restricts a token pair to an active company
+type TokenScope struct {
+	CompanyID   int64
+	Permissions string
+}
+
+func NewJWTManager(keys *KeyManager, accessTTL, refreshTTL time.Duration) *JWTManager {
 	return &JWTManager{
-		secretKey:       secretKey,
+		keys:            keys,
 		accessTokenTTL:  accessTTL,
 		refreshTokenTTL: refreshTTL,
 	}
 }
 
-func (m *JWTManager) GenerateTokenPair(userID int64) (*TokenPair, error) {
-	accessToken, err := m.generateToken(userID, m.accessTokenTTL)
+func (m *JWTManager) GenerateTokenPair(userID, sessionID, tokenVersion int64) (*TokenPair, error) {
+	return m.GenerateScopedTokenPair(userID, sessionID, tokenVersion, TokenScope{})
+}
+
+// GenerateScopedTokenPair issues a token pair for the active company in scope.
+// Only the access token carries the permission digest; it is recomputed
+// whenever the refresh token is used.
+func (m *JWTManager) GenerateScopedTokenPair(userID, sessionID, tokenVersion int64, scope TokenScope) (*TokenPair, error) {
+	accessToken, err := m.generateToken(Claims{
+		UserID:       userID,
+		SessionID:    sessionID,
+		TokenType:    AccessTokenType,
+		CompanyID:    scope.CompanyID,
+		Permissions:  scope.Permissions,
+		TokenVersion: tokenVersion,
+	}, m.accessTokenTTL)
 	if err != nil {
 		return nil, err
 	}
 
-	refreshToken, err := m.generateToken(userID, m.refreshTokenTTL)
+	refreshToken, err := m.generateToken(Claims{
+		UserID:       userID,
+		SessionID:    sessionID,
+		TokenType:    RefreshTokenType,
+		CompanyID:    scope.CompanyID,
+		TokenVersion: tokenVersion,
+	}, m.refreshTokenTTL)
 	if err != nil {
 		return nil, err
 	}
@@ -54,31 +116,82 @@ func (m *JWTManager) GenerateTokenPair(userID int64) (*TokenPair, error) {
 	}, nil
 }
 
-func (m *JWTManager) generateToken(userID int64, ttl time.Duration) (string, error) {
+// GenerateChallengeToken issues a short-lived token of the given type. These
+// tokens are never accepted as access tokens by Middleware.
+func (m *JWTManager) GenerateChallengeToken(userID int64, tokenType string, ttl time.Duration) (string, error) {
+	return m.generateToken(Claims{UserID: userID, TokenType: tokenType}, ttl)
+}
+
+// GenerateImpersonationToken issues an access token letting actorID act as
+// userID. It is bound to the actor's session and has no refresh token, so it
+// ends when the session does or the access token expires.
+func (m *JWTManager) GenerateImpersonationToken(actorID, sessionID, userID, tokenVersion int64, scope TokenScope) (string, error) {
+	return m.generateToken(Claims{
+		UserID:       userID,
+		SessionID:    sessionID,
+		TokenType:    AccessTokenType,
+		CompanyID:    scope.CompanyID,
+		Permissions:  scope.Permissions,
+		TokenVersion: tokenVersion,
+		Act:          &Actor{UserID: actorID},
+	}, m.accessTokenTTL)
+}
+
+// AccessTokenTTL returns how long issued access tokens stay valid
+func (m *JWTManager) AccessTokenTTL() time.Duration {
+	return m.accessTokenTTL
+}
+
+// GenerateEmailChangeToken issues a single-use token confirming that the user
+// controls the new email address
+func (m *JWTManager) GenerateEmailChangeToken(userID int64, email string, ttl time.Duration) (string, error) {
+	return m.generateToken(Claims{UserID: userID, TokenType: EmailChangeTokenType, Email: email}, ttl)
+}
+
+// GenerateInvitationToken issues the token of a company invitation link. The
+// token ID is chosen by the caller and stored with the invitation, so that
+// only the most recently sent link is accepted.
+func (m *JWTManager) GenerateInvitationToken(invitationID int64, tokenID string, expiresAt time.Time) (string, error) {
+	claims := Claims{TokenType: InvitationTokenType, InvitationID: invitationID}
+	claims.ID = tokenID
+	return m.generateToken(claims, time.Until(expiresAt))
+}
+
+// JWKS returns the public keys other services can verify tokens with
+func (m *JWTManager) JWKS() JWKS {
+	return m.keys.JWKS()
+}
+
+// RefreshTokenTTL returns how long issued refresh tokens stay valid
+func (m *JWTManager) RefreshTokenTTL() time.Duration {
+	return m.refreshTokenTTL
+}
+
+func (m *JWTManager) generateToken(claims Claims, ttl time.Duration) (string, error) {
+	tokenID := claims.ID
+	if tokenID == "" {
+		var err error
+		if tokenID, err = NewTokenID(); err != nil {
+			return "", err
+		}
+	}
+
 	now := time.Now()
-	claims := Claims{
-		UserID: userID,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
-			IssuedAt:  jwt.NewNumericDate(now),
-		},
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ID:        tokenID,
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		IssuedAt:  jwt.NewNumericDate(now),
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(m.secretKey))
+	return m.keys.sign(claims)
 }
 
 func (m *JWTManager) VerifyToken(tokenString string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(
 		tokenString,
 		&Claims{},
-		func(token *jwt.Token) (interface{}, error) {
-			_, ok := token.Method.(*jwt.SigningMethodHMAC)
-			if !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(m.secretKey), nil
-		},
+		m.keys.keyfunc,
+		jwt.WithValidMethods([]string{"HS256", "RS256", "EdDSA"}),
 	)
 
 	if err != nil {
@@ -95,3 +208,12 @@ func (m *JWTManager) VerifyToken(tokenString string) (*Claims, error) {
 
 	return claims, nil
 }
+
+// NewTokenID returns a random identifier suitable for token IDs and families
+func NewTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,390 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+
+	"gobizmanager/pkg/encryption"
+	"gobizmanager/pkg/logger"
+	"gobizmanager/platform/config"
+)
+
+const (
+	rsaKeyBits = 2048
+	// keyReloadInterval limits how often an unknown kid triggers a reload
+	keyReloadInterval = 10 * time.Second
+)
+
+// verificationKey is a decoded public key that tokens may be checked against
+type verificationKey struct {
+	kid       string
+	algorithm string
+	public    crypto.PublicKey
+}
+
+// KeyManager owns the keys used to sign and verify tokens. The newest key
+// signs; retired keys keep verifying until every token they signed has expired.
+type KeyManager struct {
+	repo          *Repository
+	encryptionKey string
+	algorithm     string
+	rotation      time.Duration
+	retention     time.Duration
+	legacySecret  []byte
+	// legacyUntil ends the verification of HS256 tokens once asymmetric
+	// keys are in use
+	legacyUntil time.Time
+
+	mu         sync.RWMutex
+	signingKID string
+	signer     crypto.Signer
+	keys       map[string]*verificationKey
+	ordered    []*verificationKey
+	loadedAt   time.Time
+}
+
+// NewKeyManager loads the stored keys, creating the first one if needed.
+// retention must cover the lifetime of the longest-lived token.
+func NewKeyManager(repo *Repository, cfg *config.Config, retention time.Duration) (*KeyManager, error) {
+	km := &KeyManager{
+		repo:          repo,
+		encryptionKey: cfg.EncryptionKey,
+		algorithm:     cfg.JWTAlgorithm,
+		rotation:      cfg.JWTKeyRotation,
+		retention:     retention,
+		legacySecret:  []byte(cfg.JWTSecret),
+	}
+
+	if km.algorithm == config.JWTAlgorithmHS256 {
+		return km, nil
+	}
+
+	if err := km.load(); err != nil {
+		return nil, err
+	}
+	if err := km.RotateIfDue(); err != nil {
+		return nil, err
+	}
+
+	// HS256 tokens issued before the first key pair expire within retention
+	if len(km.legacySecret) > 0 {
+		migratedAt, err := repo.FirstSigningKeyCreatedAt()
+		if err != nil {
+			return nil, err
+		}
+		km.legacyUntil = migratedAt.Add(retention)
+		if time.Now().Before(km.legacyUntil) {
+			logger.Warn("Accepting HS256 tokens signed with JWT_SECRET", zap.Time("until", km.legacyUntil))
+		}
+	}
+	return km, nil
+}
+
+// Rotate creates a new signing key and retires the current one
+func (km *KeyManager) Rotate() error {
+	if km.algorithm == config.JWTAlgorithmHS256 {
+		return nil
+	}
+
+	key, err := km.generateKey()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if err := km.repo.RotateSigningKey(key, now, now.Add(km.retention)); err != nil {
+		return err
+	}
+
+	logger.Info("Rotated token signing key", zap.String("kid", key.KID), zap.String("algorithm", key.Algorithm))
+	return km.load()
+}
+
+// RotateIfDue rotates when there is no active key, the active key uses a
+// different algorithm than configured or it is older than the rotation period
+func (km *KeyManager) RotateIfDue() error {
+	if km.algorithm == config.JWTAlgorithmHS256 {
+		return nil
+	}
+
+	current, err := km.repo.GetActiveSigningKey()
+	if err != nil && !errors.Is(err, errNoSigningKey) {
+		return err
+	}
+	if current != nil && current.Algorithm == km.algorithm && time.Since(current.CreatedAt) < km.rotation {
+		return nil
+	}
+	return km.Rotate()
+}
+
+// StartRotation checks periodically for a due rotation until ctx is done
+func (km *KeyManager) StartRotation(ctx context.Context, interval time.Duration) {
+	if km.algorithm == config.JWTAlgorithmHS256 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := km.RotateIfDue(); err != nil {
+					logger.Error("Failed to rotate signing key", zap.Error(err))
+				}
+				// Pick up keys rotated by other instances
+				if err := km.load(); err != nil {
+					logger.Error("Failed to reload signing keys", zap.Error(err))
+				}
+			}
+		}
+	}()
+}
+
+// sign signs the claims with the current key and sets its kid header
+func (km *KeyManager) sign(claims jwt.Claims) (string, error) {
+	if km.algorithm == config.JWTAlgorithmHS256 {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(km.legacySecret)
+	}
+
+	km.mu.RLock()
+	kid, signer := km.signingKID, km.signer
+	km.mu.RUnlock()
+
+	token := jwt.NewWithClaims(signingMethod(km.algorithm), claims)
+	token.Header["kid"] = kid
+	return token.SignedString(signer)
+}
+
+// keyfunc resolves the verification key of a token from its kid. Tokens
+// without a kid are HS256 tokens checked against JWT_SECRET. After switching
+// to asymmetric keys they are accepted for one retention period only, long
+// enough for the tokens issued before the switch to expire.
+func (km *KeyManager) keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok || len(km.legacySecret) == 0 {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		if km.algorithm != config.JWTAlgorithmHS256 && !time.Now().Before(km.legacyUntil) {
+			return nil, errors.New("HS256 tokens are no longer accepted")
+		}
+		return km.legacySecret, nil
+	}
+
+	key, err := km.lookup(kid)
+	if err != nil {
+		return nil, err
+	}
+	if token.Method.Alg() != key.algorithm {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.public, nil
+}
+
+// lookup returns the key with the given kid, reloading once if it is unknown
+func (km *KeyManager) lookup(kid string) (*verificationKey, error) {
+	km.mu.RLock()
+	key, ok := km.keys[kid]
+	stale := time.Since(km.loadedAt) > keyReloadInterval
+	km.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+
+	if stale {
+		if err := km.load(); err != nil {
+			return nil, err
+		}
+		km.mu.RLock()
+		key, ok = km.keys[kid]
+		km.mu.RUnlock()
+		if ok {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// load replaces the in-memory keys with the stored ones that still verify
+func (km *KeyManager) load() error {
+	stored, err := km.repo.ListVerificationKeys()
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]*verificationKey, len(stored))
+	ordered := make([]*verificationKey, 0, len(stored))
+	var signingKID string
+	var signer crypto.Signer
+	for _, sk := range stored {
+		public, err := parsePublicKey(sk.PublicKey)
+		if err != nil {
+			return fmt.Errorf("failed to parse signing key %s: %w", sk.KID, err)
+		}
+		key := &verificationKey{kid: sk.KID, algorithm: sk.Algorithm, public: public}
+		keys[sk.KID] = key
+		ordered = append(ordered, key)
+
+		if !sk.RetiredAt.Valid && signer == nil {
+			signer, err = km.decryptPrivateKey(sk.PrivateKey)
+			if err != nil {
+				return fmt.Errorf("failed to decrypt signing key %s: %w", sk.KID, err)
+			}
+			signingKID = sk.KID
+		}
+	}
+
+	km.mu.Lock()
+	km.keys = keys
+	km.ordered = ordered
+	km.loadedAt = time.Now()
+	if signer != nil {
+		km.signingKID = signingKID
+		km.signer = signer
+	}
+	km.mu.Unlock()
+	return nil
+}
+
+func (km *KeyManager) generateKey() (*SigningKey, error) {
+	var private crypto.Signer
+	switch km.algorithm {
+	case config.JWTAlgorithmRS256:
+		key, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+		if err != nil {
+			return nil, err
+		}
+		private = key
+	case config.JWTAlgorithmEdDSA:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		private = key
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", km.algorithm)
+	}
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(private.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, err := encryption.Encrypt(string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER})), km.encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	kid, err := NewTokenID()
+	if err != nil {
+		return nil, err
+	}
+
+	return &SigningKey{
+		KID:        kid,
+		Algorithm:  km.algorithm,
+		PrivateKey: encrypted,
+		PublicKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})),
+	}, nil
+}
+
+func (km *KeyManager) decryptPrivateKey(encrypted string) (crypto.Signer, error) {
+	decrypted, err := encryption.Decrypt(encrypted, km.encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode([]byte(decrypted))
+	if block == nil {
+		return nil, errors.New("invalid private key PEM")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("private key cannot sign")
+	}
+	return signer, nil
+}
+
+func parsePublicKey(encoded string) (crypto.PublicKey, error) {
+	block, _ := pem.Decode([]byte(encoded))
+	if block == nil {
+		return nil, errors.New("invalid public key PEM")
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+func signingMethod(algorithm string) jwt.SigningMethod {
+	if algorithm == config.JWTAlgorithmRS256 {
+		return jwt.SigningMethodRS256
+	}
+	return jwt.SigningMethodEdDSA
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys tokens may currently be verified with, newest first
+func (km *KeyManager) JWKS() JWKS {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+
+	set := JWKS{Keys: []JWK{}}
+	for _, key := range km.ordered {
+		jwk := JWK{Kid: key.kid, Use: "sig", Alg: key.algorithm}
+		switch public := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
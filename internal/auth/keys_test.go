@@ -0,0 +1,77 @@
+package auth_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+
+	"gobizmanager/internal/auth"
+	"gobizmanager/internal/testutil"
+	"gobizmanager/platform/config"
+)
+
+const (
+	legacySecret = "a-legacy-hs256-secret-of-32-bytes"
+	retention    = time.Hour
+)
+
+func newJWTManager(t *testing.T, db *gorm.DB) *auth.JWTManager {
+	t.Helper()
+	cfg := testutil.Config()
+	cfg.JWTSecret = legacySecret
+	cfg.JWTAlgorithm = config.JWTAlgorithmEdDSA
+	cfg.JWTKeyRotation = config.DefaultJWTKeyRotation
+
+	keys, err := auth.NewKeyManager(auth.NewRepository(db), cfg, retention)
+	if err != nil {
+		t.Fatalf("new key manager: %v", err)
+	}
+	return auth.NewJWTManager(keys, time.Minute, retention)
+}
+
+// legacyToken signs an access token the way tokens were signed before
+// switching to asymmetric keys: HS256 with JWT_SECRET and no kid
+func legacyToken(t *testing.T) string {
+	t.Helper()
+	now := time.Now()
+	claims := auth.Claims{UserID: 1, TokenType: auth.AccessTokenType}
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(now.Add(10 * 365 * 24 * time.Hour)),
+		IssuedAt:  jwt.NewNumericDate(now),
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(legacySecret))
+	if err != nil {
+		t.Fatalf("sign legacy token: %v", err)
+	}
+	return token
+}
+
+func TestVerifyLegacyToken(t *testing.T) {
+	db := testutil.NewDB(t)
+
+	if _, err := newJWTManager(t, db).VerifyToken(legacyToken(t)); err != nil {
+		t.Fatalf("legacy token right after the switch: %v", err)
+	}
+
+	// Move the switch to asymmetric keys back past the retention period
+	if err := db.Exec("UPDATE signing_keys SET created_at = ?", time.Now().Add(-2*retention)).Error; err != nil {
+		t.Fatalf("backdate signing keys: %v", err)
+	}
+
+	jwtManager := newJWTManager(t, db)
+	if _, err := jwtManager.VerifyToken(legacyToken(t)); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Fatalf("legacy token after the cutoff: got %v, want %v", err, auth.ErrInvalidToken)
+	}
+
+	// Tokens signed with the current key still verify
+	pair, err := jwtManager.GenerateTokenPair(1, 1, 0)
+	if err != nil {
+		t.Fatalf("generate token pair: %v", err)
+	}
+	if _, err := jwtManager.VerifyToken(pair.AccessToken); err != nil {
+		t.Fatalf("current token after the cutoff: %v", err)
+	}
+}
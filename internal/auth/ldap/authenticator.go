@@ -0,0 +1,169 @@
+// Package ldap authenticates users against an LDAP or Active Directory server
+// and maps their directory groups to company roles.
+package ldap
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	ldapv3 "github.com/go-ldap/ldap/v3"
+
+	"gobizmanager/internal/auth"
+	model "gobizmanager/internal/models"
+	"gobizmanager/platform/config"
+)
+
+// timeout bounds connecting to and each request against the directory
+const timeout = 10 * time.Second
+
+// Authenticator checks credentials by binding to the directory as the user.
+// On success the local user is created or updated and its mapped roles are
+// brought in line with its current groups.
+type Authenticator struct {
+	cfg  config.LDAPConfig
+	repo *Repository
+}
+
+func NewAuthenticator(cfg config.LDAPConfig, repo *Repository) *Authenticator {
+	return &Authenticator{cfg: cfg, repo: repo}
+}
+
+func (a *Authenticator) Name() string {
+	return "ldap"
+}
+
+func (a *Authenticator) Authenticate(ctx context.Context, username, password string) (*model.User, error) {
+	// An empty password would be an unauthenticated bind, which most servers accept
+	if username == "" || password == "" {
+		return nil, auth.ErrInvalidCredentials
+	}
+
+	conn, err := a.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	entry, err := a.findUser(conn, username)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldapv3.IsErrorWithCode(err, ldapv3.LDAPResultInvalidCredentials) {
+			return nil, auth.ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("user bind failed: %w", err)
+	}
+
+	email := entry.GetAttributeValue(a.cfg.EmailAttribute)
+	if email == "" {
+		return nil, fmt.Errorf("directory entry %q has no %s attribute", entry.DN, a.cfg.EmailAttribute)
+	}
+
+	return a.repo.SyncUser(email, a.companyRoles(entry.GetAttributeValues(a.cfg.GroupAttribute)))
+}
+
+// connect dials the server and binds as the search account
+func (a *Authenticator) connect(ctx context.Context) (*ldapv3.Conn, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+	if deadline, ok := ctx.Deadline(); ok {
+		dialer.Deadline = deadline
+	}
+
+	conn, err := ldapv3.DialURL(a.cfg.URL, ldapv3.DialWithDialer(dialer))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to directory: %w", err)
+	}
+	conn.SetTimeout(timeout)
+
+	if a.cfg.StartTLS {
+		host := a.cfg.URL
+		if u, err := url.Parse(a.cfg.URL); err == nil {
+			host = u.Hostname()
+		}
+		if err := conn.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+
+	if a.cfg.BindDN != "" {
+		if err := conn.Bind(a.cfg.BindDN, a.cfg.BindPassword); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("service bind failed: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// findUser looks up the single entry matching the login name.
+// auth.ErrUnknownUser is returned when there is none.
+func (a *Authenticator) findUser(conn *ldapv3.Conn, username string) (*ldapv3.Entry, error) {
+	filter := strings.ReplaceAll(a.cfg.UserFilter, "{username}", ldapv3.EscapeFilter(username))
+	req := ldapv3.NewSearchRequest(
+		a.cfg.BaseDN,
+		ldapv3.ScopeWholeSubtree,
+		ldapv3.NeverDerefAliases,
+		2,
+		int(timeout.Seconds()),
+		false,
+		filter,
+		[]string{a.cfg.EmailAttribute, a.cfg.GroupAttribute},
+		nil,
+	)
+
+	res, err := conn.Search(req)
+	if err != nil && !ldapv3.IsErrorWithCode(err, ldapv3.LDAPResultSizeLimitExceeded) {
+		return nil, fmt.Errorf("user search failed: %w", err)
+	}
+	if res == nil || len(res.Entries) == 0 {
+		return nil, auth.ErrUnknownUser
+	}
+	if len(res.Entries) > 1 {
+		return nil, errors.New("user search matched more than one entry")
+	}
+	return res.Entries[0], nil
+}
+
+// companyRoles resolves the configured group mappings against the user's
+// groups. Every company with a mapping is returned so roles the user lost can
+// be removed.
+func (a *Authenticator) companyRoles(groups []string) map[int64]*CompanyRoles {
+	companies := make(map[int64]*CompanyRoles)
+	for _, mapping := range a.cfg.GroupRoles {
+		roles, ok := companies[mapping.CompanyID]
+		if !ok {
+			roles = &CompanyRoles{}
+			companies[mapping.CompanyID] = roles
+		}
+		roles.Managed = appendUnique(roles.Managed, mapping.Role)
+		if hasGroup(groups, mapping.Group) {
+			roles.Granted = appendUnique(roles.Granted, mapping.Role)
+		}
+	}
+	return companies
+}
+
+// hasGroup compares DNs case-insensitively as directories do
+func hasGroup(groups []string, group string) bool {
+	for _, g := range groups {
+		if strings.EqualFold(strings.TrimSpace(g), strings.TrimSpace(group)) {
+			return true
+		}
+	}
+	return false
+}
+
+func appendUnique(values []string, value string) []string {
+	if contains(values, value) {
+		return values
+	}
+	return append(values, value)
+}
@@ -0,0 +1,378 @@
+package ldap
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	ldapv3 "github.com/go-ldap/ldap/v3"
+	"gorm.io/gorm"
+
+	"gobizmanager/internal/auth"
+	model "gobizmanager/internal/models"
+	"gobizmanager/internal/rbac"
+	"gobizmanager/internal/testutil"
+	"gobizmanager/platform/config"
+)
+
+const (
+	baseDN         = "dc=example,dc=com"
+	searchDN       = "cn=search," + baseDN
+	searchPassword = "search-secret"
+	adminsGroup    = "cn=admins,ou=groups," + baseDN
+	staffGroup     = "cn=staff,ou=groups," + baseDN
+)
+
+// directoryEntry is a user of the stand-in directory
+type directoryEntry struct {
+	password string
+	attrs    map[string][]string
+}
+
+// testDirectory is an in-process stand-in for an LDAP server. It answers
+// simple binds, equality searches and unbinds, which is all the
+// authenticator sends.
+type testDirectory struct {
+	listener net.Listener
+
+	mu      sync.Mutex
+	entries map[string]*directoryEntry
+}
+
+func newTestDirectory(t *testing.T) *testDirectory {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	d := &testDirectory{listener: listener, entries: make(map[string]*directoryEntry)}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go d.serve(conn)
+		}
+	}()
+	return d
+}
+
+func (d *testDirectory) url() string {
+	return "ldap://" + d.listener.Addr().String()
+}
+
+// add stores a user entry under uid=<uid>
+func (d *testDirectory) add(uid, password, mail string, groups ...string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.entries["uid="+uid+",ou=people,"+baseDN] = &directoryEntry{
+		password: password,
+		attrs: map[string][]string{
+			"uid":      {uid},
+			"mail":     {mail},
+			"memberOf": groups,
+		},
+	}
+}
+
+// setGroups replaces the groups of a user
+func (d *testDirectory) setGroups(uid string, groups ...string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.entries["uid="+uid+",ou=people,"+baseDN].attrs["memberOf"] = groups
+}
+
+func (d *testDirectory) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		messageID, _ := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case ldapv3.ApplicationBindRequest:
+			dn := op.Children[1].Data.String()
+			password := op.Children[2].Data.String()
+			conn.Write(ldapResult(messageID, ldapv3.ApplicationBindResponse, d.bind(dn, password)).Bytes())
+		case ldapv3.ApplicationSearchRequest:
+			filter, err := ldapv3.DecompileFilter(op.Children[6])
+			if err != nil {
+				conn.Write(ldapResult(messageID, ldapv3.ApplicationSearchResultDone, ldapv3.LDAPResultProtocolError).Bytes())
+				continue
+			}
+			for _, entry := range d.search(filter) {
+				conn.Write(entry(messageID).Bytes())
+			}
+			conn.Write(ldapResult(messageID, ldapv3.ApplicationSearchResultDone, ldapv3.LDAPResultSuccess).Bytes())
+		case ldapv3.ApplicationUnbindRequest:
+			return
+		default:
+			return
+		}
+	}
+}
+
+func (d *testDirectory) bind(dn, password string) int64 {
+	if dn == searchDN && password == searchPassword {
+		return ldapv3.LDAPResultSuccess
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if entry, ok := d.entries[dn]; ok && entry.password == password {
+		return ldapv3.LDAPResultSuccess
+	}
+	return ldapv3.LDAPResultInvalidCredentials
+}
+
+// search returns the entries matching a filter of the form (attr=value)
+func (d *testDirectory) search(filter string) []func(int64) *ber.Packet {
+	attr, value, _ := strings.Cut(strings.TrimSuffix(strings.TrimPrefix(filter, "("), ")"), "=")
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var results []func(int64) *ber.Packet
+	for dn, entry := range d.entries {
+		for _, v := range entry.attrs[attr] {
+			if strings.EqualFold(v, value) {
+				results = append(results, searchEntry(dn, entry.attrs))
+				break
+			}
+		}
+	}
+	return results
+}
+
+func ldapResult(messageID int64, tag ber.Tag, code int64) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Response")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "Result Code"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Diagnostic Message"))
+	return ldapMessage(messageID, op)
+}
+
+func searchEntry(dn string, attrs map[string][]string) func(int64) *ber.Packet {
+	return func(messageID int64) *ber.Packet {
+		op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldapv3.ApplicationSearchResultEntry, nil, "Search Result Entry")
+		op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, dn, "Object Name"))
+		list := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+		for name, values := range attrs {
+			attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+			attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+			set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+			for _, value := range values {
+				set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+			}
+			attr.AppendChild(set)
+			list.AppendChild(attr)
+		}
+		op.AppendChild(list)
+		return ldapMessage(messageID, op)
+	}
+}
+
+func ldapMessage(messageID int64, op *ber.Packet) *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Message")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "Message ID"))
+	packet.AppendChild(op)
+	return packet
+}
+
+type testEnv struct {
+	db            *gorm.DB
+	directory     *testDirectory
+	authorizer    *rbac.Authorizer
+	authenticator *Authenticator
+	companyID     int64
+	adminRoleID   int64
+	staffRoleID   int64
+}
+
+// newTestEnv maps the admins and staff groups to roles of a company. Only the
+// admin role may update the company.
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	db := testutil.NewDB(t)
+	companyID := testutil.CreateCompany(t, db, "Acme")
+	adminRoleID := testutil.CreateRole(t, db, companyID, "DIRECTORY_ADMIN")
+	staffRoleID := testutil.CreateRole(t, db, companyID, "DIRECTORY_STAFF")
+	testutil.Grant(t, db, companyID, adminRoleID, companyUpdateAction)
+
+	directory := newTestDirectory(t)
+	authorizer := rbac.NewAuthorizer(rbac.NewRepository(db), time.Minute, 100)
+	authenticator := NewAuthenticator(config.LDAPConfig{
+		URL:            directory.url(),
+		BindDN:         searchDN,
+		BindPassword:   searchPassword,
+		BaseDN:         baseDN,
+		UserFilter:     "(uid={username})",
+		EmailAttribute: "mail",
+		GroupAttribute: "memberOf",
+		GroupRoles: []config.LDAPGroupRole{
+			{Group: adminsGroup, CompanyID: companyID, Role: "DIRECTORY_ADMIN"},
+			{Group: staffGroup, CompanyID: companyID, Role: "DIRECTORY_STAFF"},
+		},
+	}, NewRepository(db, testutil.Config(), authorizer))
+
+	return &testEnv{
+		db:            db,
+		directory:     directory,
+		authorizer:    authorizer,
+		authenticator: authenticator,
+		companyID:     companyID,
+		adminRoleID:   adminRoleID,
+		staffRoleID:   staffRoleID,
+	}
+}
+
+// companyUpdateAction is the seeded company:update module action
+const companyUpdateAction = 3
+
+func (env *testEnv) roleIDs(t *testing.T, userID int64) []int64 {
+	t.Helper()
+	var ids []int64
+	if err := env.db.Model(&model.UserRole{}).Where("user_id = ?", userID).Order("role_id").Pluck("role_id", &ids).Error; err != nil {
+		t.Fatalf("list roles: %v", err)
+	}
+	return ids
+}
+
+func (env *testEnv) canUpdateCompany(t *testing.T, userID int64) bool {
+	t.Helper()
+	decision, err := env.authorizer.Authorize(context.Background(), userID, env.companyID, rbac.ModuleCompany, rbac.ActionUpdate)
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	return decision.Allowed
+}
+
+func TestAuthenticateBindsAndCreatesUser(t *testing.T) {
+	env := newTestEnv(t)
+	env.directory.add("alice", "alice-secret", "alice@example.com", adminsGroup)
+
+	u, err := env.authenticator.Authenticate(context.Background(), "alice", "alice-secret")
+	if err != nil {
+		t.Fatalf("authenticate: %v", err)
+	}
+	if u.ID == 0 {
+		t.Fatal("no local user returned")
+	}
+
+	var stored model.User
+	if err := env.db.First(&stored, u.ID).Error; err != nil {
+		t.Fatalf("load user: %v", err)
+	}
+	if err := stored.DecryptSensitiveFields(testutil.Config().EncryptionKey); err != nil {
+		t.Fatalf("decrypt user: %v", err)
+	}
+	if stored.Email != "alice@example.com" || !stored.EmailVerifiedAt.Valid {
+		t.Errorf("stored user %q, verified %v", stored.Email, stored.EmailVerifiedAt.Valid)
+	}
+
+	// A second login finds the same user
+	again, err := env.authenticator.Authenticate(context.Background(), "alice", "alice-secret")
+	if err != nil || again.ID != u.ID {
+		t.Errorf("second login: user %v, err %v", again, err)
+	}
+}
+
+func TestAuthenticateRejectsInvalidCredentials(t *testing.T) {
+	env := newTestEnv(t)
+	env.directory.add("alice", "alice-secret", "alice@example.com", adminsGroup)
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		want     error
+	}{
+		{"wrong password", "alice", "wrong", auth.ErrInvalidCredentials},
+		{"empty password", "alice", "", auth.ErrInvalidCredentials},
+		{"unknown user", "bob", "bob-secret", auth.ErrUnknownUser},
+		{"filter injection", "*", "alice-secret", auth.ErrUnknownUser},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := env.authenticator.Authenticate(context.Background(), tt.username, tt.password)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+			if u != nil {
+				t.Errorf("user %d returned", u.ID)
+			}
+		})
+	}
+
+	var users int64
+	if err := env.db.Model(&model.User{}).Count(&users).Error; err != nil {
+		t.Fatalf("count users: %v", err)
+	}
+	if users != 0 {
+		t.Errorf("%d users created by failed logins", users)
+	}
+}
+
+func TestAuthenticateSyncsGroupRoles(t *testing.T) {
+	env := newTestEnv(t)
+	env.directory.add("alice", "alice-secret", "alice@example.com", adminsGroup, staffGroup)
+
+	u, err := env.authenticator.Authenticate(context.Background(), "alice", "alice-secret")
+	if err != nil {
+		t.Fatalf("authenticate: %v", err)
+	}
+	if got := env.roleIDs(t, u.ID); len(got) != 2 || got[0] != env.adminRoleID || got[1] != env.staffRoleID {
+		t.Fatalf("roles %v, want [%d %d]", got, env.adminRoleID, env.staffRoleID)
+	}
+	if !env.canUpdateCompany(t, u.ID) {
+		t.Fatal("mapped admin role does not grant company:update")
+	}
+
+	// Leaving a group removes its role and the permissions it granted, even
+	// though they were cached
+	env.directory.setGroups("alice", staffGroup)
+	if _, err := env.authenticator.Authenticate(context.Background(), "alice", "alice-secret"); err != nil {
+		t.Fatalf("authenticate: %v", err)
+	}
+	if got := env.roleIDs(t, u.ID); len(got) != 1 || got[0] != env.staffRoleID {
+		t.Fatalf("roles %v, want [%d]", got, env.staffRoleID)
+	}
+	if env.canUpdateCompany(t, u.ID) {
+		t.Error("company:update still granted after leaving the admins group")
+	}
+}
+
+func TestAuthenticateLeavesUnmappedRoles(t *testing.T) {
+	env := newTestEnv(t)
+	env.directory.add("alice", "alice-secret", "alice@example.com", staffGroup)
+
+	u, err := env.authenticator.Authenticate(context.Background(), "alice", "alice-secret")
+	if err != nil {
+		t.Fatalf("authenticate: %v", err)
+	}
+	otherRoleID := testutil.CreateRole(t, env.db, env.companyID, "MANUAL")
+	var companyUser rbac.CompanyUser
+	if err := env.db.Where("company_id = ? AND user_id = ?", env.companyID, u.ID).First(&companyUser).Error; err != nil {
+		t.Fatalf("load membership: %v", err)
+	}
+	if err := env.db.Create(&model.UserRole{UserID: u.ID, CompanyUserID: companyUser.ID, RoleID: otherRoleID}).Error; err != nil {
+		t.Fatalf("assign role: %v", err)
+	}
+
+	env.directory.setGroups("alice")
+	if _, err := env.authenticator.Authenticate(context.Background(), "alice", "alice-secret"); err != nil {
+		t.Fatalf("authenticate: %v", err)
+	}
+	if got := env.roleIDs(t, u.ID); len(got) != 1 || got[0] != otherRoleID {
+		t.Errorf("roles %v, want only the manually assigned %d", got, otherRoleID)
+	}
+}
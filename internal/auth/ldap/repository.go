@@ -0,0 +1,199 @@
+package ldap
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"gobizmanager/internal/auth"
+	model "gobizmanager/internal/models"
+	"gobizmanager/internal/rbac"
+	userpkg "gobizmanager/internal/user"
+	"gobizmanager/pkg/encryption"
+	"gobizmanager/platform/config"
+
+	"gorm.io/gorm"
+)
+
+// CompanyRoles lists the roles of one company that group mappings control and
+// those the user's groups grant. Roles outside Managed are left alone.
+type CompanyRoles struct {
+	Managed []string
+	Granted []string
+}
+
+type Repository struct {
+	db         *gorm.DB
+	cfg        *config.Config
+	authorizer *rbac.Authorizer
+}
+
+func NewRepository(db *gorm.DB, cfg *config.Config, authorizer *rbac.Authorizer) *Repository {
+	return &Repository{db: db, cfg: cfg, authorizer: authorizer}
+}
+
+// SyncUser returns the local user for a directory login, creating it on first
+// login, and updates its mapped roles in a single transaction. The address is
+// marked verified since the directory vouches for it. The cached permissions
+// of the user are dropped in every company whose roles changed.
+func (r *Repository) SyncUser(email string, companies map[int64]*CompanyRoles) (*model.User, error) {
+	tx := r.db.Begin()
+	if tx.Error != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", tx.Error)
+	}
+	defer tx.Rollback()
+
+	user, err := r.findOrCreateUser(tx, email)
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []int64
+	for companyID, roles := range companies {
+		companyChanged, err := r.syncCompanyRoles(tx, user.ID, companyID, roles)
+		if err != nil {
+			return nil, err
+		}
+		if companyChanged {
+			if err := rbac.BumpVersion(tx, companyID); err != nil {
+				return nil, err
+			}
+			changed = append(changed, companyID)
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	for _, companyID := range changed {
+		r.authorizer.InvalidateUser(user.ID, companyID)
+	}
+	return user, nil
+}
+
+func (r *Repository) findOrCreateUser(tx *gorm.DB, email string) (*model.User, error) {
+	emailHash := userpkg.HashEmail(email)
+
+	var user model.User
+	err := tx.Where("email_hash = ?", emailHash).First(&user).Error
+	if err == nil {
+		// Directory entries never stand in for service accounts
+		if user.IsServiceAccount {
+			return nil, auth.ErrInvalidCredentials
+		}
+		return &user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	// The local password is random; the directory checks the real one
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	hashedPassword, err := encryption.HashPassword(hex.EncodeToString(secret))
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	now := time.Now()
+	user = model.User{
+		Email:    email,
+		Password: hashedPassword,
+	}
+	if err := user.EncryptSensitiveFields(r.cfg.EncryptionKey); err != nil {
+		return nil, err
+	}
+	user.EmailHash = emailHash
+	user.EmailVerifiedAt.Time = now
+	user.EmailVerifiedAt.Valid = true
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	if err := tx.Create(&user).Error; err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+	return &user, nil
+}
+
+// syncCompanyRoles grants the mapped roles the user's groups give it in the
+// company and removes the mapped roles they no longer do, and reports whether
+// any role was granted or removed. Membership is only created when a role is
+// granted.
+func (r *Repository) syncCompanyRoles(tx *gorm.DB, userID, companyID int64, roles *CompanyRoles) (bool, error) {
+	var managed []model.Role
+	if err := tx.Where("company_id = ? AND name IN ?", companyID, roles.Managed).Find(&managed).Error; err != nil {
+		return false, fmt.Errorf("failed to load mapped roles: %w", err)
+	}
+
+	granted := make(map[int64]bool)
+	var revoked []int64
+	for _, role := range managed {
+		if contains(roles.Granted, role.Name) {
+			granted[role.ID] = true
+		} else {
+			revoked = append(revoked, role.ID)
+		}
+	}
+
+	changed := false
+	if len(revoked) > 0 {
+		res := tx.Where("user_id = ? AND role_id IN ?", userID, revoked).Delete(&model.UserRole{})
+		if res.Error != nil {
+			return false, fmt.Errorf("failed to remove mapped roles: %w", res.Error)
+		}
+		changed = res.RowsAffected > 0
+	}
+	if len(granted) == 0 {
+		return changed, nil
+	}
+
+	now := time.Now()
+	var companyUser rbac.CompanyUser
+	err := tx.Where("company_id = ? AND user_id = ?", companyID, userID).First(&companyUser).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		companyUser = rbac.CompanyUser{
+			CompanyID: companyID,
+			UserID:    userID,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		err = tx.Create(&companyUser).Error
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to add user to company: %w", err)
+	}
+
+	var existing []int64
+	if err := tx.Model(&model.UserRole{}).Where("user_id = ?", userID).Pluck("role_id", &existing).Error; err != nil {
+		return false, err
+	}
+	for _, roleID := range existing {
+		delete(granted, roleID)
+	}
+
+	for roleID := range granted {
+		if err := tx.Create(&model.UserRole{
+			UserID:        userID,
+			CompanyUserID: companyUser.ID,
+			RoleID:        roleID,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}).Error; err != nil {
+			return false, fmt.Errorf("failed to assign mapped role: %w", err)
+		}
+		changed = true
+	}
+	return changed, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
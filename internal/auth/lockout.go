@@ -0,0 +1,314 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"gobizmanager/internal/audit"
+	types "gobizmanager/internal/types"
+	appcontext "gobizmanager/pkg/context"
+	"gobizmanager/pkg/language"
+	"gobizmanager/pkg/logger"
+	"gobizmanager/pkg/ratelimiter"
+	"gobizmanager/pkg/utils"
+	"gobizmanager/platform/middleware"
+)
+
+const accountUnlockTTL = time.Hour
+
+var (
+	// accountPolicy throttles guesses against one account from anywhere
+	accountPolicy = ratelimiter.Policy{
+		MaxAttempts:  10,
+		Window:       15 * time.Minute,
+		BanTime:      30 * time.Minute,
+		FreeAttempts: 3,
+		BaseDelay:    time.Second,
+		MaxDelay:     30 * time.Second,
+	}
+	// ipPolicy throttles one address trying many accounts
+	ipPolicy = ratelimiter.Policy{
+		MaxAttempts:  100,
+		Window:       15 * time.Minute,
+		BanTime:      time.Hour,
+		FreeAttempts: 20,
+		BaseDelay:    time.Second,
+		MaxDelay:     10 * time.Second,
+	}
+	// challengePolicy limits the codes tried against one MFA challenge. Once
+	// used up, the challenge is refused for the rest of its life.
+	challengePolicy = ratelimiter.Policy{
+		MaxAttempts:  5,
+		Window:       mfaChallengeTTL,
+		BanTime:      mfaChallengeTTL,
+		FreeAttempts: 5,
+	}
+)
+
+// LoginGuard throttles failed logins by client IP and by account, and wrong
+// codes by MFA challenge. Accounts are keyed by the hash of the login name, so
+// unknown names are throttled the same way as existing ones.
+type LoginGuard struct {
+	accounts   *ratelimiter.RateLimiter
+	ips        *ratelimiter.RateLimiter
+	challenges *ratelimiter.RateLimiter
+	audit      *audit.Repository
+}
+
+func NewLoginGuard(tokenRepo *Repository, auditLog *audit.Repository) *LoginGuard {
+	store := &throttleStore{db: tokenRepo.db}
+	return &LoginGuard{
+		accounts:   ratelimiter.New(store, accountPolicy),
+		ips:        ratelimiter.New(store, ipPolicy),
+		challenges: ratelimiter.New(store, challengePolicy),
+		audit:      auditLog,
+	}
+}
+
+// Check returns the message key to reject a login attempt with, or an empty
+// key when it may proceed. Storage errors let the attempt through.
+func (g *LoginGuard) Check(ip, username string) (string, time.Duration) {
+	decision, err := g.ips.Check(ipKey(ip))
+	if err != nil {
+		logger.Error("Failed to check login throttle", zap.Error(err))
+	} else if !decision.Allowed {
+		return language.AuthTooManyAttempts, decision.RetryAfter
+	}
+
+	decision, err = g.accounts.Check(accountKey(username))
+	if err != nil {
+		logger.Error("Failed to check login throttle", zap.Error(err))
+	} else if decision.Banned {
+		return language.AuthAccountLocked, decision.RetryAfter
+	} else if !decision.Allowed {
+		return language.AuthTooManyAttempts, decision.RetryAfter
+	}
+	return "", 0
+}
+
+// Fail records a failed login and reports whether it locked the account.
+// userID is zero when the login name matches no user.
+func (g *LoginGuard) Fail(ip, username string, userID int64) bool {
+	ipBlocked, err := g.ips.Fail(ipKey(ip))
+	if err != nil {
+		logger.Error("Failed to record login failure", zap.Error(err))
+	}
+	if ipBlocked {
+		logger.Warn("Blocked IP after repeated failed logins", zap.String("ip", ip))
+		g.audit.Record(&audit.Event{Type: audit.EventIPBlocked, IPAddress: ip}, map[string]interface{}{
+			"minutes": int(ipPolicy.BanTime.Minutes()),
+		})
+	}
+
+	locked, err := g.accounts.Fail(accountKey(username))
+	if err != nil {
+		logger.Error("Failed to record login failure", zap.Error(err))
+	}
+	if locked {
+		logger.Warn("Locked account after repeated failed logins", zap.Int64("userID", userID))
+		g.audit.Record(&audit.Event{Type: audit.EventAccountLocked, UserID: audit.ID(userID), IPAddress: ip}, map[string]interface{}{
+			"minutes": int(accountPolicy.BanTime.Minutes()),
+		})
+	}
+	return locked
+}
+
+// Succeed clears the failures of an account after a successful login
+func (g *LoginGuard) Succeed(username string) {
+	if err := g.accounts.Reset(accountKey(username)); err != nil {
+		logger.Error("Failed to reset login throttle", zap.Error(err))
+	}
+}
+
+// Unlock lifts the lockout of an account. actorID is the user who unlocked it.
+func (g *LoginGuard) Unlock(email string, userID, actorID int64, ip string) error {
+	if err := g.accounts.Reset(accountKey(email)); err != nil {
+		return err
+	}
+	g.audit.Record(&audit.Event{
+		Type:      audit.EventAccountUnlocked,
+		UserID:    audit.ID(userID),
+		ActorID:   audit.ID(actorID),
+		IPAddress: ip,
+	}, nil)
+	return nil
+}
+
+// CheckChallenge reports whether the MFA challenge may still be answered.
+// Storage errors let the attempt through.
+func (g *LoginGuard) CheckChallenge(challengeID string) bool {
+	decision, err := g.challenges.Check(challengeKey(challengeID))
+	if err != nil {
+		logger.Error("Failed to check MFA challenge throttle", zap.Error(err))
+		return true
+	}
+	return !decision.Banned
+}
+
+// FailChallenge records a wrong code for the MFA challenge and reports
+// whether it used the challenge up
+func (g *LoginGuard) FailChallenge(challengeID string) bool {
+	exhausted, err := g.challenges.Fail(challengeKey(challengeID))
+	if err != nil {
+		logger.Error("Failed to record MFA challenge failure", zap.Error(err))
+	}
+	return exhausted
+}
+
+// ClearChallenge forgets the failures of an answered MFA challenge
+func (g *LoginGuard) ClearChallenge(challengeID string) {
+	if err := g.challenges.Reset(challengeKey(challengeID)); err != nil {
+		logger.Error("Failed to reset MFA challenge throttle", zap.Error(err))
+	}
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+func challengeKey(challengeID string) string {
+	return "mfa:" + challengeID
+}
+
+// accountKey ignores case and surrounding space so variants of a login name
+// share one counter
+func accountKey(username string) string {
+	return "account:" + HashToken(strings.ToLower(strings.TrimSpace(username)))
+}
+
+// loginFailed records a failed login and emails an unlock link when it locked
+// an existing account
+func (h *Handler) loginFailed(r *http.Request, ip, username string) {
+	u, err := h.UserRepo.GetUserByEmail(username)
+	if err != nil {
+		h.Guard.Fail(ip, username, 0)
+		return
+	}
+	if !h.Guard.Fail(ip, username, u.ID) || u.IsServiceAccount {
+		return
+	}
+
+	token, err := h.JWTManager.GenerateChallengeToken(u.ID, AccountUnlockTokenType, accountUnlockTTL)
+	if err != nil {
+		logger.Error("Failed to generate account unlock token", zap.Error(err))
+		return
+	}
+	h.sendEmail(appcontext.GetLanguage(r.Context()), u.Email, language.EmailAccountLockedSubject, language.EmailAccountLockedBody, map[string]interface{}{
+		"Link":    h.appLink("/unlock-account", token),
+		"Minutes": int(accountPolicy.BanTime.Minutes()),
+	})
+}
+
+// UnlockAccount lifts a lockout from the link in the lockout email
+func (h *Handler) UnlockAccount(w http.ResponseWriter, r *http.Request) {
+	var req types.UnlockAccountRequest
+	if err := utils.ParseRequest(r, &req); err != nil {
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+
+	if err := h.Validator.Struct(req); err != nil {
+		utils.ValidationError(w, r, err, h.MsgStore)
+		return
+	}
+
+	userID, err := h.consumeActionToken(req.Token, AccountUnlockTokenType)
+	if err != nil {
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+
+	h.unlock(w, r, userID, userID)
+}
+
+// AdminUnlockAccount lets the root user lift the lockout of any account
+func (h *Handler) AdminUnlockAccount(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := GetUserID(r.Context())
+	if !ok {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthUnauthorized))
+		return
+	}
+
+	isRoot, err := h.UserRepo.IsRoot(callerID)
+	if err != nil {
+		logger.Error("Failed to check root role", zap.Error(err))
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthDatabaseError))
+		return
+	}
+	if !isRoot {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthPermissionDenied))
+		return
+	}
+
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.ValidationInvalidID))
+		return
+	}
+
+	h.unlock(w, r, userID, callerID)
+}
+
+func (h *Handler) unlock(w http.ResponseWriter, r *http.Request, userID, actorID int64) {
+	u, err := h.UserRepo.GetUserByID(userID)
+	if err != nil {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthUserNotFound))
+		return
+	}
+
+	if err := h.Guard.Unlock(u.Email, u.ID, actorID, middleware.GetReqIP(r)); err != nil {
+		logger.Error("Failed to unlock account", zap.Error(err))
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthDatabaseError))
+		return
+	}
+
+	logger.Info("Account unlocked", zap.Int64("userID", u.ID), zap.Int64("actorID", actorID))
+	msg, httpStatus := h.MsgStore.GetMessage(appcontext.GetLanguage(r.Context()), language.AuthAccountUnlocked)
+	utils.JSON(w, httpStatus, msg)
+}
+
+// throttleStore persists login throttling state in the login_throttles table
+type throttleStore struct {
+	db *gorm.DB
+}
+
+func (s *throttleStore) Get(key string) (*ratelimiter.State, error) {
+	var row LoginThrottle
+	err := s.db.Where("key = ?", key).First(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ratelimiter.State{
+		Key:             row.Key,
+		Failures:        row.Failures,
+		WindowStartedAt: row.WindowStartedAt,
+		NextAttemptAt:   row.NextAttemptAt,
+		BannedUntil:     row.BannedUntil,
+	}, nil
+}
+
+func (s *throttleStore) Put(state *ratelimiter.State) error {
+	return s.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&LoginThrottle{
+		Key:             state.Key,
+		Failures:        state.Failures,
+		WindowStartedAt: state.WindowStartedAt,
+		NextAttemptAt:   state.NextAttemptAt,
+		BannedUntil:     state.BannedUntil,
+		UpdatedAt:       time.Now(),
+	}).Error
+}
+
+func (s *throttleStore) Delete(key string) error {
+	return s.db.Where("key = ?", key).Delete(&LoginThrottle{}).Error
+}
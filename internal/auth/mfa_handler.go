@@ -0,0 +1,502 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	types "gobizmanager/internal/types"
+	appcontext "gobizmanager/pkg/context"
+	"gobizmanager/pkg/encryption"
+	"gobizmanager/pkg/language"
+	"gobizmanager/pkg/logger"
+	"gobizmanager/pkg/totp"
+	"gobizmanager/pkg/utils"
+	"gobizmanager/platform/middleware"
+)
+
+const (
+	mfaIssuer         = "GoBizManager"
+	mfaChallengeTTL   = 5 * time.Minute
+	recoveryCodeCount = 10
+)
+
+// MFAChallenge is returned by Login instead of a TokenPair when a second
+// factor is needed. EnrollmentRequired is set when company policy forces the
+// user to enrol before logging in.
+type MFAChallenge struct {
+	MFARequired        bool   `json:"mfa_required"`
+	EnrollmentRequired bool   `json:"enrollment_required,omitempty"`
+	MFAToken           string `json:"mfa_token"`
+}
+
+type MFAEnrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURL string `json:"otpauth_url"`
+}
+
+type MFAConfirmation struct {
+	RecoveryCodes []string   `json:"recovery_codes"`
+	Tokens        *TokenPair `json:"tokens,omitempty"`
+}
+
+// VerifyMFA completes a two-step login with a TOTP or recovery code. Wrong
+// codes count as failed logins of the account, and a challenge stops being
+// accepted after a few of them or once it has been answered.
+func (h *Handler) VerifyMFA(w http.ResponseWriter, r *http.Request) {
+	var req types.MFAVerifyRequest
+	if err := utils.ParseRequest(r, &req); err != nil {
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+
+	if err := h.Validator.Struct(req); err != nil {
+		utils.ValidationError(w, r, err, h.MsgStore)
+		return
+	}
+
+	claims, err := h.JWTManager.VerifyToken(req.MFAToken)
+	if err != nil || claims.TokenType != MFAChallengeTokenType || claims.ID == "" {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.MFAInvalidChallenge))
+		return
+	}
+	if !h.Guard.CheckChallenge(claims.ID) {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.MFAInvalidChallenge))
+		return
+	}
+
+	u, err := h.UserRepo.GetUserByID(claims.UserID)
+	if err != nil {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.MFAInvalidChallenge))
+		return
+	}
+
+	ip := middleware.GetReqIP(r)
+	if key, retryAfter := h.Guard.Check(ip, u.Email); key != "" {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		utils.RespondError(w, r, h.MsgStore, errors.New(key))
+		return
+	}
+
+	mfa, err := h.TokenRepo.GetUserMFA(claims.UserID)
+	if err != nil || !mfa.Enabled {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.MFAInvalidChallenge))
+		return
+	}
+
+	if req.Code != "" {
+		err = h.verifyTOTP(mfa, req.Code)
+		if err == nil {
+			err = h.consumeChallenge(claims)
+		}
+	} else {
+		err = h.answerWithRecoveryCode(claims, req.RecoveryCode)
+	}
+	if err != nil {
+		h.challengeFailed(r, ip, u.Email, claims, err)
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+	h.Guard.Succeed(u.Email)
+
+	tokens, err := h.issueTokens(r, claims.UserID)
+	if err != nil {
+		logger.Error("Failed to generate tokens", zap.Error(err))
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthTokenGenFailed))
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, tokens)
+}
+
+// EnrollMFA creates a pending TOTP secret for the caller. Authenticated users
+// call it with a bearer token; users forced to enrol by policy pass the
+// mfa_token returned by Login.
+func (h *Handler) EnrollMFA(w http.ResponseWriter, r *http.Request) {
+	var req types.MFAEnrollRequest
+	if err := utils.ParseRequest(r, &req); err != nil {
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+
+	userID, _, err := h.mfaSubject(r, req.MFAToken)
+	if err != nil {
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+
+	existing, err := h.TokenRepo.GetUserMFA(userID)
+	if err == nil && existing.Enabled {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.MFAAlreadyEnabled))
+		return
+	}
+
+	u, err := h.UserRepo.GetUserByID(userID)
+	if err != nil {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthUserNotFound))
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		logger.Error("Failed to generate TOTP secret", zap.Error(err))
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.MFAEnrollFailed))
+		return
+	}
+
+	encryptedSecret, err := encryption.Encrypt(secret, h.Config.EncryptionKey)
+	if err != nil {
+		logger.Error("Failed to encrypt TOTP secret", zap.Error(err))
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.MFAEnrollFailed))
+		return
+	}
+
+	if err := h.TokenRepo.SavePendingMFA(userID, encryptedSecret); err != nil {
+		logger.Error("Failed to save TOTP secret", zap.Error(err))
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.MFAEnrollFailed))
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, MFAEnrollment{
+		Secret:     secret,
+		OTPAuthURL: totp.URI(mfaIssuer, u.Email, secret),
+	})
+}
+
+// ConfirmMFA enables the pending enrolment once the user proves they can
+// generate codes, and returns the recovery codes. Users enrolling through a
+// login challenge also receive their token pair; their wrong codes count like
+// those sent to VerifyMFA and the challenge is accepted once.
+func (h *Handler) ConfirmMFA(w http.ResponseWriter, r *http.Request) {
+	var req types.MFAConfirmRequest
+	if err := utils.ParseRequest(r, &req); err != nil {
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+
+	if err := h.Validator.Struct(req); err != nil {
+		utils.ValidationError(w, r, err, h.MsgStore)
+		return
+	}
+
+	userID, challenge, err := h.mfaSubject(r, req.MFAToken)
+	if err != nil {
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+
+	ip := middleware.GetReqIP(r)
+	var email string
+	if challenge != nil {
+		if !h.Guard.CheckChallenge(challenge.ID) {
+			utils.RespondError(w, r, h.MsgStore, errors.New(language.MFAInvalidChallenge))
+			return
+		}
+
+		u, err := h.UserRepo.GetUserByID(userID)
+		if err != nil {
+			utils.RespondError(w, r, h.MsgStore, errors.New(language.MFAInvalidChallenge))
+			return
+		}
+		email = u.Email
+
+		if key, retryAfter := h.Guard.Check(ip, email); key != "" {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			utils.RespondError(w, r, h.MsgStore, errors.New(key))
+			return
+		}
+	}
+
+	mfa, err := h.TokenRepo.GetUserMFA(userID)
+	if err != nil {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.MFANotEnabled))
+		return
+	}
+	if mfa.Enabled {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.MFAAlreadyEnabled))
+		return
+	}
+
+	secret, err := encryption.Decrypt(mfa.Secret, h.Config.EncryptionKey)
+	if err != nil {
+		logger.Error("Failed to decrypt TOTP secret", zap.Error(err))
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.MFAEnrollFailed))
+		return
+	}
+
+	step, ok := totp.Validate(secret, req.Code, time.Now())
+	if !ok {
+		err := errors.New(language.MFAInvalidCode)
+		if challenge != nil {
+			h.challengeFailed(r, ip, email, challenge, err)
+		}
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+
+	if challenge != nil {
+		if err := h.consumeChallenge(challenge); err != nil {
+			utils.RespondError(w, r, h.MsgStore, err)
+			return
+		}
+		h.Guard.Succeed(email)
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		logger.Error("Failed to generate recovery codes", zap.Error(err))
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.MFAEnrollFailed))
+		return
+	}
+
+	if err := h.TokenRepo.EnableMFA(userID, step, hashes); err != nil {
+		logger.Error("Failed to enable MFA", zap.Error(err))
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.MFAEnrollFailed))
+		return
+	}
+
+	res := MFAConfirmation{RecoveryCodes: codes}
+	if challenge != nil {
+		res.Tokens, err = h.issueTokens(r, userID)
+		if err != nil {
+			logger.Error("Failed to generate tokens", zap.Error(err))
+			utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthTokenGenFailed))
+			return
+		}
+	}
+
+	logger.Info("MFA enabled", zap.Int64("userID", userID))
+	utils.JSON(w, http.StatusOK, res)
+}
+
+// DisableMFA removes the caller's enrolment after checking a current code
+func (h *Handler) DisableMFA(w http.ResponseWriter, r *http.Request) {
+	userID, mfa, ok := h.requireMFACode(w, r)
+	if !ok {
+		return
+	}
+
+	required, err := h.TokenRepo.RequiresAdminMFA(userID)
+	if err != nil {
+		logger.Error("Failed to check MFA policy", zap.Error(err))
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.MFADisableFailed))
+		return
+	}
+	if required {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.MFARequiredByPolicy))
+		return
+	}
+
+	if err := h.TokenRepo.DisableMFA(mfa.UserID); err != nil {
+		logger.Error("Failed to disable MFA", zap.Error(err))
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.MFADisableFailed))
+		return
+	}
+
+	logger.Info("MFA disabled", zap.Int64("userID", userID))
+	msg, httpStatus := h.MsgStore.GetMessage(appcontext.GetLanguage(r.Context()), language.MFADisabled)
+	utils.JSON(w, httpStatus, msg)
+}
+
+// RegenerateRecoveryCodes replaces the caller's recovery codes
+func (h *Handler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	userID, _, ok := h.requireMFACode(w, r)
+	if !ok {
+		return
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		logger.Error("Failed to generate recovery codes", zap.Error(err))
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.MFAEnrollFailed))
+		return
+	}
+
+	if err := h.TokenRepo.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		logger.Error("Failed to store recovery codes", zap.Error(err))
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.MFAEnrollFailed))
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, MFAConfirmation{RecoveryCodes: codes})
+}
+
+// mfaChallenge returns the challenge Login must answer with instead of tokens,
+// or nil when no second factor is needed
+func (h *Handler) mfaChallenge(userID int64) (*MFAChallenge, error) {
+	mfa, err := h.TokenRepo.GetUserMFA(userID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if err == nil && mfa.Enabled {
+		token, err := h.JWTManager.GenerateChallengeToken(userID, MFAChallengeTokenType, mfaChallengeTTL)
+		if err != nil {
+			return nil, err
+		}
+		return &MFAChallenge{MFARequired: true, MFAToken: token}, nil
+	}
+
+	required, err := h.TokenRepo.RequiresAdminMFA(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !required {
+		return nil, nil
+	}
+
+	token, err := h.JWTManager.GenerateChallengeToken(userID, MFAEnrollmentTokenType, mfaChallengeTTL)
+	if err != nil {
+		return nil, err
+	}
+	return &MFAChallenge{MFARequired: true, EnrollmentRequired: true, MFAToken: token}, nil
+}
+
+// mfaSubject resolves the user enrolling either from an enrollment challenge
+// token, whose claims are returned too, or from the authenticated request
+func (h *Handler) mfaSubject(r *http.Request, mfaToken string) (int64, *Claims, error) {
+	if mfaToken != "" {
+		claims, err := h.JWTManager.VerifyToken(mfaToken)
+		if err != nil || claims.TokenType != MFAEnrollmentTokenType || claims.ID == "" {
+			return 0, nil, errors.New(language.MFAInvalidChallenge)
+		}
+		return claims.UserID, claims, nil
+	}
+
+	userID, ok := GetUserID(r.Context())
+	if !ok {
+		return 0, nil, errors.New(language.AuthUnauthorized)
+	}
+	return userID, nil, nil
+}
+
+// consumeChallenge marks an answered challenge token as used so it cannot be
+// answered again
+func (h *Handler) consumeChallenge(claims *Claims) error {
+	if err := h.TokenRepo.ConsumeToken(claims.ID, claims.UserID, claims.TokenType, claims.ExpiresAt.Time); err != nil {
+		if !errors.Is(err, ErrTokenAlreadyUsed) {
+			logger.Error("Failed to record used MFA challenge", zap.Error(err))
+		}
+		return errors.New(language.MFAInvalidChallenge)
+	}
+	h.Guard.ClearChallenge(claims.ID)
+	return nil
+}
+
+// challengeFailed counts a wrong code sent with a challenge as a failed login
+// of the account and against the challenge
+func (h *Handler) challengeFailed(r *http.Request, ip, email string, claims *Claims, err error) {
+	if err.Error() != language.MFAInvalidCode {
+		return
+	}
+	h.loginFailed(r, ip, email)
+	if h.Guard.FailChallenge(claims.ID) {
+		logger.Warn("MFA challenge used up by wrong codes", zap.Int64("userID", claims.UserID))
+	}
+}
+
+// requireMFACode checks the TOTP code in the body against the enabled
+// enrolment of the authenticated user
+func (h *Handler) requireMFACode(w http.ResponseWriter, r *http.Request) (int64, *UserMFA, bool) {
+	userID, ok := GetUserID(r.Context())
+	if !ok {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthUnauthorized))
+		return 0, nil, false
+	}
+
+	var req types.MFACodeRequest
+	if err := utils.ParseRequest(r, &req); err != nil {
+		utils.RespondError(w, r, h.MsgStore, err)
+		return 0, nil, false
+	}
+
+	if err := h.Validator.Struct(req); err != nil {
+		utils.ValidationError(w, r, err, h.MsgStore)
+		return 0, nil, false
+	}
+
+	mfa, err := h.TokenRepo.GetUserMFA(userID)
+	if err != nil || !mfa.Enabled {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.MFANotEnabled))
+		return 0, nil, false
+	}
+
+	if err := h.verifyTOTP(mfa, req.Code); err != nil {
+		utils.RespondError(w, r, h.MsgStore, err)
+		return 0, nil, false
+	}
+
+	return userID, mfa, true
+}
+
+func (h *Handler) verifyTOTP(mfa *UserMFA, code string) error {
+	secret, err := encryption.Decrypt(mfa.Secret, h.Config.EncryptionKey)
+	if err != nil {
+		logger.Error("Failed to decrypt TOTP secret", zap.Error(err))
+		return errors.New(language.AuthDatabaseError)
+	}
+
+	step, ok := totp.Validate(secret, code, time.Now())
+	if !ok {
+		return errors.New(language.MFAInvalidCode)
+	}
+
+	fresh, err := h.TokenRepo.ConsumeMFAStep(mfa.UserID, step)
+	if err != nil {
+		logger.Error("Failed to record TOTP step", zap.Error(err))
+		return errors.New(language.AuthDatabaseError)
+	}
+	if !fresh {
+		return errors.New(language.MFAInvalidCode)
+	}
+	return nil
+}
+
+// answerWithRecoveryCode consumes the challenge and the recovery code together
+func (h *Handler) answerWithRecoveryCode(claims *Claims, code string) error {
+	used, err := h.TokenRepo.AnswerChallengeWithRecoveryCode(claims.ID, claims.UserID, claims.ExpiresAt.Time, HashToken(normalizeRecoveryCode(code)))
+	if errors.Is(err, ErrTokenAlreadyUsed) {
+		return errors.New(language.MFAInvalidChallenge)
+	}
+	if err != nil {
+		logger.Error("Failed to use recovery code", zap.Error(err))
+		return errors.New(language.AuthDatabaseError)
+	}
+	if !used {
+		return errors.New(language.MFAInvalidCode)
+	}
+	h.Guard.ClearChallenge(claims.ID)
+
+	logger.Info("MFA recovery code used", zap.Int64("userID", claims.UserID))
+	return nil
+}
+
+// generateRecoveryCodes returns the plain recovery codes to show the user once
+// together with the hashes to store
+func generateRecoveryCodes() ([]string, []string, error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(encoding.EncodeToString(b))[:10]
+		codes[i] = raw[:5] + "-" + raw[5:]
+		hashes[i] = HashToken(raw)
+	}
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.ReplaceAll(code, "-", "")
+}
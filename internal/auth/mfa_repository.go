@@ -0,0 +1,172 @@
+package auth
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MFA operations
+func (r *Repository) GetUserMFA(userID int64) (*UserMFA, error) {
+	var mfa UserMFA
+	if err := r.db.Where("user_id = ?", userID).First(&mfa).Error; err != nil {
+		return nil, err
+	}
+	return &mfa, nil
+}
+
+// SavePendingMFA stores a new, not yet confirmed, encrypted secret for the user
+func (r *Repository) SavePendingMFA(userID int64, encryptedSecret string) error {
+	tx := r.db.Begin()
+	if tx.Error != nil {
+		return fmt.Errorf("failed to begin transaction: %w", tx.Error)
+	}
+	defer tx.Rollback()
+
+	if err := tx.Where("user_id = ? AND enabled = ?", userID, false).Delete(&UserMFA{}).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if err := tx.Create(&UserMFA{
+		UserID:    userID,
+		Secret:    encryptedSecret,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}).Error; err != nil {
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// EnableMFA confirms the pending enrolment and replaces the recovery codes
+func (r *Repository) EnableMFA(userID, step int64, codeHashes []string) error {
+	tx := r.db.Begin()
+	if tx.Error != nil {
+		return fmt.Errorf("failed to begin transaction: %w", tx.Error)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if err := tx.Model(&UserMFA{}).
+		Where("user_id = ?", userID).
+		Updates(map[string]interface{}{
+			"enabled":        true,
+			"last_used_step": step,
+			"confirmed_at":   now,
+			"updated_at":     now,
+		}).Error; err != nil {
+		return err
+	}
+
+	if err := replaceRecoveryCodes(tx, userID, codeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// DisableMFA removes the enrolment and every recovery code of the user
+func (r *Repository) DisableMFA(userID int64) error {
+	tx := r.db.Begin()
+	if tx.Error != nil {
+		return fmt.Errorf("failed to begin transaction: %w", tx.Error)
+	}
+	defer tx.Rollback()
+
+	if err := tx.Where("user_id = ?", userID).Delete(&MFARecoveryCode{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ?", userID).Delete(&UserMFA{}).Error; err != nil {
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// ConsumeMFAStep records a used time step. It returns false when the step, or
+// a later one, has already been used.
+func (r *Repository) ConsumeMFAStep(userID, step int64) (bool, error) {
+	res := r.db.Model(&UserMFA{}).
+		Where("user_id = ? AND last_used_step < ?", userID, step).
+		Updates(map[string]interface{}{"last_used_step": step, "updated_at": time.Now()})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected > 0, nil
+}
+
+func (r *Repository) ReplaceRecoveryCodes(userID int64, codeHashes []string) error {
+	tx := r.db.Begin()
+	if tx.Error != nil {
+		return fmt.Errorf("failed to begin transaction: %w", tx.Error)
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(tx, userID, codeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// AnswerChallengeWithRecoveryCode consumes an MFA challenge token and a
+// recovery code in one transaction. The challenge goes first, so a replayed
+// challenge fails with ErrTokenAlreadyUsed without spending a code, and a
+// wrong code leaves the challenge unanswered.
+func (r *Repository) AnswerChallengeWithRecoveryCode(jti string, userID int64, expiresAt time.Time, codeHash string) (bool, error) {
+	tx := r.db.Begin()
+	if tx.Error != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", tx.Error)
+	}
+	defer tx.Rollback()
+
+	if err := consumeToken(tx, jti, userID, MFAChallengeTokenType, expiresAt); err != nil {
+		return false, err
+	}
+
+	res := tx.Model(&MFARecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	if res.Error != nil || res.RowsAffected == 0 {
+		return false, res.Error
+	}
+
+	return true, tx.Commit().Error
+}
+
+// RequiresAdminMFA reports whether the user holds the ADMIN role in a company
+// whose policy forces multi-factor authentication for administrators
+func (r *Repository) RequiresAdminMFA(userID int64) (bool, error) {
+	var count int64
+	err := r.db.Table("user_roles").
+		Joins("JOIN roles ON user_roles.role_id = roles.id").
+		Joins("JOIN company_users ON user_roles.company_user_id = company_users.id").
+		Joins("JOIN companies ON company_users.company_id = companies.id").
+		Where("company_users.user_id = ? AND roles.name = ? AND companies.require_admin_mfa = ?", userID, "ADMIN", true).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID int64, codeHashes []string) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&MFARecoveryCode{}).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, codeHash := range codeHashes {
+		if err := tx.Create(&MFARecoveryCode{
+			UserID:    userID,
+			CodeHash:  codeHash,
+			CreatedAt: now,
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
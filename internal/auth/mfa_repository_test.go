@@ -0,0 +1,41 @@
+package auth_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gobizmanager/internal/auth"
+	"gobizmanager/internal/testutil"
+)
+
+func TestAnswerChallengeWithRecoveryCode(t *testing.T) {
+	db := testutil.NewDB(t)
+	repo := auth.NewRepository(db)
+	userID := testutil.CreateUser(t, db, "mfa@example.com")
+	codes := []string{auth.HashToken("first"), auth.HashToken("second")}
+	if err := repo.ReplaceRecoveryCodes(userID, codes); err != nil {
+		t.Fatalf("replace recovery codes: %v", err)
+	}
+	expiresAt := time.Now().Add(time.Minute)
+
+	// A wrong code leaves the challenge open
+	used, err := repo.AnswerChallengeWithRecoveryCode("challenge", userID, expiresAt, auth.HashToken("wrong"))
+	if err != nil || used {
+		t.Fatalf("wrong code: got %v, %v", used, err)
+	}
+
+	used, err = repo.AnswerChallengeWithRecoveryCode("challenge", userID, expiresAt, codes[0])
+	if err != nil || !used {
+		t.Fatalf("first code: got %v, %v", used, err)
+	}
+
+	// Replaying the challenge does not spend the second code
+	if _, err := repo.AnswerChallengeWithRecoveryCode("challenge", userID, expiresAt, codes[1]); !errors.Is(err, auth.ErrTokenAlreadyUsed) {
+		t.Fatalf("replayed challenge: got %v, want %v", err, auth.ErrTokenAlreadyUsed)
+	}
+	used, err = repo.AnswerChallengeWithRecoveryCode("another", userID, expiresAt, codes[1])
+	if err != nil || !used {
+		t.Fatalf("second code with a new challenge: got %v, %v", used, err)
+	}
+}
@@ -3,18 +3,34 @@ package auth
 import (
 	"context"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
+
+	"go.uber.org/zap"
 
 	appcontext "gobizmanager/pkg/context"
 	"gobizmanager/pkg/language"
+	"gobizmanager/pkg/logger"
+	"gobizmanager/pkg/permdigest"
 	"gobizmanager/pkg/utils"
+	"gobizmanager/platform/middleware"
 )
 
 type contextKey string
 
-const UserIDKey contextKey = "userID"
+const (
+	UserIDKey    contextKey = "userID"
+	SessionIDKey contextKey = "sessionID"
+	APIKeyIDKey  contextKey = "apiKeyID"
+	ActorIDKey   contextKey = "actorID"
+)
+
+// ImpersonationHeader is set on every response to a request made with an
+// impersonation token. It holds the ID of the ROOT user acting.
+const ImpersonationHeader = "X-Impersonated-By"
 
-func Middleware(jwtManager *JWTManager, msgStore *language.MessageStore) func(http.Handler) http.Handler {
+func Middleware(jwtManager *JWTManager, tokenRepo *Repository, msgStore *language.MessageStore) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			lang := appcontext.GetLanguage(r.Context())
@@ -26,33 +42,159 @@ func Middleware(jwtManager *JWTManager, msgStore *language.MessageStore) func(ht
 				return
 			}
 
-			parts := strings.Split(authHeader, " ")
-			if len(parts) != 2 || parts[0] != "Bearer" {
-				msg, httpStatus := msgStore.GetMessage(lang, language.AuthInvalidFormat)
+			ctx, errKey := authenticate(r, authHeader, jwtManager, tokenRepo)
+			if errKey != "" {
+				msg, httpStatus := msgStore.GetMessage(lang, errKey)
 				utils.JSONError(w, httpStatus, msg)
 				return
 			}
 
-			tokenString := parts[1]
-			claims, err := jwtManager.VerifyToken(tokenString)
-			if err != nil {
-				if err == ErrExpiredToken {
-					msg, httpStatus := msgStore.GetMessage(lang, language.AuthTokenExpired)
-					utils.JSONError(w, httpStatus, msg)
-				} else {
-					msg, httpStatus := msgStore.GetMessage(lang, language.AuthInvalidToken)
-					utils.JSONError(w, httpStatus, msg)
-				}
+			flagImpersonation(w, ctx)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// OptionalMiddleware authenticates the request when an Authorization header is
+// present and lets anonymous requests through untouched
+func OptionalMiddleware(jwtManager *JWTManager, tokenRepo *Repository, msgStore *language.MessageStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authHeader := r.Header.Get("Authorization")
+			if authHeader == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, errKey := authenticate(r, authHeader, jwtManager, tokenRepo)
+			if errKey != "" {
+				msg, httpStatus := msgStore.GetMessage(appcontext.GetLanguage(r.Context()), errKey)
+				utils.JSONError(w, httpStatus, msg)
 				return
 			}
 
-			ctx := context.WithValue(r.Context(), UserIDKey, claims.UserID)
+			flagImpersonation(w, ctx)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
+// authenticate validates the Authorization header and returns the request
+// context carrying the caller, or the language key describing the failure
+func authenticate(r *http.Request, authHeader string, jwtManager *JWTManager, tokenRepo *Repository) (context.Context, string) {
+	parts := strings.Split(authHeader, " ")
+	if len(parts) == 2 && parts[0] == APIKeyScheme {
+		return authenticateAPIKey(r, parts[1], tokenRepo)
+	}
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		return nil, language.AuthInvalidFormat
+	}
+
+	tokenString := parts[1]
+	claims, err := jwtManager.VerifyToken(tokenString)
+	if err != nil {
+		if err == ErrExpiredToken {
+			return nil, language.AuthTokenExpired
+		}
+		return nil, language.AuthInvalidToken
+	}
+
+	if claims.TokenType != AccessTokenType {
+		return nil, language.AuthInvalidToken
+	}
+
+	// Changing the password raises the token version, invalidating every
+	// token issued before
+	tokenVersion, err := tokenRepo.GetTokenVersion(claims.UserID)
+	if err != nil || tokenVersion != claims.TokenVersion {
+		return nil, language.AuthSessionRevoked
+	}
+
+	// Impersonation tokens live on the session of the acting ROOT user
+	sessionUserID := claims.UserID
+	if claims.Act != nil {
+		sessionUserID = claims.Act.UserID
+	}
+	session, err := tokenRepo.GetSessionByID(claims.SessionID)
+	if err != nil || session.RevokedAt.Valid || session.UserID != sessionUserID {
+		return nil, language.AuthSessionRevoked
+	}
+	if err := tokenRepo.TouchSession(session, middleware.GetReqIP(r)); err != nil {
+		logger.Warn("Failed to update session activity", zap.Error(err))
+	}
+
+	ctx := context.WithValue(r.Context(), UserIDKey, claims.UserID)
+	ctx = context.WithValue(ctx, SessionIDKey, session.ID)
+	if claims.Act != nil {
+		ctx = context.WithValue(ctx, ActorIDKey, claims.Act.UserID)
+	}
+
+	// Company-scoped tokens carry the active company and its permission digest
+	if claims.CompanyID != 0 {
+		digest, err := permdigest.Parse(claims.Permissions)
+		if err != nil {
+			return nil, language.AuthInvalidToken
+		}
+		ctx = appcontext.SetCompanyID(ctx, claims.CompanyID)
+		ctx = appcontext.SetPermissions(ctx, digest)
+	}
+	return ctx, ""
+}
+
+// authenticateAPIKey resolves an API key to its user, scoped to the key's
+// company and limited to the module actions granted to the key. Like tokens,
+// keys stop working when the user changes password, and they also stop
+// working when the user leaves the company.
+func authenticateAPIKey(r *http.Request, plain string, tokenRepo *Repository) (context.Context, string) {
+	key, err := tokenRepo.GetAPIKeyByHash(HashToken(plain))
+	if err != nil || key.RevokedAt.Valid || time.Now().After(key.ExpiresAt) {
+		return nil, language.APIKeyInvalid
+	}
+
+	tokenVersion, err := tokenRepo.GetTokenVersion(key.UserID)
+	if err != nil || tokenVersion != key.TokenVersion {
+		return nil, language.APIKeyInvalid
+	}
+	member, err := tokenRepo.IsCompanyMember(key.CompanyID, key.UserID)
+	if err != nil || !member {
+		return nil, language.APIKeyInvalid
+	}
+	if err := tokenRepo.TouchAPIKey(key); err != nil {
+		logger.Warn("Failed to update API key activity", zap.Error(err))
+	}
+
+	ctx := context.WithValue(r.Context(), UserIDKey, key.UserID)
+	ctx = context.WithValue(ctx, APIKeyIDKey, key.ID)
+	ctx = appcontext.SetCompanyID(ctx, key.CompanyID)
+	ctx = appcontext.SetPermissions(ctx, permdigest.New(key.ModuleActionIDs))
+	return ctx, ""
+}
+
+// flagImpersonation marks the response of an impersonated request
+func flagImpersonation(w http.ResponseWriter, ctx context.Context) {
+	if actorID, ok := GetActorID(ctx); ok {
+		w.Header().Set(ImpersonationHeader, strconv.FormatInt(actorID, 10))
+	}
+}
+
 func GetUserID(ctx context.Context) (int64, bool) {
 	userID, ok := ctx.Value(UserIDKey).(int64)
 	return userID, ok
 }
+
+func GetSessionID(ctx context.Context) (int64, bool) {
+	sessionID, ok := ctx.Value(SessionIDKey).(int64)
+	return sessionID, ok
+}
+
+// GetAPIKeyID returns the API key the request was authenticated with, if any
+func GetAPIKeyID(ctx context.Context) (int64, bool) {
+	apiKeyID, ok := ctx.Value(APIKeyIDKey).(int64)
+	return apiKeyID, ok
+}
+
+// GetActorID returns the ROOT user impersonating the caller, if any
+func GetActorID(ctx context.Context) (int64, bool) {
+	actorID, ok := ctx.Value(ActorIDKey).(int64)
+	return actorID, ok
+}
@@ -0,0 +1,62 @@
+package auth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gobizmanager/internal/auth"
+	"gobizmanager/internal/testutil"
+	"gobizmanager/pkg/language"
+)
+
+func TestMiddlewareAPIKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		change string // run after the key is issued
+		want   int
+	}{
+		{"valid", "", http.StatusOK},
+		{"password changed", "UPDATE users SET token_version = token_version + 1", http.StatusUnauthorized},
+		{"removed from company", "DELETE FROM company_users", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testutil.NewDB(t)
+			tokenRepo := auth.NewRepository(db)
+			companyID := testutil.CreateCompany(t, db, "Acme")
+			userID := testutil.CreateUser(t, db, "integration@example.com")
+			testutil.AddMember(t, db, companyID, userID)
+
+			const plain = "gbm_test-api-key"
+			key := &auth.APIKey{
+				UserID:    userID,
+				CompanyID: companyID,
+				Name:      "CI",
+				Prefix:    plain[:8],
+				KeyHash:   auth.HashToken(plain),
+				ExpiresAt: time.Now().Add(time.Hour),
+			}
+			if err := tokenRepo.CreateAPIKey(key); err != nil {
+				t.Fatalf("create API key: %v", err)
+			}
+			if tt.change != "" {
+				if err := db.Exec(tt.change).Error; err != nil {
+					t.Fatalf("change: %v", err)
+				}
+			}
+
+			handler := auth.Middleware(newJWTManager(t, db), tokenRepo, language.NewMessageStore())(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", auth.APIKeyScheme+" "+plain)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("got status %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"database/sql"
+	"time"
+)
+
+// RefreshToken is the server-side record of an issued refresh token.
+// Only the SHA-256 hash of the token is stored. Tokens issued from the same
+// login share a FamilyID so that the whole chain can be revoked at once.
+type RefreshToken struct {
+	ID        int64        `json:"id"`
+	UserID    int64        `json:"user_id"`
+	FamilyID  string       `json:"family_id"`
+	TokenHash string       `json:"-"`
+	Device    string       `json:"device"`
+	ExpiresAt time.Time    `json:"expires_at"`
+	RevokedAt sql.NullTime `json:"revoked_at"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+}
+
+// Session is the server-side record of a login. Its FamilyID links it to the
+// refresh tokens issued for that login and access tokens carry its ID.
+type Session struct {
+	ID         int64        `json:"id"`
+	UserID     int64        `json:"user_id"`
+	FamilyID   string       `json:"-"`
+	IPAddress  string       `json:"ip_address"`
+	UserAgent  string       `json:"user_agent"`
+	ExpiresAt  time.Time    `json:"expires_at"`
+	LastUsedAt time.Time    `json:"last_used_at"`
+	RevokedAt  sql.NullTime `json:"-"`
+	Current    bool         `json:"current" gorm:"-"`
+	CreatedAt  time.Time    `json:"created_at"`
+	UpdatedAt  time.Time    `json:"updated_at"`
+}
+
+// UserMFA holds a user's TOTP enrolment. Secret is encrypted at rest and
+// LastUsedStep prevents a code from being accepted twice.
+type UserMFA struct {
+	ID           int64        `json:"id"`
+	UserID       int64        `json:"user_id"`
+	Secret       string       `json:"-"`
+	Enabled      bool         `json:"enabled"`
+	LastUsedStep int64        `json:"-"`
+	ConfirmedAt  sql.NullTime `json:"confirmed_at"`
+	CreatedAt    time.Time    `json:"created_at"`
+	UpdatedAt    time.Time    `json:"updated_at"`
+}
+
+func (UserMFA) TableName() string {
+	return "user_mfa"
+}
+
+// MFARecoveryCode is a hashed single-use recovery code
+type MFARecoveryCode struct {
+	ID        int64        `json:"id"`
+	UserID    int64        `json:"user_id"`
+	CodeHash  string       `json:"-"`
+	UsedAt    sql.NullTime `json:"used_at"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+func (MFARecoveryCode) TableName() string {
+	return "mfa_recovery_codes"
+}
+
+// UsedToken records the ID of a single-use token once it has been redeemed
+type UsedToken struct {
+	JTI       string    `json:"jti" gorm:"column:jti;primaryKey"`
+	UserID    int64     `json:"user_id"`
+	Purpose   string    `json:"purpose"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SigningKey is a token signing key pair. The private key is stored as an
+// encrypted PKCS#8 PEM. RetiredAt is set once a newer key takes over signing
+// and ExpiresAt once no token signed with the key can still be valid.
+type SigningKey struct {
+	ID         int64        `json:"id"`
+	KID        string       `json:"kid" gorm:"column:kid"`
+	Algorithm  string       `json:"algorithm"`
+	PrivateKey string       `json:"-"`
+	PublicKey  string       `json:"public_key"`
+	RetiredAt  sql.NullTime `json:"retired_at"`
+	ExpiresAt  sql.NullTime `json:"expires_at"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
+// APIKey is a long-lived credential for integrations. It acts for its user
+// within one company and only for the module actions it was granted. Only the
+// SHA-256 hash of the key is stored; Prefix identifies it in listings.
+// TokenVersion is the user's token version when the key was issued.
+type APIKey struct {
+	ID              int64        `json:"id"`
+	UserID          int64        `json:"user_id"`
+	CompanyID       int64        `json:"company_id"`
+	Name            string       `json:"name"`
+	Prefix          string       `json:"prefix"`
+	KeyHash         string       `json:"-"`
+	ModuleActionIDs []int64      `json:"module_action_ids" gorm:"-"`
+	TokenVersion    int64        `json:"-"`
+	ExpiresAt       time.Time    `json:"expires_at"`
+	LastUsedAt      sql.NullTime `json:"last_used_at"`
+	RevokedAt       sql.NullTime `json:"-"`
+	CreatedAt       time.Time    `json:"created_at"`
+	UpdatedAt       time.Time    `json:"updated_at"`
+}
+
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+// APIKeyModuleAction grants a module action to an API key
+type APIKeyModuleAction struct {
+	ID             int64 `json:"id"`
+	APIKeyID       int64 `json:"api_key_id" gorm:"column:api_key_id"`
+	ModuleActionID int64 `json:"module_action_id"`
+}
+
+func (APIKeyModuleAction) TableName() string {
+	return "api_key_module_actions"
+}
+
+// LoginThrottle persists the failed login state of an IP address or account
+// so that delays and lockouts survive restarts
+type LoginThrottle struct {
+	Key             string `gorm:"primaryKey"`
+	Failures        int
+	WindowStartedAt time.Time
+	NextAttemptAt   time.Time
+	BannedUntil     time.Time
+	UpdatedAt       time.Time
+}
@@ -0,0 +1,231 @@
+package oidc
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"gobizmanager/internal/auth"
+	user "gobizmanager/internal/user"
+	"gobizmanager/pkg/language"
+	"gobizmanager/pkg/logger"
+	"gobizmanager/pkg/utils"
+)
+
+// loginStateTTL bounds how long a user may take at the identity provider
+const loginStateTTL = 10 * time.Minute
+
+// LoginCompleter finishes a login once the user is identified, answering with
+// an MFA challenge or tokens. It is implemented by *auth.Handler.
+type LoginCompleter interface {
+	CompleteLogin(w http.ResponseWriter, r *http.Request, userID int64)
+}
+
+type Handler struct {
+	Providers map[string]*Provider
+	Repo      *Repository
+	UserRepo  *user.Repository
+	Login     LoginCompleter
+	Validator *validator.Validate
+	MsgStore  *language.MessageStore
+
+	names []string
+}
+
+func NewHandler(providers []*Provider, repo *Repository, userRepo *user.Repository, login LoginCompleter, msgStore *language.MessageStore) *Handler {
+	h := &Handler{
+		Providers: make(map[string]*Provider, len(providers)),
+		Repo:      repo,
+		UserRepo:  userRepo,
+		Login:     login,
+		Validator: validator.New(),
+		MsgStore:  msgStore,
+	}
+	for _, p := range providers {
+		h.Providers[p.Name()] = p
+		h.names = append(h.names, p.Name())
+	}
+	return h
+}
+
+// ListProviders returns the identity providers users can log in with
+func (h *Handler) ListProviders(w http.ResponseWriter, r *http.Request) {
+	providers := make([]ProviderInfo, 0, len(h.names))
+	for _, name := range h.names {
+		providers = append(providers, ProviderInfo{Name: name})
+	}
+	utils.JSON(w, http.StatusOK, providers)
+}
+
+// Authorize starts a login and returns the provider URL to send the user to
+func (h *Handler) Authorize(w http.ResponseWriter, r *http.Request) {
+	provider, ok := h.provider(w, r)
+	if !ok {
+		return
+	}
+
+	state, err := randomToken(32)
+	if err != nil {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.OIDCLoginFailed))
+		return
+	}
+	nonce, err := randomToken(32)
+	if err != nil {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.OIDCLoginFailed))
+		return
+	}
+	verifier, err := randomToken(32)
+	if err != nil {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.OIDCLoginFailed))
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(r.Context(), state, nonce, pkceChallenge(verifier))
+	if err != nil {
+		logger.Error("Failed to build authorization URL", zap.String("provider", provider.Name()), zap.Error(err))
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.OIDCLoginFailed))
+		return
+	}
+
+	if err := h.Repo.CreateLoginState(&LoginState{
+		StateHash:    auth.HashToken(state),
+		Provider:     provider.Name(),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(loginStateTTL),
+	}); err != nil {
+		logger.Error("Failed to store login state", zap.Error(err))
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.OIDCLoginFailed))
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, AuthorizationResponse{AuthorizationURL: authURL})
+}
+
+// Callback redeems the authorization code the provider redirected back with
+// and logs in the linked user, linking or provisioning one on first login
+func (h *Handler) Callback(w http.ResponseWriter, r *http.Request) {
+	provider, ok := h.provider(w, r)
+	if !ok {
+		return
+	}
+
+	var req CallbackRequest
+	if err := utils.ParseRequest(r, &req); err != nil {
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+	if err := h.Validator.Struct(req); err != nil {
+		utils.ValidationError(w, r, err, h.MsgStore)
+		return
+	}
+
+	state, err := h.Repo.ConsumeLoginState(provider.Name(), auth.HashToken(req.State))
+	if err != nil {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.OIDCInvalidState))
+		return
+	}
+
+	rawIDToken, err := provider.Exchange(r.Context(), req.Code, state.CodeVerifier)
+	if err != nil {
+		logger.Error("Failed to exchange authorization code", zap.String("provider", provider.Name()), zap.Error(err))
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.OIDCLoginFailed))
+		return
+	}
+
+	claims, err := provider.VerifyIDToken(r.Context(), rawIDToken, state.Nonce)
+	if err != nil {
+		logger.Error("Failed to verify ID token", zap.String("provider", provider.Name()), zap.Error(err))
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.OIDCLoginFailed))
+		return
+	}
+
+	userID, err := h.resolveUser(provider, claims)
+	if err != nil {
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+
+	h.Login.CompleteLogin(w, r, userID)
+}
+
+// resolveUser finds the user for the provider subject. An unknown subject is
+// linked to the user with the same verified address, or provisioned into the
+// provider's company when one is configured. The returned error carries a
+// language message key.
+func (h *Handler) resolveUser(provider *Provider, claims *IDTokenClaims) (int64, error) {
+	identity, err := h.Repo.GetIdentity(provider.Name(), claims.Subject)
+	if err == nil {
+		if err := h.Repo.TouchIdentity(identity); err != nil {
+			logger.Error("Failed to record identity login", zap.Error(err))
+		}
+		return identity.UserID, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		logger.Error("Failed to look up identity", zap.Error(err))
+		return 0, errors.New(language.AuthDatabaseError)
+	}
+
+	// Linking by address is only safe when the provider verified it
+	if claims.Email == "" || !claims.EmailVerified {
+		return 0, errors.New(language.OIDCEmailNotVerified)
+	}
+
+	identity = &Identity{
+		Provider:  provider.Name(),
+		Subject:   claims.Subject,
+		EmailHash: user.HashEmail(claims.Email),
+	}
+
+	u, err := h.UserRepo.GetUserByEmail(claims.Email)
+	if err == nil {
+		if u.IsServiceAccount {
+			return 0, errors.New(language.OIDCNoAccount)
+		}
+		identity.UserID = u.ID
+		if err := h.Repo.LinkIdentity(identity); err != nil {
+			logger.Error("Failed to link identity", zap.Error(err))
+			return 0, errors.New(language.OIDCProvisionFailed)
+		}
+		if !u.EmailVerifiedAt.Valid {
+			if err := h.UserRepo.MarkEmailVerified(u.ID); err != nil {
+				logger.Error("Failed to mark email verified", zap.Error(err))
+			}
+		}
+		logger.Info("Linked external identity", zap.String("provider", provider.Name()), zap.Int64("userID", u.ID))
+		return u.ID, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		logger.Error("Failed to look up user", zap.Error(err))
+		return 0, errors.New(language.AuthDatabaseError)
+	}
+
+	if provider.cfg.CompanyID == 0 {
+		return 0, errors.New(language.OIDCNoAccount)
+	}
+
+	userID, err := h.Repo.ProvisionUser(claims.Email, provider.cfg.CompanyID, provider.cfg.DefaultRole, identity)
+	if err != nil {
+		logger.Error("Failed to provision user", zap.String("provider", provider.Name()), zap.Error(err))
+		return 0, errors.New(language.OIDCProvisionFailed)
+	}
+	logger.Info("Provisioned user from external identity",
+		zap.String("provider", provider.Name()),
+		zap.Int64("userID", userID),
+		zap.Int64("companyID", provider.cfg.CompanyID))
+	return userID, nil
+}
+
+func (h *Handler) provider(w http.ResponseWriter, r *http.Request) (*Provider, bool) {
+	provider, ok := h.Providers[chi.URLParam(r, "provider")]
+	if !ok {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.OIDCProviderNotFound))
+		return nil, false
+	}
+	return provider, true
+}
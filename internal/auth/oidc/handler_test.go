@@ -0,0 +1,375 @@
+package oidc
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+
+	model "gobizmanager/internal/models"
+	"gobizmanager/internal/testutil"
+	"gobizmanager/internal/user"
+	"gobizmanager/pkg/language"
+	"gobizmanager/platform/config"
+)
+
+const (
+	testProvider = "idp"
+	testClientID = "gobizmanager"
+	testKeyID    = "idp-key"
+)
+
+// testIdP is a stand-in identity provider serving discovery, its key set and
+// the token endpoint. Codes are registered by the test in place of the
+// user's visit to the authorization endpoint.
+type testIdP struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]idpGrant
+}
+
+// idpGrant is what the provider remembers about an issued code
+type idpGrant struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	idp := &testIdP{key: key, codes: make(map[string]idpGrant)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", idp.discovery)
+	mux.HandleFunc("/jwks", idp.jwks)
+	mux.HandleFunc("/token", idp.token)
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func (idp *testIdP) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, discoveryDocument{
+		Issuer:                idp.server.URL,
+		AuthorizationEndpoint: idp.server.URL + "/authorize",
+		TokenEndpoint:         idp.server.URL + "/token",
+		JWKSURI:               idp.server.URL + "/jwks",
+	})
+}
+
+func (idp *testIdP) jwks(w http.ResponseWriter, r *http.Request) {
+	pub := idp.key.PublicKey
+	writeJSON(w, http.StatusOK, jsonWebKeySet{Keys: []jsonWebKey{{
+		KID: testKeyID,
+		Kty: "RSA",
+		Use: "sig",
+		N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}}})
+}
+
+// token redeems a code once, checking the PKCE verifier against the
+// challenge it was issued for
+func (idp *testIdP) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" || r.PostForm.Get("client_id") != testClientID {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	idp.mu.Lock()
+	grant, ok := idp.codes[r.PostForm.Get("code")]
+	delete(idp.codes, r.PostForm.Get("code"))
+	idp.mu.Unlock()
+	if !ok || pkceChallenge(r.PostForm.Get("code_verifier")) != grant.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, grant.claims)
+	token.Header["kid"] = testKeyID
+	idToken, err := token.SignedString(idp.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"id_token": idToken, "token_type": "Bearer"})
+}
+
+// issue registers a code for the authorization URL the handler sent the
+// user to, as the provider would once the user signs in
+func (idp *testIdP) issue(t *testing.T, authURL, subject, email string, verified bool) (code, state string) {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("parse authorization URL: %v", err)
+	}
+	params := u.Query()
+	if params.Get("code_challenge_method") != "S256" || params.Get("code_challenge") == "" {
+		t.Fatalf("authorization URL has no S256 PKCE challenge: %s", authURL)
+	}
+	if params.Get("client_id") != testClientID {
+		t.Fatalf("client_id = %q, want %q", params.Get("client_id"), testClientID)
+	}
+
+	code, err = randomToken(16)
+	if err != nil {
+		t.Fatalf("generate code: %v", err)
+	}
+	now := time.Now()
+	idp.mu.Lock()
+	idp.codes[code] = idpGrant{
+		challenge: params.Get("code_challenge"),
+		claims: jwt.MapClaims{
+			"iss":            idp.server.URL,
+			"aud":            testClientID,
+			"sub":            subject,
+			"email":          email,
+			"email_verified": verified,
+			"nonce":          params.Get("nonce"),
+			"iat":            now.Unix(),
+			"exp":            now.Add(time.Minute).Unix(),
+		},
+	}
+	idp.mu.Unlock()
+	return code, params.Get("state")
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// recordingLogin stands in for auth.Handler and remembers who logged in
+type recordingLogin struct {
+	userID int64
+}
+
+func (l *recordingLogin) CompleteLogin(w http.ResponseWriter, r *http.Request, userID int64) {
+	l.userID = userID
+	w.WriteHeader(http.StatusOK)
+}
+
+type testEnv struct {
+	db     *gorm.DB
+	idp    *testIdP
+	repo   *Repository
+	login  *recordingLogin
+	router http.Handler
+}
+
+// newTestEnv wires a handler to a fresh database and stand-in provider. The
+// provider provisions unknown users into companyID when it is set.
+func newTestEnv(t *testing.T, companyID int64, defaultRole string, db *gorm.DB) *testEnv {
+	t.Helper()
+	if db == nil {
+		db = testutil.NewDB(t)
+	}
+	cfg := testutil.Config()
+	idp := newTestIdP(t)
+	provider := NewProvider(config.OIDCProvider{
+		Name:        testProvider,
+		Issuer:      idp.server.URL,
+		ClientID:    testClientID,
+		RedirectURL: "http://localhost:5173/oidc/callback",
+		CompanyID:   companyID,
+		DefaultRole: defaultRole,
+	}, idp.server.Client())
+
+	repo := NewRepository(db, cfg)
+	login := &recordingLogin{}
+	handler := NewHandler([]*Provider{provider}, repo, user.NewRepository(db, cfg), login, language.NewMessageStore())
+	return &testEnv{db: db, idp: idp, repo: repo, login: login, router: Routes(handler)}
+}
+
+// authorize starts a login and returns the authorization URL
+func (env *testEnv) authorize(t *testing.T) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	env.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/"+testProvider+"/authorize", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("authorize: status %d: %s", rec.Code, rec.Body)
+	}
+	var res AuthorizationResponse
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatalf("decode authorize response: %v", err)
+	}
+	return res.AuthorizationURL
+}
+
+func (env *testEnv) callback(t *testing.T, code, state string) *httptest.ResponseRecorder {
+	t.Helper()
+	body, _ := json.Marshal(CallbackRequest{Code: code, State: state})
+	req := httptest.NewRequest(http.MethodPost, "/"+testProvider+"/callback", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	env.router.ServeHTTP(rec, req)
+	return rec
+}
+
+// signIn runs the whole flow for a user of the provider
+func (env *testEnv) signIn(t *testing.T, subject, email string, verified bool) *httptest.ResponseRecorder {
+	t.Helper()
+	code, state := env.idp.issue(t, env.authorize(t), subject, email, verified)
+	return env.callback(t, code, state)
+}
+
+func TestCallbackWithCodeAndPKCE(t *testing.T) {
+	env := newTestEnv(t, 0, "", nil)
+	userID := testutil.CreateUser(t, env.db, "linked@example.com")
+	if err := env.repo.LinkIdentity(&Identity{UserID: userID, Provider: testProvider, Subject: "sub-linked"}); err != nil {
+		t.Fatalf("link identity: %v", err)
+	}
+
+	rec := env.signIn(t, "sub-linked", "linked@example.com", true)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if env.login.userID != userID {
+		t.Errorf("logged in user %d, want %d", env.login.userID, userID)
+	}
+}
+
+func TestCallbackRejectsCodeForAnotherChallenge(t *testing.T) {
+	env := newTestEnv(t, 0, "", nil)
+	userID := testutil.CreateUser(t, env.db, "linked@example.com")
+	if err := env.repo.LinkIdentity(&Identity{UserID: userID, Provider: testProvider, Subject: "sub-linked"}); err != nil {
+		t.Fatalf("link identity: %v", err)
+	}
+
+	// The code was issued to another login, whose verifier this one lacks
+	code, _ := env.idp.issue(t, env.authorize(t), "sub-linked", "linked@example.com", true)
+	_, state := env.idp.issue(t, env.authorize(t), "sub-linked", "linked@example.com", true)
+
+	rec := env.callback(t, code, state)
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("status %d, want %d: %s", rec.Code, http.StatusBadGateway, rec.Body)
+	}
+	if env.login.userID != 0 {
+		t.Errorf("logged in user %d", env.login.userID)
+	}
+}
+
+func TestCallbackRejectsStateMismatch(t *testing.T) {
+	env := newTestEnv(t, 0, "", nil)
+	testutil.CreateUser(t, env.db, "user@example.com")
+
+	code, state := env.idp.issue(t, env.authorize(t), "sub-1", "user@example.com", true)
+	rec := env.callback(t, code, state+"x")
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body)
+	}
+	if env.login.userID != 0 {
+		t.Errorf("logged in user %d", env.login.userID)
+	}
+
+	// A state is only good for one callback
+	if rec := env.callback(t, code, state); rec.Code != http.StatusOK {
+		t.Fatalf("first use: status %d: %s", rec.Code, rec.Body)
+	}
+	if rec := env.callback(t, code, state); rec.Code != http.StatusBadRequest {
+		t.Fatalf("replay: status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestCallbackLinksVerifiedEmail(t *testing.T) {
+	env := newTestEnv(t, 0, "", nil)
+	userID := testutil.CreateUser(t, env.db, "existing@example.com")
+
+	rec := env.signIn(t, "sub-new", "existing@example.com", true)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if env.login.userID != userID {
+		t.Errorf("logged in user %d, want %d", env.login.userID, userID)
+	}
+
+	identity, err := env.repo.GetIdentity(testProvider, "sub-new")
+	if err != nil {
+		t.Fatalf("identity not linked: %v", err)
+	}
+	if identity.UserID != userID {
+		t.Errorf("identity linked to user %d, want %d", identity.UserID, userID)
+	}
+}
+
+func TestCallbackRejectsUnverifiedEmail(t *testing.T) {
+	env := newTestEnv(t, 0, "", nil)
+	testutil.CreateUser(t, env.db, "existing@example.com")
+
+	rec := env.signIn(t, "sub-new", "existing@example.com", false)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("status %d, want %d: %s", rec.Code, http.StatusForbidden, rec.Body)
+	}
+	if env.login.userID != 0 {
+		t.Errorf("logged in user %d", env.login.userID)
+	}
+	if _, err := env.repo.GetIdentity(testProvider, "sub-new"); err == nil {
+		t.Error("unverified address was linked")
+	}
+}
+
+func TestCallbackProvisionsUser(t *testing.T) {
+	db := testutil.NewDB(t)
+	companyID := testutil.CreateCompany(t, db, "Acme")
+	roleID := testutil.CreateRole(t, db, companyID, "MEMBER")
+	env := newTestEnv(t, companyID, "MEMBER", db)
+
+	rec := env.signIn(t, "sub-jit", "new@example.com", true)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+
+	u, err := user.NewRepository(db, testutil.Config()).GetUserByEmail("new@example.com")
+	if err != nil {
+		t.Fatalf("user not provisioned: %v", err)
+	}
+	if env.login.userID != u.ID {
+		t.Errorf("logged in user %d, want %d", env.login.userID, u.ID)
+	}
+	if !u.EmailVerifiedAt.Valid {
+		t.Error("provisioned address is not marked verified")
+	}
+
+	var roles int64
+	if err := db.Model(&model.UserRole{}).
+		Joins("JOIN company_users ON user_roles.company_user_id = company_users.id").
+		Where("company_users.company_id = ? AND user_roles.user_id = ? AND user_roles.role_id = ?", companyID, u.ID, roleID).
+		Count(&roles).Error; err != nil {
+		t.Fatalf("count roles: %v", err)
+	}
+	if roles != 1 {
+		t.Errorf("provisioned user holds the default role %d times, want 1", roles)
+	}
+
+	// The next login goes through the linked identity
+	env.login.userID = 0
+	if rec := env.signIn(t, "sub-jit", "new@example.com", true); rec.Code != http.StatusOK || env.login.userID != u.ID {
+		t.Errorf("second login: status %d, user %d", rec.Code, env.login.userID)
+	}
+}
+
+func TestCallbackWithoutAccountOrCompany(t *testing.T) {
+	env := newTestEnv(t, 0, "", nil)
+
+	rec := env.signIn(t, "sub-unknown", "nobody@example.com", true)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("status %d, want %d: %s", rec.Code, http.StatusForbidden, rec.Body)
+	}
+}
@@ -0,0 +1,53 @@
+package oidc
+
+import (
+	"database/sql"
+	"time"
+)
+
+// LoginState remembers an authorization request between the redirect to the
+// identity provider and the callback. Only the hash of the state is stored and
+// the PKCE verifier is encrypted at rest.
+type LoginState struct {
+	StateHash    string `gorm:"primaryKey"`
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	ExpiresAt    time.Time
+	CreatedAt    time.Time
+}
+
+func (LoginState) TableName() string {
+	return "oidc_login_states"
+}
+
+// Identity links a subject at an external identity provider to a user
+type Identity struct {
+	ID          int64        `json:"id"`
+	UserID      int64        `json:"user_id"`
+	Provider    string       `json:"provider"`
+	Subject     string       `json:"subject"`
+	EmailHash   string       `json:"-"`
+	LastLoginAt sql.NullTime `json:"last_login_at"`
+	CreatedAt   time.Time    `json:"created_at"`
+}
+
+func (Identity) TableName() string {
+	return "user_identities"
+}
+
+// CallbackRequest carries the parameters the identity provider redirected back with
+type CallbackRequest struct {
+	Code  string `json:"code" validate:"required" msg:"auth.field_required"`
+	State string `json:"state" validate:"required" msg:"auth.field_required"`
+}
+
+// AuthorizationResponse tells the client where to send the user to log in
+type AuthorizationResponse struct {
+	AuthorizationURL string `json:"authorization_url"`
+}
+
+// ProviderInfo describes a configured provider to clients
+type ProviderInfo struct {
+	Name string `json:"name"`
+}
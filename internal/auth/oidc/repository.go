@@ -0,0 +1,167 @@
+package oidc
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	model "gobizmanager/internal/models"
+	"gobizmanager/internal/rbac"
+	userpkg "gobizmanager/internal/user"
+	"gobizmanager/pkg/encryption"
+	"gobizmanager/platform/config"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidState = errors.New("invalid or expired login state")
+	ErrRoleNotFound = errors.New("default role not found in company")
+)
+
+type Repository struct {
+	db  *gorm.DB
+	cfg *config.Config
+}
+
+func NewRepository(db *gorm.DB, cfg *config.Config) *Repository {
+	return &Repository{db: db, cfg: cfg}
+}
+
+// CreateLoginState stores the state of a new login and clears expired ones
+func (r *Repository) CreateLoginState(state *LoginState) error {
+	now := time.Now()
+	if err := r.db.Where("expires_at < ?", now).Delete(&LoginState{}).Error; err != nil {
+		return err
+	}
+
+	verifier, err := encryption.Encrypt(state.CodeVerifier, r.cfg.EncryptionKey)
+	if err != nil {
+		return err
+	}
+	row := *state
+	row.CodeVerifier = verifier
+	row.CreatedAt = now
+	return r.db.Create(&row).Error
+}
+
+// ConsumeLoginState removes and returns the login state for the provider.
+// ErrInvalidState is returned when it is unknown, expired or already used.
+func (r *Repository) ConsumeLoginState(provider, stateHash string) (*LoginState, error) {
+	var state LoginState
+	if err := r.db.Where("state_hash = ? AND provider = ?", stateHash, provider).First(&state).Error; err != nil {
+		return nil, ErrInvalidState
+	}
+
+	res := r.db.Where("state_hash = ?", stateHash).Delete(&LoginState{})
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 || time.Now().After(state.ExpiresAt) {
+		return nil, ErrInvalidState
+	}
+
+	verifier, err := encryption.Decrypt(state.CodeVerifier, r.cfg.EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	state.CodeVerifier = verifier
+	return &state, nil
+}
+
+// GetIdentity returns the identity linked to a provider subject
+func (r *Repository) GetIdentity(provider, subject string) (*Identity, error) {
+	var identity Identity
+	if err := r.db.Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error; err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// LinkIdentity links a provider subject to an existing user
+func (r *Repository) LinkIdentity(identity *Identity) error {
+	now := time.Now()
+	identity.CreatedAt = now
+	identity.LastLoginAt.Time = now
+	identity.LastLoginAt.Valid = true
+	return r.db.Create(identity).Error
+}
+
+func (r *Repository) TouchIdentity(identity *Identity) error {
+	return r.db.Model(identity).Update("last_login_at", time.Now()).Error
+}
+
+// ProvisionUser creates a user for a first-time login and adds it to the
+// company with the named role, linking the identity in the same transaction.
+// The address is marked verified since the provider vouched for it.
+func (r *Repository) ProvisionUser(email string, companyID int64, roleName string, identity *Identity) (int64, error) {
+	secret, err := randomToken(32)
+	if err != nil {
+		return 0, err
+	}
+	hashedPassword, err := encryption.HashPassword(secret)
+	if err != nil {
+		return 0, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	tx := r.db.Begin()
+	if tx.Error != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", tx.Error)
+	}
+	defer tx.Rollback()
+
+	var role model.Role
+	if err := tx.Where("company_id = ? AND name = ?", companyID, roleName).First(&role).Error; err != nil {
+		return 0, ErrRoleNotFound
+	}
+
+	now := time.Now()
+	user := &model.User{
+		Email:    email,
+		Password: hashedPassword,
+	}
+	if err := user.EncryptSensitiveFields(r.cfg.EncryptionKey); err != nil {
+		return 0, err
+	}
+	user.EmailHash = userpkg.HashEmail(email)
+	user.EmailVerifiedAt.Time = now
+	user.EmailVerifiedAt.Valid = true
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	if err := tx.Create(user).Error; err != nil {
+		return 0, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	companyUser := &rbac.CompanyUser{
+		CompanyID: companyID,
+		UserID:    user.ID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := tx.Create(companyUser).Error; err != nil {
+		return 0, fmt.Errorf("failed to add user to company: %w", err)
+	}
+
+	if err := tx.Create(&model.UserRole{
+		UserID:        user.ID,
+		CompanyUserID: companyUser.ID,
+		RoleID:        role.ID,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}).Error; err != nil {
+		return 0, fmt.Errorf("failed to assign default role: %w", err)
+	}
+
+	identity.UserID = user.ID
+	identity.CreatedAt = now
+	identity.LastLoginAt.Time = now
+	identity.LastLoginAt.Valid = true
+	if err := tx.Create(identity).Error; err != nil {
+		return 0, fmt.Errorf("failed to link identity: %w", err)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return user.ID, nil
+}
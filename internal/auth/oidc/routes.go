@@ -0,0 +1,18 @@
+package oidc
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Routes returns the external login routes, mounted under /auth/oidc
+func Routes(handler *Handler) http.Handler {
+	r := chi.NewRouter()
+
+	r.Get("/providers", handler.ListProviders)
+	r.Get("/{provider}/authorize", handler.Authorize)
+	r.Post("/{provider}/callback", handler.Callback)
+
+	return r
+}
@@ -0,0 +1,316 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	model "gobizmanager/internal/models"
+)
+
+var (
+	ErrRefreshTokenReused = errors.New("refresh token already used")
+	ErrTokenAlreadyUsed   = errors.New("token already used")
+
+	errNoSigningKey = errors.New("no active signing key")
+)
+
+// sessionTouchInterval limits how often last_used_at is written for a session
+const sessionTouchInterval = time.Minute
+
+type Repository struct {
+	db *gorm.DB
+}
+
+func NewRepository(db *gorm.DB) *Repository {
+	return &Repository{db: db}
+}
+
+// HashToken returns the hex encoded SHA-256 hash used to store tokens
+func HashToken(token string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(token)))
+}
+
+func (r *Repository) CreateRefreshToken(token *RefreshToken) error {
+	now := time.Now()
+	token.CreatedAt = now
+	token.UpdatedAt = now
+	return r.db.Create(token).Error
+}
+
+func (r *Repository) GetRefreshTokenByHash(tokenHash string) (*RefreshToken, error) {
+	var token RefreshToken
+	if err := r.db.Where("token_hash = ?", tokenHash).First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// RotateRefreshToken revokes the current token and stores its successor in a
+// single transaction. ErrRefreshTokenReused is returned when the current token
+// was revoked concurrently.
+func (r *Repository) RotateRefreshToken(currentID int64, next *RefreshToken) error {
+	tx := r.db.Begin()
+	if tx.Error != nil {
+		return fmt.Errorf("failed to begin transaction: %w", tx.Error)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	res := tx.Model(&RefreshToken{}).
+		Where("id = ? AND revoked_at IS NULL", currentID).
+		Updates(map[string]interface{}{"revoked_at": now, "updated_at": now})
+	if res.Error != nil {
+		return fmt.Errorf("failed to revoke refresh token: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrRefreshTokenReused
+	}
+
+	next.CreatedAt = now
+	next.UpdatedAt = now
+	if err := tx.Create(next).Error; err != nil {
+		return fmt.Errorf("failed to create refresh token: %w", err)
+	}
+
+	if err := tx.Model(&Session{}).
+		Where("family_id = ?", next.FamilyID).
+		Updates(map[string]interface{}{"expires_at": next.ExpiresAt, "last_used_at": now, "updated_at": now}).Error; err != nil {
+		return fmt.Errorf("failed to extend session: %w", err)
+	}
+
+	return tx.Commit().Error
+}
+
+// ReissueRefreshToken revokes the active tokens of the family and stores next
+// in their place, keeping the session. Used when a session changes scope.
+func (r *Repository) ReissueRefreshToken(next *RefreshToken) error {
+	tx := r.db.Begin()
+	if tx.Error != nil {
+		return fmt.Errorf("failed to begin transaction: %w", tx.Error)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if err := tx.Model(&RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", next.FamilyID).
+		Updates(map[string]interface{}{"revoked_at": now, "updated_at": now}).Error; err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+
+	next.CreatedAt = now
+	next.UpdatedAt = now
+	if err := tx.Create(next).Error; err != nil {
+		return fmt.Errorf("failed to create refresh token: %w", err)
+	}
+
+	return tx.Commit().Error
+}
+
+// RevokeRefreshTokenFamily revokes every active token sharing the family ID
+// together with the session the family belongs to
+func (r *Repository) RevokeRefreshTokenFamily(familyID string) error {
+	tx := r.db.Begin()
+	if tx.Error != nil {
+		return fmt.Errorf("failed to begin transaction: %w", tx.Error)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if err := tx.Model(&RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Updates(map[string]interface{}{"revoked_at": now, "updated_at": now}).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Model(&Session{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Updates(map[string]interface{}{"revoked_at": now, "updated_at": now}).Error; err != nil {
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// RevokeUserRefreshTokens revokes every active token and session of the user
+func (r *Repository) RevokeUserRefreshTokens(userID int64) error {
+	tx := r.db.Begin()
+	if tx.Error != nil {
+		return fmt.Errorf("failed to begin transaction: %w", tx.Error)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if err := tx.Model(&RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Updates(map[string]interface{}{"revoked_at": now, "updated_at": now}).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Model(&Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Updates(map[string]interface{}{"revoked_at": now, "updated_at": now}).Error; err != nil {
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// Session operations
+func (r *Repository) CreateSession(session *Session) error {
+	now := time.Now()
+	session.LastUsedAt = now
+	session.CreatedAt = now
+	session.UpdatedAt = now
+	return r.db.Create(session).Error
+}
+
+// GetTokenVersion returns the token version tokens of the user must carry
+func (r *Repository) GetTokenVersion(userID int64) (int64, error) {
+	var version int64
+	err := r.db.Model(&model.User{}).Where("id = ?", userID).Select("token_version").Scan(&version).Error
+	return version, err
+}
+
+// IsCompanyMember reports whether the user belongs to the company
+func (r *Repository) IsCompanyMember(companyID, userID int64) (bool, error) {
+	var count int64
+	err := r.db.Table("company_users").Where("company_id = ? AND user_id = ?", companyID, userID).Count(&count).Error
+	return count > 0, err
+}
+
+func (r *Repository) GetSessionByID(id int64) (*Session, error) {
+	var session Session
+	if err := r.db.First(&session, id).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *Repository) GetSessionByFamily(familyID string) (*Session, error) {
+	var session Session
+	if err := r.db.Where("family_id = ?", familyID).First(&session).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// ListActiveSessions returns the sessions of a user that are neither revoked nor expired
+func (r *Repository) ListActiveSessions(userID int64) ([]Session, error) {
+	var sessions []Session
+	if err := r.db.
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_used_at DESC").
+		Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// TouchSession records activity on a session, writing at most once per sessionTouchInterval
+func (r *Repository) TouchSession(session *Session, ipAddress string) error {
+	now := time.Now()
+	if now.Sub(session.LastUsedAt) < sessionTouchInterval {
+		return nil
+	}
+	return r.db.Model(&Session{}).
+		Where("id = ?", session.ID).
+		Updates(map[string]interface{}{"last_used_at": now, "ip_address": ipAddress, "updated_at": now}).Error
+}
+
+// RevokeSession ends a session and every refresh token issued for it
+func (r *Repository) RevokeSession(session *Session) error {
+	return r.RevokeRefreshTokenFamily(session.FamilyID)
+}
+
+// ConsumeToken marks a single-use token as redeemed. ErrTokenAlreadyUsed is
+// returned when the token ID was recorded before.
+func (r *Repository) ConsumeToken(jti string, userID int64, purpose string, expiresAt time.Time) error {
+	return consumeToken(r.db, jti, userID, purpose, expiresAt)
+}
+
+func consumeToken(db *gorm.DB, jti string, userID int64, purpose string, expiresAt time.Time) error {
+	res := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&UsedToken{
+		JTI:       jti,
+		UserID:    userID,
+		Purpose:   purpose,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrTokenAlreadyUsed
+	}
+	return nil
+}
+
+// Signing key operations
+
+// GetActiveSigningKey returns the newest key that has not been retired
+func (r *Repository) GetActiveSigningKey() (*SigningKey, error) {
+	var key SigningKey
+	err := r.db.Where("retired_at IS NULL").Order("created_at DESC, id DESC").First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errNoSigningKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// FirstSigningKeyCreatedAt returns when the oldest signing key was created,
+// which is when tokens stopped being signed with the shared secret
+func (r *Repository) FirstSigningKeyCreatedAt() (time.Time, error) {
+	var key SigningKey
+	err := r.db.Order("created_at, id").First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return time.Time{}, errNoSigningKey
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return key.CreatedAt, nil
+}
+
+// ListVerificationKeys returns the keys that tokens may still be signed with,
+// newest first
+func (r *Repository) ListVerificationKeys() ([]SigningKey, error) {
+	var keys []SigningKey
+	if err := r.db.
+		Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		Order("created_at DESC, id DESC").
+		Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// RotateSigningKey retires the active keys and stores their successor in a
+// single transaction. Retired keys verify until expiresAt.
+func (r *Repository) RotateSigningKey(next *SigningKey, retiredAt, expiresAt time.Time) error {
+	tx := r.db.Begin()
+	if tx.Error != nil {
+		return fmt.Errorf("failed to begin transaction: %w", tx.Error)
+	}
+	defer tx.Rollback()
+
+	if err := tx.Model(&SigningKey{}).
+		Where("retired_at IS NULL").
+		Updates(map[string]interface{}{"retired_at": retiredAt, "expires_at": expiresAt}).Error; err != nil {
+		return fmt.Errorf("failed to retire signing keys: %w", err)
+	}
+
+	next.CreatedAt = retiredAt
+	if err := tx.Create(next).Error; err != nil {
+		return fmt.Errorf("failed to create signing key: %w", err)
+	}
+
+	return tx.Commit().Error
+}
@@ -5,6 +5,7 @@ import (
 
 	"gobizmanager/pkg/context"
 	"gobizmanager/pkg/language"
+	"gobizmanager/platform/middleware/permission"
 	"gobizmanager/platform/middleware/ratelimit"
 
 	"github.com/go-chi/chi/v5"
@@ -18,9 +19,46 @@ func Routes(handler *Handler, msgStore *language.MessageStore) http.Handler {
 
 	// Apply rate limiting middleware to login route
 	r.With(ratelimit.New(10)).Post("/login", handler.Login)
+	r.With(ratelimit.New(10)).Post("/setup", handler.Setup)
 
 	r.Post("/register", handler.Register)
 	r.Post("/refresh", handler.RefreshToken)
+	r.Post("/logout", handler.Logout)
+	r.Post("/mfa/verify", handler.VerifyMFA)
+	r.Post("/password/forgot", handler.ForgotPassword)
+	r.Post("/password/reset", handler.ResetPassword)
+	r.Post("/verify-email", handler.VerifyEmail)
+	r.Post("/unlock-account", handler.UnlockAccount)
+	r.Post("/email/confirm", handler.ConfirmEmailChange)
+
+	// Enrolment accepts either a bearer token or a login enrollment challenge
+	r.Group(func(r chi.Router) {
+		r.Use(OptionalMiddleware(handler.JWTManager, handler.TokenRepo, msgStore))
+		r.Use(RejectImpersonation(msgStore))
+		r.Post("/mfa/enroll", handler.EnrollMFA)
+		r.Post("/mfa/confirm", handler.ConfirmMFA)
+	})
+
+	return r
+}
+
+// SessionRoutes returns the routes for managing the caller's own sessions
+func SessionRoutes(handler *SessionHandler, guard permission.Guard) http.Handler {
+	r := chi.NewRouter()
+
+	r.With(guard.RequireAuthentication()).Get("/", handler.ListSessions)
+	r.With(guard.RequireAuthentication()).Delete("/{sessionID}", handler.RevokeSession)
+
+	return r
+}
+
+// APIKeyRoutes returns the routes for managing the caller's API keys
+func APIKeyRoutes(handler *APIKeyHandler, guard permission.Guard) http.Handler {
+	r := chi.NewRouter()
+
+	r.With(guard.RequireAuthentication()).Post("/", handler.CreateAPIKey)
+	r.With(guard.RequireAuthentication()).Get("/", handler.ListAPIKeys)
+	r.With(guard.RequireAuthentication()).Delete("/{keyID}", handler.RevokeAPIKey)
 
 	return r
 }
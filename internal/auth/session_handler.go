@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	appcontext "gobizmanager/pkg/context"
+	"gobizmanager/pkg/language"
+	"gobizmanager/pkg/logger"
+	"gobizmanager/pkg/utils"
+)
+
+// SessionHandler lets users list and end their own sessions
+type SessionHandler struct {
+	TokenRepo *Repository
+	MsgStore  *language.MessageStore
+}
+
+func NewSessionHandler(tokenRepo *Repository, msgStore *language.MessageStore) *SessionHandler {
+	return &SessionHandler{
+		TokenRepo: tokenRepo,
+		MsgStore:  msgStore,
+	}
+}
+
+// ListSessions returns the active sessions of the authenticated user
+func (h *SessionHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserID(r.Context())
+	if !ok {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthUnauthorized))
+		return
+	}
+
+	sessions, err := h.TokenRepo.ListActiveSessions(userID)
+	if err != nil {
+		logger.Error("Failed to list sessions", zap.Error(err))
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.SessionListFailed))
+		return
+	}
+
+	currentID, _ := GetSessionID(r.Context())
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentID
+	}
+
+	utils.JSON(w, http.StatusOK, sessions)
+}
+
+// RevokeSession ends one of the authenticated user's sessions
+func (h *SessionHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserID(r.Context())
+	if !ok {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthUnauthorized))
+		return
+	}
+
+	sessionID, err := strconv.ParseInt(chi.URLParam(r, "sessionID"), 10, 64)
+	if err != nil {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.ValidationInvalidID))
+		return
+	}
+
+	if err := RevokeUserSession(h.TokenRepo, userID, sessionID); err != nil {
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+
+	msg, httpStatus := h.MsgStore.GetMessage(appcontext.GetLanguage(r.Context()), language.SessionRevoked)
+	utils.JSON(w, httpStatus, msg)
+}
+
+// RevokeUserSession revokes a session after checking it belongs to the user.
+// The returned error carries a language message key.
+func RevokeUserSession(tokenRepo *Repository, userID, sessionID int64) error {
+	session, err := tokenRepo.GetSessionByID(sessionID)
+	if err != nil || session.UserID != userID || session.RevokedAt.Valid {
+		return errors.New(language.SessionNotFound)
+	}
+
+	if err := tokenRepo.RevokeSession(session); err != nil {
+		logger.Error("Failed to revoke session", zap.Error(err))
+		return errors.New(language.SessionRevokeFailed)
+	}
+	return nil
+}
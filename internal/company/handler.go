@@ -8,8 +8,10 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-playground/validator/v10"
 
+	model "gobizmanager/internal/models"
 	"gobizmanager/internal/rbac"
 	"gobizmanager/internal/user"
+	pkgctx "gobizmanager/pkg/context"
 	"gobizmanager/pkg/language"
 	"gobizmanager/pkg/logger"
 	"gobizmanager/pkg/shared"
@@ -18,17 +20,19 @@ import (
 
 type Handler struct {
 	shared.BaseHandler
-	repo      *Repository
-	rbacRepo  *rbac.Repository
-	userRepo  *user.Repository
-	Validator *validator.Validate
+	repo       *Repository
+	rbacRepo   *rbac.Repository
+	authorizer *rbac.Authorizer
+	userRepo   *user.Repository
+	Validator  *validator.Validate
 }
 
-func NewHandler(repo *Repository, rbacRepo *rbac.Repository, userRepo *user.Repository, msgStore *language.MessageStore) *Handler {
+func NewHandler(repo *Repository, rbacRepo *rbac.Repository, authorizer *rbac.Authorizer, userRepo *user.Repository, msgStore *language.MessageStore) *Handler {
 	return &Handler{
 		BaseHandler: shared.BaseHandler{MsgStore: msgStore},
 		repo:        repo,
 		rbacRepo:    rbacRepo,
+		authorizer:  authorizer,
 		userRepo:    userRepo,
 		Validator:   validator.New(),
 	}
@@ -162,10 +166,107 @@ func (h *Handler) DeleteCompany(w http.ResponseWriter, r *http.Request) {
 		h.RespondError(w, r, errors.New(language.CompanyDeleteFailed))
 		return
 	}
+	h.authorizer.InvalidateCompany(companyIDInt)
 
 	utils.JSON(w, http.StatusNoContent, nil)
 }
 
+// UpdateMFAPolicy sets whether company administrators must use MFA
+func (h *Handler) UpdateMFAPolicy(w http.ResponseWriter, r *http.Request) {
+	companyID, ok := h.companyID(w, r)
+	if !ok {
+		return
+	}
+
+	var req UpdateMFAPolicyRequest
+	if err := utils.ParseRequest(r, &req); err != nil {
+		h.RespondError(w, r, err)
+		return
+	}
+
+	if err := h.Validator.Struct(req); err != nil {
+		utils.ValidationError(w, r, err, h.MsgStore)
+		return
+	}
+
+	if err := h.repo.UpdateMFAPolicy(companyID, *req.RequireAdminMFA); err != nil {
+		logger.Error(err.Error())
+		h.RespondError(w, r, errors.New(language.CompanyUpdateFailed))
+		return
+	}
+
+	msg, httpStatus := h.MsgStore.GetMessage(pkgctx.GetLanguage(r.Context()), language.CompanyMFAPolicyUpdated)
+	utils.JSON(w, httpStatus, msg)
+}
+
+// GetPasswordPolicy returns the password rules for company members
+func (h *Handler) GetPasswordPolicy(w http.ResponseWriter, r *http.Request) {
+	companyID, ok := h.companyID(w, r)
+	if !ok {
+		return
+	}
+
+	policy, err := h.repo.GetPasswordPolicy(companyID)
+	if err != nil {
+		logger.Error(err.Error())
+		h.RespondError(w, r, errors.New(language.CompanyGetFailed))
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, policy)
+}
+
+// UpdatePasswordPolicy sets the password rules for company members. They
+// apply the next time a member sets a password, except the maximum age which
+// applies at login.
+func (h *Handler) UpdatePasswordPolicy(w http.ResponseWriter, r *http.Request) {
+	companyID, ok := h.companyID(w, r)
+	if !ok {
+		return
+	}
+
+	var req UpdatePasswordPolicyRequest
+	if err := utils.ParseRequest(r, &req); err != nil {
+		h.RespondError(w, r, err)
+		return
+	}
+
+	if err := h.Validator.Struct(req); err != nil {
+		utils.ValidationError(w, r, err, h.MsgStore)
+		return
+	}
+
+	err := h.repo.UpdatePasswordPolicy(&model.PasswordPolicy{
+		CompanyID:     companyID,
+		MinLength:     req.MinLength,
+		RequireUpper:  req.RequireUpper,
+		RequireLower:  req.RequireLower,
+		RequireDigit:  req.RequireDigit,
+		RequireSymbol: req.RequireSymbol,
+		HistorySize:   req.HistorySize,
+		MaxAgeDays:    req.MaxAgeDays,
+	})
+	if err != nil {
+		logger.Error(err.Error())
+		h.RespondError(w, r, errors.New(language.CompanyUpdateFailed))
+		return
+	}
+
+	msg, httpStatus := h.MsgStore.GetMessage(pkgctx.GetLanguage(r.Context()), language.PasswordPolicyUpdated)
+	utils.JSON(w, httpStatus, msg)
+}
+
+// companyID returns the company from the URL, which the route's permission
+// requirement was checked against
+func (h *Handler) companyID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	companyID, err := strconv.ParseInt(chi.URLParam(r, "companyID"), 10, 64)
+	if err != nil {
+		h.RespondError(w, r, errors.New(language.CompanyNotFound))
+		return 0, false
+	}
+	return companyID, true
+}
+
 func (h *Handler) UpdateCompanyLogo(w http.ResponseWriter, r *http.Request) {
 	//TODO: Implement
 }
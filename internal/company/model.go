@@ -16,8 +16,10 @@ type Company struct {
 	Address    string         `json:"address" encrypted:"true"`
 	Identifier string         `json:"identifier"`
 	Logo       sql.NullString `json:"logo"`
-	CreatedAt  time.Time      `json:"created_at"`
-	UpdatedAt  time.Time      `json:"updated_at"`
+	// RequireAdminMFA forces members holding the ADMIN role to use MFA
+	RequireAdminMFA bool      `json:"require_admin_mfa"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
 }
 
 // EncryptSensitiveFields encrypts sensitive fields using the provided key
@@ -4,13 +4,16 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 
 	model "gobizmanager/internal/models"
 	"gobizmanager/internal/rbac"
 	"gobizmanager/pkg/language"
+	"gobizmanager/pkg/passwordpolicy"
 	"gobizmanager/platform/config"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Repository struct {
@@ -86,20 +89,36 @@ func (r *Repository) CreateCompany(req *CreateCompanyRequest, userID int64) (*Co
 		return nil, fmt.Errorf("failed to get permissions: %w", err)
 	}
 
-	// Assign all permissions to ADMIN role
+	// Copy the generic permissions into the company and assign them to the ADMIN role
 	for _, permission := range permissions {
-		rolePermission := &model.Permission{
+		companyPermission := &model.Permission{
 			CompanyID:   company.ID,
 			Name:        permission.Name,
 			Description: permission.Description,
 		}
-		if err := tx.Create(rolePermission).Error; err != nil {
+		if err := tx.Create(companyPermission).Error; err != nil {
 			tx.Rollback()
 			return nil, fmt.Errorf("failed to assign permission to ADMIN role: %w", err)
 		}
+
+		if err := tx.Create(&rbac.RolePermission{
+			RoleID:       adminRole.ID,
+			PermissionID: companyPermission.ID,
+		}).Error; err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("failed to assign permission to ADMIN role: %w", err)
+		}
+
+		if err := tx.Exec(`INSERT INTO permission_module_actions (permission_id, module_action_id, created_at, updated_at)
+			SELECT ?, module_action_id, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP
+			FROM permission_module_actions WHERE permission_id = ?`, companyPermission.ID, permission.ID).Error; err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("failed to copy permission module actions: %w", err)
+		}
 	}
 	// Assign ADMIN role to user
 	userRole := &model.UserRole{
+		UserID:        userID,
 		CompanyUserID: companyUser.ID,
 		RoleID:        adminRole.ID,
 	}
@@ -155,6 +174,29 @@ func (r *Repository) UpdateCompany(id int64, req *UpdateCompanyRequest) (*Compan
 	return r.GetCompany(id)
 }
 
+func (r *Repository) UpdateMFAPolicy(id int64, requireAdminMFA bool) error {
+	return r.db.Model(&Company{}).Where("id = ?", id).Update("require_admin_mfa", requireAdminMFA).Error
+}
+
+// GetPasswordPolicy returns the company's password policy, or the default
+// policy when it has not set one
+func (r *Repository) GetPasswordPolicy(id int64) (*model.PasswordPolicy, error) {
+	policy := &model.PasswordPolicy{}
+	err := r.db.Where("company_id = ?", id).First(policy).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &model.PasswordPolicy{CompanyID: id, MinLength: passwordpolicy.DefaultMinLength}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+func (r *Repository) UpdatePasswordPolicy(policy *model.PasswordPolicy) error {
+	policy.UpdatedAt = time.Now()
+	return r.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(policy).Error
+}
+
 func (r *Repository) UpdateCompanyLogo(id string, logo string) error {
 	return r.db.Model(&Company{}).Where("id = ?", id).Update("logo", logo).Error
 }
@@ -1,7 +1,9 @@
 package company
 
 import (
+	"gobizmanager/internal/rbac"
 	"gobizmanager/pkg/language"
+	"gobizmanager/platform/middleware/permission"
 	"gobizmanager/platform/middleware/ratelimit"
 
 	"net/http"
@@ -9,17 +11,23 @@ import (
 	"github.com/go-chi/chi/v5"
 )
 
-func Routes(handler *Handler, msgStore *language.MessageStore) http.Handler {
+func Routes(handler *Handler, guard permission.Guard, msgStore *language.MessageStore) http.Handler {
 	r := chi.NewRouter()
 
 	// Apply rate limiting middleware to all company routes
 	r.Group(func(r chi.Router) {
 		r.Use(ratelimit.New(100))
-		r.Post("/", handler.CreateCompany)
-		r.Get("/", handler.ListCompanies)
-		r.Get("/{id}", handler.GetCompany)
-		r.Put("/{id}", handler.UpdateCompany)
-		r.Delete("/{id}", handler.DeleteCompany)
+
+		// Any user may create a company and list the ones they belong to
+		r.With(guard.RequireAuthentication()).Post("/", handler.CreateCompany)
+		r.With(guard.RequireAuthentication()).Get("/", handler.ListCompanies)
+
+		r.With(guard.RequirePermission(rbac.ModuleCompany, rbac.ActionRead)).Get("/{companyID}", handler.GetCompany)
+		r.With(guard.RequirePermission(rbac.ModuleCompany, rbac.ActionUpdate)).Put("/{companyID}", handler.UpdateCompany)
+		r.With(guard.RequirePermission(rbac.ModuleCompany, rbac.ActionDelete)).Delete("/{companyID}", handler.DeleteCompany)
+		r.With(guard.RequirePermission(rbac.ModuleCompany, rbac.ActionUpdate)).Put("/{companyID}/mfa-policy", handler.UpdateMFAPolicy)
+		r.With(guard.RequirePermission(rbac.ModuleCompany, rbac.ActionRead)).Get("/{companyID}/password-policy", handler.GetPasswordPolicy)
+		r.With(guard.RequirePermission(rbac.ModuleCompany, rbac.ActionUpdate)).Put("/{companyID}/password-policy", handler.UpdatePasswordPolicy)
 	})
 
 	return r
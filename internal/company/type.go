@@ -20,6 +20,22 @@ type UpdateCompanyLogoRequest struct {
 	Logo string `json:"logo" validate:"required" msg:"company.logo_required"`
 }
 
+type UpdateMFAPolicyRequest struct {
+	RequireAdminMFA *bool `json:"require_admin_mfa" validate:"required" msg:"auth.field_required"`
+}
+
+// UpdatePasswordPolicyRequest sets the password rules for company members.
+// Zero values disable a rule.
+type UpdatePasswordPolicyRequest struct {
+	MinLength     int  `json:"min_length" validate:"min=8,max=128" msg:"validation.failed"`
+	RequireUpper  bool `json:"require_upper"`
+	RequireLower  bool `json:"require_lower"`
+	RequireDigit  bool `json:"require_digit"`
+	RequireSymbol bool `json:"require_symbol"`
+	HistorySize   int  `json:"history_size" validate:"min=0,max=24" msg:"validation.failed"`
+	MaxAgeDays    int  `json:"max_age_days" validate:"min=0,max=3650" msg:"validation.failed"`
+}
+
 type CompanyResponse struct {
 	CompanyID  int64
 	Name       string
@@ -5,36 +5,42 @@ import (
 	"net/http"
 	"strconv"
 
-	"gobizmanager/internal/company"
+	"gobizmanager/internal/auth"
 	"gobizmanager/internal/rbac"
+	pkgctx "gobizmanager/pkg/context"
 	"gobizmanager/pkg/language"
 	"gobizmanager/pkg/logger"
+	"gobizmanager/pkg/passwordpolicy"
 	"gobizmanager/pkg/shared"
 	"gobizmanager/pkg/utils"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-playground/validator/v10"
+	"go.uber.org/zap"
 )
 
 type Handler struct {
 	shared.BaseHandler
-	repo        *Repository
-	companyRepo *company.Repository
-	rbacRepo    *rbac.Repository
-	validator   *validator.Validate
+	repo       *Repository
+	rbacRepo   *rbac.Repository
+	authorizer *rbac.Authorizer
+	tokenRepo  *auth.Repository
+	validator  *validator.Validate
 }
 
-func NewHandler(repo *Repository, rbacRepo *rbac.Repository, msgStore *language.MessageStore) *Handler {
+func NewHandler(repo *Repository, rbacRepo *rbac.Repository, authorizer *rbac.Authorizer, tokenRepo *auth.Repository, msgStore *language.MessageStore) *Handler {
 	return &Handler{
 		BaseHandler: shared.BaseHandler{MsgStore: msgStore},
 		repo:        repo,
 		rbacRepo:    rbacRepo,
+		authorizer:  authorizer,
+		tokenRepo:   tokenRepo,
 		validator:   validator.New(),
 	}
 }
 
 func (h *Handler) RegisterCompanyUser(w http.ResponseWriter, r *http.Request) {
-	userID, ok := h.MustGetUserID(w, r)
+	companyID, ok := h.companyID(w, r)
 	if !ok {
 		return
 	}
@@ -44,13 +50,19 @@ func (h *Handler) RegisterCompanyUser(w http.ResponseWriter, r *http.Request) {
 		h.RespondError(w, r, err)
 		return
 	}
+	req.CompanyID = companyID
 
-	if err := ValidateCreateCompanyUser(&req, userID, h.repo, h.companyRepo, *h.validator, h.MsgStore); err != nil {
-		h.RespondError(w, r, err)
+	if err := ValidateCreateCompanyUser(&req, *h.validator); err != nil {
+		utils.ValidationError(w, r, err, h.MsgStore)
 		return
 	}
 
 	companyUser, err := h.repo.RegisterCompanyUser(&req)
+	var violation *passwordpolicy.Violation
+	if errors.As(err, &violation) {
+		h.RespondError(w, r, violation)
+		return
+	}
 	if err != nil {
 		logger.Error(err.Error())
 		h.RespondError(w, r, errors.New(language.CompanyCreateFailed))
@@ -61,13 +73,12 @@ func (h *Handler) RegisterCompanyUser(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) ListCompanyUsers(w http.ResponseWriter, r *http.Request) {
-	companyID := chi.URLParam(r, "companyID")
-	companyIDInt, err := strconv.ParseInt(companyID, 10, 64)
-	if err != nil {
-		h.RespondError(w, r, errors.New(language.CompanyNotFound))
+	companyID, ok := h.companyID(w, r)
+	if !ok {
+		return
 	}
 
-	users, err := h.repo.ListCompanyUsers(companyIDInt)
+	users, err := h.repo.ListCompanyUsers(companyID)
 	if err != nil {
 		logger.Error(err.Error())
 		h.RespondError(w, r, errors.New(language.CompanyListFailed))
@@ -79,29 +90,124 @@ func (h *Handler) ListCompanyUsers(w http.ResponseWriter, r *http.Request) {
 
 // RemoveCompanyUser removes a user from a company
 func (h *Handler) RemoveCompanyUser(w http.ResponseWriter, r *http.Request) {
-	companyID := chi.URLParam(r, "companyID")
-	companyIDInt, err := strconv.ParseInt(companyID, 10, 64)
-	if err != nil {
+	companyID, memberID, ok := h.member(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.repo.RemoveCompanyUser(companyID, memberID); err != nil {
 		logger.Error(err.Error())
-		h.RespondError(w, r, errors.New(language.CompanyNotFound))
+		h.RespondError(w, r, errors.New(language.CompanyUserRemoveFailed))
+		return
+	}
+	h.authorizer.InvalidateUser(memberID, companyID)
+
+	utils.JSON(w, http.StatusNoContent, nil)
+}
+
+// ListUserSessions lists the active sessions of a company member
+func (h *Handler) ListUserSessions(w http.ResponseWriter, r *http.Request) {
+	companyID, memberID, ok := h.member(w, r)
+	if !ok {
 		return
 	}
 
-	userID := chi.URLParam(r, "userID")
-	userIDInt, err := strconv.ParseInt(userID, 10, 64)
+	sessions, err := h.tokenRepo.ListActiveSessions(memberID)
 	if err != nil {
 		logger.Error(err.Error())
-		h.RespondError(w, r, errors.New(language.CompanyUserNotFound))
+		h.RespondError(w, r, errors.New(language.SessionListFailed))
 		return
 	}
 
-	//TODO: check permissions
+	logger.Info("Listed member sessions", zap.Int64("companyID", companyID), zap.Int64("userID", memberID))
+	utils.JSON(w, http.StatusOK, sessions)
+}
 
-	if err := h.repo.RemoveCompanyUser(companyIDInt, userIDInt); err != nil {
-		logger.Error(err.Error())
-		h.RespondError(w, r, errors.New(language.CompanyUserRemoveFailed))
+// RevokeUserSession ends a session of a company member
+func (h *Handler) RevokeUserSession(w http.ResponseWriter, r *http.Request) {
+	companyID, memberID, ok := h.member(w, r)
+	if !ok {
 		return
 	}
 
-	utils.JSON(w, http.StatusNoContent, nil)
+	sessionID, err := strconv.ParseInt(chi.URLParam(r, "sessionID"), 10, 64)
+	if err != nil {
+		h.RespondError(w, r, errors.New(language.ValidationInvalidID))
+		return
+	}
+
+	if err := auth.RevokeUserSession(h.tokenRepo, memberID, sessionID); err != nil {
+		h.RespondError(w, r, err)
+		return
+	}
+
+	logger.Info("Revoked member session",
+		zap.Int64("companyID", companyID),
+		zap.Int64("userID", memberID),
+		zap.Int64("sessionID", sessionID))
+	msg, httpStatus := h.MsgStore.GetMessage(pkgctx.GetLanguage(r.Context()), language.SessionRevoked)
+	utils.JSON(w, httpStatus, msg)
+}
+
+// companyID returns the company from the URL, which the route's permission
+// requirement was checked against
+func (h *Handler) companyID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	companyID, err := strconv.ParseInt(chi.URLParam(r, "companyID"), 10, 64)
+	if err != nil {
+		h.RespondError(w, r, errors.New(language.CompanyNotFound))
+		return 0, false
+	}
+	return companyID, true
+}
+
+// MemberResource returns the attributes of the company member the URL
+// addresses, so that grants can be limited to the caller's own membership
+// with a condition such as resource.user_id == user.id
+func (h *Handler) MemberResource(r *http.Request) (map[string]any, error) {
+	companyID, err := strconv.ParseInt(chi.URLParam(r, "companyID"), 10, 64)
+	if err != nil {
+		return nil, errors.New(language.CompanyUserNotFound)
+	}
+	memberID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		return nil, errors.New(language.CompanyUserNotFound)
+	}
+
+	companyUser, err := h.rbacRepo.GetCompanyUserByCompanyAndUser(companyID, memberID)
+	if err != nil {
+		return nil, errors.New(language.CompanyUserNotFound)
+	}
+	return map[string]any{
+		"user_id":    companyUser.UserID,
+		"company_id": companyUser.CompanyID,
+		"is_main":    companyUser.IsMain,
+	}, nil
+}
+
+// member returns the company and the user from the URL, checking that the
+// user is a member of that company
+func (h *Handler) member(w http.ResponseWriter, r *http.Request) (int64, int64, bool) {
+	companyID, ok := h.companyID(w, r)
+	if !ok {
+		return 0, 0, false
+	}
+
+	memberID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		h.RespondError(w, r, errors.New(language.CompanyUserNotFound))
+		return 0, 0, false
+	}
+
+	isMember, err := h.rbacRepo.HasCompanyAccess(memberID, companyID)
+	if err != nil {
+		logger.Error(err.Error())
+		h.RespondError(w, r, errors.New(language.PermissionCheckFailed))
+		return 0, 0, false
+	}
+	if !isMember {
+		h.RespondError(w, r, errors.New(language.CompanyUserNotFound))
+		return 0, 0, false
+	}
+
+	return companyID, memberID, true
 }
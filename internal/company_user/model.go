@@ -11,9 +11,10 @@ type CompanyUser struct {
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
-// RegisterCompanyUserRequest represents the request to register a new user for a company
+// RegisterCompanyUserRequest represents the request to register a new user for a company.
+// CompanyID is taken from the URL.
 type RegisterCompanyUserRequest struct {
-	CompanyID int64  `json:"company_id" validate:"required"`
+	CompanyID int64  `json:"-"`
 	Username  string `json:"username" validate:"required,email"`
 	Password  string `json:"password" validate:"required"`
 	Phone     string `json:"phone" validate:"required"`
@@ -1,11 +1,11 @@
 package company_user
 
 import (
-	"crypto/sha256"
 	"fmt"
 	"time"
 
 	model "gobizmanager/internal/models"
+	"gobizmanager/internal/rbac"
 	"gobizmanager/internal/user"
 	"gobizmanager/pkg/encryption"
 
@@ -32,6 +32,10 @@ func (r *Repository) RegisterCompanyUser(req *RegisterCompanyUserRequest) (*Comp
 		return nil, fmt.Errorf("username already exists")
 	}
 
+	if err := userRepo.ValidatePassword(0, req.CompanyID, req.Password); err != nil {
+		return nil, err
+	}
+
 	tx := r.db.Begin()
 	if tx.Error != nil {
 		return nil, fmt.Errorf("failed to begin transaction: %w", tx.Error)
@@ -56,13 +60,16 @@ func (r *Repository) RegisterCompanyUser(req *RegisterCompanyUserRequest) (*Comp
 	}
 
 	// Create email hash for searching
-	emailHash := fmt.Sprintf("%x", sha256.Sum256([]byte(req.Username)))
+	emailHash := user.HashEmail(req.Username)
 
 	// Create user
 	userID, err := r.createUser(tx, encryptedUsername, emailHash, hashedPassword, encryptedPhone)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
+	if err := userRepo.RecordPasswordWithTx(tx, userID, hashedPassword); err != nil {
+		return nil, fmt.Errorf("failed to record password: %w", err)
+	}
 
 	// Create company-user relationship
 	companyUser, err := r.createCompanyUser(tx, req.CompanyID, userID)
@@ -78,10 +85,11 @@ func (r *Repository) RegisterCompanyUser(req *RegisterCompanyUserRequest) (*Comp
 
 	// Assign USER role to the new user
 	userRoleAssignment := &model.UserRole{
-		UserID:    userID,
-		RoleID:    userRole.ID,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		UserID:        userID,
+		CompanyUserID: companyUser.ID,
+		RoleID:        userRole.ID,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
 	}
 	if err := tx.Create(userRoleAssignment).Error; err != nil {
 		return nil, fmt.Errorf("failed to assign USER role: %w", err)
@@ -137,5 +145,10 @@ func (r *Repository) ListCompanyUsers(companyID int64) ([]*CompanyUser, error) {
 }
 
 func (r *Repository) RemoveCompanyUser(companyID, userID int64) error {
-	return r.db.Where("company_id = ? AND user_id = ?", companyID, userID).Delete(&CompanyUser{}).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("company_id = ? AND user_id = ?", companyID, userID).Delete(&CompanyUser{}).Error; err != nil {
+			return err
+		}
+		return rbac.BumpVersion(tx, companyID)
+	})
 }
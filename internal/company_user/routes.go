@@ -4,13 +4,23 @@ import (
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
+
+	"gobizmanager/internal/rbac"
+	"gobizmanager/platform/middleware/permission"
 )
 
-func Routes(handler *Handler) http.Handler {
+func Routes(handler *Handler, guard permission.Guard) http.Handler {
 	r := chi.NewRouter()
 
-	// Register company user routes
-	r.Post("/register", handler.RegisterCompanyUser)
+	// Company members
+	r.With(guard.RequirePermission(rbac.ModuleUser, rbac.ActionCreate)).Post("/{companyID}/users", handler.RegisterCompanyUser)
+	r.With(guard.RequirePermission(rbac.ModuleUser, rbac.ActionRead)).Get("/{companyID}/users", handler.ListCompanyUsers)
+	r.With(guard.RequirePermissionOn(rbac.ModuleUser, rbac.ActionDelete, handler.MemberResource)).Delete("/{companyID}/users/{userID}", handler.RemoveCompanyUser)
+
+	// Session management for company members. Conditional grants see the
+	// member as the resource.
+	r.With(guard.RequirePermissionOn(rbac.ModuleUser, rbac.ActionUpdate, handler.MemberResource)).Get("/{companyID}/users/{userID}/sessions", handler.ListUserSessions)
+	r.With(guard.RequirePermissionOn(rbac.ModuleUser, rbac.ActionUpdate, handler.MemberResource)).Delete("/{companyID}/users/{userID}/sessions/{sessionID}", handler.RevokeUserSession)
 
 	return r
 }
@@ -1,27 +1,9 @@
 package company_user
 
 import (
-	"errors"
-
-	"gobizmanager/internal/company"
-	"gobizmanager/pkg/language"
-	"gobizmanager/pkg/logger"
-
 	"github.com/go-playground/validator/v10"
 )
 
-func ValidateCreateCompanyUser(req *RegisterCompanyUserRequest, userID int64, repo *Repository, companyRepo *company.Repository, validator validator.Validate, msgStore *language.MessageStore) error {
-	if err := validator.Struct(req); err != nil {
-		return err
-	}
-
-	exists, err := companyRepo.CompanyExistsForUserByID(userID, req.CompanyID)
-	if err != nil {
-		logger.Error(err.Error())
-		return errors.New(language.CompanyListFailed)
-	}
-	if !exists {
-		return errors.New(language.CompanyNotFound)
-	}
-	return nil
+func ValidateCreateCompanyUser(req *RegisterCompanyUserRequest, validator validator.Validate) error {
+	return validator.Struct(req)
 }
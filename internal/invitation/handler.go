@@ -0,0 +1,365 @@
+// Package invitation lets company administrators invite people by email
+// instead of choosing passwords for them.
+package invitation
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+	"go.uber.org/zap"
+
+	"gobizmanager/internal/auth"
+	"gobizmanager/internal/user"
+	pkgctx "gobizmanager/pkg/context"
+	"gobizmanager/pkg/language"
+	"gobizmanager/pkg/logger"
+	"gobizmanager/pkg/mailer"
+	"gobizmanager/pkg/passwordpolicy"
+	"gobizmanager/pkg/shared"
+	"gobizmanager/pkg/utils"
+	"gobizmanager/platform/config"
+)
+
+const (
+	invitationTTL   = 7 * 24 * time.Hour
+	mailSendTimeout = 30 * time.Second
+)
+
+type Handler struct {
+	shared.BaseHandler
+	repo       *Repository
+	userRepo   *user.Repository
+	jwtManager *auth.JWTManager
+	mailer     mailer.Mailer
+	cfg        *config.Config
+	validator  *validator.Validate
+}
+
+func NewHandler(repo *Repository, userRepo *user.Repository, jwtManager *auth.JWTManager, mail mailer.Mailer, cfg *config.Config, msgStore *language.MessageStore) *Handler {
+	return &Handler{
+		BaseHandler: shared.BaseHandler{MsgStore: msgStore},
+		repo:        repo,
+		userRepo:    userRepo,
+		jwtManager:  jwtManager,
+		mailer:      mail,
+		cfg:         cfg,
+		validator:   validator.New(),
+	}
+}
+
+// CreateInvitation invites an email address to the company with a role and
+// emails the invitation link
+func (h *Handler) CreateInvitation(w http.ResponseWriter, r *http.Request) {
+	companyID, callerID, ok := h.caller(w, r)
+	if !ok {
+		return
+	}
+
+	var req CreateInvitationRequest
+	if !h.parse(w, r, &req) {
+		return
+	}
+
+	role, err := h.repo.GetCompanyRole(companyID, req.RoleID)
+	if err != nil {
+		if !errors.Is(err, ErrRoleNotInCompany) {
+			logger.Error("Failed to load role", zap.Error(err))
+		}
+		h.RespondError(w, r, errors.New(language.RoleNotFound))
+		return
+	}
+
+	member, err := h.repo.IsMember(companyID, req.Email)
+	if err != nil {
+		logger.Error("Failed to check company membership", zap.Error(err))
+		h.RespondError(w, r, errors.New(language.InvitationCreateFailed))
+		return
+	}
+	if member {
+		h.RespondError(w, r, errors.New(language.InvitationAlreadyMember))
+		return
+	}
+
+	pending, err := h.repo.HasPendingInvitation(companyID, req.Email)
+	if err != nil {
+		logger.Error("Failed to check pending invitations", zap.Error(err))
+		h.RespondError(w, r, errors.New(language.InvitationCreateFailed))
+		return
+	}
+	if pending {
+		h.RespondError(w, r, errors.New(language.InvitationExists))
+		return
+	}
+
+	tokenID, err := auth.NewTokenID()
+	if err != nil {
+		logger.Error("Failed to generate invitation token ID", zap.Error(err))
+		h.RespondError(w, r, errors.New(language.InvitationCreateFailed))
+		return
+	}
+
+	inv := &Invitation{
+		CompanyID: companyID,
+		Email:     req.Email,
+		RoleID:    role.ID,
+		TokenID:   tokenID,
+		ExpiresAt: time.Now().Add(invitationTTL),
+	}
+	inv.InvitedBy.Int64, inv.InvitedBy.Valid = callerID, true
+	if err := h.repo.CreateInvitation(inv); err != nil {
+		logger.Error("Failed to create invitation", zap.Error(err))
+		h.RespondError(w, r, errors.New(language.InvitationCreateFailed))
+		return
+	}
+
+	if err := h.send(r, inv, role.Name); err != nil {
+		logger.Error("Failed to send invitation", zap.Error(err))
+		h.RespondError(w, r, errors.New(language.InvitationCreateFailed))
+		return
+	}
+
+	logger.Info("Invitation created", zap.Int64("companyID", companyID), zap.Int64("invitationID", inv.ID))
+	utils.JSON(w, http.StatusCreated, inv)
+}
+
+// ListInvitations lists the company's pending invitations
+func (h *Handler) ListInvitations(w http.ResponseWriter, r *http.Request) {
+	companyID, _, ok := h.caller(w, r)
+	if !ok {
+		return
+	}
+
+	invitations, err := h.repo.ListPendingInvitations(companyID)
+	if err != nil {
+		logger.Error("Failed to list invitations", zap.Error(err))
+		h.RespondError(w, r, errors.New(language.InvitationListFailed))
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, invitations)
+}
+
+// ResendInvitation emails a fresh link for a pending invitation. Links sent
+// before stop working.
+func (h *Handler) ResendInvitation(w http.ResponseWriter, r *http.Request) {
+	companyID, _, ok := h.caller(w, r)
+	if !ok {
+		return
+	}
+
+	inv, ok := h.getInvitation(w, r, companyID)
+	if !ok {
+		return
+	}
+
+	role, err := h.repo.GetCompanyRole(companyID, inv.RoleID)
+	if err != nil {
+		h.RespondError(w, r, errors.New(language.RoleNotFound))
+		return
+	}
+
+	tokenID, err := auth.NewTokenID()
+	if err != nil {
+		logger.Error("Failed to generate invitation token ID", zap.Error(err))
+		h.RespondError(w, r, errors.New(language.InvitationUpdateFailed))
+		return
+	}
+
+	if err := h.repo.ReissueInvitation(inv, tokenID, time.Now().Add(invitationTTL)); err != nil {
+		if errors.Is(err, ErrNotPending) {
+			h.RespondError(w, r, errors.New(language.InvitationNotFound))
+			return
+		}
+		logger.Error("Failed to reissue invitation", zap.Error(err))
+		h.RespondError(w, r, errors.New(language.InvitationUpdateFailed))
+		return
+	}
+
+	if err := h.send(r, inv, role.Name); err != nil {
+		logger.Error("Failed to send invitation", zap.Error(err))
+		h.RespondError(w, r, errors.New(language.InvitationUpdateFailed))
+		return
+	}
+
+	msg, httpStatus := h.MsgStore.GetMessage(pkgctx.GetLanguage(r.Context()), language.InvitationResent)
+	utils.JSON(w, httpStatus, msg)
+}
+
+// RevokeInvitation stops a pending invitation from being accepted
+func (h *Handler) RevokeInvitation(w http.ResponseWriter, r *http.Request) {
+	companyID, _, ok := h.caller(w, r)
+	if !ok {
+		return
+	}
+
+	inv, ok := h.getInvitation(w, r, companyID)
+	if !ok {
+		return
+	}
+
+	if err := h.repo.RevokeInvitation(inv); err != nil {
+		if errors.Is(err, ErrNotPending) {
+			h.RespondError(w, r, errors.New(language.InvitationNotFound))
+			return
+		}
+		logger.Error("Failed to revoke invitation", zap.Error(err))
+		h.RespondError(w, r, errors.New(language.InvitationUpdateFailed))
+		return
+	}
+
+	logger.Info("Invitation revoked", zap.Int64("companyID", companyID), zap.Int64("invitationID", inv.ID))
+	msg, httpStatus := h.MsgStore.GetMessage(pkgctx.GetLanguage(r.Context()), language.InvitationRevoked)
+	utils.JSON(w, httpStatus, msg)
+}
+
+// AcceptInvitation accepts an invitation from its link. An existing account
+// with the invited address is added to the company; receiving the link proves
+// control of the address just as a password reset would. Otherwise an account
+// is created with the chosen password.
+func (h *Handler) AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	var req AcceptInvitationRequest
+	if !h.parse(w, r, &req) {
+		return
+	}
+
+	claims, err := h.jwtManager.VerifyToken(req.Token)
+	if err != nil || claims.TokenType != auth.InvitationTokenType || claims.InvitationID == 0 {
+		h.RespondError(w, r, errors.New(language.InvitationInvalid))
+		return
+	}
+
+	inv, err := h.repo.GetInvitationByID(claims.InvitationID)
+	if err != nil || !inv.Pending() || inv.TokenID != claims.ID {
+		h.RespondError(w, r, errors.New(language.InvitationInvalid))
+		return
+	}
+
+	existing, err := h.userRepo.GetUserByEmail(inv.Email)
+	switch {
+	case err == nil && existing.IsServiceAccount:
+		h.RespondError(w, r, errors.New(language.InvitationInvalid))
+		return
+	case err == nil:
+		err = h.repo.AcceptForUser(inv, existing.ID)
+	default:
+		if req.Password == "" {
+			h.RespondError(w, r, errors.New(language.InvitationPasswordRequired))
+			return
+		}
+		if err := h.userRepo.ValidatePassword(0, inv.CompanyID, req.Password); err != nil {
+			var violation *passwordpolicy.Violation
+			if errors.As(err, &violation) {
+				h.RespondError(w, r, violation)
+				return
+			}
+			logger.Error("Failed to check password policy", zap.Error(err))
+			h.RespondError(w, r, errors.New(language.PasswordCheckFailed))
+			return
+		}
+		_, err = h.repo.AcceptForNewUser(inv, req.Password, req.Phone)
+	}
+
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrNotPending):
+			h.RespondError(w, r, errors.New(language.InvitationInvalid))
+		case errors.Is(err, ErrAlreadyMember):
+			h.RespondError(w, r, errors.New(language.InvitationAlreadyMember))
+		default:
+			logger.Error("Failed to accept invitation", zap.Error(err))
+			h.RespondError(w, r, errors.New(language.InvitationAcceptFailed))
+		}
+		return
+	}
+
+	logger.Info("Invitation accepted", zap.Int64("companyID", inv.CompanyID), zap.Int64("invitationID", inv.ID))
+	msg, httpStatus := h.MsgStore.GetMessage(pkgctx.GetLanguage(r.Context()), language.InvitationAccepted)
+	utils.JSON(w, httpStatus, msg)
+}
+
+// send emails the invitation link in the background
+func (h *Handler) send(r *http.Request, inv *Invitation, roleName string) error {
+	token, err := h.jwtManager.GenerateInvitationToken(inv.ID, inv.TokenID, inv.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	companyName, err := h.repo.GetCompanyName(inv.CompanyID)
+	if err != nil {
+		return err
+	}
+
+	lang := pkgctx.GetLanguage(r.Context())
+	subject, _ := h.MsgStore.GetMessage(lang, language.EmailInvitationSubject)
+	tmpl, _ := h.MsgStore.GetMessage(lang, language.EmailInvitationBody)
+	body, err := mailer.Render(tmpl, map[string]interface{}{
+		"Company": companyName,
+		"Role":    roleName,
+		"Days":    int(invitationTTL.Hours() / 24),
+		"Link":    h.cfg.AppURL + "/accept-invitation?token=" + url.QueryEscape(token),
+	})
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mailSendTimeout)
+		defer cancel()
+
+		if err := h.mailer.Send(ctx, mailer.Message{To: inv.Email, Subject: subject, Body: body}); err != nil {
+			logger.Error("Failed to send invitation email", zap.Int64("invitationID", inv.ID), zap.Error(err))
+		}
+	}()
+	return nil
+}
+
+// caller returns the company from the URL, which the route's permission
+// requirement was checked against, and the caller's ID
+func (h *Handler) caller(w http.ResponseWriter, r *http.Request) (int64, int64, bool) {
+	callerID, ok := h.MustGetUserID(w, r)
+	if !ok {
+		return 0, 0, false
+	}
+
+	companyID, err := strconv.ParseInt(chi.URLParam(r, "companyID"), 10, 64)
+	if err != nil {
+		h.RespondError(w, r, errors.New(language.CompanyNotFound))
+		return 0, 0, false
+	}
+
+	return companyID, callerID, true
+}
+
+func (h *Handler) getInvitation(w http.ResponseWriter, r *http.Request, companyID int64) (*Invitation, bool) {
+	invitationID, err := strconv.ParseInt(chi.URLParam(r, "invitationID"), 10, 64)
+	if err != nil {
+		h.RespondError(w, r, errors.New(language.InvitationNotFound))
+		return nil, false
+	}
+
+	inv, err := h.repo.GetInvitation(companyID, invitationID)
+	if err != nil {
+		h.RespondError(w, r, errors.New(language.InvitationNotFound))
+		return nil, false
+	}
+	return inv, true
+}
+
+func (h *Handler) parse(w http.ResponseWriter, r *http.Request, req interface{}) bool {
+	if err := utils.ParseRequest(r, req); err != nil {
+		h.RespondError(w, r, err)
+		return false
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		utils.ValidationError(w, r, err, h.MsgStore)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,44 @@
+package invitation
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Invitation offers membership of a company with a role to an email address.
+// TokenID identifies the most recently sent link; links sent before a resend
+// stop working.
+type Invitation struct {
+	ID             int64         `json:"id"`
+	CompanyID      int64         `json:"company_id"`
+	Email          string        `json:"email" encrypted:"true"`
+	EmailHash      string        `json:"-"`
+	RoleID         int64         `json:"role_id"`
+	InvitedBy      sql.NullInt64 `json:"-"`
+	TokenID        string        `json:"-"`
+	ExpiresAt      time.Time     `json:"expires_at"`
+	AcceptedAt     sql.NullTime  `json:"accepted_at"`
+	AcceptedUserID sql.NullInt64 `json:"-"`
+	RevokedAt      sql.NullTime  `json:"revoked_at"`
+	CreatedAt      time.Time     `json:"created_at"`
+	UpdatedAt      time.Time     `json:"updated_at"`
+}
+
+// Pending reports whether the invitation can still be accepted
+func (i *Invitation) Pending() bool {
+	return !i.AcceptedAt.Valid && !i.RevokedAt.Valid && time.Now().Before(i.ExpiresAt)
+}
+
+// CreateInvitationRequest represents the request to invite someone to a company
+type CreateInvitationRequest struct {
+	Email  string `json:"email" validate:"required,email" msg:"auth.invalid_email"`
+	RoleID int64  `json:"role_id" validate:"required" msg:"auth.field_required"`
+}
+
+// AcceptInvitationRequest accepts an invitation from its link. Password and
+// phone are only used when no account exists for the invited address yet.
+type AcceptInvitationRequest struct {
+	Token    string `json:"token" validate:"required" msg:"auth.field_required"`
+	Password string `json:"password" validate:"omitempty,min=8" msg:"auth.password_too_short"`
+	Phone    string `json:"phone" validate:"max=32" msg:"validation.failed"`
+}
@@ -0,0 +1,247 @@
+package invitation
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	model "gobizmanager/internal/models"
+	"gobizmanager/internal/rbac"
+	"gobizmanager/internal/user"
+	"gobizmanager/pkg/encryption"
+	"gobizmanager/platform/config"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrRoleNotInCompany = errors.New("role does not belong to the company")
+	ErrAlreadyMember    = errors.New("user is already a member of the company")
+	// ErrNotPending is returned when an invitation was accepted, revoked or
+	// resent while it was being accepted
+	ErrNotPending = errors.New("invitation is no longer pending")
+)
+
+type Repository struct {
+	db       *gorm.DB
+	cfg      *config.Config
+	userRepo *user.Repository
+}
+
+func NewRepository(db *gorm.DB, cfg *config.Config, userRepo *user.Repository) *Repository {
+	return &Repository{db: db, cfg: cfg, userRepo: userRepo}
+}
+
+// CreateInvitation stores a new invitation. inv.Email is left in plain text.
+func (r *Repository) CreateInvitation(inv *Invitation) error {
+	encryptedEmail, err := encryption.Encrypt(inv.Email, r.cfg.EncryptionKey)
+	if err != nil {
+		return err
+	}
+
+	row := *inv
+	row.Email = encryptedEmail
+	row.EmailHash = user.HashEmail(inv.Email)
+	row.CreatedAt = time.Now()
+	row.UpdatedAt = row.CreatedAt
+	if err := r.db.Create(&row).Error; err != nil {
+		return err
+	}
+
+	inv.ID = row.ID
+	inv.EmailHash = row.EmailHash
+	inv.CreatedAt = row.CreatedAt
+	inv.UpdatedAt = row.UpdatedAt
+	return nil
+}
+
+// GetInvitation returns an invitation of the company
+func (r *Repository) GetInvitation(companyID, id int64) (*Invitation, error) {
+	var inv Invitation
+	if err := r.db.Where("company_id = ? AND id = ?", companyID, id).First(&inv).Error; err != nil {
+		return nil, err
+	}
+	return r.decrypt(&inv)
+}
+
+// GetInvitationByID returns an invitation of any company
+func (r *Repository) GetInvitationByID(id int64) (*Invitation, error) {
+	var inv Invitation
+	if err := r.db.First(&inv, id).Error; err != nil {
+		return nil, err
+	}
+	return r.decrypt(&inv)
+}
+
+// ListPendingInvitations returns the company's invitations that were neither
+// accepted nor revoked, including expired ones that can still be resent
+func (r *Repository) ListPendingInvitations(companyID int64) ([]*Invitation, error) {
+	var invitations []*Invitation
+	err := r.db.Where("company_id = ? AND accepted_at IS NULL AND revoked_at IS NULL", companyID).
+		Order("created_at DESC").
+		Find(&invitations).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, inv := range invitations {
+		if _, err := r.decrypt(inv); err != nil {
+			return nil, err
+		}
+	}
+	return invitations, nil
+}
+
+// HasPendingInvitation reports whether the address has an unexpired
+// invitation to the company
+func (r *Repository) HasPendingInvitation(companyID int64, email string) (bool, error) {
+	var count int64
+	err := r.db.Model(&Invitation{}).
+		Where("company_id = ? AND email_hash = ? AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?",
+			companyID, user.HashEmail(email), time.Now()).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// IsMember reports whether a user with the address belongs to the company
+func (r *Repository) IsMember(companyID int64, email string) (bool, error) {
+	var count int64
+	err := r.db.Model(&rbac.CompanyUser{}).
+		Joins("JOIN users ON users.id = company_users.user_id").
+		Where("company_users.company_id = ? AND users.email_hash = ?", companyID, user.HashEmail(email)).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// GetCompanyRole returns a role defined by the company.
+// ErrRoleNotInCompany is returned for global roles and other companies' roles.
+func (r *Repository) GetCompanyRole(companyID, roleID int64) (*model.Role, error) {
+	var role model.Role
+	err := r.db.Where("id = ? AND company_id = ?", roleID, companyID).First(&role).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrRoleNotInCompany
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// GetCompanyName returns the name shown in invitation emails
+func (r *Repository) GetCompanyName(companyID int64) (string, error) {
+	var name string
+	err := r.db.Table("companies").Where("id = ?", companyID).Select("name").Scan(&name).Error
+	return name, err
+}
+
+// ReissueInvitation replaces the link of a pending invitation and extends it
+func (r *Repository) ReissueInvitation(inv *Invitation, tokenID string, expiresAt time.Time) error {
+	now := time.Now()
+	res := r.db.Model(&Invitation{}).
+		Where("id = ? AND accepted_at IS NULL AND revoked_at IS NULL", inv.ID).
+		Updates(map[string]interface{}{"token_id": tokenID, "expires_at": expiresAt, "updated_at": now})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotPending
+	}
+
+	inv.TokenID = tokenID
+	inv.ExpiresAt = expiresAt
+	inv.UpdatedAt = now
+	return nil
+}
+
+// RevokeInvitation stops a pending invitation from being accepted
+func (r *Repository) RevokeInvitation(inv *Invitation) error {
+	now := time.Now()
+	res := r.db.Model(&Invitation{}).
+		Where("id = ? AND accepted_at IS NULL AND revoked_at IS NULL", inv.ID).
+		Updates(map[string]interface{}{"revoked_at": now, "updated_at": now})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotPending
+	}
+	return nil
+}
+
+// AcceptForUser adds an existing user to the company with the invited role
+func (r *Repository) AcceptForUser(inv *Invitation, userID int64) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return r.acceptWithTx(tx, inv, userID)
+	})
+}
+
+// AcceptForNewUser creates the invited user and adds it to the company with
+// the invited role. The address is marked verified since the link reached it.
+func (r *Repository) AcceptForNewUser(inv *Invitation, password, phone string) (int64, error) {
+	var userID int64
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		userID, err = r.userRepo.CreateUserWithTx(tx, inv.Email, password, phone)
+		if err != nil {
+			return fmt.Errorf("failed to create user: %w", err)
+		}
+		if err := tx.Model(&model.User{}).Where("id = ?", userID).Update("email_verified_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return r.acceptWithTx(tx, inv, userID)
+	})
+	return userID, err
+}
+
+func (r *Repository) acceptWithTx(tx *gorm.DB, inv *Invitation, userID int64) error {
+	now := time.Now()
+
+	// Claim the invitation first so concurrent accepts of the same link fail
+	res := tx.Model(&Invitation{}).
+		Where("id = ? AND token_id = ? AND accepted_at IS NULL AND revoked_at IS NULL", inv.ID, inv.TokenID).
+		Updates(map[string]interface{}{"accepted_at": now, "accepted_user_id": userID, "updated_at": now})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotPending
+	}
+
+	var count int64
+	if err := tx.Model(&rbac.CompanyUser{}).Where("company_id = ? AND user_id = ?", inv.CompanyID, userID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrAlreadyMember
+	}
+
+	companyUser := &rbac.CompanyUser{
+		CompanyID: inv.CompanyID,
+		UserID:    userID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := tx.Create(companyUser).Error; err != nil {
+		return fmt.Errorf("failed to add user to company: %w", err)
+	}
+
+	if err := tx.Create(&model.UserRole{
+		UserID:        userID,
+		CompanyUserID: companyUser.ID,
+		RoleID:        inv.RoleID,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to assign invited role: %w", err)
+	}
+	return nil
+}
+
+func (r *Repository) decrypt(inv *Invitation) (*Invitation, error) {
+	email, err := encryption.Decrypt(inv.Email, r.cfg.EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	inv.Email = email
+	return inv, nil
+}
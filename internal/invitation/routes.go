@@ -0,0 +1,23 @@
+package invitation
+
+import (
+	"net/http"
+
+	"gobizmanager/internal/rbac"
+	"gobizmanager/platform/middleware/permission"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Routes returns the invitation management routes, mounted under
+// /companies/{companyID}/invitations
+func Routes(handler *Handler, guard permission.Guard) http.Handler {
+	r := chi.NewRouter()
+
+	r.With(guard.RequirePermission(rbac.ModuleUser, rbac.ActionRead)).Get("/", handler.ListInvitations)
+	r.With(guard.RequirePermission(rbac.ModuleUser, rbac.ActionCreate)).Post("/", handler.CreateInvitation)
+	r.With(guard.RequirePermission(rbac.ModuleUser, rbac.ActionCreate)).Post("/{invitationID}/resend", handler.ResendInvitation)
+	r.With(guard.RequirePermission(rbac.ModuleUser, rbac.ActionDelete)).Delete("/{invitationID}", handler.RevokeInvitation)
+
+	return r
+}
@@ -0,0 +1,48 @@
+package model
+
+import (
+	"time"
+
+	"gobizmanager/pkg/passwordpolicy"
+)
+
+// PasswordPolicy holds the password rules a company sets for its members
+type PasswordPolicy struct {
+	CompanyID     int64     `json:"company_id" gorm:"primaryKey;autoIncrement:false"`
+	MinLength     int       `json:"min_length"`
+	RequireUpper  bool      `json:"require_upper"`
+	RequireLower  bool      `json:"require_lower"`
+	RequireDigit  bool      `json:"require_digit"`
+	RequireSymbol bool      `json:"require_symbol"`
+	HistorySize   int       `json:"history_size"`
+	MaxAgeDays    int       `json:"max_age_days"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+func (PasswordPolicy) TableName() string {
+	return "company_password_policies"
+}
+
+func (p *PasswordPolicy) ToPolicy() passwordpolicy.Policy {
+	return passwordpolicy.Policy{
+		MinLength:     p.MinLength,
+		RequireUpper:  p.RequireUpper,
+		RequireLower:  p.RequireLower,
+		RequireDigit:  p.RequireDigit,
+		RequireSymbol: p.RequireSymbol,
+		HistorySize:   p.HistorySize,
+		MaxAge:        time.Duration(p.MaxAgeDays) * 24 * time.Hour,
+	}
+}
+
+// PasswordHistory is a previous password hash of a user
+type PasswordHistory struct {
+	ID           int64     `json:"id"`
+	UserID       int64     `json:"user_id"`
+	PasswordHash string    `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func (PasswordHistory) TableName() string {
+	return "password_history"
+}
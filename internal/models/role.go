@@ -14,13 +14,16 @@ type Permission struct {
 }
 
 type Role struct {
-	ID          int64        `json:"id"`
-	CompanyID   int64        `json:"company_id"`
-	Name        string       `json:"name"`
-	Description string       `json:"description"`
-	Permissions []Permission `json:"permissions"`
-	CreatedAt   time.Time    `json:"created_at"`
-	UpdatedAt   time.Time    `json:"updated_at"`
+	ID          int64  `json:"id"`
+	CompanyID   int64  `json:"company_id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// ParentRoleID is a role of the same company whose permissions this role
+	// inherits, along with those of its own parents
+	ParentRoleID *int64       `json:"parent_role_id"`
+	Permissions  []Permission `json:"permissions" gorm:"-"`
+	CreatedAt    time.Time    `json:"created_at"`
+	UpdatedAt    time.Time    `json:"updated_at"`
 }
 
 type UserRole struct {
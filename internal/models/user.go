@@ -1,19 +1,31 @@
 package model
 
 import (
+	"database/sql"
 	"time"
 
 	utils "gobizmanager/pkg/encryption"
 )
 
 type User struct {
-	ID        int64     `json:"id"`
-	Email     string    `json:"email" encrypted:"true"`
-	EmailHash string    `json:"-" gorm:"index"`
-	Password  string    `json:"-"`
-	Phone     string    `json:"phone" encrypted:"true"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID        int64  `json:"id"`
+	Email     string `json:"email" encrypted:"true"`
+	EmailHash string `json:"-" gorm:"index"`
+	Password  string `json:"-"`
+	Phone     string `json:"phone" encrypted:"true"`
+	// IsServiceAccount marks users backing a company service account. They
+	// authenticate with API keys only and cannot log in interactively.
+	IsServiceAccount bool `json:"is_service_account"`
+	// EmailVerifiedAt is set once the user follows the verification link
+	EmailVerifiedAt sql.NullTime `json:"email_verified_at"`
+	// PasswordChangedAt is when the password was last set, for maximum age
+	// policies. It is null for users created before it was tracked.
+	PasswordChangedAt sql.NullTime `json:"-"`
+	// TokenVersion is carried in issued tokens. Raising it invalidates every
+	// token issued before.
+	TokenVersion int64     `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
 }
 
 func (u *User) EncryptSensitiveFields(key string) error {
@@ -0,0 +1,339 @@
+package rbac
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"gobizmanager/pkg/condition"
+	pkgctx "gobizmanager/pkg/context"
+)
+
+// Reason explains an authorization decision
+type Reason string
+
+const (
+	// ReasonRoot allows global ROOT users every action in every company
+	ReasonRoot Reason = "root"
+	// ReasonGranted allows an action held through a role of the company
+	ReasonGranted Reason = "granted"
+	// ReasonUnknownAction denies a module action that does not exist
+	ReasonUnknownAction Reason = "unknown_action"
+	// ReasonNotMember denies users who do not belong to the company
+	ReasonNotMember Reason = "not_member"
+	// ReasonNotGranted denies members whose roles do not grant the action
+	ReasonNotGranted Reason = "not_granted"
+	// ReasonDenied denies actions denied to the member or one of its roles,
+	// whatever their grants
+	ReasonDenied Reason = "denied"
+	// ReasonConditionNotMet denies actions only granted under conditions the
+	// request and resource do not satisfy
+	ReasonConditionNotMet Reason = "condition_not_met"
+	// ReasonOutsideTokenScope denies actions a company-scoped token or API key
+	// was not issued for, even when the user holds them
+	ReasonOutsideTokenScope Reason = "outside_token_scope"
+)
+
+// Decision is the outcome of an authorization check. RoleID, PermissionID,
+// PermissionGroupID and Condition name the grant that allowed the action,
+// DenyID the deny that refused it.
+type Decision struct {
+	Allowed           bool   `json:"allowed"`
+	Reason            Reason `json:"reason"`
+	ModuleActionID    int64  `json:"module_action_id,omitempty"`
+	RoleID            int64  `json:"role_id,omitempty"`
+	PermissionID      int64  `json:"permission_id,omitempty"`
+	PermissionGroupID int64  `json:"permission_group_id,omitempty"`
+	Condition         string `json:"condition,omitempty"`
+	DenyID            int64  `json:"deny_id,omitempty"`
+}
+
+// Authorizer decides whether a user may perform a module action in a company.
+// Only the roles the user holds through its membership of that company count.
+// The permissions of each user and company are compiled once and cached for
+// cacheTTL, up to cacheSize users and companies; a cacheSize of 0 disables
+// the cache. Cached permissions are only used while the RBAC version of the
+// company is the one they were loaded at, so changes made through another
+// instance are seen on the next check.
+type Authorizer struct {
+	repo  *Repository
+	cache *permissionCache
+
+	actionsMu sync.RWMutex
+	actions   map[string]int64 // module action IDs by module:action
+}
+
+func NewAuthorizer(repo *Repository, cacheTTL time.Duration, cacheSize int) *Authorizer {
+	return &Authorizer{
+		repo:    repo,
+		cache:   newPermissionCache(cacheTTL, cacheSize),
+		actions: make(map[string]int64),
+	}
+}
+
+// Version identifies the RBAC state of the company. It is stored with the
+// company and bumped, see BumpVersion, in the transaction of every change of
+// the permissions of the company or of one of its members.
+func (a *Authorizer) Version(companyID int64) (string, error) {
+	version, _, err := a.repo.GetVersion(companyID)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(version, 10), nil
+}
+
+// InvalidateUser drops the cached permissions of the user in the company. It
+// should be called when the roles of the membership change or it is removed,
+// so that this instance frees them right away; other instances notice the
+// bumped version.
+func (a *Authorizer) InvalidateUser(userID, companyID int64) {
+	key := cacheKey{userID: userID, companyID: companyID}
+	a.cache.invalidate(func(k cacheKey) bool { return k == key })
+}
+
+// InvalidateCompany drops the cached permissions of everyone in the company.
+// It should be called when the company's roles or permissions change or the
+// company is deleted.
+func (a *Authorizer) InvalidateCompany(companyID int64) {
+	a.cache.invalidate(func(k cacheKey) bool { return k.companyID == companyID })
+}
+
+// Authorize decides for the request in ctx. Requests authenticated with a
+// company-scoped token or API key are limited to their active company and to
+// the actions in their digest.
+func (a *Authorizer) Authorize(ctx context.Context, userID, companyID int64, moduleName, actionName string) (Decision, error) {
+	return a.AuthorizeResource(ctx, userID, companyID, moduleName, actionName, nil)
+}
+
+// AuthorizeResource is Authorize for an action on a resource. Conditions of
+// the grants are evaluated against the resource attributes, which are nil
+// when the request addresses no single resource.
+func (a *Authorizer) AuthorizeResource(ctx context.Context, userID, companyID int64, moduleName, actionName string, resource condition.Attributes) (Decision, error) {
+	decision, err := a.Evaluate(userID, companyID, moduleName, actionName, resource)
+	if err != nil || !decision.Allowed {
+		return decision, err
+	}
+
+	if activeID, ok := pkgctx.GetCompanyID(ctx); ok {
+		if activeID != companyID || !pkgctx.GetPermissions(ctx).Has(decision.ModuleActionID) {
+			return Decision{Reason: ReasonOutsideTokenScope, ModuleActionID: decision.ModuleActionID}, nil
+		}
+	}
+	return decision, nil
+}
+
+// Evaluate decides from the user's roles alone, following
+// company_users → user_roles → roles → role_permissions → permissions →
+// permission_module_actions for the company. Denies of the member or its
+// roles win over grants, except for ROOT. Conditional grants only count when
+// their condition holds for the request and resource, see Attributes.
+func (a *Authorizer) Evaluate(userID, companyID int64, moduleName, actionName string, resource condition.Attributes) (Decision, error) {
+	moduleActionID, err := a.moduleActionID(moduleName, actionName)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return Decision{Reason: ReasonUnknownAction}, nil
+	}
+	if err != nil {
+		return Decision{}, err
+	}
+
+	set, err := a.permissionSet(userID, companyID)
+	if err != nil {
+		return Decision{}, err
+	}
+	if set == nil {
+		return Decision{Reason: ReasonNotMember, ModuleActionID: moduleActionID}, nil
+	}
+	if set.root {
+		return Decision{Allowed: true, Reason: ReasonRoot, ModuleActionID: moduleActionID}, nil
+	}
+
+	if denyID, ok := set.denies[moduleActionID]; ok {
+		return Decision{Reason: ReasonDenied, ModuleActionID: moduleActionID, DenyID: denyID}, nil
+	}
+	grants, ok := set.grants[moduleActionID]
+	if !ok {
+		return Decision{Reason: ReasonNotGranted, ModuleActionID: moduleActionID}, nil
+	}
+
+	var attrs condition.Attributes
+	for _, grant := range grants {
+		if grant.Condition != "" {
+			if attrs == nil {
+				attrs = Attributes(userID, companyID, resource)
+			}
+			// Conditions that fail to evaluate do not grant anything
+			if ok, err := set.conditions[grant.Condition].Eval(attrs); err != nil || !ok {
+				continue
+			}
+		}
+		return Decision{
+			Allowed:           true,
+			Reason:            ReasonGranted,
+			ModuleActionID:    moduleActionID,
+			RoleID:            grant.RoleID,
+			PermissionID:      grant.PermissionID,
+			PermissionGroupID: grant.GroupID,
+			Condition:         grant.Condition,
+		}, nil
+	}
+	return Decision{Reason: ReasonConditionNotMet, ModuleActionID: moduleActionID}, nil
+}
+
+// Attributes returns what conditions are evaluated against: the user, the
+// company, the time of the request in UTC and the resource supplied by the
+// handler, if any
+func Attributes(userID, companyID int64, resource condition.Attributes) condition.Attributes {
+	now := time.Now().UTC()
+	return condition.Attributes{
+		"user":    condition.Attributes{"id": userID},
+		"company": condition.Attributes{"id": companyID},
+		"request": condition.Attributes{
+			"time":    now.Unix(),
+			"hour":    now.Hour(),
+			"weekday": int(now.Weekday()),
+		},
+		"resource": resource,
+	}
+}
+
+// Granted returns the module actions, as module:action, the request in ctx
+// may perform in the company, with the same token scope as Authorize. Module
+// actions only granted under conditions are returned apart, unevaluated.
+func (a *Authorizer) Granted(ctx context.Context, userID, companyID int64) (granted, conditional []string, err error) {
+	granted, conditional = []string{}, []string{}
+	set, err := a.permissionSet(userID, companyID)
+	if err != nil || set == nil {
+		return granted, conditional, err
+	}
+
+	activeID, scoped := pkgctx.GetCompanyID(ctx)
+	if scoped && activeID != companyID {
+		return granted, conditional, nil
+	}
+	digest := pkgctx.GetPermissions(ctx)
+
+	actions, err := a.repo.ListModuleActionNames()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, action := range actions {
+		if scoped && !digest.Has(action.ID) {
+			continue
+		}
+		name := action.ModuleName + ":" + action.Name
+		if set.root {
+			granted = append(granted, name)
+			continue
+		}
+		grants, ok := set.grants[action.ID]
+		if _, denied := set.denies[action.ID]; !ok || denied {
+			continue
+		}
+		if grants[0].Condition == "" {
+			granted = append(granted, name)
+		} else {
+			conditional = append(conditional, name)
+		}
+	}
+	return granted, conditional, nil
+}
+
+// permissionSet returns the compiled permissions of the user in the company,
+// or nil when the user is neither ROOT nor a member. Non-members are not
+// cached so that new members are let in right away, nor is anyone in a
+// company that no longer exists. The version is read before the permissions,
+// so a concurrent change leaves the cached set stale.
+func (a *Authorizer) permissionSet(userID, companyID int64) (*permissionSet, error) {
+	version, exists, err := a.repo.GetVersion(companyID)
+	if err != nil {
+		return nil, err
+	}
+	key := cacheKey{userID: userID, companyID: companyID}
+	set := a.cache.get(key, version)
+	if set != nil && exists {
+		return set, nil
+	}
+
+	isRoot, err := a.repo.IsRoot(userID)
+	if err != nil {
+		return nil, err
+	}
+	if isRoot {
+		set = &permissionSet{root: true}
+	} else {
+		companyUser, err := a.repo.GetCompanyUserByCompanyAndUser(companyID, userID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		grants, err := a.repo.ListGrants(companyUser)
+		if err != nil {
+			return nil, err
+		}
+		denies, err := a.repo.ListDenies(companyUser)
+		if err != nil {
+			return nil, err
+		}
+		set = &permissionSet{grants: grants, denies: denies, conditions: compileConditions(grants)}
+	}
+
+	if exists {
+		a.cache.put(key, set, version)
+	}
+	return set, nil
+}
+
+// compileConditions parses the conditions of the grants. Conditions are
+// validated when saved; one that no longer parses never holds, so its grants
+// are dropped.
+func compileConditions(grants map[int64][]Grant) map[string]*condition.Expr {
+	conditions := make(map[string]*condition.Expr)
+	for moduleActionID, held := range grants {
+		valid := held[:0]
+		for _, grant := range held {
+			if grant.Condition != "" {
+				if _, ok := conditions[grant.Condition]; !ok {
+					expr, err := condition.Parse(grant.Condition)
+					if err != nil {
+						continue
+					}
+					conditions[grant.Condition] = expr
+				}
+			}
+			valid = append(valid, grant)
+		}
+		if len(valid) == 0 {
+			delete(grants, moduleActionID)
+		} else {
+			grants[moduleActionID] = valid
+		}
+	}
+	return conditions
+}
+
+// moduleActionID looks up a module action. Module actions are seeded by
+// migrations and never change while the server runs.
+func (a *Authorizer) moduleActionID(moduleName, actionName string) (int64, error) {
+	name := moduleName + ":" + actionName
+	a.actionsMu.RLock()
+	id, ok := a.actions[name]
+	a.actionsMu.RUnlock()
+	if ok {
+		return id, nil
+	}
+
+	id, err := a.repo.GetModuleActionID(moduleName, actionName)
+	if err != nil {
+		return 0, err
+	}
+	a.actionsMu.Lock()
+	a.actions[name] = id
+	a.actionsMu.Unlock()
+	return id, nil
+}
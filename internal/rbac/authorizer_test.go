@@ -0,0 +1,294 @@
+package rbac
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"gobizmanager/internal/auth"
+	"gobizmanager/internal/testutil"
+	"gobizmanager/pkg/language"
+)
+
+// seededActions are the module actions migrations seed, by ID
+var seededActions = []struct {
+	id             int64
+	module, action string
+}{
+	{1, ModuleCompany, ActionCreate},
+	{2, ModuleCompany, ActionRead},
+	{3, ModuleCompany, ActionUpdate},
+	{4, ModuleCompany, ActionDelete},
+	{5, ModuleUser, ActionCreate},
+	{6, ModuleUser, ActionRead},
+	{7, ModuleUser, ActionUpdate},
+	{8, ModuleUser, ActionDelete},
+	{9, ModuleRole, ActionCreate},
+	{10, ModuleRole, ActionRead},
+	{11, ModuleRole, ActionUpdate},
+	{12, ModuleRole, ActionDelete},
+}
+
+// principals are the users of a company the tests check access for
+type principals struct {
+	companyID int64
+	root      int64 // global ROOT, not a member
+	outsider  int64 // member of another company holding every action there
+	granted   int64 // member whose role holds every action
+	ungranted int64 // member whose role holds nothing
+}
+
+func newPrincipals(t testing.TB, db *gorm.DB) principals {
+	t.Helper()
+	p := principals{companyID: testutil.CreateCompany(t, db, "Acme")}
+	otherID := testutil.CreateCompany(t, db, "Globex")
+
+	allActions := make([]int64, 0, len(seededActions))
+	for _, seeded := range seededActions {
+		allActions = append(allActions, seeded.id)
+	}
+
+	p.root = testutil.CreateUser(t, db, "root@example.com")
+	testutil.MakeRoot(t, db, p.root)
+
+	p.outsider = testutil.CreateUser(t, db, "outsider@example.com")
+	otherRole := testutil.CreateRole(t, db, otherID, "Owner")
+	testutil.Grant(t, db, otherID, otherRole, allActions...)
+	testutil.AddMember(t, db, otherID, p.outsider, otherRole)
+
+	p.granted = testutil.CreateUser(t, db, "granted@example.com")
+	ownerRole := testutil.CreateRole(t, db, p.companyID, "Owner")
+	testutil.Grant(t, db, p.companyID, ownerRole, allActions...)
+	testutil.AddMember(t, db, p.companyID, p.granted, ownerRole)
+
+	p.ungranted = testutil.CreateUser(t, db, "ungranted@example.com")
+	guestRole := testutil.CreateRole(t, db, p.companyID, "Guest")
+	testutil.AddMember(t, db, p.companyID, p.ungranted, guestRole)
+	return p
+}
+
+func TestEvaluate(t *testing.T) {
+	db := testutil.NewDB(t)
+	p := newPrincipals(t, db)
+	authorizer := NewAuthorizer(NewRepository(db), time.Minute, 100)
+
+	users := []struct {
+		name    string
+		userID  int64
+		allowed bool
+		reason  Reason
+	}{
+		{"root", p.root, true, ReasonRoot},
+		{"non-member", p.outsider, false, ReasonNotMember},
+		{"member with grant", p.granted, true, ReasonGranted},
+		{"member without grant", p.ungranted, false, ReasonNotGranted},
+	}
+	for _, user := range users {
+		for _, seeded := range seededActions {
+			t.Run(user.name+"/"+seeded.module+":"+seeded.action, func(t *testing.T) {
+				decision, err := authorizer.Evaluate(user.userID, p.companyID, seeded.module, seeded.action, nil)
+				if err != nil {
+					t.Fatalf("evaluate: %v", err)
+				}
+				if decision.Allowed != user.allowed || decision.Reason != user.reason {
+					t.Errorf("got allowed=%v reason=%s, want allowed=%v reason=%s",
+						decision.Allowed, decision.Reason, user.allowed, user.reason)
+				}
+				if decision.ModuleActionID != seeded.id {
+					t.Errorf("got module action %d, want %d", decision.ModuleActionID, seeded.id)
+				}
+			})
+		}
+
+		t.Run(user.name+"/unknown action", func(t *testing.T) {
+			decision, err := authorizer.Evaluate(user.userID, p.companyID, ModuleCompany, "approve", nil)
+			if err != nil {
+				t.Fatalf("evaluate: %v", err)
+			}
+			if decision.Allowed || decision.Reason != ReasonUnknownAction {
+				t.Errorf("got allowed=%v reason=%s, want a denial for an unknown action", decision.Allowed, decision.Reason)
+			}
+		})
+	}
+}
+
+func TestGranted(t *testing.T) {
+	db := testutil.NewDB(t)
+	p := newPrincipals(t, db)
+	authorizer := NewAuthorizer(NewRepository(db), time.Minute, 100)
+
+	tests := []struct {
+		name   string
+		userID int64
+		want   int
+	}{
+		{"root", p.root, len(seededActions)},
+		{"non-member", p.outsider, 0},
+		{"member with grant", p.granted, len(seededActions)},
+		{"member without grant", p.ungranted, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			granted, conditional, err := authorizer.Granted(context.Background(), tt.userID, p.companyID)
+			if err != nil {
+				t.Fatalf("granted: %v", err)
+			}
+			if len(granted) != tt.want {
+				t.Errorf("got %d granted module actions %v, want %d", len(granted), granted, tt.want)
+			}
+			if len(conditional) != 0 {
+				t.Errorf("got conditional module actions %v, want none", conditional)
+			}
+		})
+	}
+}
+
+// TestEvaluatePrefersDirectGrants holds a module action through a permission
+// group of one role and directly through a later role
+func TestEvaluatePrefersDirectGrants(t *testing.T) {
+	db := testutil.NewDB(t)
+	repo := NewRepository(db)
+	companyID := testutil.CreateCompany(t, db, "Acme")
+	groupRoleID := testutil.CreateRole(t, db, companyID, "Grouped")
+	directRoleID := testutil.CreateRole(t, db, companyID, "Direct")
+	permissionID := testutil.Grant(t, db, companyID, directRoleID, 3)
+
+	group := &PermissionGroup{CompanyID: companyID, Name: "Editors", Description: "Edit the company"}
+	if err := repo.CreatePermissionGroup(group, []int64{permissionID}); err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	groupRole, err := repo.GetRoleByID(groupRoleID)
+	if err != nil {
+		t.Fatalf("get role: %v", err)
+	}
+	if err := repo.SetRolePermissionGroups(groupRole, []int64{group.ID}); err != nil {
+		t.Fatalf("set role groups: %v", err)
+	}
+
+	userID := testutil.CreateUser(t, db, "member@example.com")
+	testutil.AddMember(t, db, companyID, userID, groupRoleID, directRoleID)
+
+	decision, err := NewAuthorizer(repo, time.Minute, 100).Evaluate(userID, companyID, ModuleCompany, ActionUpdate, nil)
+	if err != nil {
+		t.Fatalf("evaluate: %v", err)
+	}
+	if !decision.Allowed || decision.RoleID != directRoleID || decision.PermissionGroupID != 0 {
+		t.Errorf("got %+v, want the direct grant of role %d", decision, directRoleID)
+	}
+}
+
+// TestChangeThroughAnotherInstance changes permissions through one
+// authorizer's repository while another holds them cached, as with two
+// server instances sharing the database
+func TestChangeThroughAnotherInstance(t *testing.T) {
+	db := testutil.NewDB(t)
+	p := newPrincipals(t, db)
+	repo := NewRepository(db)
+	cached := NewAuthorizer(repo, time.Minute, 100)
+	other := NewAuthorizer(repo, time.Minute, 100)
+
+	version, err := cached.Version(p.companyID)
+	if err != nil {
+		t.Fatalf("version: %v", err)
+	}
+	decision, err := cached.Evaluate(p.granted, p.companyID, ModuleRole, ActionDelete, nil)
+	if err != nil || !decision.Allowed {
+		t.Fatalf("before the change: got %+v, %v", decision, err)
+	}
+
+	companyUser, err := repo.GetCompanyUserByCompanyAndUser(p.companyID, p.granted)
+	if err != nil {
+		t.Fatalf("company user: %v", err)
+	}
+	deny := &PermissionDeny{CompanyID: p.companyID, CompanyUserID: &companyUser.ID, ModuleActionID: decision.ModuleActionID}
+	if err := repo.CreatePermissionDeny(deny); err != nil {
+		t.Fatalf("create deny: %v", err)
+	}
+	other.InvalidateUser(p.granted, p.companyID)
+
+	decision, err = cached.Evaluate(p.granted, p.companyID, ModuleRole, ActionDelete, nil)
+	if err != nil || decision.Reason != ReasonDenied {
+		t.Errorf("after the change: got %+v, %v, want %s", decision, err, ReasonDenied)
+	}
+	changed, err := cached.Version(p.companyID)
+	if err != nil {
+		t.Fatalf("version: %v", err)
+	}
+	if changed == version {
+		t.Errorf("version stayed %s after the change", version)
+	}
+}
+
+func TestValidateCompanyRequest(t *testing.T) {
+	db := testutil.NewDB(t)
+	p := newPrincipals(t, db)
+	validator := NewValidator(NewRepository(db), nil)
+
+	tests := []struct {
+		name    string
+		userID  int64
+		wantErr string
+	}{
+		{"root", p.root, ""},
+		{"non-member", p.outsider, language.PermissionDenied},
+		{"member with grant", p.granted, ""},
+		{"member without grant", p.ungranted, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.WithValue(context.Background(), auth.UserIDKey, tt.userID)
+			err := validator.ValidateCompanyRequest(ctx, p.companyID)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("got %v, want access", err)
+			}
+			if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Fatalf("got %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("root outside the request's company", func(t *testing.T) {
+		ctx := context.WithValue(context.Background(), auth.UserIDKey, p.root)
+		ctx = context.WithValue(ctx, requestCompanyKey, p.companyID+1)
+		err := validator.ValidateCompanyRequest(ctx, p.companyID)
+		if err == nil || err.Error() != language.PermissionDenied {
+			t.Fatalf("got %v, want %s", err, language.PermissionDenied)
+		}
+	})
+}
+
+func TestEvaluateConditions(t *testing.T) {
+	db := testutil.NewDB(t)
+	companyID := testutil.CreateCompany(t, db, "Acme")
+	userID := testutil.CreateUser(t, db, "member@example.com")
+	roleID := testutil.CreateRole(t, db, companyID, "Reviewer")
+	testutil.GrantIf(t, db, companyID, roleID, "resource.owner_id != user.id", 7) // user:update
+	testutil.AddMember(t, db, companyID, userID, roleID)
+	authorizer := NewAuthorizer(NewRepository(db), time.Minute, 100)
+
+	tests := []struct {
+		name     string
+		resource map[string]any
+		allowed  bool
+		reason   Reason
+	}{
+		{"no resource", nil, false, ReasonConditionNotMet},
+		{"resource without the attribute", map[string]any{"id": 1}, false, ReasonConditionNotMet},
+		{"own resource", map[string]any{"owner_id": userID}, false, ReasonConditionNotMet},
+		{"resource of another user", map[string]any{"owner_id": userID + 1}, true, ReasonGranted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, err := authorizer.Evaluate(userID, companyID, ModuleUser, ActionUpdate, tt.resource)
+			if err != nil {
+				t.Fatalf("evaluate: %v", err)
+			}
+			if decision.Allowed != tt.allowed || decision.Reason != tt.reason {
+				t.Errorf("got allowed=%v reason=%s, want allowed=%v reason=%s",
+					decision.Allowed, decision.Reason, tt.allowed, tt.reason)
+			}
+		})
+	}
+}
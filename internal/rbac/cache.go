@@ -0,0 +1,109 @@
+package rbac
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"gobizmanager/pkg/condition"
+)
+
+// permissionSet is the compiled authorization state of a user in a company:
+// whether the user is ROOT, the grants of every module action its roles hold
+// there with their parsed conditions, and the deny of every module action
+// denied to it
+type permissionSet struct {
+	root       bool
+	grants     map[int64][]Grant
+	conditions map[string]*condition.Expr
+	denies     map[int64]int64
+}
+
+type cacheKey struct {
+	userID    int64
+	companyID int64
+}
+
+type cacheEntry struct {
+	key       cacheKey
+	set       *permissionSet
+	version   int64 // RBAC version of the company the set was loaded at
+	expiresAt time.Time
+}
+
+// permissionCache keeps the most recently used permission sets for a limited
+// time, each along with the RBAC version of the company it was loaded at
+type permissionCache struct {
+	ttl  time.Duration
+	size int
+
+	mu      sync.Mutex
+	entries map[cacheKey]*list.Element
+	order   *list.List // most recently used first
+}
+
+func newPermissionCache(ttl time.Duration, size int) *permissionCache {
+	return &permissionCache{
+		ttl:     ttl,
+		size:    size,
+		entries: make(map[cacheKey]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// get returns the cached set of the user in the company, or nil when there
+// is none loaded at the version or it expired
+func (c *permissionCache) get(key cacheKey, version int64) *permissionSet {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		if entry.version == version && time.Now().Before(entry.expiresAt) {
+			c.order.MoveToFront(elem)
+			return entry.set
+		}
+		c.remove(elem)
+	}
+	return nil
+}
+
+// put stores a set loaded at version, evicting the least recently used sets
+// beyond the size limit
+func (c *permissionCache) put(key cacheKey, set *permissionSet, version int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.size <= 0 {
+		return
+	}
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{
+		key:       key,
+		set:       set,
+		version:   version,
+		expiresAt: time.Now().Add(c.ttl),
+	})
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+// invalidate drops the sets matching the filter
+func (c *permissionCache) invalidate(match func(cacheKey) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, elem := range c.entries {
+		if match(key) {
+			c.remove(elem)
+		}
+	}
+}
+
+func (c *permissionCache) remove(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*cacheEntry).key)
+}
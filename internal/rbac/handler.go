@@ -1,6 +1,7 @@
 package rbac
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
@@ -15,6 +16,7 @@ import (
 	"gobizmanager/pkg/language"
 	"gobizmanager/pkg/logger"
 	"gobizmanager/pkg/utils"
+	"gobizmanager/platform/middleware/permission"
 )
 
 type RbacBaseHandler struct {
@@ -22,40 +24,167 @@ type RbacBaseHandler struct {
 	MsgStore *language.MessageStore
 }
 
-func NewBaseHandler(repo *Repository, msgStore *language.MessageStore) *RbacBaseHandler {
+func NewBaseHandler(repo *Repository, authorizer *Authorizer, msgStore *language.MessageStore) *RbacBaseHandler {
 	val := NewValidator(repo, msgStore)
-	service := NewService(repo, val)
+	service := NewService(repo, val, authorizer)
 	return &RbacBaseHandler{
 		Service:  service,
 		MsgStore: msgStore,
 	}
 }
 
-// RequirePermission is a middleware to check if user has permission to access a resource
+type contextKey string
+
+const requestCompanyKey contextKey = "requestCompanyID"
+
+// RequirePermission is a middleware to check if user has permission to access a resource.
+// The company is taken from the URL, see requestCompany, and the request is
+// only let through when the caller holds the module action there.
 func (h *RbacBaseHandler) RequirePermission(moduleName, actionName string) func(http.Handler) http.Handler {
+	return h.RequirePermissionOn(moduleName, actionName, nil)
+}
+
+// RequirePermissionOn is RequirePermission for a route addressing a single
+// resource. When only conditional grants remain, they are evaluated again
+// against the attributes load returns; without a loader, conditions reading
+// the resource fail and deny the request.
+func (h *RbacBaseHandler) RequirePermissionOn(moduleName, actionName string, load permission.ResourceLoader) func(http.Handler) http.Handler {
+	req := permission.Requirement{Module: moduleName, Action: actionName}
 	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		return permission.Declare(req, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			userID, ok := auth.GetUserID(r.Context())
 			if !ok {
 				utils.RespondError(w, r, h.MsgStore, errors.New(language.AuthInvalidRequest))
 				return
 			}
 
-			hasPermission, err := h.Service.CheckPermission(r.Context(), userID, moduleName, actionName)
+			companyID, err := h.requestCompany(r)
+			if err != nil {
+				utils.RespondError(w, r, h.MsgStore, err)
+				return
+			}
+
+			decision, err := h.Service.CheckPermission(r.Context(), userID, companyID, moduleName, actionName, nil)
+			// The resource is only loaded when a conditional grant needs it
+			if err == nil && decision.Reason == ReasonConditionNotMet && load != nil {
+				resource, loadErr := load(r)
+				if loadErr != nil {
+					utils.RespondError(w, r, h.MsgStore, loadErr)
+					return
+				}
+				decision, err = h.Service.CheckPermission(r.Context(), userID, companyID, moduleName, actionName, resource)
+			}
 			if err != nil {
 				logger.Error("Error checking permission", zap.Error(err))
 				utils.RespondError(w, r, h.MsgStore, errors.New(language.PermissionCheckFailed))
 				return
 			}
-			if !hasPermission {
+			if !decision.Allowed {
+				logger.Info("Permission denied",
+					zap.Int64("userID", userID),
+					zap.Int64("companyID", companyID),
+					zap.String("permission", req.String()),
+					zap.String("reason", string(decision.Reason)))
 				utils.RespondError(w, r, h.MsgStore, errors.New(language.PermissionDenied))
 				return
 			}
-			next.ServeHTTP(w, r)
-		})
+
+			ctx := context.WithValue(r.Context(), requestCompanyKey, companyID)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		}))
 	}
 }
 
+// RequireAuthentication declares a route that needs no module action, because
+// it only acts on the caller's own data
+func (h *RbacBaseHandler) RequireAuthentication() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return permission.Declare(permission.Requirement{}, next)
+	}
+}
+
+// RequestCompanyID returns the company RequirePermission authorized the
+// request for. Handlers must not act on resources of other companies.
+func RequestCompanyID(ctx context.Context) (int64, bool) {
+	companyID, ok := ctx.Value(requestCompanyKey).(int64)
+	return companyID, ok
+}
+
+// requestCompany returns the company a request addresses. It is, in order,
+// the companyID URL parameter, the company owning the role, permission or
+// permission group in the URL, the company_id query parameter, or the active
+// company of a company-scoped token.
+func (h *RbacBaseHandler) requestCompany(r *http.Request) (int64, error) {
+	if value := chi.URLParam(r, "companyID"); value != "" {
+		return parseID(value)
+	}
+
+	if value := chi.URLParam(r, "roleID"); value != "" {
+		roleID, err := parseID(value)
+		if err != nil {
+			return 0, err
+		}
+		role, err := h.Service.repo.GetRoleByID(roleID)
+		if err != nil || role.CompanyID == 0 {
+			return 0, errors.New(language.RoleNotFound)
+		}
+		return role.CompanyID, nil
+	}
+
+	if value := chi.URLParam(r, "permissionID"); value != "" {
+		permissionID, err := parseID(value)
+		if err != nil {
+			return 0, err
+		}
+		perm, err := h.Service.repo.GetPermissionByID(permissionID)
+		if err != nil || perm.CompanyID == 0 {
+			return 0, errors.New(language.PermissionNotFound)
+		}
+		return perm.CompanyID, nil
+	}
+
+	if value := chi.URLParam(r, "groupID"); value != "" {
+		groupID, err := parseID(value)
+		if err != nil {
+			return 0, err
+		}
+		group, err := h.Service.repo.GetPermissionGroup(groupID)
+		if err != nil {
+			return 0, errors.New(language.PermissionGroupNotFound)
+		}
+		return group.CompanyID, nil
+	}
+
+	if value := chi.URLParam(r, "denyID"); value != "" {
+		denyID, err := parseID(value)
+		if err != nil {
+			return 0, err
+		}
+		deny, err := h.Service.repo.GetPermissionDeny(denyID)
+		if err != nil {
+			return 0, errors.New(language.PermissionDenyNotFound)
+		}
+		return deny.CompanyID, nil
+	}
+
+	if value := r.URL.Query().Get("company_id"); value != "" {
+		return parseID(value)
+	}
+
+	if companyID, ok := pkgctx.GetCompanyID(r.Context()); ok {
+		return companyID, nil
+	}
+	return 0, errors.New(language.PermissionCompanyRequired)
+}
+
+func parseID(value string) (int64, error) {
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, errors.New(language.ValidationInvalidID)
+	}
+	return id, nil
+}
+
 func (h *RbacBaseHandler) CreatePermission(w http.ResponseWriter, r *http.Request) {
 	var req CreatePermissionRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -88,6 +217,7 @@ func (h *RbacBaseHandler) GetPermissionModuleActions(w http.ResponseWriter, r *h
 	permissionID := chi.URLParam(r, "permissionID")
 	if permissionID == "" {
 		utils.RespondError(w, r, h.MsgStore, errors.New(language.ValidationFailed))
+		return
 	}
 
 	permissionIDInt, err := strconv.ParseInt(permissionID, 10, 64)
@@ -98,16 +228,16 @@ func (h *RbacBaseHandler) GetPermissionModuleActions(w http.ResponseWriter, r *h
 
 	moduleActions, err := h.Service.GetPermissionModuleActions(r.Context(), permissionIDInt)
 	if err != nil {
-		panic(err)
+		logger.Error("Error getting permission module actions", zap.Error(err))
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
 	}
 
 	utils.JSON(w, http.StatusOK, moduleActions)
 }
 
 func (h *RbacBaseHandler) UpdatePermissionModuleActions(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		ModuleActionIDs []int64 `json:"module_action_ids" validate:"required"`
-	}
+	var req UpdatePermissionModuleActionsRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		utils.RespondError(w, r, h.MsgStore, errors.New(language.ValidationFailed))
 		return
@@ -119,9 +249,9 @@ func (h *RbacBaseHandler) UpdatePermissionModuleActions(w http.ResponseWriter, r
 		return
 	}
 
-	if err := h.Service.UpdatePermissionModuleActions(r.Context(), permissionID, req.ModuleActionIDs); err != nil {
+	if err := h.Service.UpdatePermissionModuleActions(r.Context(), permissionID, req.ModuleActionIDs, req.Conditions); err != nil {
 		logger.Error("Error updating permission module actions", zap.Error(err))
-		utils.RespondError(w, r, h.MsgStore, errors.New(language.PermissionAssignFailed))
+		utils.RespondError(w, r, h.MsgStore, err)
 		return
 	}
 	msg, httpStatus := h.MsgStore.GetMessage(pkgctx.GetLanguage(r.Context()), language.PermissionAssigned)
@@ -1,6 +1,10 @@
 package rbac
 
-import "time"
+import (
+	"time"
+
+	model "gobizmanager/internal/models"
+)
 
 type CompanyUser struct {
 	ID        int64     `json:"id"`
@@ -24,6 +28,7 @@ type ModuleAction struct {
 	ModuleID    int64     `json:"module_id"`
 	Name        string    `json:"name"`
 	Description string    `json:"description"`
+	Condition   string    `json:"condition,omitempty" gorm:"-"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
@@ -74,20 +79,180 @@ type RootGroup struct {
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
-// CreatePermissionGroupRequest represents the request to create a permission group
+// PermissionGroup bundles permissions of a company so that they can be given
+// to roles together
+type PermissionGroup struct {
+	ID          int64              `json:"id"`
+	CompanyID   int64              `json:"company_id"`
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Permissions []model.Permission `json:"permissions" gorm:"-"`
+	CreatedAt   time.Time          `json:"created_at"`
+	UpdatedAt   time.Time          `json:"updated_at"`
+}
+
+// PermissionGroupPermission represents the relationship between permission groups and permissions
+type PermissionGroupPermission struct {
+	ID           int64
+	GroupID      int64
+	PermissionID int64
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// RolePermissionGroup gives a role every permission of a group
+type RolePermissionGroup struct {
+	ID        int64
+	RoleID    int64
+	GroupID   int64
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// CreatePermissionGroupRequest represents the request to create a permission group.
+// The company is taken from the request when company_id is omitted.
 type CreatePermissionGroupRequest struct {
-	CompanyID     int64   `json:"company_id" validate:"required" msg:"company.id_required"`
+	CompanyID     int64   `json:"company_id"`
 	Name          string  `json:"name" validate:"required,min=3,max=100" msg:"permission.name_required"`
 	Description   string  `json:"description" validate:"required" msg:"permission.description_required"`
 	PermissionIDs []int64 `json:"permission_ids" validate:"required,min=1" msg:"permission.ids_required"`
 }
 
-// CreatePermissionModuleActionRequest represents a request to associate a module action with a permission
-type CreatePermissionModuleActionRequest struct {
-	PermissionID   int64 `json:"permission_id" validate:"required"`
+// PermissionDeny excludes a module action from a role of a company or from one
+// of its members, whatever their grants. Exactly one of RoleID and
+// CompanyUserID is set.
+type PermissionDeny struct {
+	ID             int64     `json:"id"`
+	CompanyID      int64     `json:"company_id"`
+	RoleID         *int64    `json:"role_id"`
+	CompanyUserID  *int64    `json:"company_user_id"`
+	ModuleActionID int64     `json:"module_action_id"`
+	Module         string    `json:"module" gorm:"->"`
+	Action         string    `json:"action" gorm:"->"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// CreatePermissionDenyRequest denies a module action to a role or to the
+// member of the company given by user_id. The company is taken from the
+// role, or from the request for members.
+type CreatePermissionDenyRequest struct {
+	RoleID         int64 `json:"role_id"`
+	UserID         int64 `json:"user_id"`
 	ModuleActionID int64 `json:"module_action_id" validate:"required"`
 }
 
+// CreatePermissionModuleActionRequest represents a request to associate a module action with a permission.
+// The module action is only granted when the optional condition holds.
+type CreatePermissionModuleActionRequest struct {
+	PermissionID   int64  `json:"permission_id" validate:"required"`
+	ModuleActionID int64  `json:"module_action_id" validate:"required"`
+	Condition      string `json:"condition"`
+}
+
+// UpdatePermissionModuleActionsRequest replaces the module actions of a
+// permission. Conditions maps module actions to the condition under which
+// they are granted; the others are granted unconditionally.
+type UpdatePermissionModuleActionsRequest struct {
+	ModuleActionIDs []int64          `json:"module_action_ids" validate:"required"`
+	Conditions      map[int64]string `json:"conditions"`
+}
+
+// UpdatePermissionGroupRequest replaces the name, description and permissions
+// of a permission group
+type UpdatePermissionGroupRequest struct {
+	Name          string  `json:"name" validate:"required,min=3,max=100" msg:"permission.name_required"`
+	Description   string  `json:"description" validate:"required" msg:"permission.description_required"`
+	PermissionIDs []int64 `json:"permission_ids" validate:"required,min=1" msg:"permission.ids_required"`
+}
+
+// SetRolePermissionGroupsRequest replaces the permission groups of a role
+type SetRolePermissionGroupsRequest struct {
+	GroupIDs []int64 `json:"group_ids"`
+}
+
+// SetRoleParentRequest sets the role a role inherits permissions from. A null
+// parent_role_id removes the parent.
+type SetRoleParentRequest struct {
+	ParentRoleID *int64 `json:"parent_role_id"`
+}
+
+// InheritedPermission is a permission a role holds through an ancestor
+type InheritedPermission struct {
+	model.Permission
+	InheritedFrom int64 `json:"inherited_from"`
+}
+
+// RoleDetails is a role with the permissions it holds directly, its
+// permission groups, the permissions it inherits from its ancestors, nearest
+// ancestor first, and the denies of the role and its ancestors
+type RoleDetails struct {
+	model.Role
+	PermissionGroups     []PermissionGroup     `json:"permission_groups"`
+	Ancestors            []int64               `json:"ancestors"`
+	InheritedPermissions []InheritedPermission `json:"inherited_permissions"`
+	Denies               []PermissionDeny      `json:"denies"`
+}
+
+// Links of the authorization path an explanation can stop at
+const (
+	LinkModuleActions           = "module_actions"
+	LinkCompanyUsers            = "company_users"
+	LinkUserRoles               = "user_roles"
+	LinkRolePermissions         = "role_permissions"
+	LinkPermissionModuleActions = "permission_module_actions"
+)
+
+// ExplainedPermission is a permission a role holds, directly or through the
+// permission group GroupID, with the module actions it grants and the
+// conditions of the conditional ones
+type ExplainedPermission struct {
+	ID              int64            `json:"id"`
+	Name            string           `json:"name"`
+	GroupID         int64            `json:"group_id,omitempty"`
+	ModuleActionIDs []int64          `json:"module_action_ids"`
+	Conditions      map[int64]string `json:"conditions,omitempty"`
+	Grants          bool             `json:"grants"`
+}
+
+// ExplainedRole is a role of the company the user holds, either assigned or
+// inherited by the assigned role InheritedBy
+type ExplainedRole struct {
+	ID          int64                 `json:"id"`
+	Name        string                `json:"name"`
+	Assigned    bool                  `json:"assigned"`
+	InheritedBy int64                 `json:"inherited_by,omitempty"`
+	Permissions []ExplainedPermission `json:"permissions"`
+}
+
+// Explanation is the decision path of a module action for a user in a
+// company. Denies lists the denies of the membership and its roles for the
+// action. MissingLink names the first link of the path that was not found
+// when the action is not granted.
+type Explanation struct {
+	UserID      int64            `json:"user_id"`
+	CompanyID   int64            `json:"company_id"`
+	Module      string           `json:"module"`
+	Action      string           `json:"action"`
+	Root        bool             `json:"root"`
+	CompanyUser *CompanyUser     `json:"company_user"`
+	Roles       []ExplainedRole  `json:"roles"`
+	Denies      []PermissionDeny `json:"denies"`
+	Decision    Decision         `json:"decision"`
+	MissingLink string           `json:"missing_link,omitempty"`
+}
+
+// EffectivePermissions are the module actions, as module:action, a user may
+// perform in a company. Conditional lists the module actions only granted
+// under conditions, which depend on the request and resource. Version
+// changes with the RBAC state of the company.
+type EffectivePermissions struct {
+	CompanyID   int64    `json:"company_id"`
+	Version     string   `json:"version"`
+	Permissions []string `json:"permissions"`
+	Conditional []string `json:"conditional"`
+}
+
 // UpdateRolePermissionsRequest represents the request to update role permissions
 type UpdateRolePermissionsRequest struct {
 	RoleID        string  `json:"role_id" validate:"required"`
@@ -124,10 +289,12 @@ type RolePermission struct {
 	UpdatedAt    time.Time
 }
 
-// PermissionModuleAction represents the relationship between permissions and module actions
+// PermissionModuleAction represents the relationship between permissions and module actions.
+// A non-empty Condition limits the grant to requests satisfying it.
 type PermissionModuleAction struct {
 	PermissionID   int64     `json:"permission_id" gorm:"primaryKey"`
 	ModuleActionID int64     `json:"module_action_id" gorm:"primaryKey"`
+	Condition      string    `json:"condition"`
 	CreatedAt      time.Time `json:"created_at"`
 	UpdatedAt      time.Time `json:"updated_at"`
 }
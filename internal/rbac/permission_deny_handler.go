@@ -0,0 +1,84 @@
+package rbac
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+	"go.uber.org/zap"
+
+	"gobizmanager/pkg/language"
+	"gobizmanager/pkg/logger"
+	"gobizmanager/pkg/utils"
+)
+
+// PermissionDenyHandler handles all permission deny HTTP requests
+type PermissionDenyHandler struct {
+	*RbacBaseHandler
+	validator *validator.Validate
+}
+
+func NewPermissionDenyHandler(repo *Repository, authorizer *Authorizer, msgStore *language.MessageStore) *PermissionDenyHandler {
+	return &PermissionDenyHandler{
+		RbacBaseHandler: NewBaseHandler(repo, authorizer, msgStore),
+		validator:       validator.New(),
+	}
+}
+
+// CreatePermissionDeny denies a module action to a role or a member of the
+// company
+func (h *PermissionDenyHandler) CreatePermissionDeny(w http.ResponseWriter, r *http.Request) {
+	var req CreatePermissionDenyRequest
+	if err := utils.ParseRequest(r, &req); err != nil {
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+	if err := h.validator.Struct(req); err != nil {
+		utils.ValidationError(w, r, err, h.MsgStore)
+		return
+	}
+
+	deny, err := h.Service.CreatePermissionDeny(r.Context(), &req)
+	if err != nil {
+		logger.Error("Error creating permission deny", zap.Error(err))
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusCreated, deny)
+}
+
+// ListPermissionDenies returns the denies of a company
+func (h *PermissionDenyHandler) ListPermissionDenies(w http.ResponseWriter, r *http.Request) {
+	companyID, err := parseID(chi.URLParam(r, "companyID"))
+	if err != nil {
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+
+	denies, err := h.Service.ListPermissionDenies(r.Context(), companyID)
+	if err != nil {
+		logger.Error("Error listing permission denies", zap.Error(err))
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, denies)
+}
+
+// DeletePermissionDeny deletes a deny. Grants of the module action apply again.
+func (h *PermissionDenyHandler) DeletePermissionDeny(w http.ResponseWriter, r *http.Request) {
+	denyID, err := parseID(chi.URLParam(r, "denyID"))
+	if err != nil {
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+
+	if err := h.Service.DeletePermissionDeny(r.Context(), denyID); err != nil {
+		logger.Error("Error deleting permission deny", zap.Error(err))
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusNoContent, nil)
+}
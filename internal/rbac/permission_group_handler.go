@@ -0,0 +1,130 @@
+package rbac
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+	"go.uber.org/zap"
+
+	"gobizmanager/pkg/language"
+	"gobizmanager/pkg/logger"
+	"gobizmanager/pkg/utils"
+)
+
+// PermissionGroupHandler handles all permission group HTTP requests
+type PermissionGroupHandler struct {
+	*RbacBaseHandler
+	validator *validator.Validate
+}
+
+func NewPermissionGroupHandler(repo *Repository, authorizer *Authorizer, msgStore *language.MessageStore) *PermissionGroupHandler {
+	return &PermissionGroupHandler{
+		RbacBaseHandler: NewBaseHandler(repo, authorizer, msgStore),
+		validator:       validator.New(),
+	}
+}
+
+// CreatePermissionGroup creates a permission group of the company
+func (h *PermissionGroupHandler) CreatePermissionGroup(w http.ResponseWriter, r *http.Request) {
+	var req CreatePermissionGroupRequest
+	if err := utils.ParseRequest(r, &req); err != nil {
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+	if err := h.validator.Struct(req); err != nil {
+		utils.ValidationError(w, r, err, h.MsgStore)
+		return
+	}
+
+	group, err := h.Service.CreatePermissionGroup(r.Context(), &req)
+	if err != nil {
+		logger.Error("Error creating permission group", zap.Error(err))
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusCreated, group)
+}
+
+// ListPermissionGroups returns the permission groups of a company
+func (h *PermissionGroupHandler) ListPermissionGroups(w http.ResponseWriter, r *http.Request) {
+	companyID, err := parseID(chi.URLParam(r, "companyID"))
+	if err != nil {
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+
+	groups, err := h.Service.ListPermissionGroups(r.Context(), companyID)
+	if err != nil {
+		logger.Error("Error listing permission groups", zap.Error(err))
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, groups)
+}
+
+// GetPermissionGroup returns a permission group with its permissions
+func (h *PermissionGroupHandler) GetPermissionGroup(w http.ResponseWriter, r *http.Request) {
+	groupID, err := parseID(chi.URLParam(r, "groupID"))
+	if err != nil {
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+
+	group, err := h.Service.GetPermissionGroup(r.Context(), groupID)
+	if err != nil {
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, group)
+}
+
+// UpdatePermissionGroup replaces the name, description and permissions of a
+// permission group
+func (h *PermissionGroupHandler) UpdatePermissionGroup(w http.ResponseWriter, r *http.Request) {
+	groupID, err := parseID(chi.URLParam(r, "groupID"))
+	if err != nil {
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+
+	var req UpdatePermissionGroupRequest
+	if err := utils.ParseRequest(r, &req); err != nil {
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+	if err := h.validator.Struct(req); err != nil {
+		utils.ValidationError(w, r, err, h.MsgStore)
+		return
+	}
+
+	group, err := h.Service.UpdatePermissionGroup(r.Context(), groupID, &req)
+	if err != nil {
+		logger.Error("Error updating permission group", zap.Error(err))
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, group)
+}
+
+// DeletePermissionGroup deletes a permission group. Roles lose the permissions
+// they held through it.
+func (h *PermissionGroupHandler) DeletePermissionGroup(w http.ResponseWriter, r *http.Request) {
+	groupID, err := parseID(chi.URLParam(r, "groupID"))
+	if err != nil {
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+
+	if err := h.Service.DeletePermissionGroup(r.Context(), groupID); err != nil {
+		logger.Error("Error deleting permission group", zap.Error(err))
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusNoContent, nil)
+}
@@ -3,11 +3,15 @@ package rbac
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"hash/fnv"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 
+	"gobizmanager/internal/auth"
 	pkgctx "gobizmanager/pkg/context"
 	"gobizmanager/pkg/language"
 	"gobizmanager/pkg/logger"
@@ -21,9 +25,9 @@ type PermissionHandler struct {
 	*RbacBaseHandler
 }
 
-func NewPermissionHandler(repo *Repository, msgStore *language.MessageStore) *PermissionHandler {
+func NewPermissionHandler(repo *Repository, authorizer *Authorizer, msgStore *language.MessageStore) *PermissionHandler {
 	return &PermissionHandler{
-		RbacBaseHandler: NewBaseHandler(repo, msgStore),
+		RbacBaseHandler: NewBaseHandler(repo, authorizer, msgStore),
 	}
 }
 
@@ -99,9 +103,9 @@ func (h *PermissionHandler) CreatePermissionModuleAction(w http.ResponseWriter,
 		return
 	}
 
-	if err := h.Service.CreatePermissionModuleAction(r.Context(), req.PermissionID, req.ModuleActionID); err != nil {
+	if err := h.Service.CreatePermissionModuleAction(r.Context(), req.PermissionID, req.ModuleActionID, req.Condition); err != nil {
 		logger.Error("Error creating permission module action", zap.Error(err))
-		utils.RespondError(w, r, h.MsgStore, errors.New(language.PermissionAssignFailed))
+		utils.RespondError(w, r, h.MsgStore, err)
 		return
 	}
 
@@ -135,9 +139,7 @@ func (h *PermissionHandler) GetPermissionModuleActions(w http.ResponseWriter, r
 
 // UpdatePermissionModuleActions updates module actions for a permission
 func (h *PermissionHandler) UpdatePermissionModuleActions(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		ModuleActionIDs []int64 `json:"module_action_ids" validate:"required"`
-	}
+	var req UpdatePermissionModuleActionsRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		utils.RespondError(w, r, h.MsgStore, errors.New(language.ValidationFailed))
 		return
@@ -149,9 +151,9 @@ func (h *PermissionHandler) UpdatePermissionModuleActions(w http.ResponseWriter,
 		return
 	}
 
-	if err := h.Service.UpdatePermissionModuleActions(r.Context(), permissionID, req.ModuleActionIDs); err != nil {
+	if err := h.Service.UpdatePermissionModuleActions(r.Context(), permissionID, req.ModuleActionIDs, req.Conditions); err != nil {
 		logger.Error("Error updating permission module actions", zap.Error(err))
-		utils.RespondError(w, r, h.MsgStore, errors.New(language.PermissionAssignFailed))
+		utils.RespondError(w, r, h.MsgStore, err)
 		return
 	}
 
@@ -169,3 +171,71 @@ func (h *PermissionHandler) GetModuleActions(w http.ResponseWriter, r *http.Requ
 
 	utils.JSON(w, http.StatusOK, actions)
 }
+
+// ExplainPermission explains why a user may or may not perform a module
+// action in a company
+func (h *PermissionHandler) ExplainPermission(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	userID, err := parseID(query.Get("user_id"))
+	if err != nil {
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+	companyID, err := parseID(query.Get("company_id"))
+	if err != nil {
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+	moduleName, actionName := query.Get("module"), query.Get("action")
+	if moduleName == "" || actionName == "" {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.ValidationFailed))
+		return
+	}
+
+	explanation, err := h.Service.Explain(r.Context(), userID, companyID, moduleName, actionName)
+	if err != nil {
+		logger.Error("Error explaining permission", zap.Error(err))
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, explanation)
+}
+
+// GetMyPermissions returns the module actions the caller may perform in the
+// company given by the company_id query parameter, or in the active company.
+// The ETag changes with the RBAC version of the company, so clients can
+// revalidate with If-None-Match and only reload after roles change.
+func (h *PermissionHandler) GetMyPermissions(w http.ResponseWriter, r *http.Request) {
+	var companyID int64
+	if value := r.URL.Query().Get("company_id"); value != "" {
+		id, err := parseID(value)
+		if err != nil {
+			utils.RespondError(w, r, h.MsgStore, err)
+			return
+		}
+		companyID = id
+	}
+
+	permissions, err := h.Service.EffectivePermissions(r.Context(), companyID)
+	if err != nil {
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+
+	// The permissions also depend on the user and the token scope, which the
+	// version does not cover
+	hash := fnv.New64a()
+	userID, _ := auth.GetUserID(r.Context())
+	fmt.Fprintf(hash, "%d:%s", userID, strings.Join(permissions.Permissions, ","))
+	etag := fmt.Sprintf(`"%s-%x"`, permissions.Version, hash.Sum64())
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, permissions)
+}
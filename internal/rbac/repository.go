@@ -1,6 +1,7 @@
 package rbac
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
 	"time"
@@ -10,6 +11,14 @@ import (
 	model "gobizmanager/internal/models"
 )
 
+// ErrRoleCycle is returned when a parent role would make a role inherit from
+// itself
+var ErrRoleCycle = errors.New("role would inherit from itself")
+
+// ErrDenyExists is returned when the role or member already has a deny for
+// the module action
+var ErrDenyExists = errors.New("module action already denied")
+
 type Repository struct {
 	db *gorm.DB
 }
@@ -18,6 +27,28 @@ func NewRepository(db *gorm.DB) *Repository {
 	return &Repository{db: db}
 }
 
+// BumpVersion records a change of the roles or permissions of the company.
+// It must run in the transaction making the change, so that every instance
+// sees the new version together with the new state.
+func BumpVersion(tx *gorm.DB, companyID int64) error {
+	return tx.Table("companies").
+		Where("id = ?", companyID).
+		UpdateColumn("rbac_version", gorm.Expr("rbac_version + 1")).Error
+}
+
+// GetVersion returns the RBAC version of the company. ok is false when the
+// company does not exist.
+func (r *Repository) GetVersion(companyID int64) (version int64, ok bool, err error) {
+	var versions []int64
+	if err := r.db.Table("companies").Where("id = ?", companyID).Pluck("rbac_version", &versions).Error; err != nil {
+		return 0, false, err
+	}
+	if len(versions) == 0 {
+		return 0, false, nil
+	}
+	return versions[0], true, nil
+}
+
 // CompanyUser operations
 func (r *Repository) CreateCompanyUser(companyID, userID int64, isMain bool) (int64, error) {
 	now := time.Now()
@@ -120,6 +151,10 @@ func (r *Repository) CreatePermission(companyID int64, name, description string,
 		return nil, fmt.Errorf("failed to associate permission with role: %w", err)
 	}
 
+	if err := BumpVersion(tx, companyID); err != nil {
+		return nil, err
+	}
+
 	if err := tx.Commit().Error; err != nil {
 		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
@@ -127,6 +162,20 @@ func (r *Repository) CreatePermission(companyID int64, name, description string,
 	return permission, nil
 }
 
+// GetGrantedPermissionsByRoleID returns the permissions the role holds
+// directly or through its permission groups
+func (r *Repository) GetGrantedPermissionsByRoleID(roleID int64) ([]model.Permission, error) {
+	var permissions []model.Permission
+	if err := r.db.
+		Where("permissions.id IN (?)", r.db.Table("(?) AS role_permissions", r.rolePermissions()).
+			Where("role_permissions.role_id = ?", roleID).
+			Select("role_permissions.permission_id")).
+		Find(&permissions).Error; err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
+
 func (r *Repository) GetPermissionsByRoleID(roleID int64) ([]model.Permission, error) {
 	var permissions []model.Permission
 	if err := r.db.
@@ -138,10 +187,11 @@ func (r *Repository) GetPermissionsByRoleID(roleID int64) ([]model.Permission, e
 	return permissions, nil
 }
 
-func (r *Repository) AssignRole(userID, roleID int64) (int64, error) {
+// AssignRole gives the member a role of its company
+func (r *Repository) AssignRole(companyUser *CompanyUser, roleID int64) (int64, error) {
 	var count int64
 	if err := r.db.Model(&model.UserRole{}).
-		Where("user_id = ? AND role_id = ?", userID, roleID).
+		Where("company_user_id = ? AND role_id = ?", companyUser.ID, roleID).
 		Count(&count).Error; err != nil {
 		return 0, err
 	}
@@ -151,12 +201,19 @@ func (r *Repository) AssignRole(userID, roleID int64) (int64, error) {
 
 	now := time.Now()
 	userRole := &model.UserRole{
-		UserID:    userID,
-		RoleID:    roleID,
-		CreatedAt: now,
-		UpdatedAt: now,
+		UserID:        companyUser.UserID,
+		CompanyUserID: companyUser.ID,
+		RoleID:        roleID,
+		CreatedAt:     now,
+		UpdatedAt:     now,
 	}
-	if err := r.db.Create(userRole).Error; err != nil {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(userRole).Error; err != nil {
+			return err
+		}
+		return BumpVersion(tx, companyUser.CompanyID)
+	})
+	if err != nil {
 		return 0, err
 	}
 	return userRole.ID, nil
@@ -187,30 +244,265 @@ func (r *Repository) GetModuleActionByID(id int64) (*ModuleAction, error) {
 	return &moduleAction, nil
 }
 
-func (r *Repository) HasPermission(userID, moduleActionID int64) (bool, error) {
-	var count int64
-	err := r.db.Model(&model.Permission{}).
-		Joins("JOIN role_permissions ON permissions.id = role_permissions.permission_id").
-		Joins("JOIN user_roles ON role_permissions.role_id = user_roles.role_id").
-		Joins("JOIN permission_module_actions ON permissions.id = permission_module_actions.permission_id").
-		Where("user_roles.user_id = ? AND permission_module_actions.module_action_id = ?", userID, moduleActionID).
-		Count(&count).Error
+// Grant is a role of a company and the permission through which it grants
+// a module action. GroupID is the permission group holding the permission, or
+// 0 when the role holds it directly. A non-empty Condition limits the grant
+// to requests satisfying it.
+type Grant struct {
+	RoleID       int64
+	PermissionID int64
+	GroupID      int64
+	Condition    string
+}
+
+// ListGrants returns the grants of every module action the roles of the
+// membership hold, directly or through their parents and permission groups.
+// An unconditional grant is returned alone, preferring direct grants and then
+// the lowest IDs; otherwise every conditional grant is returned in that order.
+func (r *Repository) ListGrants(companyUser *CompanyUser) (map[int64][]Grant, error) {
+	var rows []struct {
+		ModuleActionID int64
+		Grant
+	}
+	roleIDs, err := r.EffectiveRoleIDs(companyUser)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
-	return count > 0, nil
+	if err := r.roleModuleActions(companyUser.CompanyID, roleIDs).
+		Order("role_permissions.group_id <> 0, role_permissions.role_id, role_permissions.group_id, permissions.id").
+		Select("permission_module_actions.module_action_id AS module_action_id, role_permissions.role_id AS role_id, permissions.id AS permission_id, " +
+			"role_permissions.group_id AS group_id, permission_module_actions.condition AS condition").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	grants := make(map[int64][]Grant, len(rows))
+	for _, row := range rows {
+		held := grants[row.ModuleActionID]
+		switch {
+		case len(held) > 0 && held[0].Condition == "":
+		case row.Condition == "":
+			grants[row.ModuleActionID] = []Grant{row.Grant}
+		default:
+			grants[row.ModuleActionID] = append(held, row.Grant)
+		}
+	}
+	return grants, nil
 }
 
-func (r *Repository) GetUserPermissions(userID int64) ([]model.Permission, error) {
-	var permissions []model.Permission
-	err := r.db.Model(&model.Permission{}).
-		Joins("JOIN role_permissions ON permissions.id = role_permissions.permission_id").
-		Joins("JOIN user_roles ON role_permissions.role_id = user_roles.role_id").
-		Where("user_roles.user_id = ?", userID).
-		Find(&permissions).Error
+// ListDenies returns the deny of every module action denied to the membership
+// or to one of its roles, by module action
+func (r *Repository) ListDenies(companyUser *CompanyUser) (map[int64]int64, error) {
+	roleIDs, err := r.EffectiveRoleIDs(companyUser)
+	if err != nil {
+		return nil, err
+	}
+	denies, err := r.GetMemberDenies(companyUser, roleIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	denied := make(map[int64]int64, len(denies))
+	for _, deny := range denies {
+		if _, ok := denied[deny.ModuleActionID]; !ok {
+			denied[deny.ModuleActionID] = deny.ID
+		}
+	}
+	return denied, nil
+}
+
+// GetUserCompanyModuleActionIDs returns the module actions the user holds
+// through the roles of the company and is not denied
+func (r *Repository) GetUserCompanyModuleActionIDs(userID, companyID int64) ([]int64, error) {
+	companyUser, err := r.GetCompanyUserByCompanyAndUser(companyID, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	roleIDs, err := r.EffectiveRoleIDs(companyUser)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int64
+	if err := r.roleModuleActions(companyID, roleIDs).
+		Distinct().
+		Pluck("permission_module_actions.module_action_id", &ids).Error; err != nil {
+		return nil, err
+	}
+
+	denies, err := r.GetMemberDenies(companyUser, roleIDs)
+	if err != nil {
+		return nil, err
+	}
+	denied := make(map[int64]bool, len(denies))
+	for _, deny := range denies {
+		denied[deny.ModuleActionID] = true
+	}
+	allowed := ids[:0]
+	for _, id := range ids {
+		if !denied[id] {
+			allowed = append(allowed, id)
+		}
+	}
+	return allowed, nil
+}
+
+// roleModuleActions joins roles down to the module actions they grant through
+// their permissions and permission groups. Permissions of other companies
+// never count, even if they were linked by mistake.
+func (r *Repository) roleModuleActions(companyID int64, roleIDs []int64) *gorm.DB {
+	return r.db.Table("(?) AS role_permissions", r.rolePermissions()).
+		Joins("JOIN permissions ON permissions.id = role_permissions.permission_id AND permissions.company_id = ?", companyID).
+		Joins("JOIN permission_module_actions ON permission_module_actions.permission_id = permissions.id").
+		Where("role_permissions.role_id IN ?", roleIDs)
+}
+
+// rolePermissions lists the permissions held by roles, with the permission
+// group holding them or 0 for permissions held directly
+func (r *Repository) rolePermissions() *gorm.DB {
+	return r.db.Raw(`
+		SELECT role_id, permission_id, 0 AS group_id FROM role_permissions
+		UNION
+		SELECT role_permission_groups.role_id, permission_group_permissions.permission_id, role_permission_groups.group_id
+		FROM role_permission_groups
+		JOIN permission_group_permissions ON permission_group_permissions.group_id = role_permission_groups.group_id`)
+}
+
+// GetAssignedRoleIDs returns the roles of its company the membership holds
+func (r *Repository) GetAssignedRoleIDs(companyUser *CompanyUser) ([]int64, error) {
+	var ids []int64
+	if err := r.db.Model(&model.UserRole{}).
+		Joins("JOIN roles ON roles.id = user_roles.role_id").
+		Where("user_roles.company_user_id = ? AND roles.company_id = ?", companyUser.ID, companyUser.CompanyID).
+		Order("user_roles.role_id").
+		Pluck("user_roles.role_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// EffectiveRoleIDs returns the roles of its company the membership holds,
+// followed by the roles they inherit from
+func (r *Repository) EffectiveRoleIDs(companyUser *CompanyUser) ([]int64, error) {
+	assigned, err := r.GetAssignedRoleIDs(companyUser)
+	if err != nil {
+		return nil, err
+	}
+	if len(assigned) == 0 {
+		return nil, nil
+	}
+
+	parents, err := roleParents(r.db, companyUser.CompanyID)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[int64]bool)
+	ids := make([]int64, 0, len(assigned))
+	for _, id := range assigned {
+		for ok := true; ok && !seen[id]; id, ok = parents[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// GetRoleAncestors returns the parent of the role, its parent and so on
+func (r *Repository) GetRoleAncestors(role *model.Role) ([]int64, error) {
+	parents, err := roleParents(r.db, role.CompanyID)
 	if err != nil {
 		return nil, err
 	}
+	seen := map[int64]bool{role.ID: true}
+	var ancestors []int64
+	for id, ok := parents[role.ID]; ok && !seen[id]; id, ok = parents[id] {
+		seen[id] = true
+		ancestors = append(ancestors, id)
+	}
+	return ancestors, nil
+}
+
+// SetRoleParent makes parentID the parent of the role, or removes its parent
+// when parentID is nil. The parent must be a role of the same company.
+// ErrRoleCycle is returned when the role would inherit from itself.
+func (r *Repository) SetRoleParent(role *model.Role, parentID *int64) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if parentID != nil {
+			parents, err := roleParents(tx, role.CompanyID)
+			if err != nil {
+				return err
+			}
+			seen := make(map[int64]bool)
+			for id, ok := *parentID, true; ok && !seen[id]; id, ok = parents[id] {
+				if id == role.ID {
+					return ErrRoleCycle
+				}
+				seen[id] = true
+			}
+		}
+
+		if err := tx.Model(&model.Role{}).
+			Where("id = ?", role.ID).
+			Updates(map[string]interface{}{"parent_role_id": parentID, "updated_at": time.Now()}).Error; err != nil {
+			return err
+		}
+		return BumpVersion(tx, role.CompanyID)
+	})
+}
+
+// roleParents maps the roles of the company to their parent. Parents outside
+// the company are ignored.
+func roleParents(db *gorm.DB, companyID int64) (map[int64]int64, error) {
+	var rows []struct {
+		ID           int64
+		ParentRoleID int64
+	}
+	if err := db.Table("roles").
+		Joins("JOIN roles AS parents ON parents.id = roles.parent_role_id AND parents.company_id = roles.company_id").
+		Where("roles.company_id = ?", companyID).
+		Select("roles.id AS id, roles.parent_role_id AS parent_role_id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	parents := make(map[int64]int64, len(rows))
+	for _, row := range rows {
+		parents[row.ID] = row.ParentRoleID
+	}
+	return parents, nil
+}
+
+// UserPermission is a permission of the company a role holds, directly or
+// through a permission group, with one of its module actions and the
+// condition of the grant. ModuleActionID is 0 for permissions without module
+// actions.
+type UserPermission struct {
+	RoleID         int64
+	PermissionID   int64
+	PermissionName string
+	GroupID        int64
+	ModuleActionID int64
+	Condition      string
+}
+
+// GetUserPermissions returns the permissions of the company the roles hold,
+// one row per module action
+func (r *Repository) GetUserPermissions(companyID int64, roleIDs []int64) ([]UserPermission, error) {
+	var permissions []UserPermission
+	if err := r.db.Table("(?) AS role_permissions", r.rolePermissions()).
+		Joins("JOIN permissions ON permissions.id = role_permissions.permission_id AND permissions.company_id = ?", companyID).
+		Joins("LEFT JOIN permission_module_actions ON permission_module_actions.permission_id = permissions.id").
+		Where("role_permissions.role_id IN ?", roleIDs).
+		Order("role_permissions.role_id, role_permissions.group_id, permissions.id, permission_module_actions.module_action_id").
+		Select("role_permissions.role_id AS role_id, permissions.id AS permission_id, permissions.name AS permission_name, " +
+			"role_permissions.group_id AS group_id, COALESCE(permission_module_actions.module_action_id, 0) AS module_action_id, " +
+			"COALESCE(permission_module_actions.condition, '') AS condition").
+		Scan(&permissions).Error; err != nil {
+		return nil, err
+	}
 	return permissions, nil
 }
 
@@ -354,18 +646,48 @@ func (r *Repository) ListRolesWithPermissions(companyID int64) ([]model.Role, er
 	return roles, nil
 }
 
-func (r *Repository) RemovePermissionFromRole(roleID int64, permissionID int64) error {
-	return r.db.Where("role_id = ? AND permission_id = ?", roleID, permissionID).Delete(&RolePermission{}).Error
+func (r *Repository) RemovePermissionFromRole(companyID, roleID, permissionID int64) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("role_id = ? AND permission_id = ?", roleID, permissionID).Delete(&RolePermission{}).Error; err != nil {
+			return err
+		}
+		return BumpVersion(tx, companyID)
+	})
 }
 
 func (r *Repository) GetModuleActionID(module, action string) (int64, error) {
 	var moduleAction ModuleAction
-	if err := r.db.Where("module = ? AND action = ?", module, action).First(&moduleAction).Error; err != nil {
+	if err := r.db.
+		Joins("JOIN modules ON module_actions.module_id = modules.id").
+		Where("modules.name = ? AND module_actions.name = ?", module, action).
+		First(&moduleAction).Error; err != nil {
 		return 0, err
 	}
 	return moduleAction.ID, nil
 }
 
+// CompanyOwnsPermissions reports whether every permission belongs to the company
+func (r *Repository) CompanyOwnsPermissions(companyID int64, permissionIDs []int64) (bool, error) {
+	if len(permissionIDs) == 0 {
+		return true, nil
+	}
+	var count int64
+	if err := r.db.Model(&model.Permission{}).
+		Where("company_id = ? AND id IN ?", companyID, permissionIDs).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count == int64(len(uniqueIDs(permissionIDs))), nil
+}
+
+func uniqueIDs(ids []int64) map[int64]struct{} {
+	set := make(map[int64]struct{}, len(ids))
+	for _, id := range ids {
+		set[id] = struct{}{}
+	}
+	return set
+}
+
 func (r *Repository) GetPermissionByID(id int64) (*model.Permission, error) {
 	var permission model.Permission
 	if err := r.db.First(&permission, id).Error; err != nil {
@@ -374,38 +696,49 @@ func (r *Repository) GetPermissionByID(id int64) (*model.Permission, error) {
 	return &permission, nil
 }
 
-func (r *Repository) CreatePermissionModuleAction(permissionID, moduleActionID int64) error {
-	return r.db.Create(&PermissionModuleAction{
-		PermissionID:   permissionID,
-		ModuleActionID: moduleActionID,
-	}).Error
+func (r *Repository) CreatePermissionModuleAction(companyID, permissionID, moduleActionID int64, condition string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&PermissionModuleAction{
+			PermissionID:   permissionID,
+			ModuleActionID: moduleActionID,
+			Condition:      condition,
+		}).Error; err != nil {
+			return err
+		}
+		return BumpVersion(tx, companyID)
+	})
 }
 
-// Updates the permissions for a role
-func (r *Repository) UpdateRolePermissions(roleID string, permissionIDs []int64) error {
+// Updates the permissions for a role of the company
+func (r *Repository) UpdateRolePermissions(companyID int64, roleID string, permissionIDs []int64) error {
 	roleIDInt, err := strconv.ParseInt(roleID, 10, 64)
 	if err != nil {
 		return fmt.Errorf("invalid role ID: %w", err)
 	}
 
-	if err := r.db.Where("role_id = ?", roleIDInt).Delete(&RolePermission{}).Error; err != nil {
-		return err
-	}
-
-	for _, permissionID := range permissionIDs {
-		rolePermission := RolePermission{
-			RoleID:       roleIDInt,
-			PermissionID: permissionID,
-		}
-		if err := r.db.Create(&rolePermission).Error; err != nil {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("role_id = ?", roleIDInt).Delete(&RolePermission{}).Error; err != nil {
 			return err
 		}
-	}
 
-	return nil
+		for _, permissionID := range permissionIDs {
+			rolePermission := RolePermission{
+				RoleID:       roleIDInt,
+				PermissionID: permissionID,
+			}
+			if err := tx.Create(&rolePermission).Error; err != nil {
+				return err
+			}
+		}
+
+		return BumpVersion(tx, companyID)
+	})
 }
 
-func (r *Repository) UpdatePermissionModuleActions(permissionID int64, moduleActionIDs []int64) error {
+// UpdatePermissionModuleActions replaces the module actions of a permission
+// of the company. Module actions without an entry in conditions are granted
+// unconditionally.
+func (r *Repository) UpdatePermissionModuleActions(companyID, permissionID int64, moduleActionIDs []int64, conditions map[int64]string) error {
 	tx := r.db.Begin()
 	if tx.Error != nil {
 		return tx.Error
@@ -422,6 +755,7 @@ func (r *Repository) UpdatePermissionModuleActions(permissionID int64, moduleAct
 		permissionModuleAction := &PermissionModuleAction{
 			PermissionID:   permissionID,
 			ModuleActionID: moduleActionID,
+			Condition:      conditions[moduleActionID],
 			CreatedAt:      time.Now(),
 			UpdatedAt:      time.Now(),
 		}
@@ -430,6 +764,10 @@ func (r *Repository) UpdatePermissionModuleActions(permissionID int64, moduleAct
 		}
 	}
 
+	if err := BumpVersion(tx, companyID); err != nil {
+		return err
+	}
+
 	return tx.Commit().Error
 }
 
@@ -444,16 +782,45 @@ func (r *Repository) GetModuleActions() ([]ModuleAction, error) {
 	return moduleActions, nil
 }
 
+// ModuleActionName is a module action with the name of its module
+type ModuleActionName struct {
+	ID         int64
+	ModuleName string
+	Name       string
+}
+
+// ListModuleActionNames returns every module action with its module name
+func (r *Repository) ListModuleActionNames() ([]ModuleActionName, error) {
+	var names []ModuleActionName
+	if err := r.db.Model(&ModuleAction{}).
+		Select("module_actions.id, modules.name AS module_name, module_actions.name").
+		Joins("JOIN modules ON module_actions.module_id = modules.id").
+		Order("module_actions.id").
+		Scan(&names).Error; err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
 func (r *Repository) GetPermissionModuleActions(permissionID int64) ([]ModuleAction, error) {
-	var moduleActions []ModuleAction
+	var rows []struct {
+		ModuleAction `gorm:"embedded"`
+		Condition    string
+	}
 	if err := r.db.Model(&ModuleAction{}).
-		Select("module_actions.id, modules.name as module_name, module_actions.name, module_actions.description").
+		Select("module_actions.id, modules.name as module_name, module_actions.name, module_actions.description, permission_module_actions.condition AS condition").
 		Joins("JOIN modules ON module_actions.module_id = modules.id").
 		Joins("JOIN permission_module_actions ON module_actions.id = permission_module_actions.module_action_id").
 		Where("permission_module_actions.permission_id = ?", permissionID).
-		Find(&moduleActions).Error; err != nil {
+		Scan(&rows).Error; err != nil {
 		return nil, err
 	}
+
+	moduleActions := make([]ModuleAction, len(rows))
+	for i, row := range rows {
+		moduleActions[i] = row.ModuleAction
+		moduleActions[i].Condition = row.Condition
+	}
 	return moduleActions, nil
 }
 
@@ -464,3 +831,251 @@ func (r *Repository) GetCompanyUser(userID int64, companyID int64) (*CompanyUser
 	}
 	return &companyUser, nil
 }
+
+// Permission group operations
+
+// CreatePermissionGroup stores the group with its permissions
+func (r *Repository) CreatePermissionGroup(group *PermissionGroup, permissionIDs []int64) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		group.CreatedAt = now
+		group.UpdatedAt = now
+		if err := tx.Create(group).Error; err != nil {
+			return err
+		}
+		return setGroupPermissions(tx, group.ID, permissionIDs)
+	})
+}
+
+// UpdatePermissionGroup saves the name and description of the group and
+// replaces its permissions
+func (r *Repository) UpdatePermissionGroup(group *PermissionGroup, permissionIDs []int64) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		group.UpdatedAt = time.Now()
+		if err := tx.Model(&PermissionGroup{}).
+			Where("id = ?", group.ID).
+			Updates(map[string]interface{}{
+				"name":        group.Name,
+				"description": group.Description,
+				"updated_at":  group.UpdatedAt,
+			}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("group_id = ?", group.ID).Delete(&PermissionGroupPermission{}).Error; err != nil {
+			return err
+		}
+		if err := setGroupPermissions(tx, group.ID, permissionIDs); err != nil {
+			return err
+		}
+		return BumpVersion(tx, group.CompanyID)
+	})
+}
+
+func setGroupPermissions(tx *gorm.DB, groupID int64, permissionIDs []int64) error {
+	now := time.Now()
+	for permissionID := range uniqueIDs(permissionIDs) {
+		if err := tx.Create(&PermissionGroupPermission{
+			GroupID:      groupID,
+			PermissionID: permissionID,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeletePermissionGroup deletes the group. Roles lose its permissions.
+func (r *Repository) DeletePermissionGroup(group *PermissionGroup) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&PermissionGroup{}, group.ID).Error; err != nil {
+			return err
+		}
+		return BumpVersion(tx, group.CompanyID)
+	})
+}
+
+// GetPermissionGroup returns a group with its permissions
+func (r *Repository) GetPermissionGroup(id int64) (*PermissionGroup, error) {
+	var group PermissionGroup
+	if err := r.db.First(&group, id).Error; err != nil {
+		return nil, err
+	}
+	groups := []PermissionGroup{group}
+	if err := r.loadGroupPermissions(groups); err != nil {
+		return nil, err
+	}
+	return &groups[0], nil
+}
+
+// ListPermissionGroups returns the groups of the company with their permissions
+func (r *Repository) ListPermissionGroups(companyID int64) ([]PermissionGroup, error) {
+	groups := []PermissionGroup{}
+	if err := r.db.Where("company_id = ?", companyID).Order("name").Find(&groups).Error; err != nil {
+		return nil, err
+	}
+	return groups, r.loadGroupPermissions(groups)
+}
+
+// GetRolePermissionGroups returns the groups given to the role with their
+// permissions
+func (r *Repository) GetRolePermissionGroups(roleID int64) ([]PermissionGroup, error) {
+	groups := []PermissionGroup{}
+	if err := r.db.
+		Joins("JOIN role_permission_groups ON role_permission_groups.group_id = permission_groups.id").
+		Where("role_permission_groups.role_id = ?", roleID).
+		Order("permission_groups.name").
+		Find(&groups).Error; err != nil {
+		return nil, err
+	}
+	return groups, r.loadGroupPermissions(groups)
+}
+
+func (r *Repository) loadGroupPermissions(groups []PermissionGroup) error {
+	for i := range groups {
+		permissions := []model.Permission{}
+		if err := r.db.
+			Joins("JOIN permission_group_permissions ON permission_group_permissions.permission_id = permissions.id").
+			Where("permission_group_permissions.group_id = ?", groups[i].ID).
+			Find(&permissions).Error; err != nil {
+			return err
+		}
+		groups[i].Permissions = permissions
+	}
+	return nil
+}
+
+// PermissionGroupNameTaken reports whether another group of the company has
+// the name
+func (r *Repository) PermissionGroupNameTaken(companyID int64, name string, excludeID int64) (bool, error) {
+	var count int64
+	if err := r.db.Model(&PermissionGroup{}).
+		Where("company_id = ? AND name = ? AND id != ?", companyID, name, excludeID).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// CompanyOwnsPermissionGroups reports whether every group belongs to the company
+func (r *Repository) CompanyOwnsPermissionGroups(companyID int64, groupIDs []int64) (bool, error) {
+	if len(groupIDs) == 0 {
+		return true, nil
+	}
+	var count int64
+	if err := r.db.Model(&PermissionGroup{}).
+		Where("company_id = ? AND id IN ?", companyID, groupIDs).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count == int64(len(uniqueIDs(groupIDs))), nil
+}
+
+// SetRolePermissionGroups replaces the permission groups of the role
+func (r *Repository) SetRolePermissionGroups(role *model.Role, groupIDs []int64) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("role_id = ?", role.ID).Delete(&RolePermissionGroup{}).Error; err != nil {
+			return err
+		}
+		now := time.Now()
+		for groupID := range uniqueIDs(groupIDs) {
+			if err := tx.Create(&RolePermissionGroup{
+				RoleID:    role.ID,
+				GroupID:   groupID,
+				CreatedAt: now,
+				UpdatedAt: now,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return BumpVersion(tx, role.CompanyID)
+	})
+}
+
+// permissionDenies selects denies with the names of their module and action
+func (r *Repository) permissionDenies() *gorm.DB {
+	return r.db.Model(&PermissionDeny{}).
+		Select("permission_denies.*, modules.name AS module, module_actions.name AS action").
+		Joins("JOIN module_actions ON module_actions.id = permission_denies.module_action_id").
+		Joins("JOIN modules ON modules.id = module_actions.module_id").
+		Order("permission_denies.id")
+}
+
+// CreatePermissionDeny stores a deny. ErrDenyExists is returned when its role
+// or member already has a deny for the module action.
+func (r *Repository) CreatePermissionDeny(deny *PermissionDeny) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		query := tx.Model(&PermissionDeny{}).Where("module_action_id = ?", deny.ModuleActionID)
+		if deny.RoleID != nil {
+			query = query.Where("role_id = ?", *deny.RoleID)
+		} else {
+			query = query.Where("company_user_id = ?", *deny.CompanyUserID)
+		}
+		var count int64
+		if err := query.Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrDenyExists
+		}
+		if err := tx.Omit("Module", "Action").Create(deny).Error; err != nil {
+			return err
+		}
+		return BumpVersion(tx, deny.CompanyID)
+	})
+}
+
+func (r *Repository) GetPermissionDeny(id int64) (*PermissionDeny, error) {
+	var deny PermissionDeny
+	if err := r.permissionDenies().Where("permission_denies.id = ?", id).First(&deny).Error; err != nil {
+		return nil, err
+	}
+	return &deny, nil
+}
+
+// ListPermissionDenies returns the denies of a company
+func (r *Repository) ListPermissionDenies(companyID int64) ([]PermissionDeny, error) {
+	denies := []PermissionDeny{}
+	if err := r.permissionDenies().Where("permission_denies.company_id = ?", companyID).Find(&denies).Error; err != nil {
+		return nil, err
+	}
+	return denies, nil
+}
+
+// GetRoleDenies returns the denies of the roles
+func (r *Repository) GetRoleDenies(roleIDs []int64) ([]PermissionDeny, error) {
+	denies := []PermissionDeny{}
+	if len(roleIDs) == 0 {
+		return denies, nil
+	}
+	if err := r.permissionDenies().Where("permission_denies.role_id IN ?", roleIDs).Find(&denies).Error; err != nil {
+		return nil, err
+	}
+	return denies, nil
+}
+
+// GetMemberDenies returns the denies of the membership and of the roles of
+// its company among roleIDs
+func (r *Repository) GetMemberDenies(companyUser *CompanyUser, roleIDs []int64) ([]PermissionDeny, error) {
+	denies := []PermissionDeny{}
+	query := r.permissionDenies().Where("permission_denies.company_id = ?", companyUser.CompanyID)
+	if len(roleIDs) > 0 {
+		query = query.Where("permission_denies.company_user_id = ? OR permission_denies.role_id IN ?", companyUser.ID, roleIDs)
+	} else {
+		query = query.Where("permission_denies.company_user_id = ?", companyUser.ID)
+	}
+	if err := query.Find(&denies).Error; err != nil {
+		return nil, err
+	}
+	return denies, nil
+}
+
+func (r *Repository) DeletePermissionDeny(deny *PermissionDeny) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&PermissionDeny{}, deny.ID).Error; err != nil {
+			return err
+		}
+		return BumpVersion(tx, deny.CompanyID)
+	})
+}
@@ -20,9 +20,9 @@ type RoleHandler struct {
 	*RbacBaseHandler
 }
 
-func NewRoleHandler(repo *Repository, msgStore *language.MessageStore) *RoleHandler {
+func NewRoleHandler(repo *Repository, authorizer *Authorizer, msgStore *language.MessageStore) *RoleHandler {
 	return &RoleHandler{
-		RbacBaseHandler: NewBaseHandler(repo, msgStore),
+		RbacBaseHandler: NewBaseHandler(repo, authorizer, msgStore),
 	}
 }
 
@@ -37,7 +37,7 @@ func (h *RoleHandler) CreateRole(w http.ResponseWriter, r *http.Request) {
 	role, err := h.Service.CreateRole(r.Context(), req.CompanyID, req.Name, req.Description)
 	if err != nil {
 		logger.Error("Error creating role", zap.Error(err))
-		utils.RespondError(w, r, h.MsgStore, errors.New(language.RoleCreateFailed))
+		utils.RespondError(w, r, h.MsgStore, err)
 		return
 	}
 
@@ -46,7 +46,7 @@ func (h *RoleHandler) CreateRole(w http.ResponseWriter, r *http.Request) {
 
 // GetRole returns a role by ID
 func (h *RoleHandler) GetRole(w http.ResponseWriter, r *http.Request) {
-	roleID := chi.URLParam(r, "id")
+	roleID := chi.URLParam(r, "roleID")
 	if roleID == "" {
 		utils.RespondError(w, r, h.MsgStore, errors.New(language.ValidationFailed))
 		return
@@ -69,6 +69,54 @@ func (h *RoleHandler) GetRole(w http.ResponseWriter, r *http.Request) {
 	utils.JSON(w, http.StatusOK, role)
 }
 
+// SetRoleParent sets or removes the role the role inherits permissions from
+func (h *RoleHandler) SetRoleParent(w http.ResponseWriter, r *http.Request) {
+	roleID, err := parseID(chi.URLParam(r, "roleID"))
+	if err != nil {
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+
+	var req SetRoleParentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.ValidationFailed))
+		return
+	}
+
+	role, err := h.Service.SetRoleParent(r.Context(), roleID, req.ParentRoleID)
+	if err != nil {
+		logger.Error("Error setting role parent", zap.Error(err))
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, role)
+}
+
+// SetRolePermissionGroups replaces the permission groups of the role
+func (h *RoleHandler) SetRolePermissionGroups(w http.ResponseWriter, r *http.Request) {
+	roleID, err := parseID(chi.URLParam(r, "roleID"))
+	if err != nil {
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+
+	var req SetRolePermissionGroupsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondError(w, r, h.MsgStore, errors.New(language.ValidationFailed))
+		return
+	}
+
+	role, err := h.Service.SetRolePermissionGroups(r.Context(), roleID, req.GroupIDs)
+	if err != nil {
+		logger.Error("Error setting role permission groups", zap.Error(err))
+		utils.RespondError(w, r, h.MsgStore, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, role)
+}
+
 // ListRoles returns all roles for a company
 func (h *RoleHandler) ListRoles(w http.ResponseWriter, r *http.Request) {
 	companyID := chi.URLParam(r, "companyID")
@@ -99,6 +147,7 @@ func (h *RoleHandler) AssignRole(w http.ResponseWriter, r *http.Request) {
 	if err := h.Service.AssignRole(r.Context(), req.UserID, req.RoleID); err != nil {
 		logger.Error("Error assigning role", zap.Error(err))
 		utils.RespondError(w, r, h.MsgStore, errors.New(language.RoleAssignFailed))
+		return
 	}
 
 	msg, httpStatus := h.MsgStore.GetMessage(pkgctx.GetLanguage(r.Context()), language.RoleAssigned)
@@ -122,7 +171,7 @@ func (h *RoleHandler) UpdateRolePermissions(w http.ResponseWriter, r *http.Reque
 
 	if err := h.Service.UpdateRolePermissions(r.Context(), roleID, req.PermissionIDs); err != nil {
 		logger.Error("Error updating role permissions", zap.Error(err))
-		utils.RespondError(w, r, h.MsgStore, errors.New(language.RoleAssignFailed))
+		utils.RespondError(w, r, h.MsgStore, err)
 		return
 	}
 
@@ -4,32 +4,57 @@ import (
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
+
+	"gobizmanager/platform/middleware/permission"
 )
 
-// Routes returns the routes for the RBAC module
-func Routes(roleHandler *RoleHandler, permissionHandler *PermissionHandler) http.Handler {
+// Routes returns the routes for the RBAC module. Routes that name their role,
+// permission or company only in the body take the company from the
+// company_id query parameter or the active company of the token.
+func Routes(roleHandler *RoleHandler, permissionHandler *PermissionHandler, groupHandler *PermissionGroupHandler, denyHandler *PermissionDenyHandler, guard permission.Guard) http.Handler {
 	r := chi.NewRouter()
 
 	// Module actions route
-	r.Get("/module-actions", permissionHandler.GetModuleActions)
+	r.With(guard.RequireAuthentication()).Get("/module-actions", permissionHandler.GetModuleActions)
+
+	// Decision path of a module action for a user of the company
+	r.With(guard.RequirePermission(ModuleRole, ActionRead)).Get("/explain", permissionHandler.ExplainPermission)
 
 	// Permission routes
 	r.Route("/permissions", func(r chi.Router) {
-		r.Post("/", permissionHandler.CreatePermission)
-		r.Get("/company/{companyID}", permissionHandler.ListPermissions)
-		r.Post("/module-actions", permissionHandler.CreatePermissionModuleAction)
-		r.Delete("/assign", permissionHandler.RemovePermission)
-		r.Get("/{permissionID}/module-actions", permissionHandler.GetPermissionModuleActions)
-		r.Put("/{permissionID}/module-actions", permissionHandler.UpdatePermissionModuleActions)
+		r.With(guard.RequirePermission(ModuleRole, ActionCreate)).Post("/", permissionHandler.CreatePermission)
+		r.With(guard.RequirePermission(ModuleRole, ActionRead)).Get("/company/{companyID}", permissionHandler.ListPermissions)
+		r.With(guard.RequirePermission(ModuleRole, ActionUpdate)).Post("/module-actions", permissionHandler.CreatePermissionModuleAction)
+		r.With(guard.RequirePermission(ModuleRole, ActionUpdate)).Delete("/assign", permissionHandler.RemovePermission)
+		r.With(guard.RequirePermission(ModuleRole, ActionRead)).Get("/{permissionID}/module-actions", permissionHandler.GetPermissionModuleActions)
+		r.With(guard.RequirePermission(ModuleRole, ActionUpdate)).Put("/{permissionID}/module-actions", permissionHandler.UpdatePermissionModuleActions)
+	})
+
+	// Permission group routes
+	r.Route("/permission-groups", func(r chi.Router) {
+		r.With(guard.RequirePermission(ModuleRole, ActionCreate)).Post("/", groupHandler.CreatePermissionGroup)
+		r.With(guard.RequirePermission(ModuleRole, ActionRead)).Get("/company/{companyID}", groupHandler.ListPermissionGroups)
+		r.With(guard.RequirePermission(ModuleRole, ActionRead)).Get("/{groupID}", groupHandler.GetPermissionGroup)
+		r.With(guard.RequirePermission(ModuleRole, ActionUpdate)).Put("/{groupID}", groupHandler.UpdatePermissionGroup)
+		r.With(guard.RequirePermission(ModuleRole, ActionDelete)).Delete("/{groupID}", groupHandler.DeletePermissionGroup)
+	})
+
+	// Permission deny routes
+	r.Route("/denies", func(r chi.Router) {
+		r.With(guard.RequirePermission(ModuleRole, ActionUpdate)).Post("/", denyHandler.CreatePermissionDeny)
+		r.With(guard.RequirePermission(ModuleRole, ActionRead)).Get("/company/{companyID}", denyHandler.ListPermissionDenies)
+		r.With(guard.RequirePermission(ModuleRole, ActionUpdate)).Delete("/{denyID}", denyHandler.DeletePermissionDeny)
 	})
 
 	// Role routes
 	r.Route("/roles", func(r chi.Router) {
-		r.Post("/", roleHandler.CreateRole)
-		r.Get("/{id}", roleHandler.GetRole)
-		r.Get("/company/{companyID}", roleHandler.ListRoles)
-		r.Post("/assign", roleHandler.AssignRole)
-		r.Put("/permissions", roleHandler.UpdateRolePermissions)
+		r.With(guard.RequirePermission(ModuleRole, ActionCreate)).Post("/", roleHandler.CreateRole)
+		r.With(guard.RequirePermission(ModuleRole, ActionRead)).Get("/{roleID}", roleHandler.GetRole)
+		r.With(guard.RequirePermission(ModuleRole, ActionUpdate)).Put("/{roleID}/parent", roleHandler.SetRoleParent)
+		r.With(guard.RequirePermission(ModuleRole, ActionUpdate)).Put("/{roleID}/permission-groups", roleHandler.SetRolePermissionGroups)
+		r.With(guard.RequirePermission(ModuleRole, ActionRead)).Get("/company/{companyID}", roleHandler.ListRoles)
+		r.With(guard.RequirePermission(ModuleRole, ActionUpdate)).Post("/assign", roleHandler.AssignRole)
+		r.With(guard.RequirePermission(ModuleRole, ActionUpdate)).Put("/permissions", roleHandler.UpdateRolePermissions)
 	})
 
 	return r
@@ -5,23 +5,45 @@ import (
 	"errors"
 	"strconv"
 
+	"gorm.io/gorm"
+
+	"gobizmanager/internal/auth"
 	model "gobizmanager/internal/models"
+	"gobizmanager/pkg/condition"
+	pkgctx "gobizmanager/pkg/context"
 	"gobizmanager/pkg/language"
 )
 
 type Service struct {
-	repo *Repository
-	val  *Validator
+	repo       *Repository
+	val        *Validator
+	authorizer *Authorizer
 }
 
-func NewService(repo *Repository, val *Validator) *Service {
+func NewService(repo *Repository, val *Validator, authorizer *Authorizer) *Service {
 	return &Service{
-		repo: repo,
-		val:  val,
+		repo:       repo,
+		val:        val,
+		authorizer: authorizer,
 	}
 }
 
+// resolveCompanyID falls back to the company the request was authorized for,
+// then to the active company, when a request names none
+func resolveCompanyID(ctx context.Context, companyID int64) int64 {
+	if companyID == 0 {
+		if requestID, ok := RequestCompanyID(ctx); ok {
+			return requestID
+		}
+		if activeID, ok := pkgctx.GetCompanyID(ctx); ok {
+			return activeID
+		}
+	}
+	return companyID
+}
+
 func (s *Service) CreatePermission(ctx context.Context, companyID int64, name, description string, roleID int64) (*model.Permission, error) {
+	companyID = resolveCompanyID(ctx, companyID)
 	err := s.val.ValidateCompanyRequest(ctx, companyID)
 	if err != nil {
 		return nil, err
@@ -34,7 +56,13 @@ func (s *Service) CreatePermission(ctx context.Context, companyID int64, name, d
 	if role.CompanyID != companyID {
 		return nil, errors.New(language.RoleNotFound)
 	}
-	return s.repo.CreatePermission(companyID, name, description, roleID)
+	permission, err := s.repo.CreatePermission(companyID, name, description, roleID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.authorizer.InvalidateCompany(companyID)
+	return permission, nil
 }
 
 func (s *Service) AssignRole(ctx context.Context, userID int64, roleID int64) error {
@@ -46,48 +74,77 @@ func (s *Service) AssignRole(ctx context.Context, userID int64, roleID int64) er
 		return errors.New(language.PermissionDenied)
 	}
 
-	_, err = s.repo.AssignRole(companyUser.ID, roleID)
+	_, err = s.repo.AssignRole(companyUser, roleID)
 	if err != nil {
 		return err
 	}
 
+	s.authorizer.InvalidateUser(companyUser.UserID, companyUser.CompanyID)
 	return nil
 }
 
 func (s *Service) UpdateRolePermissions(ctx context.Context, roleID int64, permissionIDs []int64) error {
-	err := s.val.ValidateRoleRequest(ctx, strconv.FormatInt(roleID, 10))
+	role, err := s.val.ValidateRoleRequest(ctx, strconv.FormatInt(roleID, 10))
 	if err != nil {
 		return err
 	}
 
-	err = s.repo.UpdateRolePermissions(strconv.FormatInt(roleID, 10), permissionIDs)
+	// Roles may only hold permissions of their own company
+	owned, err := s.repo.CompanyOwnsPermissions(role.CompanyID, permissionIDs)
+	if err != nil {
+		return errors.New(language.PermissionCheckFailed)
+	}
+	if !owned {
+		return errors.New(language.PermissionNotFound)
+	}
+
+	err = s.repo.UpdateRolePermissions(role.CompanyID, strconv.FormatInt(roleID, 10), permissionIDs)
 	if err != nil {
 		return errors.New(language.PermissionCreateFailed)
 	}
 
+	s.authorizer.InvalidateCompany(role.CompanyID)
 	return nil
 }
 
-func (s *Service) CreatePermissionModuleAction(ctx context.Context, permissionID int64, moduleActionID int64) error {
-	err := s.val.ValidatePermissionRequest(ctx, permissionID)
+// CreatePermissionModuleAction grants a module action through a permission,
+// only when condition holds if it is not empty
+func (s *Service) CreatePermissionModuleAction(ctx context.Context, permissionID int64, moduleActionID int64, condition string) error {
+	permission, err := s.val.ValidatePermissionRequest(ctx, permissionID)
+	if err != nil {
+		return err
+	}
+	conditions, err := s.val.ValidateConditions([]int64{moduleActionID}, map[int64]string{moduleActionID: condition})
 	if err != nil {
 		return err
 	}
 
-	return s.repo.CreatePermissionModuleAction(permissionID, moduleActionID)
+	if err := s.repo.CreatePermissionModuleAction(permission.CompanyID, permissionID, moduleActionID, conditions[moduleActionID]); err != nil {
+		return errors.New(language.PermissionAssignFailed)
+	}
+
+	s.authorizer.InvalidateCompany(permission.CompanyID)
+	return nil
 }
 
-func (s *Service) UpdatePermissionModuleActions(ctx context.Context, permissionID int64, moduleActionIDs []int64) error {
-	err := s.val.ValidatePermissionRequest(ctx, permissionID)
+// UpdatePermissionModuleActions replaces the module actions of a permission.
+// Conditions are validated before anything is saved.
+func (s *Service) UpdatePermissionModuleActions(ctx context.Context, permissionID int64, moduleActionIDs []int64, conditions map[int64]string) error {
+	permission, err := s.val.ValidatePermissionRequest(ctx, permissionID)
+	if err != nil {
+		return err
+	}
+	conditions, err = s.val.ValidateConditions(moduleActionIDs, conditions)
 	if err != nil {
 		return err
 	}
 
-	err = s.repo.UpdatePermissionModuleActions(permissionID, moduleActionIDs)
+	err = s.repo.UpdatePermissionModuleActions(permission.CompanyID, permissionID, moduleActionIDs, conditions)
 	if err != nil {
-		return errors.New(language.PermissionCreateFailed)
+		return errors.New(language.PermissionAssignFailed)
 	}
 
+	s.authorizer.InvalidateCompany(permission.CompanyID)
 	return nil
 }
 
@@ -120,7 +177,7 @@ func (s *Service) ListPermissions(ctx context.Context, companyID int64) ([]model
 }
 
 func (s *Service) GetPermissionModuleActions(ctx context.Context, permissionID int64) ([]ModuleAction, error) {
-	err := s.val.ValidatePermissionRequest(ctx, permissionID)
+	_, err := s.val.ValidatePermissionRequest(ctx, permissionID)
 	if err != nil {
 		return nil, err
 	}
@@ -136,26 +193,290 @@ func (s *Service) GetPermissionModuleActions(ctx context.Context, permissionID i
 			ID:          action.ID,
 			Name:        action.Name,
 			Description: action.Description,
+			Condition:   action.Condition,
 		}
 	}
 
 	return moduleActions, nil
 }
 
-func (s *Service) CheckPermission(ctx context.Context, userID int64, moduleName, actionName string) (bool, error) {
-	moduleActionID, err := s.repo.GetModuleActionID(moduleName, actionName)
+// CheckPermission checks a module action in the company, on the resource
+// when the request addresses one. Requests carrying a company-scoped token or
+// API key are limited to its active company.
+func (s *Service) CheckPermission(ctx context.Context, userID, companyID int64, moduleName, actionName string, resource condition.Attributes) (Decision, error) {
+	decision, err := s.authorizer.AuthorizeResource(ctx, userID, companyID, moduleName, actionName, resource)
 	if err != nil {
-		return false, errors.New(language.PermissionCheckFailed)
+		return Decision{}, errors.New(language.PermissionCheckFailed)
 	}
-	hasPermission, err := s.repo.HasPermission(userID, moduleActionID)
+	return decision, nil
+}
+
+// CreatePermissionDeny denies a module action to a role of the company or to
+// one of its members
+func (s *Service) CreatePermissionDeny(ctx context.Context, req *CreatePermissionDenyRequest) (*PermissionDeny, error) {
+	deny, err := s.val.ValidatePermissionDeny(ctx, resolveCompanyID(ctx, 0), req)
 	if err != nil {
-		return false, errors.New(language.PermissionCheckFailed)
+		return nil, err
 	}
 
-	return hasPermission, nil
+	if err := s.repo.CreatePermissionDeny(deny); err != nil {
+		if errors.Is(err, ErrDenyExists) {
+			return nil, errors.New(language.PermissionDenyExists)
+		}
+		return nil, errors.New(language.PermissionDenyCreateFailed)
+	}
+
+	s.invalidateDeny(deny)
+	deny, err = s.repo.GetPermissionDeny(deny.ID)
+	if err != nil {
+		return nil, errors.New(language.PermissionDenyListFailed)
+	}
+	return deny, nil
+}
+
+func (s *Service) ListPermissionDenies(ctx context.Context, companyID int64) ([]PermissionDeny, error) {
+	if err := s.val.ValidateCompanyRequest(ctx, companyID); err != nil {
+		return nil, err
+	}
+	denies, err := s.repo.ListPermissionDenies(companyID)
+	if err != nil {
+		return nil, errors.New(language.PermissionDenyListFailed)
+	}
+	return denies, nil
+}
+
+func (s *Service) DeletePermissionDeny(ctx context.Context, denyID int64) error {
+	deny, err := s.repo.GetPermissionDeny(denyID)
+	if err != nil {
+		return errors.New(language.PermissionDenyNotFound)
+	}
+	if err := s.val.ValidateCompanyRequest(ctx, deny.CompanyID); err != nil {
+		return err
+	}
+
+	if err := s.repo.DeletePermissionDeny(deny); err != nil {
+		return errors.New(language.PermissionDenyDeleteFailed)
+	}
+
+	s.invalidateDeny(deny)
+	return nil
+}
+
+// invalidateDeny drops the cached permissions the deny affects: everyone in
+// the company for role denies, as roles may be inherited
+func (s *Service) invalidateDeny(deny *PermissionDeny) {
+	if deny.CompanyUserID == nil {
+		s.authorizer.InvalidateCompany(deny.CompanyID)
+		return
+	}
+	companyUser, err := s.repo.GetCompanyUserByID(*deny.CompanyUserID)
+	if err != nil {
+		s.authorizer.InvalidateCompany(deny.CompanyID)
+		return
+	}
+	s.authorizer.InvalidateUser(companyUser.UserID, deny.CompanyID)
+}
+
+// EffectivePermissions returns the module actions the caller may perform in
+// the company, or in the active company when companyID is 0
+func (s *Service) EffectivePermissions(ctx context.Context, companyID int64) (*EffectivePermissions, error) {
+	userID, ok := auth.GetUserID(ctx)
+	if !ok {
+		return nil, errors.New(language.AuthUserNotFound)
+	}
+	companyID = resolveCompanyID(ctx, companyID)
+	if companyID == 0 {
+		return nil, errors.New(language.PermissionCompanyRequired)
+	}
+	if err := s.val.ValidateCompanyRequest(ctx, companyID); err != nil {
+		return nil, err
+	}
+
+	// Read the version first so that a concurrent change makes it stale
+	version, err := s.authorizer.Version(companyID)
+	if err != nil {
+		return nil, errors.New(language.PermissionCheckFailed)
+	}
+	permissions, conditional, err := s.authorizer.Granted(ctx, userID, companyID)
+	if err != nil {
+		return nil, errors.New(language.PermissionCheckFailed)
+	}
+	return &EffectivePermissions{
+		CompanyID:   companyID,
+		Version:     version,
+		Permissions: permissions,
+		Conditional: conditional,
+	}, nil
+}
+
+// Explain checks a module action for a user in the company and returns the
+// membership, roles, permissions and module actions that were considered.
+// The decision comes from the user's roles alone; the token scope of the
+// request does not apply to another user. Conditions are evaluated without
+// resource attributes.
+func (s *Service) Explain(ctx context.Context, userID, companyID int64, moduleName, actionName string) (*Explanation, error) {
+	if err := s.val.ValidateCompanyRequest(ctx, companyID); err != nil {
+		return nil, err
+	}
+
+	decision, err := s.authorizer.Evaluate(userID, companyID, moduleName, actionName, nil)
+	if err != nil {
+		return nil, errors.New(language.PermissionCheckFailed)
+	}
+	explanation := &Explanation{
+		UserID:    userID,
+		CompanyID: companyID,
+		Module:    moduleName,
+		Action:    actionName,
+		Root:      decision.Reason == ReasonRoot,
+		Roles:     []ExplainedRole{},
+		Denies:    []PermissionDeny{},
+		Decision:  decision,
+	}
+	if decision.Reason == ReasonUnknownAction {
+		explanation.MissingLink = LinkModuleActions
+		return explanation, nil
+	}
+
+	companyUser, err := s.repo.GetCompanyUserByCompanyAndUser(companyID, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		explanation.MissingLink = LinkCompanyUsers
+		if explanation.Root {
+			explanation.MissingLink = ""
+		}
+		return explanation, nil
+	}
+	if err != nil {
+		return nil, errors.New(language.PermissionCheckFailed)
+	}
+	explanation.CompanyUser = companyUser
+
+	if explanation.Roles, err = s.explainRoles(companyUser, decision.ModuleActionID); err != nil {
+		return nil, errors.New(language.PermissionCheckFailed)
+	}
+
+	roleIDs := make([]int64, len(explanation.Roles))
+	for i, role := range explanation.Roles {
+		roleIDs[i] = role.ID
+	}
+	denies, err := s.repo.GetMemberDenies(companyUser, roleIDs)
+	if err != nil {
+		return nil, errors.New(language.PermissionCheckFailed)
+	}
+	for _, deny := range denies {
+		if deny.ModuleActionID == decision.ModuleActionID {
+			explanation.Denies = append(explanation.Denies, deny)
+		}
+	}
+
+	if decision.Reason == ReasonNotGranted {
+		explanation.MissingLink = missingLink(explanation.Roles)
+	}
+	return explanation, nil
+}
+
+// explainRoles lists the assigned roles of the membership followed by the
+// roles they inherit from, each with its permissions
+func (s *Service) explainRoles(companyUser *CompanyUser, moduleActionID int64) ([]ExplainedRole, error) {
+	assigned, err := s.repo.GetAssignedRoleIDs(companyUser)
+	if err != nil {
+		return nil, err
+	}
+
+	roles := []ExplainedRole{}
+	index := make(map[int64]int)
+	add := func(roleID, inheritedBy int64) error {
+		if _, ok := index[roleID]; ok {
+			return nil
+		}
+		role, err := s.repo.GetRoleByID(roleID)
+		if err != nil {
+			return err
+		}
+		index[roleID] = len(roles)
+		roles = append(roles, ExplainedRole{
+			ID:          role.ID,
+			Name:        role.Name,
+			Assigned:    inheritedBy == 0,
+			InheritedBy: inheritedBy,
+			Permissions: []ExplainedPermission{},
+		})
+		return nil
+	}
+	for _, roleID := range assigned {
+		if err := add(roleID, 0); err != nil {
+			return nil, err
+		}
+	}
+	for _, roleID := range assigned {
+		role, err := s.repo.GetRoleByID(roleID)
+		if err != nil {
+			return nil, err
+		}
+		ancestors, err := s.repo.GetRoleAncestors(role)
+		if err != nil {
+			return nil, err
+		}
+		for _, ancestorID := range ancestors {
+			if err := add(ancestorID, roleID); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(roles) == 0 {
+		return roles, nil
+	}
+
+	roleIDs := make([]int64, len(roles))
+	for i, role := range roles {
+		roleIDs[i] = role.ID
+	}
+	rows, err := s.repo.GetUserPermissions(companyUser.CompanyID, roleIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		role := &roles[index[row.RoleID]]
+		last := len(role.Permissions) - 1
+		if last < 0 || role.Permissions[last].ID != row.PermissionID || role.Permissions[last].GroupID != row.GroupID {
+			role.Permissions = append(role.Permissions, ExplainedPermission{
+				ID:              row.PermissionID,
+				Name:            row.PermissionName,
+				GroupID:         row.GroupID,
+				ModuleActionIDs: []int64{},
+			})
+			last++
+		}
+		if row.ModuleActionID != 0 {
+			permission := &role.Permissions[last]
+			permission.ModuleActionIDs = append(permission.ModuleActionIDs, row.ModuleActionID)
+			permission.Grants = permission.Grants || row.ModuleActionID == moduleActionID
+			if row.Condition != "" {
+				if permission.Conditions == nil {
+					permission.Conditions = make(map[int64]string)
+				}
+				permission.Conditions[row.ModuleActionID] = row.Condition
+			}
+		}
+	}
+	return roles, nil
+}
+
+// missingLink returns the first link of the path the roles do not reach
+func missingLink(roles []ExplainedRole) string {
+	if len(roles) == 0 {
+		return LinkUserRoles
+	}
+	for _, role := range roles {
+		if len(role.Permissions) > 0 {
+			return LinkPermissionModuleActions
+		}
+	}
+	return LinkRolePermissions
 }
 
 func (s *Service) CreateRole(ctx context.Context, companyID int64, name, description string) (*model.Role, error) {
+	companyID = resolveCompanyID(ctx, companyID)
 	err := s.val.ValidateCompanyRequest(ctx, companyID)
 	if err != nil {
 		return nil, err
@@ -169,29 +490,233 @@ func (s *Service) CreateRole(ctx context.Context, companyID int64, name, descrip
 }
 
 func (s *Service) RemovePermission(ctx context.Context, roleID, permissionID int64) error {
-	err := s.val.ValidateRoleRequest(ctx, strconv.FormatInt(roleID, 10))
+	role, err := s.val.ValidateRoleRequest(ctx, strconv.FormatInt(roleID, 10))
 	if err != nil {
 		return err
 	}
-	err = s.repo.RemovePermissionFromRole(roleID, permissionID)
+	err = s.repo.RemovePermissionFromRole(role.CompanyID, roleID, permissionID)
 	if err != nil {
 		return errors.New(language.PermissionRemoveFailed)
 	}
 
+	s.authorizer.InvalidateCompany(role.CompanyID)
 	return nil
 }
 
-func (s *Service) GetRole(ctx context.Context, roleID int64) (*model.Role, error) {
-	err := s.val.ValidateRoleRequest(ctx, strconv.FormatInt(roleID, 10))
+func (s *Service) GetRole(ctx context.Context, roleID int64) (*RoleDetails, error) {
+	_, err := s.val.ValidateRoleRequest(ctx, strconv.FormatInt(roleID, 10))
 	if err != nil {
 		return nil, err
 	}
+
+	return s.roleDetails(roleID)
+}
+
+// SetRoleParent makes the role inherit the permissions of another role of its
+// company, or stops it inheriting when parentID is nil
+func (s *Service) SetRoleParent(ctx context.Context, roleID int64, parentID *int64) (*RoleDetails, error) {
+	role, err := s.val.ValidateRoleRequest(ctx, strconv.FormatInt(roleID, 10))
+	if err != nil {
+		return nil, err
+	}
+
+	if parentID != nil {
+		parent, err := s.repo.GetRoleByID(*parentID)
+		if err != nil || parent.CompanyID != role.CompanyID || parent.ID == role.ID {
+			return nil, errors.New(language.RoleParentInvalid)
+		}
+	}
+
+	if err := s.repo.SetRoleParent(role, parentID); err != nil {
+		if errors.Is(err, ErrRoleCycle) {
+			return nil, errors.New(language.RoleHierarchyCycle)
+		}
+		return nil, errors.New(language.RoleUpdateFailed)
+	}
+
+	s.authorizer.InvalidateCompany(role.CompanyID)
+	return s.roleDetails(roleID)
+}
+
+// roleDetails loads the role with its direct, group and inherited
+// permissions. Permissions the role holds itself are not repeated as
+// inherited.
+func (s *Service) roleDetails(roleID int64) (*RoleDetails, error) {
 	role, err := s.repo.GetRoleWithPermissions(roleID)
 	if err != nil {
 		return nil, errors.New(language.RoleListFailed)
 	}
+	ancestors, err := s.repo.GetRoleAncestors(role)
+	if err != nil {
+		return nil, errors.New(language.RoleListFailed)
+	}
 
-	return role, nil
+	groups, err := s.repo.GetRolePermissionGroups(roleID)
+	if err != nil {
+		return nil, errors.New(language.RoleListFailed)
+	}
+
+	seen := make(map[int64]bool, len(role.Permissions))
+	for _, permission := range role.Permissions {
+		seen[permission.ID] = true
+	}
+	for _, group := range groups {
+		for _, permission := range group.Permissions {
+			seen[permission.ID] = true
+		}
+	}
+	inherited := []InheritedPermission{}
+	for _, ancestorID := range ancestors {
+		permissions, err := s.repo.GetGrantedPermissionsByRoleID(ancestorID)
+		if err != nil {
+			return nil, errors.New(language.RoleListFailed)
+		}
+		for _, permission := range permissions {
+			if !seen[permission.ID] {
+				seen[permission.ID] = true
+				inherited = append(inherited, InheritedPermission{Permission: permission, InheritedFrom: ancestorID})
+			}
+		}
+	}
+
+	denies, err := s.repo.GetRoleDenies(append([]int64{roleID}, ancestors...))
+	if err != nil {
+		return nil, errors.New(language.RoleListFailed)
+	}
+
+	if ancestors == nil {
+		ancestors = []int64{}
+	}
+	return &RoleDetails{
+		Role:                 *role,
+		PermissionGroups:     groups,
+		Ancestors:            ancestors,
+		InheritedPermissions: inherited,
+		Denies:               denies,
+	}, nil
+}
+
+// SetRolePermissionGroups replaces the permission groups of a role with groups
+// of its company
+func (s *Service) SetRolePermissionGroups(ctx context.Context, roleID int64, groupIDs []int64) (*RoleDetails, error) {
+	role, err := s.val.ValidateRoleRequest(ctx, strconv.FormatInt(roleID, 10))
+	if err != nil {
+		return nil, err
+	}
+
+	owned, err := s.repo.CompanyOwnsPermissionGroups(role.CompanyID, groupIDs)
+	if err != nil {
+		return nil, errors.New(language.PermissionCheckFailed)
+	}
+	if !owned {
+		return nil, errors.New(language.PermissionGroupNotFound)
+	}
+
+	if err := s.repo.SetRolePermissionGroups(role, groupIDs); err != nil {
+		return nil, errors.New(language.RoleUpdateFailed)
+	}
+
+	s.authorizer.InvalidateCompany(role.CompanyID)
+	return s.roleDetails(roleID)
+}
+
+func (s *Service) CreatePermissionGroup(ctx context.Context, req *CreatePermissionGroupRequest) (*PermissionGroup, error) {
+	companyID := resolveCompanyID(ctx, req.CompanyID)
+	if err := s.val.ValidateCompanyRequest(ctx, companyID); err != nil {
+		return nil, err
+	}
+	if err := s.checkPermissionGroup(companyID, 0, req.Name, req.PermissionIDs); err != nil {
+		return nil, err
+	}
+
+	group := &PermissionGroup{
+		CompanyID:   companyID,
+		Name:        req.Name,
+		Description: req.Description,
+	}
+	if err := s.repo.CreatePermissionGroup(group, req.PermissionIDs); err != nil {
+		return nil, errors.New(language.PermissionGroupCreateFailed)
+	}
+
+	return s.getPermissionGroup(group.ID)
+}
+
+func (s *Service) GetPermissionGroup(ctx context.Context, groupID int64) (*PermissionGroup, error) {
+	return s.val.ValidatePermissionGroupRequest(ctx, groupID)
+}
+
+func (s *Service) ListPermissionGroups(ctx context.Context, companyID int64) ([]PermissionGroup, error) {
+	if err := s.val.ValidateCompanyRequest(ctx, companyID); err != nil {
+		return nil, err
+	}
+
+	groups, err := s.repo.ListPermissionGroups(companyID)
+	if err != nil {
+		return nil, errors.New(language.PermissionGroupListFailed)
+	}
+	return groups, nil
+}
+
+func (s *Service) UpdatePermissionGroup(ctx context.Context, groupID int64, req *UpdatePermissionGroupRequest) (*PermissionGroup, error) {
+	group, err := s.val.ValidatePermissionGroupRequest(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkPermissionGroup(group.CompanyID, group.ID, req.Name, req.PermissionIDs); err != nil {
+		return nil, err
+	}
+
+	group.Name = req.Name
+	group.Description = req.Description
+	if err := s.repo.UpdatePermissionGroup(group, req.PermissionIDs); err != nil {
+		return nil, errors.New(language.PermissionGroupUpdateFailed)
+	}
+
+	s.authorizer.InvalidateCompany(group.CompanyID)
+	return s.getPermissionGroup(group.ID)
+}
+
+func (s *Service) DeletePermissionGroup(ctx context.Context, groupID int64) error {
+	group, err := s.val.ValidatePermissionGroupRequest(ctx, groupID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.DeletePermissionGroup(group); err != nil {
+		return errors.New(language.PermissionGroupDeleteFailed)
+	}
+
+	s.authorizer.InvalidateCompany(group.CompanyID)
+	return nil
+}
+
+// checkPermissionGroup rejects names used by another group of the company and
+// permissions of other companies
+func (s *Service) checkPermissionGroup(companyID, groupID int64, name string, permissionIDs []int64) error {
+	taken, err := s.repo.PermissionGroupNameTaken(companyID, name, groupID)
+	if err != nil {
+		return errors.New(language.PermissionCheckFailed)
+	}
+	if taken {
+		return errors.New(language.PermissionGroupNameTaken)
+	}
+
+	owned, err := s.repo.CompanyOwnsPermissions(companyID, permissionIDs)
+	if err != nil {
+		return errors.New(language.PermissionCheckFailed)
+	}
+	if !owned {
+		return errors.New(language.PermissionNotFound)
+	}
+	return nil
+}
+
+func (s *Service) getPermissionGroup(groupID int64) (*PermissionGroup, error) {
+	group, err := s.repo.GetPermissionGroup(groupID)
+	if err != nil {
+		return nil, errors.New(language.PermissionGroupNotFound)
+	}
+	return group, nil
 }
 
 func (s *Service) CheckRootAccess(ctx context.Context, userID int64) (bool, error) {
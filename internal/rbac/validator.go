@@ -4,13 +4,17 @@ import (
 	"context"
 	"errors"
 	"net/http"
+	"slices"
 	"strconv"
 
 	"gobizmanager/internal/auth"
 	model "gobizmanager/internal/models"
+	"gobizmanager/pkg/condition"
 	"gobizmanager/pkg/language"
+	"gobizmanager/pkg/logger"
 
 	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
 )
 
 func GetLanguage(ctx context.Context) string {
@@ -32,27 +36,38 @@ func NewValidator(repo *Repository, msgStore *language.MessageStore) *Validator
 	}
 }
 
-func (v *Validator) ValidatePermissionRequest(ctx context.Context, permissionID int64) error {
-
+func (v *Validator) ValidatePermissionRequest(ctx context.Context, permissionID int64) (*model.Permission, error) {
 	userID, ok := auth.GetUserID(ctx)
 	if !ok {
-		return errors.New(language.AuthUserNotFound)
+		return nil, errors.New(language.AuthUserNotFound)
 	}
 
 	permission, err := v.Repo.GetPermissionByID(permissionID)
 	if err != nil {
-		return errors.New(language.PermissionNotFound)
+		return nil, errors.New(language.PermissionNotFound)
+	}
+	if err := checkRequestCompany(ctx, permission.CompanyID); err != nil {
+		return nil, err
 	}
 
-	hasAccess, err := v.Repo.HasCompanyAccess(userID, permission.CompanyID)
+	if err := v.checkCompanyAccess(userID, permission.CompanyID); err != nil {
+		return nil, err
+	}
+
+	return permission, nil
+}
+
+// ValidatePermissionGroupRequest validates a permission group request and
+// returns the group
+func (v *Validator) ValidatePermissionGroupRequest(ctx context.Context, groupID int64) (*PermissionGroup, error) {
+	group, err := v.Repo.GetPermissionGroup(groupID)
 	if err != nil {
-		return errors.New(language.PermissionCheckFailed)
+		return nil, errors.New(language.PermissionGroupNotFound)
 	}
-	if !hasAccess {
-		return errors.New(language.PermissionDenied)
+	if err := v.ValidateCompanyRequest(ctx, group.CompanyID); err != nil {
+		return nil, err
 	}
-
-	return nil
+	return group, nil
 }
 
 func (v *Validator) ValidateCompanyRequest(ctx context.Context, companyID int64) error {
@@ -60,14 +75,10 @@ func (v *Validator) ValidateCompanyRequest(ctx context.Context, companyID int64)
 	if !ok {
 		return errors.New(language.AuthUserNotFound)
 	}
-	hasAccess, err := v.Repo.HasCompanyAccess(userID, companyID)
-	if err != nil {
-		return errors.New(language.PermissionCheckFailed)
+	if err := checkRequestCompany(ctx, companyID); err != nil {
+		return err
 	}
-	if !hasAccess {
-		return errors.New(language.PermissionDenied)
-	}
-	return nil
+	return v.checkCompanyAccess(userID, companyID)
 }
 
 func (v *Validator) ValidateAndGetPermissionID(r *http.Request) (int64, error) {
@@ -104,26 +115,18 @@ func (v *Validator) ValidatePermissionAccess(userID int64, permissionID int64) (
 		return nil, errors.New(language.PermissionNotFound)
 	}
 
-	hasAccess, err := v.Repo.HasCompanyAccess(userID, permission.CompanyID)
-	if err != nil {
-		return nil, errors.New(language.PermissionCheckFailed)
-	}
-	if !hasAccess {
-		return nil, errors.New(language.PermissionDenied)
+	if err := v.checkCompanyAccess(userID, permission.CompanyID); err != nil {
+		return nil, err
 	}
 
 	return permission, nil
 }
 
 func (v *Validator) ValidateCompanyAccess(userID int64, companyID int64) (bool, error) {
-	hasAccess, err := v.Repo.HasCompanyAccess(userID, companyID)
-	if err != nil {
-		return false, errors.New(language.PermissionCheckFailed)
-	}
-	if !hasAccess {
-		return false, errors.New(language.PermissionDenied)
+	if err := v.checkCompanyAccess(userID, companyID); err != nil {
+		return false, err
 	}
-	return hasAccess, nil
+	return true, nil
 }
 
 func (v *Validator) ValidateRootAccess(userID int64) (bool, error) {
@@ -145,19 +148,18 @@ func (v *Validator) ValidateAuthenticatedUser(r *http.Request) (int64, error) {
 	return userID, nil
 }
 
+// ValidateRoleAssignment returns the membership of the user in the company of
+// the role
 func (v *Validator) ValidateRoleAssignment(ctx context.Context, req *AssignRoleRequest) (*CompanyUser, error) {
-
-	userID, ok := auth.GetUserID(ctx)
-	if !ok {
-		return nil, errors.New(language.AuthUserNotFound)
-	}
-
 	role, err := v.Repo.GetRoleByID(req.RoleID)
 	if err != nil {
 		return nil, errors.New(language.RoleNotFound)
 	}
+	if err := checkRequestCompany(ctx, role.CompanyID); err != nil {
+		return nil, err
+	}
 
-	companyUser, err := v.Repo.GetCompanyUser(userID, role.CompanyID)
+	companyUser, err := v.Repo.GetCompanyUser(req.UserID, role.CompanyID)
 	if err != nil {
 		return nil, errors.New(language.CompanyUserNotFound)
 	}
@@ -173,31 +175,124 @@ func (v *Validator) ValidateRoleAssignment(ctx context.Context, req *AssignRoleR
 	return companyUser, nil
 }
 
-// ValidateRoleRequest validates a role request
-func (v *Validator) ValidateRoleRequest(ctx context.Context, roleID string) error {
+// ValidateConditions checks that every condition parses and belongs to one of
+// the module actions. Empty conditions are dropped.
+func (v *Validator) ValidateConditions(moduleActionIDs []int64, conditions map[int64]string) (map[int64]string, error) {
+	valid := make(map[int64]string, len(conditions))
+	for moduleActionID, src := range conditions {
+		if src == "" {
+			continue
+		}
+		if !slices.Contains(moduleActionIDs, moduleActionID) {
+			return nil, errors.New(language.PermissionConditionInvalid)
+		}
+		if _, err := condition.Parse(src); err != nil {
+			logger.Info("Invalid permission condition", zap.Int64("moduleActionID", moduleActionID), zap.Error(err))
+			return nil, errors.New(language.PermissionConditionInvalid)
+		}
+		valid[moduleActionID] = src
+	}
+	return valid, nil
+}
+
+// ValidatePermissionDeny returns the deny the request creates in the company.
+// ROOT, through its role or a member holding it, cannot be denied.
+func (v *Validator) ValidatePermissionDeny(ctx context.Context, companyID int64, req *CreatePermissionDenyRequest) (*PermissionDeny, error) {
+	if (req.RoleID == 0) == (req.UserID == 0) {
+		return nil, errors.New(language.PermissionDenyTargetInvalid)
+	}
+	if _, err := v.Repo.GetModuleActionByID(req.ModuleActionID); err != nil {
+		return nil, errors.New(language.PermissionDenyActionNotFound)
+	}
+	deny := &PermissionDeny{ModuleActionID: req.ModuleActionID}
+
+	if req.RoleID != 0 {
+		role, err := v.Repo.GetRoleByID(req.RoleID)
+		if err != nil {
+			return nil, errors.New(language.RoleNotFound)
+		}
+		if role.Name == "ROOT" && role.CompanyID == 0 {
+			return nil, errors.New(language.PermissionDenyRoot)
+		}
+		if _, err := v.ValidateRoleRequest(ctx, strconv.FormatInt(role.ID, 10)); err != nil {
+			return nil, err
+		}
+		deny.CompanyID = role.CompanyID
+		deny.RoleID = &role.ID
+		return deny, nil
+	}
 
+	if err := v.ValidateCompanyRequest(ctx, companyID); err != nil {
+		return nil, err
+	}
+	isRoot, err := v.Repo.IsRoot(req.UserID)
+	if err != nil {
+		return nil, errors.New(language.PermissionCheckFailed)
+	}
+	if isRoot {
+		return nil, errors.New(language.PermissionDenyRoot)
+	}
+	companyUser, err := v.Repo.GetCompanyUser(req.UserID, companyID)
+	if err != nil {
+		return nil, errors.New(language.CompanyUserNotFound)
+	}
+	deny.CompanyID = companyID
+	deny.CompanyUserID = &companyUser.ID
+	return deny, nil
+}
+
+// ValidateRoleRequest validates a role request and returns the role
+func (v *Validator) ValidateRoleRequest(ctx context.Context, roleID string) (*model.Role, error) {
 	userID, ok := auth.GetUserID(ctx)
 	if !ok {
-		return errors.New(language.AuthUserNotFound)
+		return nil, errors.New(language.AuthUserNotFound)
 	}
 
 	id, err := strconv.ParseInt(roleID, 10, 64)
 	if err != nil {
-		return errors.New(language.ValidationInvalidID)
+		return nil, errors.New(language.ValidationInvalidID)
 	}
 
 	role, err := v.Repo.GetRoleByID(id)
 	if err != nil {
-		return errors.New(language.RoleNotFound)
+		return nil, errors.New(language.RoleNotFound)
+	}
+	if err := checkRequestCompany(ctx, role.CompanyID); err != nil {
+		return nil, err
+	}
+
+	if err := v.checkCompanyAccess(userID, role.CompanyID); err != nil {
+		return nil, err
+	}
+
+	return role, nil
+}
+
+// checkCompanyAccess lets ROOT and the members of the company through
+func (v *Validator) checkCompanyAccess(userID, companyID int64) error {
+	isRoot, err := v.Repo.IsRoot(userID)
+	if err != nil {
+		return errors.New(language.PermissionCheckFailed)
+	}
+	if isRoot {
+		return nil
 	}
 
-	hasAccess, err := v.Repo.HasCompanyAccess(userID, role.CompanyID)
+	hasAccess, err := v.Repo.HasCompanyAccess(userID, companyID)
 	if err != nil {
 		return errors.New(language.PermissionCheckFailed)
 	}
 	if !hasAccess {
 		return errors.New(language.PermissionDenied)
 	}
+	return nil
+}
 
+// checkRequestCompany rejects resources of a company other than the one
+// RequirePermission authorized the request for
+func checkRequestCompany(ctx context.Context, companyID int64) error {
+	if requestID, ok := RequestCompanyID(ctx); ok && requestID != companyID {
+		return errors.New(language.PermissionDenied)
+	}
 	return nil
 }
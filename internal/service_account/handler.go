@@ -0,0 +1,352 @@
+package service_account
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+	"go.uber.org/zap"
+
+	"gobizmanager/internal/auth"
+	"gobizmanager/internal/rbac"
+	types "gobizmanager/internal/types"
+	pkgctx "gobizmanager/pkg/context"
+	"gobizmanager/pkg/language"
+	"gobizmanager/pkg/logger"
+	"gobizmanager/pkg/shared"
+	"gobizmanager/pkg/utils"
+)
+
+type Handler struct {
+	shared.BaseHandler
+	repo       *Repository
+	rbacRepo   *rbac.Repository
+	authorizer *rbac.Authorizer
+	tokenRepo  *auth.Repository
+	validator  *validator.Validate
+}
+
+func NewHandler(repo *Repository, rbacRepo *rbac.Repository, authorizer *rbac.Authorizer, tokenRepo *auth.Repository, msgStore *language.MessageStore) *Handler {
+	return &Handler{
+		BaseHandler: shared.BaseHandler{MsgStore: msgStore},
+		repo:        repo,
+		rbacRepo:    rbacRepo,
+		authorizer:  authorizer,
+		tokenRepo:   tokenRepo,
+		validator:   validator.New(),
+	}
+}
+
+// ListServiceAccounts lists the service accounts of the company
+func (h *Handler) ListServiceAccounts(w http.ResponseWriter, r *http.Request) {
+	companyID, _, ok := h.caller(w, r)
+	if !ok {
+		return
+	}
+
+	accounts, err := h.repo.ListServiceAccounts(companyID)
+	if err != nil {
+		logger.Error("Failed to list service accounts", zap.Error(err))
+		h.RespondError(w, r, errors.New(language.ServiceAccountListFailed))
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, accounts)
+}
+
+// CreateServiceAccount creates a service account in the company
+func (h *Handler) CreateServiceAccount(w http.ResponseWriter, r *http.Request) {
+	companyID, callerID, ok := h.caller(w, r)
+	if !ok {
+		return
+	}
+
+	var req CreateServiceAccountRequest
+	if !h.parse(w, r, &req) {
+		return
+	}
+
+	if !h.checkNameAvailable(w, r, companyID, req.Name, 0) {
+		return
+	}
+
+	account, err := h.repo.CreateServiceAccount(companyID, callerID, req.Name, req.Description)
+	if err != nil {
+		logger.Error("Failed to create service account", zap.Error(err))
+		h.RespondError(w, r, errors.New(language.ServiceAccountCreateFailed))
+		return
+	}
+
+	logger.Info("Service account created", zap.Int64("companyID", companyID), zap.Int64("serviceAccountID", account.ID))
+	utils.JSON(w, http.StatusCreated, account)
+}
+
+// GetServiceAccount returns a service account of the company
+func (h *Handler) GetServiceAccount(w http.ResponseWriter, r *http.Request) {
+	companyID, _, ok := h.caller(w, r)
+	if !ok {
+		return
+	}
+
+	account, ok := h.getAccount(w, r, companyID)
+	if !ok {
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, account)
+}
+
+// UpdateServiceAccount renames a service account
+func (h *Handler) UpdateServiceAccount(w http.ResponseWriter, r *http.Request) {
+	companyID, _, ok := h.caller(w, r)
+	if !ok {
+		return
+	}
+
+	account, ok := h.getAccount(w, r, companyID)
+	if !ok {
+		return
+	}
+
+	var req UpdateServiceAccountRequest
+	if !h.parse(w, r, &req) {
+		return
+	}
+
+	if !h.checkNameAvailable(w, r, companyID, req.Name, account.ID) {
+		return
+	}
+
+	if err := h.repo.UpdateServiceAccount(account, req.Name, req.Description); err != nil {
+		logger.Error("Failed to update service account", zap.Error(err))
+		h.RespondError(w, r, errors.New(language.ServiceAccountUpdateFailed))
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, account)
+}
+
+// DeleteServiceAccount deletes a service account together with its API keys
+func (h *Handler) DeleteServiceAccount(w http.ResponseWriter, r *http.Request) {
+	companyID, _, ok := h.caller(w, r)
+	if !ok {
+		return
+	}
+
+	account, ok := h.getAccount(w, r, companyID)
+	if !ok {
+		return
+	}
+
+	if err := h.repo.DeleteServiceAccount(account); err != nil {
+		logger.Error("Failed to delete service account", zap.Error(err))
+		h.RespondError(w, r, errors.New(language.ServiceAccountDeleteFailed))
+		return
+	}
+
+	msg, httpStatus := h.MsgStore.GetMessage(pkgctx.GetLanguage(r.Context()), language.ServiceAccountDeleted)
+	utils.JSON(w, httpStatus, msg)
+}
+
+// AssignRole gives the service account one of the company's roles
+func (h *Handler) AssignRole(w http.ResponseWriter, r *http.Request) {
+	companyID, _, ok := h.caller(w, r)
+	if !ok {
+		return
+	}
+
+	account, ok := h.getAccount(w, r, companyID)
+	if !ok {
+		return
+	}
+
+	roleID, err := strconv.ParseInt(chi.URLParam(r, "roleID"), 10, 64)
+	if err != nil {
+		h.RespondError(w, r, errors.New(language.ValidationInvalidID))
+		return
+	}
+
+	if err := h.repo.AssignRole(account, roleID); err != nil {
+		if errors.Is(err, ErrRoleNotInCompany) {
+			h.RespondError(w, r, errors.New(language.RoleNotFound))
+			return
+		}
+		logger.Error("Failed to assign role to service account", zap.Error(err))
+		h.RespondError(w, r, errors.New(language.RoleAssignFailed))
+		return
+	}
+	h.authorizer.InvalidateUser(account.UserID, companyID)
+
+	msg, httpStatus := h.MsgStore.GetMessage(pkgctx.GetLanguage(r.Context()), language.RoleAssigned)
+	utils.JSON(w, httpStatus, msg)
+}
+
+// RemoveRole takes a role away from the service account
+func (h *Handler) RemoveRole(w http.ResponseWriter, r *http.Request) {
+	companyID, _, ok := h.caller(w, r)
+	if !ok {
+		return
+	}
+
+	account, ok := h.getAccount(w, r, companyID)
+	if !ok {
+		return
+	}
+
+	roleID, err := strconv.ParseInt(chi.URLParam(r, "roleID"), 10, 64)
+	if err != nil {
+		h.RespondError(w, r, errors.New(language.ValidationInvalidID))
+		return
+	}
+
+	if err := h.repo.RemoveRole(account, roleID); err != nil {
+		logger.Error("Failed to remove role from service account", zap.Error(err))
+		h.RespondError(w, r, errors.New(language.RoleAssignFailed))
+		return
+	}
+	h.authorizer.InvalidateUser(account.UserID, companyID)
+
+	msg, httpStatus := h.MsgStore.GetMessage(pkgctx.GetLanguage(r.Context()), language.ServiceAccountRoleRemoved)
+	utils.JSON(w, httpStatus, msg)
+}
+
+// CreateAPIKey issues an API key owned by the service account
+func (h *Handler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	companyID, _, ok := h.caller(w, r)
+	if !ok {
+		return
+	}
+
+	account, ok := h.getAccount(w, r, companyID)
+	if !ok {
+		return
+	}
+
+	var req CreateServiceAccountAPIKeyRequest
+	if !h.parse(w, r, &req) {
+		return
+	}
+
+	created, err := auth.IssueAPIKey(h.tokenRepo, h.rbacRepo, account.UserID, types.CreateAPIKeyRequest{
+		Name:            req.Name,
+		CompanyID:       companyID,
+		ModuleActionIDs: req.ModuleActionIDs,
+		ExpiresInDays:   req.ExpiresInDays,
+	})
+	if err != nil {
+		h.RespondError(w, r, err)
+		return
+	}
+
+	utils.JSON(w, http.StatusCreated, created)
+}
+
+// ListAPIKeys lists the active API keys of the service account
+func (h *Handler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	companyID, _, ok := h.caller(w, r)
+	if !ok {
+		return
+	}
+
+	account, ok := h.getAccount(w, r, companyID)
+	if !ok {
+		return
+	}
+
+	keys, err := h.tokenRepo.ListActiveAPIKeys(account.UserID)
+	if err != nil {
+		logger.Error("Failed to list API keys", zap.Error(err))
+		h.RespondError(w, r, errors.New(language.APIKeyListFailed))
+		return
+	}
+
+	utils.JSON(w, http.StatusOK, keys)
+}
+
+// RevokeAPIKey revokes an API key of the service account
+func (h *Handler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	companyID, _, ok := h.caller(w, r)
+	if !ok {
+		return
+	}
+
+	account, ok := h.getAccount(w, r, companyID)
+	if !ok {
+		return
+	}
+
+	keyID, err := strconv.ParseInt(chi.URLParam(r, "keyID"), 10, 64)
+	if err != nil {
+		h.RespondError(w, r, errors.New(language.ValidationInvalidID))
+		return
+	}
+
+	if err := auth.RevokeUserAPIKey(h.tokenRepo, account.UserID, keyID); err != nil {
+		h.RespondError(w, r, err)
+		return
+	}
+
+	msg, httpStatus := h.MsgStore.GetMessage(pkgctx.GetLanguage(r.Context()), language.APIKeyRevoked)
+	utils.JSON(w, httpStatus, msg)
+}
+
+// caller returns the company from the URL, which the route's permission
+// requirement was checked against, and the caller's ID
+func (h *Handler) caller(w http.ResponseWriter, r *http.Request) (int64, int64, bool) {
+	callerID, ok := h.MustGetUserID(w, r)
+	if !ok {
+		return 0, 0, false
+	}
+
+	companyID, err := strconv.ParseInt(chi.URLParam(r, "companyID"), 10, 64)
+	if err != nil {
+		h.RespondError(w, r, errors.New(language.CompanyNotFound))
+		return 0, 0, false
+	}
+
+	return companyID, callerID, true
+}
+
+func (h *Handler) getAccount(w http.ResponseWriter, r *http.Request, companyID int64) (*ServiceAccount, bool) {
+	accountID, err := strconv.ParseInt(chi.URLParam(r, "accountID"), 10, 64)
+	if err != nil {
+		h.RespondError(w, r, errors.New(language.ServiceAccountNotFound))
+		return nil, false
+	}
+
+	account, err := h.repo.GetServiceAccount(companyID, accountID)
+	if err != nil {
+		h.RespondError(w, r, errors.New(language.ServiceAccountNotFound))
+		return nil, false
+	}
+	return account, true
+}
+
+func (h *Handler) parse(w http.ResponseWriter, r *http.Request, req interface{}) bool {
+	if err := utils.ParseRequest(r, req); err != nil {
+		h.RespondError(w, r, err)
+		return false
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		utils.ValidationError(w, r, err, h.MsgStore)
+		return false
+	}
+	return true
+}
+
+func (h *Handler) checkNameAvailable(w http.ResponseWriter, r *http.Request, companyID int64, name string, excludeID int64) bool {
+	exists, err := h.repo.NameExists(companyID, name, excludeID)
+	if err != nil {
+		logger.Error("Failed to check service account name", zap.Error(err))
+		h.RespondError(w, r, errors.New(language.ServiceAccountCreateFailed))
+		return false
+	}
+	if exists {
+		h.RespondError(w, r, errors.New(language.ServiceAccountNameExists))
+		return false
+	}
+	return true
+}
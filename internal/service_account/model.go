@@ -0,0 +1,38 @@
+package service_account
+
+import "time"
+
+// ServiceAccount is a non-human member of a company. It is backed by a users
+// row that cannot log in, holds roles through user_roles and authenticates
+// with API keys only.
+type ServiceAccount struct {
+	ID          int64     `json:"id"`
+	CompanyID   int64     `json:"company_id"`
+	UserID      int64     `json:"user_id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	CreatedBy   int64     `json:"created_by"`
+	RoleIDs     []int64   `json:"role_ids" gorm:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// CreateServiceAccountRequest represents the request to create a service account
+type CreateServiceAccountRequest struct {
+	Name        string `json:"name" validate:"required,min=3,max=100" msg:"auth.field_required"`
+	Description string `json:"description" validate:"max=255" msg:"validation.failed"`
+}
+
+// UpdateServiceAccountRequest represents the request to rename a service account
+type UpdateServiceAccountRequest struct {
+	Name        string `json:"name" validate:"required,min=3,max=100" msg:"auth.field_required"`
+	Description string `json:"description" validate:"max=255" msg:"validation.failed"`
+}
+
+// CreateServiceAccountAPIKeyRequest represents the request to issue an API key
+// for a service account. The company comes from the URL.
+type CreateServiceAccountAPIKeyRequest struct {
+	Name            string  `json:"name" validate:"required,min=3,max=100" msg:"auth.field_required"`
+	ModuleActionIDs []int64 `json:"module_action_ids" validate:"required,min=1" msg:"auth.field_required"`
+	ExpiresInDays   int     `json:"expires_in_days" validate:"omitempty,min=1,max=365" msg:"validation.failed"`
+}
@@ -0,0 +1,207 @@
+package service_account
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	model "gobizmanager/internal/models"
+	"gobizmanager/internal/rbac"
+	userpkg "gobizmanager/internal/user"
+	"gobizmanager/pkg/encryption"
+	"gobizmanager/platform/config"
+
+	"gorm.io/gorm"
+)
+
+var ErrRoleNotInCompany = errors.New("role does not belong to the company")
+
+type Repository struct {
+	db  *gorm.DB
+	cfg *config.Config
+}
+
+func NewRepository(db *gorm.DB, cfg *config.Config) *Repository {
+	return &Repository{db: db, cfg: cfg}
+}
+
+// CreateServiceAccount creates the backing user, its company membership and
+// the service account in a single transaction. The user gets a placeholder
+// address and a random password nobody knows.
+func (r *Repository) CreateServiceAccount(companyID, createdBy int64, name, description string) (*ServiceAccount, error) {
+	secret, err := randomHex(32)
+	if err != nil {
+		return nil, err
+	}
+	email := fmt.Sprintf("sa-%s@service-accounts.invalid", secret[:16])
+
+	hashedPassword, err := encryption.HashPassword(secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	tx := r.db.Begin()
+	if tx.Error != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", tx.Error)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	user := &model.User{
+		Email:            email,
+		Password:         hashedPassword,
+		IsServiceAccount: true,
+	}
+	if err := user.EncryptSensitiveFields(r.cfg.EncryptionKey); err != nil {
+		return nil, err
+	}
+	user.EmailHash = userpkg.HashEmail(email)
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	if err := tx.Create(user).Error; err != nil {
+		return nil, fmt.Errorf("failed to create service account user: %w", err)
+	}
+
+	companyUser := &rbac.CompanyUser{
+		CompanyID: companyID,
+		UserID:    user.ID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := tx.Create(companyUser).Error; err != nil {
+		return nil, fmt.Errorf("failed to add service account to company: %w", err)
+	}
+
+	account := &ServiceAccount{
+		CompanyID:   companyID,
+		UserID:      user.ID,
+		Name:        name,
+		Description: description,
+		CreatedBy:   createdBy,
+		RoleIDs:     []int64{},
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := tx.Create(account).Error; err != nil {
+		return nil, fmt.Errorf("failed to create service account: %w", err)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return account, nil
+}
+
+// GetServiceAccount returns a service account of the company with its roles
+func (r *Repository) GetServiceAccount(companyID, id int64) (*ServiceAccount, error) {
+	var account ServiceAccount
+	if err := r.db.Where("id = ? AND company_id = ?", id, companyID).First(&account).Error; err != nil {
+		return nil, err
+	}
+	if err := r.loadRoleIDs(&account); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+func (r *Repository) ListServiceAccounts(companyID int64) ([]ServiceAccount, error) {
+	var accounts []ServiceAccount
+	if err := r.db.Where("company_id = ?", companyID).Order("name").Find(&accounts).Error; err != nil {
+		return nil, err
+	}
+	for i := range accounts {
+		if err := r.loadRoleIDs(&accounts[i]); err != nil {
+			return nil, err
+		}
+	}
+	return accounts, nil
+}
+
+// NameExists reports whether another service account of the company uses name
+func (r *Repository) NameExists(companyID int64, name string, excludeID int64) (bool, error) {
+	var count int64
+	if err := r.db.Model(&ServiceAccount{}).
+		Where("company_id = ? AND name = ? AND id <> ?", companyID, name, excludeID).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (r *Repository) UpdateServiceAccount(account *ServiceAccount, name, description string) error {
+	account.Name = name
+	account.Description = description
+	account.UpdatedAt = time.Now()
+	return r.db.Model(account).
+		Updates(map[string]interface{}{"name": name, "description": description, "updated_at": account.UpdatedAt}).Error
+}
+
+// DeleteServiceAccount removes the backing user; its membership, roles, API
+// keys and the service account row cascade with it
+func (r *Repository) DeleteServiceAccount(account *ServiceAccount) error {
+	return r.db.Delete(&model.User{}, account.UserID).Error
+}
+
+// AssignRole gives the service account a role defined by its company
+func (r *Repository) AssignRole(account *ServiceAccount, roleID int64) error {
+	var role model.Role
+	if err := r.db.First(&role, roleID).Error; err != nil || role.CompanyID != account.CompanyID {
+		return ErrRoleNotInCompany
+	}
+
+	var companyUser rbac.CompanyUser
+	if err := r.db.Where("company_id = ? AND user_id = ?", account.CompanyID, account.UserID).First(&companyUser).Error; err != nil {
+		return err
+	}
+
+	var count int64
+	if err := r.db.Model(&model.UserRole{}).
+		Where("user_id = ? AND role_id = ?", account.UserID, roleID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	now := time.Now()
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&model.UserRole{
+			UserID:        account.UserID,
+			CompanyUserID: companyUser.ID,
+			RoleID:        roleID,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}).Error; err != nil {
+			return err
+		}
+		return rbac.BumpVersion(tx, account.CompanyID)
+	})
+}
+
+func (r *Repository) RemoveRole(account *ServiceAccount, roleID int64) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND role_id = ?", account.UserID, roleID).Delete(&model.UserRole{}).Error; err != nil {
+			return err
+		}
+		return rbac.BumpVersion(tx, account.CompanyID)
+	})
+}
+
+func (r *Repository) loadRoleIDs(account *ServiceAccount) error {
+	account.RoleIDs = []int64{}
+	return r.db.Model(&model.UserRole{}).
+		Where("user_id = ?", account.UserID).
+		Order("role_id").
+		Pluck("role_id", &account.RoleIDs).Error
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,31 @@
+package service_account
+
+import (
+	"net/http"
+
+	"gobizmanager/internal/rbac"
+	"gobizmanager/platform/middleware/permission"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Routes returns the service account routes, mounted under
+// /companies/{companyID}/service-accounts
+func Routes(handler *Handler, guard permission.Guard) http.Handler {
+	r := chi.NewRouter()
+
+	r.With(guard.RequirePermission(rbac.ModuleUser, rbac.ActionRead)).Get("/", handler.ListServiceAccounts)
+	r.With(guard.RequirePermission(rbac.ModuleUser, rbac.ActionCreate)).Post("/", handler.CreateServiceAccount)
+	r.With(guard.RequirePermission(rbac.ModuleUser, rbac.ActionRead)).Get("/{accountID}", handler.GetServiceAccount)
+	r.With(guard.RequirePermission(rbac.ModuleUser, rbac.ActionUpdate)).Put("/{accountID}", handler.UpdateServiceAccount)
+	r.With(guard.RequirePermission(rbac.ModuleUser, rbac.ActionDelete)).Delete("/{accountID}", handler.DeleteServiceAccount)
+
+	r.With(guard.RequirePermission(rbac.ModuleUser, rbac.ActionUpdate)).Put("/{accountID}/roles/{roleID}", handler.AssignRole)
+	r.With(guard.RequirePermission(rbac.ModuleUser, rbac.ActionUpdate)).Delete("/{accountID}/roles/{roleID}", handler.RemoveRole)
+
+	r.With(guard.RequirePermission(rbac.ModuleUser, rbac.ActionRead)).Get("/{accountID}/api-keys", handler.ListAPIKeys)
+	r.With(guard.RequirePermission(rbac.ModuleUser, rbac.ActionUpdate)).Post("/{accountID}/api-keys", handler.CreateAPIKey)
+	r.With(guard.RequirePermission(rbac.ModuleUser, rbac.ActionUpdate)).Delete("/{accountID}/api-keys/{keyID}", handler.RevokeAPIKey)
+
+	return r
+}
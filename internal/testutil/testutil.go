@@ -0,0 +1,203 @@
+// Package testutil sets up what the tests of the internal packages share: a
+// migrated database, a silent logger and the rows most tests start from.
+package testutil
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+
+	model "gobizmanager/internal/models"
+	"gobizmanager/internal/user"
+	"gobizmanager/pkg/encryption"
+	"gobizmanager/pkg/logger"
+	"gobizmanager/pkg/migration"
+	"gobizmanager/platform/config"
+	"gobizmanager/platform/database"
+)
+
+// company holds the columns fixtures fill in. The company package imports
+// rbac, so tests of rbac could not use its model.
+type company struct {
+	ID        int64
+	Name      string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (company) TableName() string { return "companies" }
+
+// companyUser, permissionModuleAction and rolePermission stand in for the rbac
+// models for the same reason
+type companyUser struct {
+	ID        int64
+	CompanyID int64
+	UserID    int64
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (companyUser) TableName() string { return "company_users" }
+
+type permissionModuleAction struct {
+	ID             int64
+	PermissionID   int64
+	ModuleActionID int64
+	Condition      string
+}
+
+func (permissionModuleAction) TableName() string { return "permission_module_actions" }
+
+type rolePermission struct {
+	ID           int64
+	RoleID       int64
+	PermissionID int64
+}
+
+func (rolePermission) TableName() string { return "role_permissions" }
+
+// permissions numbers the permissions Grant creates, whose names must be
+// unique in their company
+var permissions atomic.Int64
+
+// NewDB returns a database with every migration applied, removed when the
+// test ends
+func NewDB(t testing.TB) *gorm.DB {
+	t.Helper()
+	logger.Log = zap.NewNop()
+
+	db, err := database.NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("get SQL database: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if err := migration.ApplyMigrations(sqlDB); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+	return db.Session(&gorm.Session{Logger: gormlogger.Discard})
+}
+
+// Config returns the configuration repositories need in tests
+func Config() *config.Config {
+	return &config.Config{EncryptionKey: config.DefaultEncryptionKey}
+}
+
+// CreateCompany inserts a company and returns its ID
+func CreateCompany(t testing.TB, db *gorm.DB, name string) int64 {
+	t.Helper()
+	now := time.Now()
+	c := &company{Name: name, CreatedAt: now, UpdatedAt: now}
+	if err := db.Create(c).Error; err != nil {
+		t.Fatalf("create company: %v", err)
+	}
+	return c.ID
+}
+
+// CreateRole inserts a role of the company and returns its ID
+func CreateRole(t testing.TB, db *gorm.DB, companyID int64, name string) int64 {
+	t.Helper()
+	now := time.Now()
+	role := &model.Role{CompanyID: companyID, Name: name, CreatedAt: now, UpdatedAt: now}
+	if err := db.Create(role).Error; err != nil {
+		t.Fatalf("create role: %v", err)
+	}
+	return role.ID
+}
+
+// CreateUser inserts a user with the email address and returns its ID
+func CreateUser(t testing.TB, db *gorm.DB, email string) int64 {
+	t.Helper()
+	hashed, err := encryption.HashPassword("Secret-password-1")
+	if err != nil {
+		t.Fatalf("hash password: %v", err)
+	}
+
+	now := time.Now()
+	u := &model.User{Email: email, Password: hashed}
+	if err := u.EncryptSensitiveFields(Config().EncryptionKey); err != nil {
+		t.Fatalf("encrypt user: %v", err)
+	}
+	u.EmailHash = user.HashEmail(email)
+	u.CreatedAt = now
+	u.UpdatedAt = now
+	if err := db.Create(u).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return u.ID
+}
+
+// MakeRoot gives the user the global ROOT role
+func MakeRoot(t testing.TB, db *gorm.DB, userID int64) {
+	t.Helper()
+	var root model.Role
+	if err := db.Where("name = ? AND company_id IS NULL", "ROOT").First(&root).Error; err != nil {
+		t.Fatalf("read root role: %v", err)
+	}
+	now := time.Now()
+	userRole := &model.UserRole{UserID: userID, RoleID: root.ID, CreatedAt: now, UpdatedAt: now}
+	// The global role belongs to no company membership
+	if err := db.Omit("CompanyUserID").Create(userRole).Error; err != nil {
+		t.Fatalf("assign root role: %v", err)
+	}
+}
+
+// AddMember adds the user to the company with the roles and returns the ID
+// of the membership
+func AddMember(t testing.TB, db *gorm.DB, companyID, userID int64, roleIDs ...int64) int64 {
+	t.Helper()
+	now := time.Now()
+	member := &companyUser{CompanyID: companyID, UserID: userID, CreatedAt: now, UpdatedAt: now}
+	if err := db.Create(member).Error; err != nil {
+		t.Fatalf("add member: %v", err)
+	}
+
+	for _, roleID := range roleIDs {
+		userRole := &model.UserRole{UserID: userID, CompanyUserID: member.ID, RoleID: roleID, CreatedAt: now, UpdatedAt: now}
+		if err := db.Create(userRole).Error; err != nil {
+			t.Fatalf("assign role: %v", err)
+		}
+	}
+	return member.ID
+}
+
+// Grant gives the role a new permission of its company holding the module
+// actions and returns the permission ID
+func Grant(t testing.TB, db *gorm.DB, companyID, roleID int64, moduleActionIDs ...int64) int64 {
+	t.Helper()
+	return GrantIf(t, db, companyID, roleID, "", moduleActionIDs...)
+}
+
+// GrantIf is Grant for module actions held under the condition
+func GrantIf(t testing.TB, db *gorm.DB, companyID, roleID int64, condition string, moduleActionIDs ...int64) int64 {
+	t.Helper()
+	now := time.Now()
+	permission := &model.Permission{
+		CompanyID: companyID,
+		Name:      fmt.Sprintf("permission-%d", permissions.Add(1)),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := db.Create(permission).Error; err != nil {
+		t.Fatalf("create permission: %v", err)
+	}
+	for _, moduleActionID := range moduleActionIDs {
+		if err := db.Create(&permissionModuleAction{PermissionID: permission.ID, ModuleActionID: moduleActionID, Condition: condition}).Error; err != nil {
+			t.Fatalf("add module action: %v", err)
+		}
+	}
+	if err := db.Create(&rolePermission{RoleID: roleID, PermissionID: permission.ID}).Error; err != nil {
+		t.Fatalf("grant permission: %v", err)
+	}
+	return permission.ID
+}
@@ -0,0 +1,8 @@
+package types
+
+type CreateAPIKeyRequest struct {
+	Name            string  `json:"name" validate:"required,min=3,max=100" msg:"auth.field_required"`
+	CompanyID       int64   `json:"company_id" validate:"required" msg:"auth.field_required"`
+	ModuleActionIDs []int64 `json:"module_action_ids" validate:"required,min=1" msg:"auth.field_required"`
+	ExpiresInDays   int     `json:"expires_in_days" validate:"omitempty,min=1,max=365" msg:"validation.failed"`
+}
@@ -0,0 +1,20 @@
+package types
+
+type MFAVerifyRequest struct {
+	MFAToken     string `json:"mfa_token" validate:"required" msg:"auth.field_required"`
+	Code         string `json:"code" validate:"required_without=RecoveryCode" msg:"auth.field_required"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type MFAEnrollRequest struct {
+	MFAToken string `json:"mfa_token"`
+}
+
+type MFAConfirmRequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code" validate:"required" msg:"auth.field_required"`
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code" validate:"required" msg:"auth.field_required"`
+}
@@ -7,10 +7,66 @@ type CreateUserRequest struct {
 }
 
 type LoginRequest struct {
-	Username string `json:"username" validate:"required,email" msg:"auth.invalid_email"`
+	// Username is an email address for local accounts; directory logins may also
+	// use the directory user name
+	Username string `json:"username" validate:"required,max=255" msg:"auth.field_required"`
 	Password string `json:"password" validate:"required" msg:"auth.field_required"`
 }
 
 type RefreshRequest struct {
 	RefreshToken string `json:"refresh_token" validate:"required" msg:"auth.field_required"`
 }
+
+type ForgotPasswordRequest struct {
+	Username string `json:"username" validate:"required,email" msg:"auth.invalid_email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required" msg:"auth.field_required"`
+	Password string `json:"password" validate:"required,min=8" msg:"auth.password_too_short"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required" msg:"auth.field_required"`
+	NewPassword     string `json:"new_password" validate:"required,min=8" msg:"auth.password_too_short"`
+}
+
+// ChangeEmailRequest starts an email change; the current password is required
+// so a stolen session alone cannot take over the account
+type ChangeEmailRequest struct {
+	Email    string `json:"email" validate:"required,email" msg:"auth.invalid_email"`
+	Password string `json:"password" validate:"required" msg:"auth.field_required"`
+}
+
+// ConfirmEmailChangeRequest carries the token sent to the new email address
+type ConfirmEmailChangeRequest struct {
+	Token string `json:"token" validate:"required" msg:"auth.field_required"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required" msg:"auth.field_required"`
+}
+
+// UnlockAccountRequest carries the token from an account unlock email
+type UnlockAccountRequest struct {
+	Token string `json:"token" validate:"required" msg:"auth.field_required"`
+}
+
+type SwitchCompanyRequest struct {
+	CompanyID int64 `json:"company_id" validate:"required" msg:"auth.field_required"`
+}
+
+// SetupRequest creates the first ROOT user with the setup token logged at startup
+type SetupRequest struct {
+	Token    string `json:"token" validate:"required" msg:"auth.field_required"`
+	Username string `json:"username" validate:"required,email" msg:"auth.invalid_email"`
+	Password string `json:"password" validate:"required,min=8" msg:"auth.password_too_short"`
+}
+
+// ImpersonateRequest asks for a token acting as a member of a company. The
+// reason is kept in the audit log.
+type ImpersonateRequest struct {
+	UserID    int64  `json:"user_id" validate:"required" msg:"auth.field_required"`
+	CompanyID int64  `json:"company_id" validate:"required" msg:"auth.field_required"`
+	Reason    string `json:"reason" validate:"required,max=500" msg:"auth.field_required"`
+}
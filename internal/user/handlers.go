@@ -14,7 +14,7 @@ func NewHandler(repo *Repository) *Handler {
 }
 
 func (h *Handler) SearchUsers(w http.ResponseWriter, r *http.Request) {
-	companyID := r.URL.Query().Get("companyId")
+	companyID := r.URL.Query().Get("company_id")
 	if companyID == "" {
 		http.Error(w, "Company ID is required", http.StatusBadRequest)
 		return
@@ -0,0 +1,106 @@
+package user
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	model "gobizmanager/internal/models"
+	"gobizmanager/pkg/logger"
+	"gobizmanager/pkg/passwordpolicy"
+)
+
+// maxPasswordHistory bounds the stored hashes per user, whatever the policies ask for
+const maxPasswordHistory = 24
+
+// PasswordPolicy returns the strictest combination of the policies of the
+// companies the user belongs to and of companyID, which may be one the user is
+// about to join. Either ID may be zero.
+func (r *Repository) PasswordPolicy(userID, companyID int64) (passwordpolicy.Policy, error) {
+	var rows []model.PasswordPolicy
+	err := r.db.Where("company_id = ? OR company_id IN (?)", companyID,
+		r.db.Table("company_users").Select("company_id").Where("user_id = ?", userID)).
+		Find(&rows).Error
+	if err != nil {
+		return passwordpolicy.Policy{}, err
+	}
+
+	policies := make([]passwordpolicy.Policy, 0, len(rows))
+	for i := range rows {
+		policies = append(policies, rows[i].ToPolicy())
+	}
+	return passwordpolicy.Merge(policies...), nil
+}
+
+// ValidatePassword checks a new password for the user against the applicable
+// policies. A *passwordpolicy.Violation is returned for a broken rule.
+func (r *Repository) ValidatePassword(userID, companyID int64, password string) error {
+	policy, err := r.PasswordPolicy(userID, companyID)
+	if err != nil {
+		return err
+	}
+
+	if err := policy.Validate(password); err != nil {
+		return err
+	}
+
+	if r.cfg.PasswordBlocklistFile != "" {
+		err := passwordpolicy.CheckBreached(passwordpolicy.NewFileSource(r.cfg.PasswordBlocklistFile), password)
+		if _, ok := err.(*passwordpolicy.Violation); ok {
+			return err
+		}
+		// An unreadable list must not stop users from setting passwords
+		if err != nil {
+			logger.Error("Failed to check breached passwords", zap.Error(err))
+		}
+	}
+
+	if userID == 0 || policy.HistorySize == 0 {
+		return nil
+	}
+	previous, err := r.passwordHistory(userID, policy.HistorySize)
+	if err != nil {
+		return err
+	}
+	return policy.CheckHistory(password, previous)
+}
+
+// PasswordExpired reports whether the user's password is older than the
+// applicable policies allow
+func (r *Repository) PasswordExpired(u *model.User) (bool, error) {
+	if !u.PasswordChangedAt.Valid {
+		return false, nil
+	}
+	policy, err := r.PasswordPolicy(u.ID, 0)
+	if err != nil {
+		return false, err
+	}
+	return policy.Expired(u.PasswordChangedAt.Time), nil
+}
+
+// RecordPasswordWithTx stores a newly set password hash in the user's history
+// and restarts its age
+func (r *Repository) RecordPasswordWithTx(tx *gorm.DB, userID int64, hash string) error {
+	now := time.Now()
+	if err := tx.Create(&model.PasswordHistory{UserID: userID, PasswordHash: hash, CreatedAt: now}).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&model.User{}).Where("id = ?", userID).Update("password_changed_at", now).Error; err != nil {
+		return err
+	}
+
+	// Drop hashes no policy can ask for
+	return tx.Where("user_id = ? AND id NOT IN (?)", userID,
+		tx.Model(&model.PasswordHistory{}).Select("id").Where("user_id = ?", userID).
+			Order("id DESC").Limit(maxPasswordHistory)).
+		Delete(&model.PasswordHistory{}).Error
+}
+
+// passwordHistory returns the user's last password hashes, newest first
+func (r *Repository) passwordHistory(userID int64, limit int) ([]string, error) {
+	var hashes []string
+	err := r.db.Model(&model.PasswordHistory{}).Where("user_id = ?", userID).
+		Order("id DESC").Limit(limit).Pluck("password_hash", &hashes).Error
+	return hashes, err
+}
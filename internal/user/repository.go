@@ -3,6 +3,7 @@ package user
 
 import (
 	"crypto/sha256"
+	"errors"
 	"fmt"
 	"time"
 
@@ -13,6 +14,13 @@ import (
 	"gorm.io/gorm"
 )
 
+var (
+	// ErrEmailTaken is returned when an email address belongs to another user
+	ErrEmailTaken = errors.New("email already in use")
+	// ErrRootExists is returned when registering a root user once one exists
+	ErrRootExists = errors.New("root user already exists")
+)
+
 type Repository struct {
 	db  *gorm.DB
 	cfg *config.Config
@@ -22,6 +30,12 @@ func NewRepository(db *gorm.DB, cfg *config.Config) *Repository {
 	return &Repository{db: db, cfg: cfg}
 }
 
+// HashEmail returns the hash users are looked up by, since their email is
+// stored encrypted
+func HashEmail(email string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(email)))
+}
+
 // CreateUserWithTx creates a new user within a transaction
 func (r *Repository) CreateUserWithTx(tx *gorm.DB, username, password, phone string) (int64, error) {
 	hashedPassword, err := encryption.HashPassword(password)
@@ -42,7 +56,7 @@ func (r *Repository) CreateUserWithTx(tx *gorm.DB, username, password, phone str
 	}
 
 	// Create email hash for searching
-	emailHash := fmt.Sprintf("%x", sha256.Sum256([]byte(username)))
+	emailHash := HashEmail(username)
 
 	now := time.Now()
 	user.EmailHash = emailHash
@@ -52,6 +66,9 @@ func (r *Repository) CreateUserWithTx(tx *gorm.DB, username, password, phone str
 	if err := tx.Create(user).Error; err != nil {
 		return 0, err
 	}
+	if err := r.RecordPasswordWithTx(tx, user.ID, hashedPassword); err != nil {
+		return 0, err
+	}
 	return user.ID, nil
 }
 
@@ -71,7 +88,7 @@ func (r *Repository) GetUserByID(id int64) (*model.User, error) {
 }
 
 func (r *Repository) GetUserByEmail(email string) (*model.User, error) {
-	emailHash := fmt.Sprintf("%x", sha256.Sum256([]byte(email)))
+	emailHash := HashEmail(email)
 
 	user := &model.User{}
 	if err := r.db.Where("email_hash = ?", emailHash).First(user).Error; err != nil {
@@ -111,20 +128,27 @@ func (r *Repository) CreateUser(email, password, phone string) (int64, error) {
 	}
 
 	// Create email hash for searching
-	emailHash := fmt.Sprintf("%x", sha256.Sum256([]byte(email)))
+	emailHash := HashEmail(email)
 	user.EmailHash = emailHash
 
 	now := time.Now()
 	user.CreatedAt = now
 	user.UpdatedAt = now
 
-	if err := r.db.Create(user).Error; err != nil {
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		return r.RecordPasswordWithTx(tx, user.ID, hashedPassword)
+	})
+	if err != nil {
 		return 0, err
 	}
 	return user.ID, nil
 }
 
-// UpdateUser updates a user
+// UpdateUser updates a user. A new password must satisfy the password
+// policies of the user's companies.
 func (r *Repository) UpdateUser(id int64, email, password, phone string) error {
 	user := &model.User{}
 	if err := r.db.First(user, id).Error; err != nil {
@@ -134,14 +158,18 @@ func (r *Repository) UpdateUser(id int64, email, password, phone string) error {
 	// Update fields
 	if email != "" {
 		user.Email = email
-		user.EmailHash = fmt.Sprintf("%x", sha256.Sum256([]byte(email)))
+		user.EmailHash = HashEmail(email)
 	}
 	if password != "" {
+		if err := r.ValidatePassword(id, 0, password); err != nil {
+			return err
+		}
 		hashedPassword, err := encryption.HashPassword(password)
 		if err != nil {
 			return err
 		}
 		user.Password = hashedPassword
+		user.TokenVersion++
 	}
 	if phone != "" {
 		user.Phone = phone
@@ -153,7 +181,15 @@ func (r *Repository) UpdateUser(id int64, email, password, phone string) error {
 	}
 
 	user.UpdatedAt = time.Now()
-	return r.db.Save(user).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(user).Error; err != nil {
+			return err
+		}
+		if password == "" {
+			return nil
+		}
+		return r.RecordPasswordWithTx(tx, id, user.Password)
+	})
 }
 
 // GetRootRoleID returns the root role ID
@@ -173,16 +209,44 @@ func (r *Repository) AssignRootRole(tx *gorm.DB, userID, roleID int64) error {
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
-	return tx.Create(userRole).Error
+	// The global role belongs to no company membership
+	return tx.Omit("CompanyUserID").Create(userRole).Error
+}
+
+// HasRootUser reports whether any user holds the global ROOT role
+func (r *Repository) HasRootUser() (bool, error) {
+	return r.hasRootUser(r.db)
 }
 
-// RegisterRootUser registers a root user
+func (r *Repository) hasRootUser(tx *gorm.DB) (bool, error) {
+	var count int64
+	if err := tx.Model(&model.UserRole{}).
+		Joins("JOIN roles ON user_roles.role_id = roles.id").
+		Where("roles.name = ? AND roles.company_id IS NULL", "ROOT").
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// RegisterRootUser registers the first root user. ErrRootExists is returned
+// once a root user exists.
 func (r *Repository) RegisterRootUser(username, password string) (int64, error) {
 	tx := r.db.Begin()
 	if tx.Error != nil {
 		return 0, tx.Error
 	}
 
+	exists, err := r.hasRootUser(tx)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if exists {
+		tx.Rollback()
+		return 0, ErrRootExists
+	}
+
 	// Create user
 	userID, err := r.CreateUserWithTx(tx, username, password, "")
 	if err != nil {
@@ -231,11 +295,83 @@ func (r *Repository) RegisterUser(username, password, phone string) (int64, erro
 	return userID, nil
 }
 
+// UpdatePassword replaces the user's password hash and invalidates the tokens
+// issued for the old one. Callers check the password policy first with
+// ValidatePassword.
+func (r *Repository) UpdatePassword(id int64, password string) error {
+	hashedPassword, err := encryption.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&model.User{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"password":      hashedPassword,
+			"token_version": gorm.Expr("token_version + 1"),
+			"updated_at":    time.Now(),
+		}).Error
+		if err != nil {
+			return err
+		}
+		return r.RecordPasswordWithTx(tx, id, hashedPassword)
+	})
+}
+
+// RehashPassword replaces a password hash that uses outdated parameters with
+// a current one for the same password. Nothing changes when the hash was
+// replaced in the meantime.
+func (r *Repository) RehashPassword(id int64, currentHash, password string) error {
+	hashedPassword, err := encryption.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	return r.db.Model(&model.User{}).Where("id = ? AND password = ?", id, currentHash).
+		Update("password", hashedPassword).Error
+}
+
+// ChangeEmail replaces the user's email address with a confirmed new one.
+// ErrEmailTaken is returned when another user has it.
+func (r *Repository) ChangeEmail(id int64, email string) error {
+	encryptedEmail, err := encryption.Encrypt(email, r.cfg.EncryptionKey)
+	if err != nil {
+		return err
+	}
+	emailHash := HashEmail(email)
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&model.User{}).Where("email_hash = ? AND id <> ?", emailHash, id).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrEmailTaken
+		}
+
+		now := time.Now()
+		return tx.Model(&model.User{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"email":             encryptedEmail,
+			"email_hash":        emailHash,
+			"email_verified_at": now,
+			"updated_at":        now,
+		}).Error
+	})
+}
+
+// MarkEmailVerified records that the user confirmed their email address
+func (r *Repository) MarkEmailVerified(id int64) error {
+	now := time.Now()
+	return r.db.Model(&model.User{}).Where("id = ? AND email_verified_at IS NULL", id).
+		Updates(map[string]interface{}{"email_verified_at": now, "updated_at": now}).Error
+}
+
+// IsRoot reports whether the user holds the global ROOT role. Company roles
+// that happen to be named ROOT do not count.
 func (r *Repository) IsRoot(userID int64) (bool, error) {
 	var count int64
 	if err := r.db.Model(&model.UserRole{}).
 		Joins("JOIN roles ON user_roles.role_id = roles.id").
-		Where("user_roles.user_id = ? AND roles.name = ?", userID, "ROOT").
+		Where("user_roles.user_id = ? AND roles.name = ? AND roles.company_id IS NULL", userID, "ROOT").
 		Count(&count).Error; err != nil {
 		return false, err
 	}
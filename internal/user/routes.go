@@ -4,13 +4,22 @@ import (
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
+
+	"gobizmanager/platform/middleware/permission"
+)
+
+// Module and action names of the routes. The rbac package, which defines
+// them, cannot be imported here.
+const (
+	moduleUser = "user"
+	actionRead = "read"
 )
 
-func Routes(handler *Handler) http.Handler {
+func Routes(handler *Handler, guard permission.Guard) http.Handler {
 	r := chi.NewRouter()
 
-	// Add user search route
-	r.Get("/search", handler.SearchUsers)
+	// Add user search route; the company is given by the company_id query parameter
+	r.With(guard.RequirePermission(moduleUser, actionRead)).Get("/search", handler.SearchUsers)
 
 	return r
 }
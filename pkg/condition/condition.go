@@ -0,0 +1,267 @@
+// Package condition evaluates the expressions that make grants conditional,
+// such as `resource.amount < 10000` or `resource.owner_id == user.id`.
+//
+// Expressions compare attributes with literals or other attributes and
+// combine the results with &&, || and !. They have no loops, function calls
+// or assignments and their size is bounded, so evaluating one always
+// terminates and cannot affect anything outside it.
+package condition
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Attributes are the values an expression reads, nested by namespace. Numbers
+// of any Go numeric type are compared as float64.
+type Attributes = map[string]any
+
+// Namespaces are the roots attribute paths may start from
+var Namespaces = []string{"user", "company", "request", "resource"}
+
+const (
+	maxLength = 1024 // bytes of source
+	maxDepth  = 32   // nesting of operators and parentheses
+	maxList   = 100  // values of an in list
+)
+
+// Expr is a parsed condition
+type Expr struct {
+	src  string
+	root node
+}
+
+// String returns the source of the expression
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Eval reports whether the attributes satisfy the expression. Reading a
+// missing attribute, ordering or combining values of the wrong types is an
+// error, which callers must treat as not satisfied. A grant on the resource
+// thus never holds for a request that did not load it, even when negated.
+func (e *Expr) Eval(attrs Attributes) (bool, error) {
+	value, err := e.root.eval(attrs)
+	if err != nil {
+		return false, err
+	}
+	result, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("condition is %s, not a boolean", typeName(value))
+	}
+	return result, nil
+}
+
+type node interface {
+	eval(attrs Attributes) (any, error)
+}
+
+// literal is a number (float64), string, boolean or null
+type literal struct {
+	value any
+}
+
+func (n literal) eval(Attributes) (any, error) {
+	return n.value, nil
+}
+
+// path reads an attribute, such as resource.owner_id
+type path []string
+
+func (n path) eval(attrs Attributes) (any, error) {
+	var value any = attrs
+	for i, name := range n {
+		values, ok := value.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("attribute %s is missing", strings.Join(n[:i+1], "."))
+		}
+		if value, ok = values[name]; !ok {
+			return nil, fmt.Errorf("attribute %s is missing", strings.Join(n[:i+1], "."))
+		}
+	}
+	return normalize(value), nil
+}
+
+// list is the right operand of in
+type list []node
+
+func (n list) eval(attrs Attributes) (any, error) {
+	return nil, fmt.Errorf("a list can only follow in")
+}
+
+type not struct {
+	x node
+}
+
+func (n not) eval(attrs Attributes) (any, error) {
+	x, err := evalBool(n.x, attrs)
+	if err != nil {
+		return nil, err
+	}
+	return !x, nil
+}
+
+type binary struct {
+	op   string
+	x, y node
+}
+
+func (n binary) eval(attrs Attributes) (any, error) {
+	switch n.op {
+	case "&&", "||":
+		x, err := evalBool(n.x, attrs)
+		if err != nil {
+			return nil, err
+		}
+		if x == (n.op == "||") {
+			return x, nil
+		}
+		return evalBool(n.y, attrs)
+	case "in":
+		x, err := n.x.eval(attrs)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range n.y.(list) {
+			y, err := item.eval(attrs)
+			if err != nil {
+				return nil, err
+			}
+			if eq, err := equal(x, y); err != nil || eq {
+				return eq, err
+			}
+		}
+		return false, nil
+	}
+
+	x, err := n.x.eval(attrs)
+	if err != nil {
+		return nil, err
+	}
+	y, err := n.y.eval(attrs)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "==":
+		return equal(x, y)
+	case "!=":
+		eq, err := equal(x, y)
+		return !eq, err
+	}
+	return compare(n.op, x, y)
+}
+
+func evalBool(n node, attrs Attributes) (bool, error) {
+	value, err := n.eval(attrs)
+	if err != nil {
+		return false, err
+	}
+	result, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("expected a boolean, got %s", typeName(value))
+	}
+	return result, nil
+}
+
+// equal compares two values of any type but objects, which have no equality
+func equal(x, y any) (bool, error) {
+	if _, ok := x.(map[string]any); ok {
+		return false, fmt.Errorf("cannot compare %s", typeName(x))
+	}
+	if _, ok := y.(map[string]any); ok {
+		return false, fmt.Errorf("cannot compare %s", typeName(y))
+	}
+	return x == y, nil
+}
+
+// compare orders two numbers or two strings
+func compare(op string, x, y any) (any, error) {
+	var cmp int
+	switch x := x.(type) {
+	case float64:
+		y, ok := y.(float64)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare %s with %s", typeName(x), typeName(y))
+		}
+		cmp = compareOrdered(x, y)
+	case string:
+		y, ok := y.(string)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare %s with %s", typeName(x), typeName(y))
+		}
+		cmp = compareOrdered(x, y)
+	default:
+		return nil, fmt.Errorf("cannot compare %s with %s", typeName(x), typeName(y))
+	}
+
+	switch op {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	default:
+		return cmp >= 0, nil
+	}
+}
+
+func compareOrdered[T float64 | string](x, y T) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+// normalize converts numbers to float64 so that attributes compare equal to
+// literals whatever their Go type
+func normalize(value any) any {
+	switch v := value.(type) {
+	case int:
+		return float64(v)
+	case int8:
+		return float64(v)
+	case int16:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint:
+		return float64(v)
+	case uint8:
+		return float64(v)
+	case uint16:
+		return float64(v)
+	case uint32:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case float32:
+		return float64(v)
+	case float64, string, bool, nil:
+		return v
+	case map[string]any:
+		return v
+	}
+	// Other types cannot be compared safely, so they read as null
+	return nil
+}
+
+func typeName(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case float64:
+		return "a number"
+	case string:
+		return "a string"
+	case bool:
+		return "a boolean"
+	}
+	return "an object"
+}
@@ -0,0 +1,128 @@
+package condition
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEval(t *testing.T) {
+	attrs := Attributes{
+		"user":    Attributes{"id": int64(7)},
+		"company": Attributes{"id": int64(3)},
+		"request": Attributes{"hour": 10, "weekday": 2},
+		"resource": Attributes{
+			"owner_id":   int64(7),
+			"amount":     float32(2500),
+			"status":     "draft",
+			"locked":     false,
+			"deleted_at": nil,
+			"tags":       Attributes{"kind": "invoice"},
+		},
+	}
+
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{"resource.owner_id == user.id", true},
+		{"resource.owner_id != user.id", false},
+		{"resource.amount < 10000", true},
+		{"resource.amount >= 2500", true},
+		{"resource.amount > 2500", false},
+		{"resource.amount <= -1", false},
+		{"resource.status == 'draft'", true},
+		{"resource.status < 'final'", true},
+		{"resource.status in ['review', 'draft']", true},
+		{"resource.status in ['review']", false},
+		{"resource.status in []", false},
+		{"user.id in [1, 7]", true},
+		{"resource.locked", false},
+		{"!resource.locked", true},
+		{"resource.deleted_at == null", true},
+		{"resource.tags.kind == 'invoice'", true},
+		{"request.hour >= 9 && request.hour < 17", true},
+		{"company.id == 4 || request.weekday == 2", true},
+		{"!(company.id == 3 && resource.locked == false)", false},
+		{"resource.owner_id == '7'", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			expr, err := Parse(tt.src)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			got, err := expr.Eval(attrs)
+			if err != nil {
+				t.Fatalf("eval: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	attrs := Attributes{
+		"user":     Attributes{"id": int64(7)},
+		"resource": Attributes{"amount": 10, "status": "draft", "locked": true, "tags": Attributes{}},
+	}
+
+	tests := []struct {
+		name, src, err string
+	}{
+		{"missing attribute", "resource.owner_id == user.id", "resource.owner_id is missing"},
+		{"negated missing attribute", "resource.owner_id != user.id", "resource.owner_id is missing"},
+		{"missing attribute under not", "!(resource.owner_id == user.id)", "resource.owner_id is missing"},
+		{"missing namespace", "company.id == 1", "company is missing"},
+		{"path into a value", "resource.amount.value == 1", "resource.amount.value is missing"},
+		{"missing attribute in a list", "resource.kind in ['a']", "resource.kind is missing"},
+		{"ordering mixed types", "resource.amount < 'ten'", "cannot compare"},
+		{"ordering booleans", "resource.locked < true", "cannot compare"},
+		{"comparing objects", "resource.tags == null", "cannot compare"},
+		{"not a boolean", "resource.amount", "not a boolean"},
+		{"and with a string", "resource.status && true", "expected a boolean"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := Parse(tt.src)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			got, err := expr.Eval(attrs)
+			if err == nil {
+				t.Fatalf("got %v, want an error containing %q", got, tt.err)
+			}
+			if got {
+				t.Errorf("got true with the error, want false")
+			}
+			if !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got %q, want an error containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestEvalShortCircuits(t *testing.T) {
+	// The right operand is not read once the left one decides
+	attrs := Attributes{"user": Attributes{"id": 1}}
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{"user.id == 1 || resource.owner_id == user.id", true},
+		{"user.id == 2 && resource.owner_id == user.id", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			expr, err := Parse(tt.src)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			got, err := expr.Eval(attrs)
+			if err != nil || got != tt.want {
+				t.Errorf("got %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
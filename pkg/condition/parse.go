@@ -0,0 +1,348 @@
+package condition
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Parse parses a condition. Paths must start from one of the Namespaces and
+// the expression must be boolean.
+//
+//	expr    = and { "||" and }
+//	and     = unary { "&&" unary }
+//	unary   = "!" unary | compare
+//	compare = operand [ ( "==" | "!=" | "<" | "<=" | ">" | ">=" ) operand | "in" list ]
+//	operand = number | string | "true" | "false" | "null" | path | "(" expr ")"
+//	path    = name { "." name }
+//	list    = "[" [ literal { "," literal } ] "]"
+func Parse(src string) (*Expr, error) {
+	if strings.TrimSpace(src) == "" {
+		return nil, fmt.Errorf("condition is empty")
+	}
+	if len(src) > maxLength {
+		return nil, fmt.Errorf("condition is longer than %d bytes", maxLength)
+	}
+
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.expr(0)
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected %s at %d", tok, tok.pos)
+	}
+	if !boolean(root) {
+		return nil, fmt.Errorf("condition must be a boolean expression")
+	}
+	return &Expr{src: src, root: root}, nil
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNumber
+	tokenString
+	tokenName
+	tokenOperator
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	value any
+	pos   int
+}
+
+func (t token) String() string {
+	if t.kind == tokenEOF {
+		return "end of condition"
+	}
+	return strconv.Quote(t.text)
+}
+
+var operators = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "(", ")", "[", "]", ",", ".", "-"}
+
+func lex(src string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c >= '0' && c <= '9':
+			start := i
+			for i < len(src) && (src[i] >= '0' && src[i] <= '9' || src[i] == '.') {
+				i++
+			}
+			value, err := strconv.ParseFloat(src[start:i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q at %d", src[start:i], start)
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: src[start:i], value: value, pos: start})
+		case c == '"' || c == '\'':
+			start := i
+			var b strings.Builder
+			for i++; ; i++ {
+				if i >= len(src) {
+					return nil, fmt.Errorf("unterminated string at %d", start)
+				}
+				if src[i] == c {
+					i++
+					break
+				}
+				if src[i] == '\\' && i+1 < len(src) {
+					i++
+				}
+				b.WriteByte(src[i])
+			}
+			tokens = append(tokens, token{kind: tokenString, text: src[start:i], value: b.String(), pos: start})
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			start := i
+			for i < len(src) && (src[i] == '_' || src[i] >= 'a' && src[i] <= 'z' || src[i] >= 'A' && src[i] <= 'Z' || src[i] >= '0' && src[i] <= '9') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenName, text: src[start:i], pos: start})
+		default:
+			op := ""
+			for _, candidate := range operators {
+				if strings.HasPrefix(src[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected character %q at %d", c, i)
+			}
+			tokens = append(tokens, token{kind: tokenOperator, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(src)}), nil
+}
+
+type parser struct {
+	tokens []token
+	next   int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *parser) take() token {
+	tok := p.tokens[p.next]
+	if tok.kind != tokenEOF {
+		p.next++
+	}
+	return tok
+}
+
+// accept takes the next token when it is the operator or keyword
+func (p *parser) accept(text string) bool {
+	tok := p.peek()
+	if (tok.kind == tokenOperator || tok.kind == tokenName) && tok.text == text {
+		p.next++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(text string) error {
+	if !p.accept(text) {
+		tok := p.peek()
+		return fmt.Errorf("expected %q, got %s at %d", text, tok, tok.pos)
+	}
+	return nil
+}
+
+func (p *parser) expr(depth int) (node, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("condition is nested deeper than %d", maxDepth)
+	}
+	x, err := p.and(depth + 1)
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		y, err := p.and(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		x, err = logical("||", x, y)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return x, nil
+}
+
+func (p *parser) and(depth int) (node, error) {
+	x, err := p.unary(depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		y, err := p.unary(depth)
+		if err != nil {
+			return nil, err
+		}
+		x, err = logical("&&", x, y)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return x, nil
+}
+
+func (p *parser) unary(depth int) (node, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("condition is nested deeper than %d", maxDepth)
+	}
+	if p.accept("!") {
+		x, err := p.unary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if !boolean(x) {
+			return nil, fmt.Errorf("! needs a boolean operand")
+		}
+		return not{x: x}, nil
+	}
+	return p.compare(depth)
+}
+
+func (p *parser) compare(depth int) (node, error) {
+	x, err := p.operand(depth)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.accept("in") {
+		y, err := p.list()
+		if err != nil {
+			return nil, err
+		}
+		return binary{op: "in", x: x, y: y}, nil
+	}
+
+	tok := p.peek()
+	if tok.kind != tokenOperator || !slices.Contains([]string{"==", "!=", "<", "<=", ">", ">="}, tok.text) {
+		return x, nil
+	}
+	p.take()
+	y, err := p.operand(depth)
+	if err != nil {
+		return nil, err
+	}
+	return binary{op: tok.text, x: x, y: y}, nil
+}
+
+func (p *parser) operand(depth int) (node, error) {
+	if p.accept("(") {
+		x, err := p.expr(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return x, nil
+	}
+	if p.peek().kind == tokenName && !keyword(p.peek().text) {
+		return p.path()
+	}
+	return p.literal()
+}
+
+func (p *parser) path() (node, error) {
+	root := p.take()
+	if !slices.Contains(Namespaces, root.text) {
+		return nil, fmt.Errorf("unknown attribute %q at %d, attributes start with %s", root.text, root.pos, strings.Join(Namespaces, ", "))
+	}
+	names := path{root.text}
+	for p.accept(".") {
+		tok := p.take()
+		if tok.kind != tokenName {
+			return nil, fmt.Errorf("expected an attribute name, got %s at %d", tok, tok.pos)
+		}
+		names = append(names, tok.text)
+	}
+	return names, nil
+}
+
+func (p *parser) literal() (node, error) {
+	tok := p.take()
+	switch {
+	case tok.kind == tokenNumber || tok.kind == tokenString:
+		return literal{value: tok.value}, nil
+	case tok.kind == tokenOperator && tok.text == "-":
+		number := p.take()
+		if number.kind != tokenNumber {
+			return nil, fmt.Errorf("expected a number, got %s at %d", number, number.pos)
+		}
+		return literal{value: -number.value.(float64)}, nil
+	case tok.kind == tokenName && tok.text == "true":
+		return literal{value: true}, nil
+	case tok.kind == tokenName && tok.text == "false":
+		return literal{value: false}, nil
+	case tok.kind == tokenName && tok.text == "null":
+		return literal{value: nil}, nil
+	}
+	return nil, fmt.Errorf("unexpected %s at %d", tok, tok.pos)
+}
+
+func (p *parser) list() (node, error) {
+	if err := p.expect("["); err != nil {
+		return nil, err
+	}
+	var items list
+	if p.accept("]") {
+		return items, nil
+	}
+	for {
+		item, err := p.literal()
+		if err != nil {
+			return nil, err
+		}
+		if items = append(items, item); len(items) > maxList {
+			return nil, fmt.Errorf("list has more than %d values", maxList)
+		}
+		if p.accept("]") {
+			return items, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func logical(op string, x, y node) (node, error) {
+	if !boolean(x) || !boolean(y) {
+		return nil, fmt.Errorf("%s needs boolean operands", op)
+	}
+	return binary{op: op, x: x, y: y}, nil
+}
+
+// boolean reports whether the node may be a boolean. Attributes are only
+// known when the condition is evaluated.
+func boolean(n node) bool {
+	switch n := n.(type) {
+	case literal:
+		_, ok := n.value.(bool)
+		return ok
+	case path, not, binary:
+		return true
+	}
+	return false
+}
+
+func keyword(name string) bool {
+	return name == "true" || name == "false" || name == "null" || name == "in"
+}
@@ -0,0 +1,72 @@
+package condition
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	valid := []string{
+		"resource.amount < 10000",
+		"resource.owner_id == user.id",
+		"resource.owner_id != user.id",
+		"resource.status in ['draft', \"review\"]",
+		"resource.status in []",
+		"!(resource.locked == true) && request.hour >= 9 || user.id == 1",
+		"resource.balance > -2.5",
+		"resource.archived",
+		"true",
+		"resource.deleted_at == null",
+		"  company.id == 3\n",
+	}
+	for _, src := range valid {
+		t.Run(src, func(t *testing.T) {
+			expr, err := Parse(src)
+			if err != nil {
+				t.Fatalf("got %v, want a parsed condition", err)
+			}
+			if expr.String() != src {
+				t.Errorf("got source %q, want %q", expr.String(), src)
+			}
+		})
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	tests := []struct {
+		name, src, err string
+	}{
+		{"empty", "  ", "empty"},
+		{"too long", "resource.a == '" + strings.Repeat("x", maxLength) + "'", "longer than"},
+		{"too deep", strings.Repeat("(", maxDepth+1) + "true" + strings.Repeat(")", maxDepth+1), "nested deeper"},
+		{"long list", "resource.a in [" + strings.Repeat("1, ", maxList) + "1]", "more than"},
+		{"unknown namespace", "account.id == 1", "unknown attribute"},
+		{"number", "42", "boolean expression"},
+		{"string", "'yes'", "boolean expression"},
+		{"null", "null", "boolean expression"},
+		{"and with a number", "resource.a == 1 && 2", "boolean operands"},
+		{"not a number", "!3", "boolean operand"},
+		{"unterminated string", "resource.name == 'acme", "unterminated string"},
+		{"invalid number", "resource.a == 1.2.3", "invalid number"},
+		{"unexpected character", "resource.a == 1 ; true", "unexpected character"},
+		{"missing operand", "resource.a ==", "unexpected end of condition"},
+		{"unbalanced parenthesis", "(resource.a == 1", "expected \")\""},
+		{"trailing tokens", "resource.a == 1 resource.b", "unexpected"},
+		{"path in list", "resource.a in [user.id]", "unexpected"},
+		{"list without in", "resource.a == [1]", "unexpected"},
+		{"assignment", "resource.a = 1", "unexpected character"},
+		{"call", "resource.a(1)", "unexpected"},
+		{"dangling dot", "resource. == 1", "attribute name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.src)
+			if err == nil {
+				t.Fatalf("got a parsed condition, want an error containing %q", tt.err)
+			}
+			if !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got %q, want an error containing %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"gobizmanager/pkg/language"
+	"gobizmanager/pkg/permdigest"
 )
 
 type contextKey string
@@ -14,6 +15,7 @@ const (
 	companyIDKey    contextKey = "companyID"
 	roleIDKey       contextKey = "roleID"
 	permissionIDKey contextKey = "permissionID"
+	permissionsKey  contextKey = "permissions"
 )
 
 // GetLanguage returns the language from the context
@@ -29,6 +31,29 @@ func SetLanguage(ctx context.Context, lang string) context.Context {
 	return context.WithValue(ctx, LanguageKey, lang)
 }
 
+// GetCompanyID returns the active company of the request, set from a
+// company-scoped access token
+func GetCompanyID(ctx context.Context) (int64, bool) {
+	companyID, ok := ctx.Value(companyIDKey).(int64)
+	return companyID, ok && companyID != 0
+}
+
+// SetCompanyID sets the active company in the context
+func SetCompanyID(ctx context.Context, companyID int64) context.Context {
+	return context.WithValue(ctx, companyIDKey, companyID)
+}
+
+// GetPermissions returns the permission digest of the active company
+func GetPermissions(ctx context.Context) permdigest.Digest {
+	digest, _ := ctx.Value(permissionsKey).(permdigest.Digest)
+	return digest
+}
+
+// SetPermissions sets the permission digest of the active company in the context
+func SetPermissions(ctx context.Context, digest permdigest.Digest) context.Context {
+	return context.WithValue(ctx, permissionsKey, digest)
+}
+
 // LanguageMiddleware creates a middleware that sets the language based on the Accept-Language header
 func LanguageMiddleware() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
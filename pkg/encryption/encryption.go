@@ -7,8 +7,6 @@ import (
 	"encoding/base64"
 	"errors"
 	"io"
-
-	"golang.org/x/crypto/bcrypt"
 )
 
 var (
@@ -90,16 +88,3 @@ func Decrypt(encryptedText, key string) (string, error) {
 
 	return string(plaintext), nil
 }
-
-func HashPassword(password string) (string, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return "", err
-	}
-	return string(hashedPassword), nil
-}
-
-func CheckPassword(password, hashedPassword string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
-	return err == nil
-}
@@ -0,0 +1,191 @@
+package encryption
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+// Argon2Params are the argon2id cost parameters. Memory is in KiB.
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+// DefaultArgon2Params follow the second recommended option of RFC 9106,
+// with less parallelism to bound the cost of concurrent logins
+var DefaultArgon2Params = Argon2Params{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+}
+
+// PasswordHasher hashes passwords with argon2id and verifies both its own
+// hashes and legacy bcrypt ones.
+//
+// Hashes use the PHC string format:
+//
+//	$argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+//
+// When a pepper is set the password is first keyed with HMAC-SHA256 and the
+// parameters gain "k=1", so hashes made before the pepper was introduced keep
+// verifying.
+type PasswordHasher struct {
+	params Argon2Params
+	pepper []byte
+}
+
+func NewPasswordHasher(params Argon2Params, pepper string) *PasswordHasher {
+	return &PasswordHasher{params: params, pepper: []byte(pepper)}
+}
+
+// passwordHasher is used by HashPassword and CheckPassword. It is replaced
+// once at startup by SetPasswordHasher.
+var passwordHasher = NewPasswordHasher(DefaultArgon2Params, "")
+
+// SetPasswordHasher replaces the hasher used by the package functions. It must
+// be called before any password is hashed or checked.
+func SetPasswordHasher(h *PasswordHasher) {
+	passwordHasher = h
+}
+
+func HashPassword(password string) (string, error) {
+	return passwordHasher.Hash(password)
+}
+
+func CheckPassword(password, hashedPassword string) bool {
+	return passwordHasher.Check(password, hashedPassword)
+}
+
+// PasswordNeedsRehash reports whether a hash that just verified should be
+// replaced with one using the current algorithm, parameters and pepper
+func PasswordNeedsRehash(hashedPassword string) bool {
+	return passwordHasher.NeedsRehash(hashedPassword)
+}
+
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	peppered := len(h.pepper) > 0
+	key := argon2.IDKey(h.input(password, peppered), salt, h.params.Iterations, h.params.Memory, h.params.Parallelism, argon2KeyLength)
+
+	params := fmt.Sprintf("m=%d,t=%d,p=%d", h.params.Memory, h.params.Iterations, h.params.Parallelism)
+	if peppered {
+		params += ",k=1"
+	}
+	return fmt.Sprintf("$argon2id$v=%d$%s$%s$%s",
+		argon2.Version,
+		params,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h *PasswordHasher) Check(password, hashedPassword string) bool {
+	if !strings.HasPrefix(hashedPassword, "$argon2id$") {
+		return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password)) == nil
+	}
+
+	hash, err := parseArgon2Hash(hashedPassword)
+	if err != nil {
+		return false
+	}
+	// A peppered hash cannot be checked once the pepper is gone
+	if hash.peppered && len(h.pepper) == 0 {
+		return false
+	}
+
+	key := argon2.IDKey(h.input(password, hash.peppered), hash.salt, hash.params.Iterations, hash.params.Memory, hash.params.Parallelism, uint32(len(hash.key)))
+	return subtle.ConstantTimeCompare(key, hash.key) == 1
+}
+
+func (h *PasswordHasher) NeedsRehash(hashedPassword string) bool {
+	hash, err := parseArgon2Hash(hashedPassword)
+	if err != nil {
+		return true
+	}
+	return hash.params != h.params || hash.peppered != (len(h.pepper) > 0) || len(hash.key) != argon2KeyLength
+}
+
+// input keys the password with the pepper when the hash uses one
+func (h *PasswordHasher) input(password string, peppered bool) []byte {
+	if !peppered {
+		return []byte(password)
+	}
+	mac := hmac.New(sha256.New, h.pepper)
+	mac.Write([]byte(password))
+	return mac.Sum(nil)
+}
+
+type argon2Hash struct {
+	params   Argon2Params
+	peppered bool
+	salt     []byte
+	key      []byte
+}
+
+func parseArgon2Hash(encoded string) (*argon2Hash, error) {
+	// "", "argon2id", "v=19", params, salt, key
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, errors.New("not an argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, errors.New("unsupported argon2 version")
+	}
+
+	hash := &argon2Hash{}
+	for _, param := range strings.Split(parts[3], ",") {
+		name, value, _ := strings.Cut(param, "=")
+		var n uint64
+		if _, err := fmt.Sscanf(value, "%d", &n); err != nil {
+			return nil, fmt.Errorf("invalid argon2 parameter %q", param)
+		}
+		switch name {
+		case "m":
+			hash.params.Memory = uint32(n)
+		case "t":
+			hash.params.Iterations = uint32(n)
+		case "p":
+			hash.params.Parallelism = uint8(n)
+		case "k":
+			hash.peppered = n == 1
+		default:
+			return nil, fmt.Errorf("unknown argon2 parameter %q", name)
+		}
+	}
+	if hash.params.Memory == 0 || hash.params.Iterations == 0 || hash.params.Parallelism == 0 {
+		return nil, errors.New("missing argon2 parameters")
+	}
+
+	var err error
+	if hash.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, err
+	}
+	if hash.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return nil, err
+	}
+	if len(hash.key) == 0 {
+		return nil, errors.New("empty argon2 hash")
+	}
+	return hash, nil
+}
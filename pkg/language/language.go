@@ -17,25 +17,45 @@ const (
 	BadRequest = "bad.request"
 
 	// Auth messages
-	AuthHeaderRequired      = "auth.header_required"
-	AuthInvalidFormat       = "auth.invalid_format"
-	AuthTokenExpired        = "auth.token_expired"
-	AuthInvalidToken        = "auth.invalid_token"
-	AuthInvalidCredentials  = "auth.invalid_credentials"
-	AuthUserNotFound        = "auth.user_not_found"
-	AuthInvalidRequest      = "auth.invalid_request"
-	AuthValidationFailed    = "auth.validation_failed"
-	AuthUsernameExists      = "auth.username_exists"
-	AuthCreateUserFailed    = "auth.create_user_failed"
-	AuthTokenGenFailed      = "auth.token_generation_failed"
-	AuthUnauthorized        = "auth.unauthorized"
-	AuthPermissionDenied    = "auth.permission_denied"
-	AuthDatabaseError       = "auth.database_error"
-	AuthInvalidRefreshToken = "auth.invalid_refresh_token"
-	AuthRegistrationClosed  = "auth.registration_closed"
-	AuthInvalidEmail        = "auth.invalid_email"
-	AuthPasswordTooShort    = "auth.password_too_short"
-	AuthFieldRequired       = "auth.field_required"
+	AuthHeaderRequired             = "auth.header_required"
+	AuthInvalidFormat              = "auth.invalid_format"
+	AuthTokenExpired               = "auth.token_expired"
+	AuthInvalidToken               = "auth.invalid_token"
+	AuthInvalidCredentials         = "auth.invalid_credentials"
+	AuthUserNotFound               = "auth.user_not_found"
+	AuthInvalidRequest             = "auth.invalid_request"
+	AuthValidationFailed           = "auth.validation_failed"
+	AuthUsernameExists             = "auth.username_exists"
+	AuthCreateUserFailed           = "auth.create_user_failed"
+	AuthTokenGenFailed             = "auth.token_generation_failed"
+	AuthUnauthorized               = "auth.unauthorized"
+	AuthPermissionDenied           = "auth.permission_denied"
+	AuthDatabaseError              = "auth.database_error"
+	AuthInvalidRefreshToken        = "auth.invalid_refresh_token"
+	AuthRegistrationClosed         = "auth.registration_closed"
+	AuthInvalidEmail               = "auth.invalid_email"
+	AuthPasswordTooShort           = "auth.password_too_short"
+	AuthFieldRequired              = "auth.field_required"
+	AuthRefreshTokenReused         = "auth.refresh_token_reused"
+	AuthLogoutFailed               = "auth.logout_failed"
+	AuthLoggedOut                  = "auth.logged_out"
+	AuthSessionRevoked             = "auth.session_revoked"
+	AuthInvalidActionToken         = "auth.invalid_action_token"
+	AuthPasswordResetRequested     = "auth.password_reset_requested"
+	AuthPasswordResetFailed        = "auth.password_reset_failed"
+	AuthPasswordReset              = "auth.password_reset"
+	AuthEmailVerifyFailed          = "auth.email_verify_failed"
+	AuthEmailVerified              = "auth.email_verified"
+	AuthPasswordChangeFailed       = "auth.password_change_failed"
+	AuthEmailChangeRequested       = "auth.email_change_requested"
+	AuthEmailChangeFailed          = "auth.email_change_failed"
+	AuthEmailChanged               = "auth.email_changed"
+	AuthTooManyAttempts            = "auth.too_many_attempts"
+	AuthAccountLocked              = "auth.account_locked"
+	AuthAccountUnlocked            = "auth.account_unlocked"
+	AuthSetupTokenInvalid          = "auth.setup_token_invalid"
+	AuthImpersonationNotAllowed    = "auth.impersonation_not_allowed"
+	AuthImpersonationTargetInvalid = "auth.impersonation_target_invalid"
 
 	// Rate limit messages
 	RateLimitExceeded = "rate_limit.exceeded"
@@ -59,23 +79,135 @@ const (
 	CompanyDeleted            = "company.deleted"
 	CompanyUserNotFound       = "company.user_not_found"
 	CompanyUserRemoveFailed   = "company.user_remove_failed"
+	CompanyMFAPolicyUpdated   = "company.mfa_policy_updated"
+
+	// Password policy messages
+	PasswordTooShort      = "password.too_short"
+	PasswordNeedsUpper    = "password.needs_upper"
+	PasswordNeedsLower    = "password.needs_lower"
+	PasswordNeedsDigit    = "password.needs_digit"
+	PasswordNeedsSymbol   = "password.needs_symbol"
+	PasswordReused        = "password.reused"
+	PasswordBreached      = "password.breached"
+	PasswordExpired       = "password.expired"
+	PasswordCheckFailed   = "password.check_failed"
+	PasswordPolicyUpdated = "password.policy_updated"
+
+	// Invitation messages
+	InvitationNotFound         = "invitation.not_found"
+	InvitationExists           = "invitation.exists"
+	InvitationAlreadyMember    = "invitation.already_member"
+	InvitationInvalid          = "invitation.invalid"
+	InvitationPasswordRequired = "invitation.password_required"
+	InvitationCreateFailed     = "invitation.create_failed"
+	InvitationListFailed       = "invitation.list_failed"
+	InvitationUpdateFailed     = "invitation.update_failed"
+	InvitationAcceptFailed     = "invitation.accept_failed"
+	InvitationResent           = "invitation.resent"
+	InvitationRevoked          = "invitation.revoked"
+	InvitationAccepted         = "invitation.accepted"
 
 	// Permission messages
-	PermissionDenied       = "permission.denied"
-	PermissionCheckFailed  = "permission.check_failed"
-	PermissionRequired     = "permission.required"
-	PermissionCreateFailed = "permission.create_failed"
-	PermissionAssignFailed = "permission.assign_failed"
-	PermissionRemoveFailed = "permission.remove_failed"
-	PermissionListFailed   = "permission.list_failed"
-	RoleCreateFailed       = "role.create_failed"
-	RoleNotFound           = "role.not_found"
-	RoleListFailed         = "role.list_failed"
-	PermissionAssigned     = "permission.assigned"
-	PermissionRemoved      = "permission.removed"
-	RoleAssignFailed       = "role.assign_failed"
-	RoleAssigned           = "role.assigned"
-	PermissionNotFound     = "permission.not_found"
+	PermissionDenied          = "permission.denied"
+	PermissionCheckFailed     = "permission.check_failed"
+	PermissionRequired        = "permission.required"
+	PermissionCreateFailed    = "permission.create_failed"
+	PermissionAssignFailed    = "permission.assign_failed"
+	PermissionRemoveFailed    = "permission.remove_failed"
+	PermissionListFailed      = "permission.list_failed"
+	RoleCreateFailed          = "role.create_failed"
+	RoleNotFound              = "role.not_found"
+	RoleListFailed            = "role.list_failed"
+	PermissionAssigned        = "permission.assigned"
+	PermissionRemoved         = "permission.removed"
+	RoleAssignFailed          = "role.assign_failed"
+	RoleAssigned              = "role.assigned"
+	RoleParentInvalid         = "role.parent_invalid"
+	RoleHierarchyCycle        = "role.hierarchy_cycle"
+	RoleUpdateFailed          = "role.update_failed"
+	PermissionNotFound        = "permission.not_found"
+	PermissionCompanyRequired = "permission.company_required"
+
+	// Permission group messages
+	PermissionGroupNotFound     = "permission_group.not_found"
+	PermissionGroupNameTaken    = "permission_group.name_taken"
+	PermissionGroupCreateFailed = "permission_group.create_failed"
+	PermissionGroupUpdateFailed = "permission_group.update_failed"
+	PermissionGroupDeleteFailed = "permission_group.delete_failed"
+	PermissionGroupListFailed   = "permission_group.list_failed"
+
+	// Permission deny messages
+	PermissionDenyNotFound       = "permission_deny.not_found"
+	PermissionDenyTargetInvalid  = "permission_deny.target_invalid"
+	PermissionDenyActionNotFound = "permission_deny.action_not_found"
+	PermissionDenyRoot           = "permission_deny.root"
+	PermissionDenyExists         = "permission_deny.exists"
+	PermissionDenyCreateFailed   = "permission_deny.create_failed"
+	PermissionDenyDeleteFailed   = "permission_deny.delete_failed"
+	PermissionDenyListFailed     = "permission_deny.list_failed"
+
+	// Permission condition messages
+	PermissionConditionInvalid = "permission_condition.invalid"
+
+	// Session messages
+	SessionNotFound     = "session.not_found"
+	SessionListFailed   = "session.list_failed"
+	SessionRevokeFailed = "session.revoke_failed"
+	SessionRevoked      = "session.revoked"
+
+	// API key messages
+	APIKeyInvalid         = "api_key.invalid"
+	APIKeyNotFound        = "api_key.not_found"
+	APIKeyCreateFailed    = "api_key.create_failed"
+	APIKeyListFailed      = "api_key.list_failed"
+	APIKeyRevokeFailed    = "api_key.revoke_failed"
+	APIKeyRevoked         = "api_key.revoked"
+	APIKeyScopeExceeded   = "api_key.scope_exceeded"
+	APIKeySessionRequired = "api_key.session_required"
+
+	// External identity provider messages
+	OIDCProviderNotFound = "oidc.provider_not_found"
+	OIDCInvalidState     = "oidc.invalid_state"
+	OIDCLoginFailed      = "oidc.login_failed"
+	OIDCEmailNotVerified = "oidc.email_not_verified"
+	OIDCNoAccount        = "oidc.no_account"
+	OIDCProvisionFailed  = "oidc.provision_failed"
+
+	// Service account messages
+	ServiceAccountNotFound     = "service_account.not_found"
+	ServiceAccountCreateFailed = "service_account.create_failed"
+	ServiceAccountListFailed   = "service_account.list_failed"
+	ServiceAccountUpdateFailed = "service_account.update_failed"
+	ServiceAccountDeleteFailed = "service_account.delete_failed"
+	ServiceAccountDeleted      = "service_account.deleted"
+	ServiceAccountNameExists   = "service_account.name_exists"
+	ServiceAccountRoleRemoved  = "service_account.role_removed"
+
+	// Email templates, rendered with text/template
+	EmailPasswordResetSubject   = "email.password_reset_subject"
+	EmailPasswordResetBody      = "email.password_reset_body"
+	EmailVerificationSubject    = "email.verification_subject"
+	EmailVerificationBody       = "email.verification_body"
+	EmailAccountLockedSubject   = "email.account_locked_subject"
+	EmailAccountLockedBody      = "email.account_locked_body"
+	EmailPasswordChangedSubject = "email.password_changed_subject"
+	EmailPasswordChangedBody    = "email.password_changed_body"
+	EmailChangeConfirmSubject   = "email.change_confirm_subject"
+	EmailChangeConfirmBody      = "email.change_confirm_body"
+	EmailEmailChangedSubject    = "email.email_changed_subject"
+	EmailEmailChangedBody       = "email.email_changed_body"
+	EmailInvitationSubject      = "email.invitation_subject"
+	EmailInvitationBody         = "email.invitation_body"
+
+	// MFA messages
+	MFAInvalidCode      = "mfa.invalid_code"
+	MFAInvalidChallenge = "mfa.invalid_challenge"
+	MFANotEnabled       = "mfa.not_enabled"
+	MFAAlreadyEnabled   = "mfa.already_enabled"
+	MFAEnrollFailed     = "mfa.enroll_failed"
+	MFADisableFailed    = "mfa.disable_failed"
+	MFADisabled         = "mfa.disabled"
+	MFARequiredByPolicy = "mfa.required_by_policy"
 
 	// Module actions messages
 	ModuleActionCreated = "module.action.denied"
@@ -133,25 +265,45 @@ func NewMessageStore() *MessageStore {
 		BadRequest: {"Bad request", http.StatusBadRequest},
 
 		// Auth messages
-		AuthHeaderRequired:      {"Authorization header required", http.StatusUnauthorized},
-		AuthInvalidFormat:       {"Invalid authorization format", http.StatusBadRequest},
-		AuthTokenExpired:        {"Token expired", http.StatusUnauthorized},
-		AuthInvalidToken:        {"Invalid token", http.StatusUnauthorized},
-		AuthInvalidCredentials:  {"Invalid credentials", http.StatusUnauthorized},
-		AuthUserNotFound:        {"User not found", http.StatusNotFound},
-		AuthInvalidRequest:      {"Invalid request", http.StatusBadRequest},
-		AuthValidationFailed:    {"Validation failed", http.StatusBadRequest},
-		AuthUsernameExists:      {"Username already exists", http.StatusConflict},
-		AuthCreateUserFailed:    {"Failed to create user", http.StatusInternalServerError},
-		AuthTokenGenFailed:      {"Failed to generate tokens", http.StatusInternalServerError},
-		AuthUnauthorized:        {"Unauthorized access", http.StatusUnauthorized},
-		AuthPermissionDenied:    {"Permission denied", http.StatusForbidden},
-		AuthDatabaseError:       {"Database error", http.StatusInternalServerError},
-		AuthInvalidRefreshToken: {"Invalid refresh token", http.StatusUnauthorized},
-		AuthRegistrationClosed:  {"Registration is closed. Only the first user can register as ROOT.", http.StatusForbidden},
-		AuthInvalidEmail:        {"Invalid email", http.StatusBadRequest},
-		AuthPasswordTooShort:    {"Password too short", http.StatusBadRequest},
-		AuthFieldRequired:       {"Field is required", http.StatusBadRequest},
+		AuthHeaderRequired:             {"Authorization header required", http.StatusUnauthorized},
+		AuthInvalidFormat:              {"Invalid authorization format", http.StatusBadRequest},
+		AuthTokenExpired:               {"Token expired", http.StatusUnauthorized},
+		AuthInvalidToken:               {"Invalid token", http.StatusUnauthorized},
+		AuthInvalidCredentials:         {"Invalid credentials", http.StatusUnauthorized},
+		AuthUserNotFound:               {"User not found", http.StatusNotFound},
+		AuthInvalidRequest:             {"Invalid request", http.StatusBadRequest},
+		AuthValidationFailed:           {"Validation failed", http.StatusBadRequest},
+		AuthUsernameExists:             {"Username already exists", http.StatusConflict},
+		AuthCreateUserFailed:           {"Failed to create user", http.StatusInternalServerError},
+		AuthTokenGenFailed:             {"Failed to generate tokens", http.StatusInternalServerError},
+		AuthUnauthorized:               {"Unauthorized access", http.StatusUnauthorized},
+		AuthPermissionDenied:           {"Permission denied", http.StatusForbidden},
+		AuthDatabaseError:              {"Database error", http.StatusInternalServerError},
+		AuthInvalidRefreshToken:        {"Invalid refresh token", http.StatusUnauthorized},
+		AuthRegistrationClosed:         {"Registration is closed. Only the first user can register as ROOT.", http.StatusForbidden},
+		AuthInvalidEmail:               {"Invalid email", http.StatusBadRequest},
+		AuthPasswordTooShort:           {"Password too short", http.StatusBadRequest},
+		AuthFieldRequired:              {"Field is required", http.StatusBadRequest},
+		AuthRefreshTokenReused:         {"Refresh token has already been used, please log in again", http.StatusUnauthorized},
+		AuthLogoutFailed:               {"Failed to log out", http.StatusInternalServerError},
+		AuthLoggedOut:                  {"Logged out successfully", http.StatusOK},
+		AuthSessionRevoked:             {"Session has been revoked, please log in again", http.StatusUnauthorized},
+		AuthInvalidActionToken:         {"Invalid or expired link", http.StatusBadRequest},
+		AuthPasswordResetRequested:     {"If the account exists, a password reset email has been sent", http.StatusOK},
+		AuthPasswordResetFailed:        {"Failed to reset password", http.StatusInternalServerError},
+		AuthPasswordReset:              {"Password has been reset, please log in again", http.StatusOK},
+		AuthEmailVerifyFailed:          {"Failed to verify email", http.StatusInternalServerError},
+		AuthEmailVerified:              {"Email verified successfully", http.StatusOK},
+		AuthPasswordChangeFailed:       {"Failed to change password", http.StatusInternalServerError},
+		AuthEmailChangeRequested:       {"A confirmation link has been sent to the new email address", http.StatusOK},
+		AuthEmailChangeFailed:          {"Failed to change email address", http.StatusInternalServerError},
+		AuthEmailChanged:               {"Email address changed successfully", http.StatusOK},
+		AuthTooManyAttempts:            {"Too many login attempts. Please try again later.", http.StatusTooManyRequests},
+		AuthAccountLocked:              {"Account is temporarily locked after repeated failed logins. Check your email to unlock it.", http.StatusLocked},
+		AuthAccountUnlocked:            {"Account unlocked successfully", http.StatusOK},
+		AuthSetupTokenInvalid:          {"Invalid setup token", http.StatusForbidden},
+		AuthImpersonationNotAllowed:    {"This action is not allowed while impersonating a user", http.StatusForbidden},
+		AuthImpersonationTargetInvalid: {"Only company members who are not ROOT users can be impersonated", http.StatusBadRequest},
 
 		// Rate limit messages
 		RateLimitExceeded: {"Too many requests. Please try again later.", http.StatusTooManyRequests},
@@ -175,23 +327,135 @@ func NewMessageStore() *MessageStore {
 		CompanyDeleted:            {"Company deleted successfully", http.StatusOK},
 		CompanyUserNotFound:       {"Company user not found", http.StatusNotFound},
 		CompanyUserRemoveFailed:   {"Failed to remove company user", http.StatusInternalServerError},
+		CompanyMFAPolicyUpdated:   {"Company MFA policy updated successfully", http.StatusOK},
+
+		// Password policy messages
+		PasswordTooShort:      {"Password is shorter than the password policy allows", http.StatusBadRequest},
+		PasswordNeedsUpper:    {"Password must contain an upper case letter", http.StatusBadRequest},
+		PasswordNeedsLower:    {"Password must contain a lower case letter", http.StatusBadRequest},
+		PasswordNeedsDigit:    {"Password must contain a digit", http.StatusBadRequest},
+		PasswordNeedsSymbol:   {"Password must contain a symbol", http.StatusBadRequest},
+		PasswordReused:        {"Password was used recently; choose a different one", http.StatusBadRequest},
+		PasswordBreached:      {"Password appears in a list of breached passwords; choose a different one", http.StatusBadRequest},
+		PasswordExpired:       {"Password has expired; reset it to log in", http.StatusForbidden},
+		PasswordCheckFailed:   {"Failed to check password", http.StatusInternalServerError},
+		PasswordPolicyUpdated: {"Password policy updated successfully", http.StatusOK},
+
+		// Invitation messages
+		InvitationNotFound:         {"Invitation not found", http.StatusNotFound},
+		InvitationExists:           {"A pending invitation already exists for this email; resend it instead", http.StatusConflict},
+		InvitationAlreadyMember:    {"The user is already a member of this company", http.StatusConflict},
+		InvitationInvalid:          {"Invitation link is invalid or has expired", http.StatusBadRequest},
+		InvitationPasswordRequired: {"Choose a password to create your account", http.StatusBadRequest},
+		InvitationCreateFailed:     {"Failed to create invitation", http.StatusInternalServerError},
+		InvitationListFailed:       {"Failed to list invitations", http.StatusInternalServerError},
+		InvitationUpdateFailed:     {"Failed to update invitation", http.StatusInternalServerError},
+		InvitationAcceptFailed:     {"Failed to accept invitation", http.StatusInternalServerError},
+		InvitationResent:           {"Invitation sent again", http.StatusOK},
+		InvitationRevoked:          {"Invitation revoked", http.StatusOK},
+		InvitationAccepted:         {"Invitation accepted, you can now log in", http.StatusOK},
 
 		// Permission messages
-		PermissionDenied:       {"Insufficient permissions", http.StatusForbidden},
-		PermissionCheckFailed:  {"Failed to check permissions", http.StatusInternalServerError},
-		PermissionRequired:     {"Permission required", http.StatusForbidden},
-		PermissionCreateFailed: {"Failed to create permission", http.StatusInternalServerError},
-		PermissionAssignFailed: {"Failed to assign permission to role", http.StatusInternalServerError},
-		PermissionRemoveFailed: {"Failed to remove permission from role", http.StatusInternalServerError},
-		PermissionListFailed:   {"Failed to list permissions", http.StatusInternalServerError},
-		RoleCreateFailed:       {"Failed to create role", http.StatusInternalServerError},
-		RoleNotFound:           {"Role not found", http.StatusNotFound},
-		RoleListFailed:         {"Failed to list roles", http.StatusInternalServerError},
-		PermissionAssigned:     {"Permission assigned successfully", http.StatusOK},
-		PermissionRemoved:      {"Permission removed successfully", http.StatusOK},
-		RoleAssignFailed:       {"Failed to assign role", http.StatusInternalServerError},
-		RoleAssigned:           {"Role assigned successfully", http.StatusOK},
-		PermissionNotFound:     {"Permission not found", http.StatusNotFound},
+		PermissionDenied:          {"Insufficient permissions", http.StatusForbidden},
+		PermissionCheckFailed:     {"Failed to check permissions", http.StatusInternalServerError},
+		PermissionRequired:        {"Permission required", http.StatusForbidden},
+		PermissionCreateFailed:    {"Failed to create permission", http.StatusInternalServerError},
+		PermissionAssignFailed:    {"Failed to assign permission to role", http.StatusInternalServerError},
+		PermissionRemoveFailed:    {"Failed to remove permission from role", http.StatusInternalServerError},
+		PermissionListFailed:      {"Failed to list permissions", http.StatusInternalServerError},
+		RoleCreateFailed:          {"Failed to create role", http.StatusInternalServerError},
+		RoleNotFound:              {"Role not found", http.StatusNotFound},
+		RoleListFailed:            {"Failed to list roles", http.StatusInternalServerError},
+		PermissionAssigned:        {"Permission assigned successfully", http.StatusOK},
+		PermissionRemoved:         {"Permission removed successfully", http.StatusOK},
+		RoleAssignFailed:          {"Failed to assign role", http.StatusInternalServerError},
+		RoleAssigned:              {"Role assigned successfully", http.StatusOK},
+		RoleParentInvalid:         {"The parent role must be another role of the same company", http.StatusBadRequest},
+		RoleHierarchyCycle:        {"The parent role would make the role inherit from itself", http.StatusConflict},
+		RoleUpdateFailed:          {"Failed to update role", http.StatusInternalServerError},
+		PermissionNotFound:        {"Permission not found", http.StatusNotFound},
+		PermissionCompanyRequired: {"The company must be given in the URL or by the active company of the token", http.StatusBadRequest},
+
+		// Permission group messages
+		PermissionGroupNotFound:     {"Permission group not found", http.StatusNotFound},
+		PermissionGroupNameTaken:    {"The company already has a permission group with this name", http.StatusConflict},
+		PermissionGroupCreateFailed: {"Failed to create permission group", http.StatusInternalServerError},
+		PermissionGroupUpdateFailed: {"Failed to update permission group", http.StatusInternalServerError},
+		PermissionGroupDeleteFailed: {"Failed to delete permission group", http.StatusInternalServerError},
+		PermissionGroupListFailed:   {"Failed to list permission groups", http.StatusInternalServerError},
+
+		// Permission deny messages
+		PermissionDenyNotFound:       {"Permission deny not found", http.StatusNotFound},
+		PermissionDenyTargetInvalid:  {"Either role_id or user_id must be given, not both", http.StatusBadRequest},
+		PermissionDenyActionNotFound: {"Module action not found", http.StatusNotFound},
+		PermissionDenyRoot:           {"ROOT cannot be denied", http.StatusBadRequest},
+		PermissionDenyExists:         {"The module action is already denied", http.StatusConflict},
+		PermissionDenyCreateFailed:   {"Failed to create permission deny", http.StatusInternalServerError},
+		PermissionDenyDeleteFailed:   {"Failed to delete permission deny", http.StatusInternalServerError},
+		PermissionDenyListFailed:     {"Failed to list permission denies", http.StatusInternalServerError},
+
+		// Permission condition messages
+		PermissionConditionInvalid: {"Invalid permission condition", http.StatusBadRequest},
+
+		// Session messages
+		SessionNotFound:     {"Session not found", http.StatusNotFound},
+		SessionListFailed:   {"Failed to list sessions", http.StatusInternalServerError},
+		SessionRevokeFailed: {"Failed to revoke session", http.StatusInternalServerError},
+		SessionRevoked:      {"Session revoked successfully", http.StatusOK},
+
+		// API key messages
+		APIKeyInvalid:         {"Invalid or expired API key", http.StatusUnauthorized},
+		APIKeyNotFound:        {"API key not found", http.StatusNotFound},
+		APIKeyCreateFailed:    {"Failed to create API key", http.StatusInternalServerError},
+		APIKeyListFailed:      {"Failed to list API keys", http.StatusInternalServerError},
+		APIKeyRevokeFailed:    {"Failed to revoke API key", http.StatusInternalServerError},
+		APIKeyRevoked:         {"API key revoked successfully", http.StatusOK},
+		APIKeyScopeExceeded:   {"API key scopes must be a subset of your permissions in the company", http.StatusForbidden},
+		APIKeySessionRequired: {"API keys cannot manage API keys", http.StatusForbidden},
+
+		// External identity provider messages
+		OIDCProviderNotFound: {"Identity provider not found", http.StatusNotFound},
+		OIDCInvalidState:     {"Login request is invalid or has expired", http.StatusBadRequest},
+		OIDCLoginFailed:      {"Login with the identity provider failed", http.StatusBadGateway},
+		OIDCEmailNotVerified: {"The identity provider has not verified your email address", http.StatusForbidden},
+		OIDCNoAccount:        {"No account is linked to this identity", http.StatusForbidden},
+		OIDCProvisionFailed:  {"Failed to create account from identity", http.StatusInternalServerError},
+
+		// Service account messages
+		ServiceAccountNotFound:     {"Service account not found", http.StatusNotFound},
+		ServiceAccountCreateFailed: {"Failed to create service account", http.StatusInternalServerError},
+		ServiceAccountListFailed:   {"Failed to list service accounts", http.StatusInternalServerError},
+		ServiceAccountUpdateFailed: {"Failed to update service account", http.StatusInternalServerError},
+		ServiceAccountDeleteFailed: {"Failed to delete service account", http.StatusInternalServerError},
+		ServiceAccountDeleted:      {"Service account deleted successfully", http.StatusOK},
+		ServiceAccountNameExists:   {"A service account with this name already exists", http.StatusConflict},
+		ServiceAccountRoleRemoved:  {"Role removed from service account", http.StatusOK},
+
+		// Email templates, rendered with text/template
+		EmailPasswordResetSubject:   {"Reset your password", http.StatusOK},
+		EmailPasswordResetBody:      {"We received a request to reset your password.\n\nFollow this link within {{.Minutes}} minutes to choose a new one:\n{{.Link}}\n\nIf you did not ask for this, you can ignore this email.", http.StatusOK},
+		EmailVerificationSubject:    {"Verify your email address", http.StatusOK},
+		EmailVerificationBody:       {"Welcome to GoBizManager.\n\nPlease confirm your email address by following this link:\n{{.Link}}", http.StatusOK},
+		EmailAccountLockedSubject:   {"Your account has been locked", http.StatusOK},
+		EmailAccountLockedBody:      {"We locked your account after repeated failed login attempts.\n\nIf this was you, follow this link to unlock it now:\n{{.Link}}\n\nOtherwise the lock lifts on its own after {{.Minutes}} minutes. If you did not try to log in, consider changing your password.", http.StatusOK},
+		EmailPasswordChangedSubject: {"Your password was changed", http.StatusOK},
+		EmailPasswordChangedBody:    {"The password of your GoBizManager account was changed and all other sessions were signed out.\n\nIf you did not do this, reset your password right away and contact your administrator.", http.StatusOK},
+		EmailChangeConfirmSubject:   {"Confirm your new email address", http.StatusOK},
+		EmailChangeConfirmBody:      {"We received a request to use this address for your GoBizManager account.\n\nFollow this link within {{.Hours}} hours to confirm it:\n{{.Link}}\n\nIf you did not ask for this, you can ignore this email.", http.StatusOK},
+		EmailEmailChangedSubject:    {"Your email address was changed", http.StatusOK},
+		EmailEmailChangedBody:       {"The email address of your GoBizManager account was changed to {{.Email}}. Future messages will go there.\n\nIf you did not do this, contact your administrator right away.", http.StatusOK},
+		EmailInvitationSubject:      {"You have been invited to GoBizManager", http.StatusOK},
+		EmailInvitationBody:         {"You have been invited to join {{.Company}} on GoBizManager as {{.Role}}.\n\nFollow this link within {{.Days}} days to accept:\n{{.Link}}\n\nIf you already have an account with this address, the company is added to it. If you were not expecting this, you can ignore this email.", http.StatusOK},
+
+		// MFA messages
+		MFAInvalidCode:      {"Invalid authentication code", http.StatusUnauthorized},
+		MFAInvalidChallenge: {"MFA challenge is invalid or expired", http.StatusUnauthorized},
+		MFANotEnabled:       {"Multi-factor authentication is not set up", http.StatusBadRequest},
+		MFAAlreadyEnabled:   {"Multi-factor authentication is already enabled", http.StatusConflict},
+		MFAEnrollFailed:     {"Failed to set up multi-factor authentication", http.StatusInternalServerError},
+		MFADisableFailed:    {"Failed to disable multi-factor authentication", http.StatusInternalServerError},
+		MFADisabled:         {"Multi-factor authentication disabled", http.StatusOK},
+		MFARequiredByPolicy: {"Your company requires multi-factor authentication for administrators", http.StatusForbidden},
 
 		// Validation messages
 		ValidationFailed:    {"Validation failed", http.StatusBadRequest},
@@ -224,25 +488,45 @@ func NewMessageStore() *MessageStore {
 		BadRequest: {"Solicitud inválida", http.StatusBadRequest},
 
 		// Auth messages
-		AuthHeaderRequired:      {"Se requiere el encabezado de autorización", http.StatusUnauthorized},
-		AuthInvalidFormat:       {"Formato de autorización inválido", http.StatusBadRequest},
-		AuthTokenExpired:        {"Token expirado", http.StatusUnauthorized},
-		AuthInvalidToken:        {"Token inválido", http.StatusUnauthorized},
-		AuthInvalidCredentials:  {"Credenciales inválidas", http.StatusUnauthorized},
-		AuthUserNotFound:        {"Usuario no encontrado", http.StatusNotFound},
-		AuthInvalidRequest:      {"Solicitud inválida", http.StatusBadRequest},
-		AuthValidationFailed:    {"Validación fallida", http.StatusBadRequest},
-		AuthUsernameExists:      {"El nombre de usuario ya existe", http.StatusConflict},
-		AuthCreateUserFailed:    {"Error al crear usuario", http.StatusInternalServerError},
-		AuthTokenGenFailed:      {"Error al generar tokens", http.StatusInternalServerError},
-		AuthUnauthorized:        {"Acceso no autorizado", http.StatusUnauthorized},
-		AuthPermissionDenied:    {"Permiso denegado", http.StatusForbidden},
-		AuthDatabaseError:       {"Error de base de datos", http.StatusInternalServerError},
-		AuthInvalidRefreshToken: {"Token de actualización inválido", http.StatusUnauthorized},
-		AuthRegistrationClosed:  {"El registro está cerrado. Solo el primer usuario puede registrarse como ROOT.", http.StatusForbidden},
-		AuthInvalidEmail:        {"Correo electrónico inválido", http.StatusBadRequest},
-		AuthPasswordTooShort:    {"Contraseña demasiado corta", http.StatusBadRequest},
-		AuthFieldRequired:       {"Campo requerido", http.StatusBadRequest},
+		AuthHeaderRequired:             {"Se requiere el encabezado de autorización", http.StatusUnauthorized},
+		AuthInvalidFormat:              {"Formato de autorización inválido", http.StatusBadRequest},
+		AuthTokenExpired:               {"Token expirado", http.StatusUnauthorized},
+		AuthInvalidToken:               {"Token inválido", http.StatusUnauthorized},
+		AuthInvalidCredentials:         {"Credenciales inválidas", http.StatusUnauthorized},
+		AuthUserNotFound:               {"Usuario no encontrado", http.StatusNotFound},
+		AuthInvalidRequest:             {"Solicitud inválida", http.StatusBadRequest},
+		AuthValidationFailed:           {"Validación fallida", http.StatusBadRequest},
+		AuthUsernameExists:             {"El nombre de usuario ya existe", http.StatusConflict},
+		AuthCreateUserFailed:           {"Error al crear usuario", http.StatusInternalServerError},
+		AuthTokenGenFailed:             {"Error al generar tokens", http.StatusInternalServerError},
+		AuthUnauthorized:               {"Acceso no autorizado", http.StatusUnauthorized},
+		AuthPermissionDenied:           {"Permiso denegado", http.StatusForbidden},
+		AuthDatabaseError:              {"Error de base de datos", http.StatusInternalServerError},
+		AuthInvalidRefreshToken:        {"Token de actualización inválido", http.StatusUnauthorized},
+		AuthRegistrationClosed:         {"El registro está cerrado. Solo el primer usuario puede registrarse como ROOT.", http.StatusForbidden},
+		AuthInvalidEmail:               {"Correo electrónico inválido", http.StatusBadRequest},
+		AuthPasswordTooShort:           {"Contraseña demasiado corta", http.StatusBadRequest},
+		AuthFieldRequired:              {"Campo requerido", http.StatusBadRequest},
+		AuthRefreshTokenReused:         {"El token de actualización ya fue utilizado, inicie sesión nuevamente", http.StatusUnauthorized},
+		AuthLogoutFailed:               {"Error al cerrar sesión", http.StatusInternalServerError},
+		AuthLoggedOut:                  {"Sesión cerrada exitosamente", http.StatusOK},
+		AuthSessionRevoked:             {"La sesión fue revocada, inicie sesión nuevamente", http.StatusUnauthorized},
+		AuthInvalidActionToken:         {"Enlace inválido o expirado", http.StatusBadRequest},
+		AuthPasswordResetRequested:     {"Si la cuenta existe, se envió un correo para restablecer la contraseña", http.StatusOK},
+		AuthPasswordResetFailed:        {"Error al restablecer la contraseña", http.StatusInternalServerError},
+		AuthPasswordReset:              {"La contraseña fue restablecida, inicie sesión nuevamente", http.StatusOK},
+		AuthEmailVerifyFailed:          {"Error al verificar el correo", http.StatusInternalServerError},
+		AuthEmailVerified:              {"Correo verificado exitosamente", http.StatusOK},
+		AuthPasswordChangeFailed:       {"No se pudo cambiar la contraseña", http.StatusInternalServerError},
+		AuthEmailChangeRequested:       {"Se ha enviado un enlace de confirmación a la nueva dirección de correo", http.StatusOK},
+		AuthEmailChangeFailed:          {"No se pudo cambiar la dirección de correo", http.StatusInternalServerError},
+		AuthEmailChanged:               {"Dirección de correo cambiada exitosamente", http.StatusOK},
+		AuthTooManyAttempts:            {"Demasiados intentos de inicio de sesión. Inténtelo de nuevo más tarde.", http.StatusTooManyRequests},
+		AuthAccountLocked:              {"La cuenta está bloqueada temporalmente tras varios intentos fallidos. Revise su correo para desbloquearla.", http.StatusLocked},
+		AuthAccountUnlocked:            {"Cuenta desbloqueada exitosamente", http.StatusOK},
+		AuthSetupTokenInvalid:          {"Token de configuración no válido", http.StatusForbidden},
+		AuthImpersonationNotAllowed:    {"Esta acción no está permitida mientras se suplanta a un usuario", http.StatusForbidden},
+		AuthImpersonationTargetInvalid: {"Solo se puede suplantar a miembros de la empresa que no sean usuarios ROOT", http.StatusBadRequest},
 
 		// Rate limit messages
 		RateLimitExceeded: {"Demasiadas solicitudes. Por favor, intente nuevamente más tarde.", http.StatusTooManyRequests},
@@ -266,23 +550,135 @@ func NewMessageStore() *MessageStore {
 		CompanyDeleted:            {"Empresa eliminada exitosamente", http.StatusOK},
 		CompanyUserNotFound:       {"Usuario de empresa no encontrado", http.StatusNotFound},
 		CompanyUserRemoveFailed:   {"Error al eliminar el usuario de la empresa", http.StatusInternalServerError},
+		CompanyMFAPolicyUpdated:   {"Política MFA de la empresa actualizada exitosamente", http.StatusOK},
+
+		// Password policy messages
+		PasswordTooShort:      {"La contraseña es más corta de lo que permite la política de contraseñas", http.StatusBadRequest},
+		PasswordNeedsUpper:    {"La contraseña debe contener una letra mayúscula", http.StatusBadRequest},
+		PasswordNeedsLower:    {"La contraseña debe contener una letra minúscula", http.StatusBadRequest},
+		PasswordNeedsDigit:    {"La contraseña debe contener un dígito", http.StatusBadRequest},
+		PasswordNeedsSymbol:   {"La contraseña debe contener un símbolo", http.StatusBadRequest},
+		PasswordReused:        {"La contraseña se usó recientemente; elija otra", http.StatusBadRequest},
+		PasswordBreached:      {"La contraseña aparece en una lista de contraseñas filtradas; elija otra", http.StatusBadRequest},
+		PasswordExpired:       {"La contraseña ha expirado; restablézcala para iniciar sesión", http.StatusForbidden},
+		PasswordCheckFailed:   {"No se pudo comprobar la contraseña", http.StatusInternalServerError},
+		PasswordPolicyUpdated: {"Política de contraseñas actualizada exitosamente", http.StatusOK},
+
+		// Invitation messages
+		InvitationNotFound:         {"Invitación no encontrada", http.StatusNotFound},
+		InvitationExists:           {"Ya existe una invitación pendiente para este correo; reenvíela en su lugar", http.StatusConflict},
+		InvitationAlreadyMember:    {"El usuario ya es miembro de esta empresa", http.StatusConflict},
+		InvitationInvalid:          {"El enlace de invitación no es válido o ha expirado", http.StatusBadRequest},
+		InvitationPasswordRequired: {"Elija una contraseña para crear su cuenta", http.StatusBadRequest},
+		InvitationCreateFailed:     {"No se pudo crear la invitación", http.StatusInternalServerError},
+		InvitationListFailed:       {"No se pudieron listar las invitaciones", http.StatusInternalServerError},
+		InvitationUpdateFailed:     {"No se pudo actualizar la invitación", http.StatusInternalServerError},
+		InvitationAcceptFailed:     {"No se pudo aceptar la invitación", http.StatusInternalServerError},
+		InvitationResent:           {"Invitación reenviada", http.StatusOK},
+		InvitationRevoked:          {"Invitación revocada", http.StatusOK},
+		InvitationAccepted:         {"Invitación aceptada, ya puede iniciar sesión", http.StatusOK},
 
 		// Permission messages
-		PermissionDenied:       {"Permisos insuficientes", http.StatusForbidden},
-		PermissionCheckFailed:  {"Error al verificar los permisos", http.StatusInternalServerError},
-		PermissionRequired:     {"Se requieren permisos", http.StatusForbidden},
-		PermissionCreateFailed: {"Error al crear el permiso", http.StatusInternalServerError},
-		PermissionAssignFailed: {"Error al asignar el permiso al rol", http.StatusInternalServerError},
-		PermissionRemoveFailed: {"Error al eliminar el permiso del rol", http.StatusInternalServerError},
-		PermissionListFailed:   {"Error al listar los permisos", http.StatusInternalServerError},
-		RoleCreateFailed:       {"Error al crear el rol", http.StatusInternalServerError},
-		RoleNotFound:           {"Rol no encontrado", http.StatusNotFound},
-		RoleListFailed:         {"Error al listar los roles", http.StatusInternalServerError},
-		PermissionAssigned:     {"Permiso asignado exitosamente", http.StatusOK},
-		PermissionRemoved:      {"Permiso eliminado exitosamente", http.StatusOK},
-		RoleAssignFailed:       {"Error al asignar el rol", http.StatusInternalServerError},
-		RoleAssigned:           {"Rol asignado exitosamente", http.StatusOK},
-		PermissionNotFound:     {"Permiso no encontrado", http.StatusNotFound},
+		PermissionDenied:          {"Permisos insuficientes", http.StatusForbidden},
+		PermissionCheckFailed:     {"Error al verificar los permisos", http.StatusInternalServerError},
+		PermissionRequired:        {"Se requieren permisos", http.StatusForbidden},
+		PermissionCreateFailed:    {"Error al crear el permiso", http.StatusInternalServerError},
+		PermissionAssignFailed:    {"Error al asignar el permiso al rol", http.StatusInternalServerError},
+		PermissionRemoveFailed:    {"Error al eliminar el permiso del rol", http.StatusInternalServerError},
+		PermissionListFailed:      {"Error al listar los permisos", http.StatusInternalServerError},
+		RoleCreateFailed:          {"Error al crear el rol", http.StatusInternalServerError},
+		RoleNotFound:              {"Rol no encontrado", http.StatusNotFound},
+		RoleListFailed:            {"Error al listar los roles", http.StatusInternalServerError},
+		PermissionAssigned:        {"Permiso asignado exitosamente", http.StatusOK},
+		PermissionRemoved:         {"Permiso eliminado exitosamente", http.StatusOK},
+		RoleAssignFailed:          {"Error al asignar el rol", http.StatusInternalServerError},
+		RoleAssigned:              {"Rol asignado exitosamente", http.StatusOK},
+		RoleParentInvalid:         {"El rol padre debe ser otro rol de la misma empresa", http.StatusBadRequest},
+		RoleHierarchyCycle:        {"El rol padre haría que el rol heredara de sí mismo", http.StatusConflict},
+		RoleUpdateFailed:          {"Error al actualizar el rol", http.StatusInternalServerError},
+		PermissionNotFound:        {"Permiso no encontrado", http.StatusNotFound},
+		PermissionCompanyRequired: {"La empresa debe indicarse en la URL o mediante la empresa activa del token", http.StatusBadRequest},
+
+		// Permission group messages
+		PermissionGroupNotFound:     {"Grupo de permisos no encontrado", http.StatusNotFound},
+		PermissionGroupNameTaken:    {"La empresa ya tiene un grupo de permisos con este nombre", http.StatusConflict},
+		PermissionGroupCreateFailed: {"Error al crear el grupo de permisos", http.StatusInternalServerError},
+		PermissionGroupUpdateFailed: {"Error al actualizar el grupo de permisos", http.StatusInternalServerError},
+		PermissionGroupDeleteFailed: {"Error al eliminar el grupo de permisos", http.StatusInternalServerError},
+		PermissionGroupListFailed:   {"Error al listar los grupos de permisos", http.StatusInternalServerError},
+
+		// Permission deny messages
+		PermissionDenyNotFound:       {"Denegación de permiso no encontrada", http.StatusNotFound},
+		PermissionDenyTargetInvalid:  {"Debe indicarse role_id o user_id, pero no ambos", http.StatusBadRequest},
+		PermissionDenyActionNotFound: {"Acción del módulo no encontrada", http.StatusNotFound},
+		PermissionDenyRoot:           {"No se puede denegar a ROOT", http.StatusBadRequest},
+		PermissionDenyExists:         {"La acción del módulo ya está denegada", http.StatusConflict},
+		PermissionDenyCreateFailed:   {"Error al crear la denegación de permiso", http.StatusInternalServerError},
+		PermissionDenyDeleteFailed:   {"Error al eliminar la denegación de permiso", http.StatusInternalServerError},
+		PermissionDenyListFailed:     {"Error al listar las denegaciones de permisos", http.StatusInternalServerError},
+
+		// Permission condition messages
+		PermissionConditionInvalid: {"Condición de permiso no válida", http.StatusBadRequest},
+
+		// Session messages
+		SessionNotFound:     {"Sesión no encontrada", http.StatusNotFound},
+		SessionListFailed:   {"Error al listar las sesiones", http.StatusInternalServerError},
+		SessionRevokeFailed: {"Error al revocar la sesión", http.StatusInternalServerError},
+		SessionRevoked:      {"Sesión revocada exitosamente", http.StatusOK},
+
+		// API key messages
+		APIKeyInvalid:         {"Clave de API inválida o expirada", http.StatusUnauthorized},
+		APIKeyNotFound:        {"Clave de API no encontrada", http.StatusNotFound},
+		APIKeyCreateFailed:    {"Error al crear la clave de API", http.StatusInternalServerError},
+		APIKeyListFailed:      {"Error al listar las claves de API", http.StatusInternalServerError},
+		APIKeyRevokeFailed:    {"Error al revocar la clave de API", http.StatusInternalServerError},
+		APIKeyRevoked:         {"Clave de API revocada exitosamente", http.StatusOK},
+		APIKeyScopeExceeded:   {"Los permisos de la clave de API deben ser un subconjunto de sus permisos en la empresa", http.StatusForbidden},
+		APIKeySessionRequired: {"Las claves de API no pueden administrar claves de API", http.StatusForbidden},
+
+		// External identity provider messages
+		OIDCProviderNotFound: {"Proveedor de identidad no encontrado", http.StatusNotFound},
+		OIDCInvalidState:     {"La solicitud de inicio de sesión no es válida o ha expirado", http.StatusBadRequest},
+		OIDCLoginFailed:      {"El inicio de sesión con el proveedor de identidad falló", http.StatusBadGateway},
+		OIDCEmailNotVerified: {"El proveedor de identidad no ha verificado su correo electrónico", http.StatusForbidden},
+		OIDCNoAccount:        {"Ninguna cuenta está vinculada a esta identidad", http.StatusForbidden},
+		OIDCProvisionFailed:  {"No se pudo crear la cuenta a partir de la identidad", http.StatusInternalServerError},
+
+		// Service account messages
+		ServiceAccountNotFound:     {"Cuenta de servicio no encontrada", http.StatusNotFound},
+		ServiceAccountCreateFailed: {"Error al crear la cuenta de servicio", http.StatusInternalServerError},
+		ServiceAccountListFailed:   {"Error al listar las cuentas de servicio", http.StatusInternalServerError},
+		ServiceAccountUpdateFailed: {"Error al actualizar la cuenta de servicio", http.StatusInternalServerError},
+		ServiceAccountDeleteFailed: {"Error al eliminar la cuenta de servicio", http.StatusInternalServerError},
+		ServiceAccountDeleted:      {"Cuenta de servicio eliminada exitosamente", http.StatusOK},
+		ServiceAccountNameExists:   {"Ya existe una cuenta de servicio con este nombre", http.StatusConflict},
+		ServiceAccountRoleRemoved:  {"Rol eliminado de la cuenta de servicio", http.StatusOK},
+
+		// Email templates, rendered with text/template
+		EmailPasswordResetSubject:   {"Restablezca su contraseña", http.StatusOK},
+		EmailPasswordResetBody:      {"Recibimos una solicitud para restablecer su contraseña.\n\nSiga este enlace dentro de los próximos {{.Minutes}} minutos para elegir una nueva:\n{{.Link}}\n\nSi no la solicitó, puede ignorar este correo.", http.StatusOK},
+		EmailVerificationSubject:    {"Verifique su correo electrónico", http.StatusOK},
+		EmailVerificationBody:       {"Bienvenido a GoBizManager.\n\nConfirme su correo electrónico siguiendo este enlace:\n{{.Link}}", http.StatusOK},
+		EmailAccountLockedSubject:   {"Su cuenta ha sido bloqueada", http.StatusOK},
+		EmailAccountLockedBody:      {"Bloqueamos su cuenta tras varios intentos fallidos de inicio de sesión.\n\nSi fue usted, siga este enlace para desbloquearla ahora:\n{{.Link}}\n\nDe lo contrario, el bloqueo se levantará solo después de {{.Minutes}} minutos. Si no intentó iniciar sesión, considere cambiar su contraseña.", http.StatusOK},
+		EmailPasswordChangedSubject: {"Su contraseña fue cambiada", http.StatusOK},
+		EmailPasswordChangedBody:    {"La contraseña de su cuenta de GoBizManager fue cambiada y se cerraron todas las demás sesiones.\n\nSi no fue usted, restablezca su contraseña de inmediato y contacte a su administrador.", http.StatusOK},
+		EmailChangeConfirmSubject:   {"Confirme su nueva dirección de correo", http.StatusOK},
+		EmailChangeConfirmBody:      {"Recibimos una solicitud para usar esta dirección en su cuenta de GoBizManager.\n\nSiga este enlace dentro de las próximas {{.Hours}} horas para confirmarla:\n{{.Link}}\n\nSi no la solicitó, puede ignorar este correo.", http.StatusOK},
+		EmailEmailChangedSubject:    {"Su dirección de correo fue cambiada", http.StatusOK},
+		EmailEmailChangedBody:       {"La dirección de correo de su cuenta de GoBizManager fue cambiada a {{.Email}}. Los próximos mensajes se enviarán allí.\n\nSi no fue usted, contacte a su administrador de inmediato.", http.StatusOK},
+		EmailInvitationSubject:      {"Ha sido invitado a GoBizManager", http.StatusOK},
+		EmailInvitationBody:         {"Ha sido invitado a unirse a {{.Company}} en GoBizManager como {{.Role}}.\n\nSiga este enlace dentro de los próximos {{.Days}} días para aceptar:\n{{.Link}}\n\nSi ya tiene una cuenta con esta dirección, la empresa se agregará a ella. Si no esperaba esta invitación, puede ignorar este correo.", http.StatusOK},
+
+		// MFA messages
+		MFAInvalidCode:      {"Código de autenticación inválido", http.StatusUnauthorized},
+		MFAInvalidChallenge: {"El desafío MFA es inválido o expiró", http.StatusUnauthorized},
+		MFANotEnabled:       {"La autenticación multifactor no está configurada", http.StatusBadRequest},
+		MFAAlreadyEnabled:   {"La autenticación multifactor ya está habilitada", http.StatusConflict},
+		MFAEnrollFailed:     {"Error al configurar la autenticación multifactor", http.StatusInternalServerError},
+		MFADisableFailed:    {"Error al deshabilitar la autenticación multifactor", http.StatusInternalServerError},
+		MFADisabled:         {"Autenticación multifactor deshabilitada", http.StatusOK},
+		MFARequiredByPolicy: {"Su empresa requiere autenticación multifactor para administradores", http.StatusForbidden},
 
 		// Validation messages
 		ValidationFailed:    {"Error de validación", http.StatusBadRequest},
@@ -0,0 +1,35 @@
+// Package mailer sends transactional email through pluggable transports
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"text/template"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Render executes a text template with the given data. Templates come from
+// the language message store so each language can word the email differently.
+func Render(tmpl string, data interface{}) (string, error) {
+	t, err := template.New("mail").Parse(tmpl)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
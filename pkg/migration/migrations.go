@@ -194,6 +194,328 @@ var migrations = []struct {
 			WHERE module_id = 3;
 		`,
 	},
+	{
+		name: "Create refresh_tokens table",
+		stmt: `
+			CREATE TABLE IF NOT EXISTS refresh_tokens (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL,
+				family_id TEXT NOT NULL,
+				token_hash TEXT NOT NULL UNIQUE,
+				device TEXT,
+				expires_at TIMESTAMP NOT NULL,
+				revoked_at TIMESTAMP,
+				created_at TIMESTAMP,
+				updated_at TIMESTAMP,
+				FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+			);
+			CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens(family_id);
+			CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON refresh_tokens(user_id);
+		`,
+	},
+	{
+		name: "Create sessions table",
+		stmt: `
+			CREATE TABLE IF NOT EXISTS sessions (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL,
+				family_id TEXT NOT NULL UNIQUE,
+				ip_address TEXT,
+				user_agent TEXT,
+				expires_at TIMESTAMP NOT NULL,
+				last_used_at TIMESTAMP,
+				revoked_at TIMESTAMP,
+				created_at TIMESTAMP,
+				updated_at TIMESTAMP,
+				FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+			);
+			CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
+		`,
+	},
+	{
+		name: "Add company_user_id to user_roles",
+		stmt: `
+			ALTER TABLE user_roles ADD COLUMN company_user_id INTEGER REFERENCES company_users(id) ON DELETE CASCADE;
+			CREATE INDEX IF NOT EXISTS idx_user_roles_company_user_id ON user_roles(company_user_id);
+		`,
+	},
+	{
+		name: "Create MFA tables",
+		stmt: `
+			CREATE TABLE IF NOT EXISTS user_mfa (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL UNIQUE,
+				secret TEXT NOT NULL,
+				enabled BOOLEAN NOT NULL DEFAULT FALSE,
+				last_used_step INTEGER NOT NULL DEFAULT 0,
+				confirmed_at TIMESTAMP,
+				created_at TIMESTAMP,
+				updated_at TIMESTAMP,
+				FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+			);
+			CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL,
+				code_hash TEXT NOT NULL,
+				used_at TIMESTAMP,
+				created_at TIMESTAMP,
+				FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+				UNIQUE(user_id, code_hash)
+			);
+			ALTER TABLE companies ADD COLUMN require_admin_mfa BOOLEAN NOT NULL DEFAULT FALSE;
+		`,
+	},
+	{
+		name: "Add email verification and used action tokens",
+		stmt: `
+			ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMP;
+			CREATE TABLE IF NOT EXISTS used_tokens (
+				jti TEXT PRIMARY KEY,
+				user_id INTEGER NOT NULL,
+				purpose TEXT NOT NULL,
+				expires_at TIMESTAMP NOT NULL,
+				created_at TIMESTAMP,
+				FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+			);
+		`,
+	},
+	{
+		name: "Create signing_keys table",
+		stmt: `
+			CREATE TABLE IF NOT EXISTS signing_keys (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				kid TEXT NOT NULL UNIQUE,
+				algorithm TEXT NOT NULL,
+				private_key TEXT NOT NULL,
+				public_key TEXT NOT NULL,
+				retired_at TIMESTAMP,
+				expires_at TIMESTAMP,
+				created_at TIMESTAMP
+			);
+		`,
+	},
+	{
+		name: "Create api_keys tables",
+		stmt: `
+			CREATE TABLE IF NOT EXISTS api_keys (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL,
+				company_id INTEGER NOT NULL,
+				name TEXT NOT NULL,
+				prefix TEXT NOT NULL,
+				key_hash TEXT NOT NULL UNIQUE,
+				expires_at TIMESTAMP NOT NULL,
+				last_used_at TIMESTAMP,
+				revoked_at TIMESTAMP,
+				created_at TIMESTAMP,
+				updated_at TIMESTAMP,
+				FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+				FOREIGN KEY (company_id) REFERENCES companies(id) ON DELETE CASCADE
+			);
+			CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys(user_id);
+			CREATE TABLE IF NOT EXISTS api_key_module_actions (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				api_key_id INTEGER NOT NULL,
+				module_action_id INTEGER NOT NULL,
+				FOREIGN KEY (api_key_id) REFERENCES api_keys(id) ON DELETE CASCADE,
+				FOREIGN KEY (module_action_id) REFERENCES module_actions(id) ON DELETE CASCADE,
+				UNIQUE(api_key_id, module_action_id)
+			);
+		`,
+	},
+	{
+		name: "Create service_accounts table",
+		stmt: `
+			ALTER TABLE users ADD COLUMN is_service_account BOOLEAN NOT NULL DEFAULT FALSE;
+			CREATE TABLE IF NOT EXISTS service_accounts (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				company_id INTEGER NOT NULL,
+				user_id INTEGER NOT NULL UNIQUE,
+				name TEXT NOT NULL,
+				description TEXT,
+				created_by INTEGER,
+				created_at TIMESTAMP,
+				updated_at TIMESTAMP,
+				FOREIGN KEY (company_id) REFERENCES companies(id) ON DELETE CASCADE,
+				FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+				FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL,
+				UNIQUE(company_id, name)
+			);
+		`,
+	},
+	{
+		name: "Create external identity tables",
+		stmt: `
+			CREATE TABLE IF NOT EXISTS oidc_login_states (
+				state_hash TEXT PRIMARY KEY,
+				provider TEXT NOT NULL,
+				nonce TEXT NOT NULL,
+				code_verifier TEXT NOT NULL,
+				expires_at TIMESTAMP NOT NULL,
+				created_at TIMESTAMP
+			);
+			CREATE TABLE IF NOT EXISTS user_identities (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL,
+				provider TEXT NOT NULL,
+				subject TEXT NOT NULL,
+				email_hash TEXT,
+				last_login_at TIMESTAMP,
+				created_at TIMESTAMP,
+				FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+				UNIQUE(provider, subject)
+			);
+			CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities(user_id);
+		`,
+	},
+	{
+		name: "Create login throttling and audit tables",
+		stmt: `
+			CREATE TABLE IF NOT EXISTS login_throttles (
+				key TEXT PRIMARY KEY,
+				failures INTEGER NOT NULL DEFAULT 0,
+				window_started_at TIMESTAMP,
+				next_attempt_at TIMESTAMP,
+				banned_until TIMESTAMP,
+				updated_at TIMESTAMP
+			);
+			CREATE TABLE IF NOT EXISTS audit_events (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				type TEXT NOT NULL,
+				user_id INTEGER,
+				actor_id INTEGER,
+				company_id INTEGER,
+				ip_address TEXT,
+				details TEXT,
+				created_at TIMESTAMP,
+				FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL,
+				FOREIGN KEY (actor_id) REFERENCES users(id) ON DELETE SET NULL,
+				FOREIGN KEY (company_id) REFERENCES companies(id) ON DELETE SET NULL
+			);
+			CREATE INDEX IF NOT EXISTS idx_audit_events_user_id ON audit_events(user_id);
+			CREATE INDEX IF NOT EXISTS idx_audit_events_type ON audit_events(type, created_at);
+		`,
+	},
+	{
+		name: "Create password policy tables",
+		stmt: `
+			CREATE TABLE IF NOT EXISTS company_password_policies (
+				company_id INTEGER PRIMARY KEY,
+				min_length INTEGER NOT NULL DEFAULT 8,
+				require_upper BOOLEAN NOT NULL DEFAULT 0,
+				require_lower BOOLEAN NOT NULL DEFAULT 0,
+				require_digit BOOLEAN NOT NULL DEFAULT 0,
+				require_symbol BOOLEAN NOT NULL DEFAULT 0,
+				history_size INTEGER NOT NULL DEFAULT 0,
+				max_age_days INTEGER NOT NULL DEFAULT 0,
+				updated_at TIMESTAMP,
+				FOREIGN KEY (company_id) REFERENCES companies(id) ON DELETE CASCADE
+			);
+			CREATE TABLE IF NOT EXISTS password_history (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL,
+				password_hash TEXT NOT NULL,
+				created_at TIMESTAMP,
+				FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+			);
+			CREATE INDEX IF NOT EXISTS idx_password_history_user_id ON password_history(user_id, created_at);
+			ALTER TABLE users ADD COLUMN password_changed_at TIMESTAMP;
+		`,
+	},
+	{
+		name: "Add token_version to users",
+		stmt: `ALTER TABLE users ADD COLUMN token_version INTEGER NOT NULL DEFAULT 0;`,
+	},
+	{
+		name: "Create invitations table",
+		stmt: `
+			CREATE TABLE IF NOT EXISTS invitations (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				company_id INTEGER NOT NULL,
+				email TEXT NOT NULL,
+				email_hash TEXT NOT NULL,
+				role_id INTEGER NOT NULL,
+				invited_by INTEGER,
+				token_id TEXT NOT NULL,
+				expires_at TIMESTAMP NOT NULL,
+				accepted_at TIMESTAMP,
+				accepted_user_id INTEGER,
+				revoked_at TIMESTAMP,
+				created_at TIMESTAMP,
+				updated_at TIMESTAMP,
+				FOREIGN KEY (company_id) REFERENCES companies(id) ON DELETE CASCADE,
+				FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE CASCADE,
+				FOREIGN KEY (invited_by) REFERENCES users(id) ON DELETE SET NULL,
+				FOREIGN KEY (accepted_user_id) REFERENCES users(id) ON DELETE SET NULL
+			);
+			CREATE INDEX IF NOT EXISTS idx_invitations_company_email ON invitations(company_id, email_hash);
+		`,
+	},
+	{
+		name: "Add parent_role_id to roles",
+		stmt: `
+			ALTER TABLE roles ADD COLUMN parent_role_id INTEGER REFERENCES roles(id) ON DELETE SET NULL;
+			CREATE INDEX IF NOT EXISTS idx_roles_parent_role_id ON roles(parent_role_id);
+		`,
+	},
+	{
+		// permission_groups is created by ApplyMigrations after this list
+		name: "Create role_permission_groups table",
+		stmt: `
+			CREATE TABLE IF NOT EXISTS role_permission_groups (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				role_id INTEGER NOT NULL,
+				group_id INTEGER NOT NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE CASCADE,
+				FOREIGN KEY (group_id) REFERENCES permission_groups(id) ON DELETE CASCADE,
+				UNIQUE(role_id, group_id)
+			);
+			CREATE INDEX IF NOT EXISTS idx_role_permission_groups_group_id ON role_permission_groups(group_id);
+		`,
+	},
+	{
+		// A deny names either a role or a company_user
+		name: "Create permission_denies table",
+		stmt: `
+			CREATE TABLE IF NOT EXISTS permission_denies (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				company_id INTEGER NOT NULL,
+				role_id INTEGER,
+				company_user_id INTEGER,
+				module_action_id INTEGER NOT NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (company_id) REFERENCES companies(id) ON DELETE CASCADE,
+				FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE CASCADE,
+				FOREIGN KEY (company_user_id) REFERENCES company_users(id) ON DELETE CASCADE,
+				FOREIGN KEY (module_action_id) REFERENCES module_actions(id) ON DELETE CASCADE,
+				CHECK ((role_id IS NULL) <> (company_user_id IS NULL)),
+				UNIQUE(role_id, module_action_id),
+				UNIQUE(company_user_id, module_action_id)
+			);
+			CREATE INDEX IF NOT EXISTS idx_permission_denies_company_id ON permission_denies(company_id);
+		`,
+	},
+	{
+		// An empty condition grants the module action unconditionally
+		name: "Add condition to permission_module_actions",
+		stmt: `ALTER TABLE permission_module_actions ADD COLUMN condition TEXT NOT NULL DEFAULT ''`,
+	},
+	{
+		// Incremented with every change of the company's roles and permissions
+		name: "Add rbac_version to companies",
+		stmt: `ALTER TABLE companies ADD COLUMN rbac_version INTEGER NOT NULL DEFAULT 0`,
+	},
+	{
+		// Keys stop working once their user's token version moves on
+		name: "Add token_version to api_keys",
+		stmt: `
+			ALTER TABLE api_keys ADD COLUMN token_version INTEGER NOT NULL DEFAULT 0;
+			UPDATE api_keys SET token_version = (SELECT token_version FROM users WHERE users.id = api_keys.user_id);
+		`,
+	},
 }
 
 func ApplyMigrations(db *sql.DB) error {
@@ -0,0 +1,157 @@
+package passwordpolicy
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	"gobizmanager/pkg/language"
+)
+
+// prefixLength is the number of hex characters of the SHA-1 hash that leave
+// the caller, as in the Pwned Passwords range API
+const prefixLength = 5
+
+// RangeSource returns the hash suffixes of breached passwords whose SHA-1
+// hash starts with prefix. Only the prefix is ever shared with the source, so
+// a remote implementation learns nothing useful about the password.
+type RangeSource interface {
+	Range(prefix string) ([]string, error)
+}
+
+// CheckBreached rejects a password that appears in the source
+func CheckBreached(source RangeSource, password string) error {
+	if source == nil {
+		return nil
+	}
+
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	suffixes, err := source.Range(hash[:prefixLength])
+	if err != nil {
+		return err
+	}
+	for _, suffix := range suffixes {
+		if suffix == hash[prefixLength:] {
+			return violation(language.PasswordBreached)
+		}
+	}
+	return nil
+}
+
+// FileSource reads a local copy of a breached password list: one upper case
+// hex SHA-1 hash per line, optionally followed by ":count", sorted by hash.
+// Lookups binary search the file so it never has to fit in memory.
+type FileSource struct {
+	path string
+}
+
+func NewFileSource(path string) *FileSource {
+	return &FileSource{path: path}
+}
+
+func (s *FileSource) Range(prefix string) ([]string, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	start, err := seekFirst(f, info.Size(), prefix)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	var suffixes []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		hash := lineHash(scanner.Bytes())
+		if !strings.HasPrefix(hash, prefix) {
+			if hash > prefix {
+				break
+			}
+			continue
+		}
+		suffixes = append(suffixes, hash[len(prefix):])
+	}
+	return suffixes, scanner.Err()
+}
+
+// seekFirst returns the offset of the first line whose hash is not below
+// prefix. The hash of the first line starting at or after an offset only grows
+// with the offset, so the offset can be bisected.
+func seekFirst(f *os.File, size int64, prefix string) (int64, error) {
+	lo, hi := int64(0), size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		_, hash, eof, err := lineAt(f, mid)
+		if err != nil {
+			return 0, err
+		}
+		if eof || hash >= prefix {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	start, _, eof, err := lineAt(f, lo)
+	if eof {
+		return size, err
+	}
+	return start, err
+}
+
+// lineAt returns the start and hash of the first line starting at or after
+// offset, or eof when there is none
+func lineAt(f *os.File, offset int64) (int64, string, bool, error) {
+	start := offset
+	if offset > 0 {
+		// Step back one byte so a line starting exactly at offset is found
+		start = offset - 1
+	}
+	if _, err := f.Seek(start, io.SeekStart); err != nil {
+		return 0, "", false, err
+	}
+	reader := bufio.NewReader(f)
+
+	if offset > 0 {
+		skipped, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return 0, "", true, nil
+		}
+		if err != nil {
+			return 0, "", false, err
+		}
+		start += int64(len(skipped))
+	}
+
+	line, err := reader.ReadBytes('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return 0, "", false, err
+	}
+	if len(line) == 0 {
+		return 0, "", true, nil
+	}
+	return start, lineHash(line), false, nil
+}
+
+func lineHash(line []byte) string {
+	if i := bytes.IndexByte(line, ':'); i >= 0 {
+		line = line[:i]
+	}
+	return strings.ToUpper(string(bytes.TrimSpace(line)))
+}
@@ -0,0 +1,122 @@
+// Package passwordpolicy checks passwords against configurable composition,
+// reuse and age rules and against a list of breached passwords
+package passwordpolicy
+
+import (
+	"time"
+	"unicode"
+
+	"gobizmanager/pkg/encryption"
+	"gobizmanager/pkg/language"
+)
+
+// DefaultMinLength is the shortest password any policy accepts
+const DefaultMinLength = 8
+
+// Policy is a set of password rules. Zero values disable a rule, except
+// MinLength which never drops below DefaultMinLength.
+type Policy struct {
+	MinLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	HistorySize   int
+	MaxAge        time.Duration
+}
+
+// Violation is a broken rule. Its message is a language key.
+type Violation struct {
+	Key string
+}
+
+func (v *Violation) Error() string {
+	return v.Key
+}
+
+func violation(key string) error {
+	return &Violation{Key: key}
+}
+
+// Default returns the policy applied outside of any company
+func Default() Policy {
+	return Policy{MinLength: DefaultMinLength}
+}
+
+// Merge returns the strictest combination of the policies, for users who
+// belong to several companies
+func Merge(policies ...Policy) Policy {
+	merged := Default()
+	for _, p := range policies {
+		if p.MinLength > merged.MinLength {
+			merged.MinLength = p.MinLength
+		}
+		merged.RequireUpper = merged.RequireUpper || p.RequireUpper
+		merged.RequireLower = merged.RequireLower || p.RequireLower
+		merged.RequireDigit = merged.RequireDigit || p.RequireDigit
+		merged.RequireSymbol = merged.RequireSymbol || p.RequireSymbol
+		if p.HistorySize > merged.HistorySize {
+			merged.HistorySize = p.HistorySize
+		}
+		if p.MaxAge > 0 && (merged.MaxAge == 0 || p.MaxAge < merged.MaxAge) {
+			merged.MaxAge = p.MaxAge
+		}
+	}
+	return merged
+}
+
+// Validate checks the composition rules and returns the first Violation
+func (p Policy) Validate(password string) error {
+	minLength := p.MinLength
+	if minLength < DefaultMinLength {
+		minLength = DefaultMinLength
+	}
+	if len([]rune(password)) < minLength {
+		return violation(language.PasswordTooShort)
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, c := range password {
+		switch {
+		case unicode.IsUpper(c):
+			upper = true
+		case unicode.IsLower(c):
+			lower = true
+		case unicode.IsDigit(c):
+			digit = true
+		case unicode.IsPunct(c) || unicode.IsSymbol(c) || unicode.IsSpace(c):
+			symbol = true
+		}
+	}
+
+	switch {
+	case p.RequireUpper && !upper:
+		return violation(language.PasswordNeedsUpper)
+	case p.RequireLower && !lower:
+		return violation(language.PasswordNeedsLower)
+	case p.RequireDigit && !digit:
+		return violation(language.PasswordNeedsDigit)
+	case p.RequireSymbol && !symbol:
+		return violation(language.PasswordNeedsSymbol)
+	}
+	return nil
+}
+
+// CheckHistory rejects a password matching one of the previous hashes, newest
+// first. Only the last HistorySize hashes are considered.
+func (p Policy) CheckHistory(password string, previous []string) error {
+	for i, hash := range previous {
+		if i >= p.HistorySize {
+			break
+		}
+		if encryption.CheckPassword(password, hash) {
+			return violation(language.PasswordReused)
+		}
+	}
+	return nil
+}
+
+// Expired reports whether a password set at changedAt is past its maximum age
+func (p Policy) Expired(changedAt time.Time) bool {
+	return p.MaxAge > 0 && !changedAt.IsZero() && time.Since(changedAt) > p.MaxAge
+}
@@ -0,0 +1,64 @@
+// Package permdigest encodes a set of module action IDs as a compact bitset so
+// that it can travel inside access tokens
+package permdigest
+
+import (
+	"encoding/base64"
+	"sort"
+)
+
+// Digest is a bitset where bit n is set when module action n is granted
+type Digest []byte
+
+// New builds a digest from module action IDs. Non-positive IDs are ignored.
+func New(ids []int64) Digest {
+	var max int64
+	for _, id := range ids {
+		if id > max {
+			max = id
+		}
+	}
+	if max == 0 {
+		return nil
+	}
+
+	d := make(Digest, max/8+1)
+	for _, id := range ids {
+		if id > 0 {
+			d[id/8] |= 1 << (id % 8)
+		}
+	}
+	return d
+}
+
+// Parse decodes a digest produced by String
+func Parse(s string) (Digest, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
+
+// String encodes the digest as unpadded base64url
+func (d Digest) String() string {
+	return base64.RawURLEncoding.EncodeToString(d)
+}
+
+// Has reports whether the module action is in the digest
+func (d Digest) Has(id int64) bool {
+	if id <= 0 || id/8 >= int64(len(d)) {
+		return false
+	}
+	return d[id/8]&(1<<(id%8)) != 0
+}
+
+// IDs returns the module action IDs in the digest in ascending order
+func (d Digest) IDs() []int64 {
+	var ids []int64
+	for i, b := range d {
+		for bit := 0; bit < 8; bit++ {
+			if b&(1<<bit) != 0 {
+				ids = append(ids, int64(i*8+bit))
+			}
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
@@ -5,71 +5,170 @@ import (
 	"time"
 )
 
+// Policy controls how failed attempts are throttled. After FreeAttempts
+// failures each further one delays the next attempt, starting at BaseDelay and
+// doubling up to MaxDelay. MaxAttempts failures within Window ban the key for
+// BanTime.
+type Policy struct {
+	MaxAttempts  int
+	Window       time.Duration
+	BanTime      time.Duration
+	FreeAttempts int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+}
+
+// State is the throttling state of one key
+type State struct {
+	Key             string
+	Failures        int
+	WindowStartedAt time.Time
+	NextAttemptAt   time.Time
+	BannedUntil     time.Time
+}
+
+// Store persists throttling state so that it survives restarts. Get returns
+// nil without an error when the key has no state.
+type Store interface {
+	Get(key string) (*State, error)
+	Put(state *State) error
+	Delete(key string) error
+}
+
+// Decision is the outcome of checking a key before an attempt
+type Decision struct {
+	Allowed    bool
+	Banned     bool
+	RetryAfter time.Duration
+}
+
 type RateLimiter struct {
-	mu          sync.Mutex
-	attempts    map[string][]time.Time
-	bannedIPs   map[string]time.Time
-	banTime     time.Duration
-	maxAttempts int
-	windowSize  time.Duration
+	mu     sync.Mutex
+	store  Store
+	policy Policy
+}
+
+func New(store Store, policy Policy) *RateLimiter {
+	return &RateLimiter{store: store, policy: policy}
 }
 
+// NewRateLimiter returns an in-memory limiter that bans a key after
+// maxAttempts failures within windowSize
 func NewRateLimiter(maxAttempts int, windowSize, banTime time.Duration) *RateLimiter {
-	return &RateLimiter{
-		attempts:    make(map[string][]time.Time),
-		bannedIPs:   make(map[string]time.Time),
-		banTime:     banTime,
-		maxAttempts: maxAttempts,
-		windowSize:  windowSize,
+	return New(NewMemoryStore(), Policy{
+		MaxAttempts:  maxAttempts,
+		Window:       windowSize,
+		BanTime:      banTime,
+		FreeAttempts: maxAttempts,
+	})
+}
+
+// Check reports whether key may make an attempt now
+func (rl *RateLimiter) Check(key string) (Decision, error) {
+	state, err := rl.store.Get(key)
+	if err != nil || state == nil {
+		return Decision{Allowed: true}, err
+	}
+
+	now := time.Now()
+	if now.Before(state.BannedUntil) {
+		return Decision{Banned: true, RetryAfter: state.BannedUntil.Sub(now)}, nil
 	}
+	if now.Before(state.NextAttemptAt) {
+		return Decision{RetryAfter: state.NextAttemptAt.Sub(now)}, nil
+	}
+	return Decision{Allowed: true}, nil
 }
 
-func (rl *RateLimiter) IsAllowed(ip string) bool {
+// Fail records a failed attempt and reports whether it banned the key
+func (rl *RateLimiter) Fail(key string) (bool, error) {
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
 
-	now := time.Now()
+	state, err := rl.store.Get(key)
+	if err != nil {
+		return false, err
+	}
 
-	// Check if IP is banned
-	if banTime, banned := rl.bannedIPs[ip]; banned {
-		if now.Sub(banTime) < rl.banTime {
-			return false
-		}
-		// Ban period has expired, remove from banned list
-		delete(rl.bannedIPs, ip)
+	now := time.Now()
+	if state == nil {
+		state = &State{Key: key}
 	}
 
-	attempts, exists := rl.attempts[ip]
-
-	// Clean up old attempts
-	if exists {
-		var validAttempts []time.Time
-		for _, attempt := range attempts {
-			if now.Sub(attempt) <= rl.windowSize {
-				validAttempts = append(validAttempts, attempt)
-			}
-		}
-		rl.attempts[ip] = validAttempts
-		attempts = validAttempts
+	// Start over once the window has passed or a ban has run out
+	expiredBan := !state.BannedUntil.IsZero() && !now.Before(state.BannedUntil)
+	if expiredBan || now.Sub(state.WindowStartedAt) > rl.policy.Window {
+		state.Failures = 0
+		state.WindowStartedAt = now
+		state.BannedUntil = time.Time{}
 	}
 
-	// Check if IP has exceeded max attempts
-	if len(attempts) >= rl.maxAttempts {
-		// Ban the IP
-		rl.bannedIPs[ip] = now
-		// Clear attempts for this IP
-		delete(rl.attempts, ip)
-		return false
+	state.Failures++
+	state.NextAttemptAt = now.Add(rl.delay(state.Failures))
+
+	banned := false
+	if state.Failures >= rl.policy.MaxAttempts {
+		state.BannedUntil = now.Add(rl.policy.BanTime)
+		banned = true
 	}
 
-	// Record new attempt
-	rl.attempts[ip] = append(attempts, now)
-	return true
+	return banned, rl.store.Put(state)
 }
 
-func (rl *RateLimiter) Reset(ip string) {
+// Reset clears the failures and any ban of key
+func (rl *RateLimiter) Reset(key string) error {
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
-	delete(rl.attempts, ip)
-	delete(rl.bannedIPs, ip)
+	return rl.store.Delete(key)
+}
+
+// delay returns how long to wait after the given number of failures
+func (rl *RateLimiter) delay(failures int) time.Duration {
+	penalised := failures - rl.policy.FreeAttempts
+	if penalised <= 0 || rl.policy.BaseDelay <= 0 {
+		return 0
+	}
+
+	d := rl.policy.BaseDelay
+	for i := 1; i < penalised && d < rl.policy.MaxDelay; i++ {
+		d *= 2
+	}
+	if rl.policy.MaxDelay > 0 && d > rl.policy.MaxDelay {
+		d = rl.policy.MaxDelay
+	}
+	return d
+}
+
+// MemoryStore keeps state in memory; it is lost on restart
+type MemoryStore struct {
+	mu     sync.Mutex
+	states map[string]State
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{states: make(map[string]State)}
+}
+
+func (s *MemoryStore) Get(key string) (*State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.states[key]
+	if !ok {
+		return nil, nil
+	}
+	return &state, nil
+}
+
+func (s *MemoryStore) Put(state *State) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states[state.Key] = *state
+	return nil
+}
+
+func (s *MemoryStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.states, key)
+	return nil
 }
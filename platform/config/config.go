@@ -5,33 +5,133 @@ import (
 	"crypto/cipher"
 	"crypto/rand"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
 	"strconv"
 	"time"
+
+	"gobizmanager/pkg/encryption"
 )
 
 // Config holds all configuration values
 type Config struct {
-	DBPath        string
-	JWTSecret     string
-	Port          int
-	EncryptionKey string
-	RateLimit     int
+	DBPath    string
+	JWTSecret string
+	// JWTAlgorithm selects how tokens are signed. RS256 and EdDSA use rotating
+	// key pairs; JWTSecret is then only used to verify older HS256 tokens.
+	JWTAlgorithm   string
+	JWTKeyRotation time.Duration
+	Port           int
+	EncryptionKey  string
+	RateLimit      int
+	// AppURL is the frontend base URL used in links sent by email
+	AppURL string
+	// Mail delivery. When SMTPHost is empty messages are written to MailDir.
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	MailFrom     string
+	MailDir      string
+	// OIDCProviders are the external identity providers users can log in with
+	OIDCProviders []OIDCProvider
+	// LDAP enables directory logins when its URL is set
+	LDAP LDAPConfig
+	// PasswordBlocklistFile is a sorted list of breached password SHA-1
+	// hashes. Passwords are not checked against breaches when it is empty.
+	PasswordBlocklistFile string
+	// PasswordHashing sets the argon2id cost of new password hashes. Stored
+	// hashes with other parameters are upgraded at the next login.
+	PasswordHashing encryption.Argon2Params
+	// PasswordPepper is an optional secret mixed into password hashes. It is
+	// kept out of the database so a leaked table alone cannot be cracked.
+	PasswordPepper string
+	// SetupToken creates the first ROOT user through POST /auth/setup. When it
+	// is empty and no ROOT user exists, a random token is logged at startup.
+	SetupToken string
+	// PermissionCacheTTL is how long the compiled permissions of a user in a
+	// company are reused. Changes made through the RBAC API apply at once.
+	PermissionCacheTTL time.Duration
+	// PermissionCacheSize bounds the users and companies whose permissions
+	// are cached. Zero disables the cache.
+	PermissionCacheSize int
+}
+
+// OIDCProvider configures an OpenID Connect identity provider. When CompanyID
+// is set, unknown users are provisioned into that company with DefaultRole.
+type OIDCProvider struct {
+	Name         string   `json:"name"`
+	Issuer       string   `json:"issuer"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	RedirectURL  string   `json:"redirect_url"`
+	Scopes       []string `json:"scopes"`
+	CompanyID    int64    `json:"company_id"`
+	DefaultRole  string   `json:"default_role"`
 }
 
 // Default values for when environment variables are not set
 const (
-	DefaultJWTSecretKey     = "key-place-holder-for-production"
+	DefaultJWTAlgorithm     = JWTAlgorithmEdDSA
+	DefaultJWTKeyRotation   = 30 * 24 * time.Hour
 	DefaultJWTExpiration    = 15 * time.Minute
 	DefaultJWTRefreshExpiry = 24 * time.Hour
 	DefaultDatabasePath     = "./data.db"
 	DefaultServerPort       = 8080
 	DefaultEncryptionKey    = "0123456789abcdef0123456789abcdef" // 32 bytes for AES-256
+	DefaultAppURL           = "http://localhost:5173"
+	DefaultSMTPPort         = 587
+	DefaultMailFrom         = "no-reply@gobizmanager.local"
+	DefaultMailDir          = "bin/mail"
+	DefaultLDAPUserFilter   = "(&(objectClass=person)(|(uid={username})(mail={username})))"
+	DefaultLDAPEmailAttr    = "mail"
+	DefaultLDAPGroupAttr    = "memberOf"
+	DefaultPermissionTTL    = 5 * time.Minute
+	DefaultPermissionCache  = 10000
+)
+
+// LDAPConfig configures authentication against an LDAP or Active Directory
+// server. The service account in BindDN searches BaseDN with UserFilter, where
+// {username} is replaced by the escaped login name, and the user's password is
+// then checked by binding as the entry found.
+type LDAPConfig struct {
+	URL            string
+	BindDN         string
+	BindPassword   string
+	BaseDN         string
+	UserFilter     string
+	EmailAttribute string
+	GroupAttribute string
+	StartTLS       bool
+	// GroupRoles maps directory groups to company roles
+	GroupRoles []LDAPGroupRole
+}
+
+// LDAPGroupRole grants the named role in a company to members of a group
+type LDAPGroupRole struct {
+	Group     string `json:"group"`
+	CompanyID int64  `json:"company_id"`
+	Role      string `json:"role"`
+}
+
+// Supported token signing algorithms
+const (
+	JWTAlgorithmHS256 = "HS256"
+	JWTAlgorithmRS256 = "RS256"
+	JWTAlgorithmEdDSA = "EdDSA"
 )
 
-// New creates a new Config instance with values from environment variables or defaults
-func New() *Config {
+// minJWTSecretLength is the shortest accepted HS256 secret, matching the hash size
+const minJWTSecretLength = 32
+
+// minPasswordPepperLength is the shortest accepted password pepper
+const minPasswordPepperLength = 16
+
+// New creates a new Config instance with values from environment variables or
+// defaults. It fails when the token signing settings are missing or unsafe.
+func New() (*Config, error) {
 	port, _ := strconv.Atoi(os.Getenv("PORT"))
 	if port == 0 {
 		port = DefaultServerPort
@@ -52,13 +152,163 @@ func New() *Config {
 		encryptionKey = DefaultEncryptionKey
 	}
 
+	smtpPort, _ := strconv.Atoi(os.Getenv("SMTP_PORT"))
+	if smtpPort == 0 {
+		smtpPort = DefaultSMTPPort
+	}
+
+	jwtSecret := os.Getenv("JWT_SECRET")
+	jwtAlgorithm := getEnv("JWT_ALGORITHM", DefaultJWTAlgorithm)
+	switch jwtAlgorithm {
+	case JWTAlgorithmHS256:
+		if jwtSecret == "" {
+			return nil, errors.New("JWT_SECRET is required when JWT_ALGORITHM is HS256")
+		}
+	case JWTAlgorithmRS256, JWTAlgorithmEdDSA:
+	default:
+		return nil, fmt.Errorf("unsupported JWT_ALGORITHM %q", jwtAlgorithm)
+	}
+	if jwtSecret != "" && len(jwtSecret) < minJWTSecretLength {
+		return nil, fmt.Errorf("JWT_SECRET must be at least %d bytes", minJWTSecretLength)
+	}
+
+	jwtKeyRotation := DefaultJWTKeyRotation
+	if value := os.Getenv("JWT_KEY_ROTATION"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid JWT_KEY_ROTATION %q", value)
+		}
+		jwtKeyRotation = d
+	}
+
+	var oidcProviders []OIDCProvider
+	if value := os.Getenv("OIDC_PROVIDERS"); value != "" {
+		if err := json.Unmarshal([]byte(value), &oidcProviders); err != nil {
+			return nil, fmt.Errorf("invalid OIDC_PROVIDERS: %w", err)
+		}
+		for _, p := range oidcProviders {
+			if p.Name == "" || p.Issuer == "" || p.ClientID == "" || p.RedirectURL == "" {
+				return nil, errors.New("OIDC_PROVIDERS entries need name, issuer, client_id and redirect_url")
+			}
+			if p.CompanyID != 0 && p.DefaultRole == "" {
+				return nil, fmt.Errorf("OIDC provider %q provisions into a company but has no default_role", p.Name)
+			}
+		}
+	}
+
+	ldapConfig := LDAPConfig{
+		URL:            os.Getenv("LDAP_URL"),
+		BindDN:         os.Getenv("LDAP_BIND_DN"),
+		BindPassword:   os.Getenv("LDAP_BIND_PASSWORD"),
+		BaseDN:         os.Getenv("LDAP_BASE_DN"),
+		UserFilter:     getEnv("LDAP_USER_FILTER", DefaultLDAPUserFilter),
+		EmailAttribute: getEnv("LDAP_EMAIL_ATTRIBUTE", DefaultLDAPEmailAttr),
+		GroupAttribute: getEnv("LDAP_GROUP_ATTRIBUTE", DefaultLDAPGroupAttr),
+		StartTLS:       os.Getenv("LDAP_START_TLS") == "true",
+	}
+	if ldapConfig.URL != "" && ldapConfig.BaseDN == "" {
+		return nil, errors.New("LDAP_BASE_DN is required when LDAP_URL is set")
+	}
+	if value := os.Getenv("LDAP_GROUP_ROLES"); value != "" {
+		if err := json.Unmarshal([]byte(value), &ldapConfig.GroupRoles); err != nil {
+			return nil, fmt.Errorf("invalid LDAP_GROUP_ROLES: %w", err)
+		}
+		for _, m := range ldapConfig.GroupRoles {
+			if m.Group == "" || m.CompanyID == 0 || m.Role == "" {
+				return nil, errors.New("LDAP_GROUP_ROLES entries need group, company_id and role")
+			}
+		}
+	}
+
+	permissionCacheTTL := DefaultPermissionTTL
+	if value := os.Getenv("PERMISSION_CACHE_TTL"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid PERMISSION_CACHE_TTL %q", value)
+		}
+		permissionCacheTTL = d
+	}
+	permissionCacheSize := DefaultPermissionCache
+	if value := os.Getenv("PERMISSION_CACHE_SIZE"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid PERMISSION_CACHE_SIZE %q", value)
+		}
+		permissionCacheSize = n
+	}
+
+	passwordHashing, err := argon2Params()
+	if err != nil {
+		return nil, err
+	}
+	passwordPepper := os.Getenv("PASSWORD_PEPPER")
+	if passwordPepper != "" && len(passwordPepper) < minPasswordPepperLength {
+		return nil, fmt.Errorf("PASSWORD_PEPPER must be at least %d bytes", minPasswordPepperLength)
+	}
+
 	return &Config{
-		DBPath:        dbPath,
-		JWTSecret:     os.Getenv("JWT_SECRET"),
-		Port:          port,
-		EncryptionKey: encryptionKey,
-		RateLimit:     rateLimit,
+		DBPath:         dbPath,
+		JWTSecret:      jwtSecret,
+		JWTAlgorithm:   jwtAlgorithm,
+		JWTKeyRotation: jwtKeyRotation,
+		Port:           port,
+		EncryptionKey:  encryptionKey,
+		RateLimit:      rateLimit,
+		AppURL:         getEnv("APP_URL", DefaultAppURL),
+		SMTPHost:       os.Getenv("SMTP_HOST"),
+		SMTPPort:       smtpPort,
+		SMTPUsername:   os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:   os.Getenv("SMTP_PASSWORD"),
+		MailFrom:       getEnv("MAIL_FROM", DefaultMailFrom),
+		MailDir:        getEnv("MAIL_DIR", DefaultMailDir),
+		OIDCProviders:  oidcProviders,
+		LDAP:           ldapConfig,
+
+		PasswordBlocklistFile: os.Getenv("PASSWORD_BLOCKLIST_FILE"),
+		PasswordHashing:       passwordHashing,
+		PasswordPepper:        passwordPepper,
+		SetupToken:            os.Getenv("SETUP_TOKEN"),
+		PermissionCacheTTL:    permissionCacheTTL,
+		PermissionCacheSize:   permissionCacheSize,
+	}, nil
+}
+
+// argon2Params reads the password hashing cost from ARGON2_MEMORY (KiB),
+// ARGON2_ITERATIONS and ARGON2_PARALLELISM
+func argon2Params() (encryption.Argon2Params, error) {
+	params := encryption.DefaultArgon2Params
+	settings := []struct {
+		name string
+		bits int
+		set  func(uint64)
+	}{
+		{"ARGON2_MEMORY", 32, func(v uint64) { params.Memory = uint32(v) }},
+		{"ARGON2_ITERATIONS", 32, func(v uint64) { params.Iterations = uint32(v) }},
+		{"ARGON2_PARALLELISM", 8, func(v uint64) { params.Parallelism = uint8(v) }},
+	}
+	for _, setting := range settings {
+		value := os.Getenv(setting.name)
+		if value == "" {
+			continue
+		}
+		v, err := strconv.ParseUint(value, 10, setting.bits)
+		if err != nil || v == 0 {
+			return params, fmt.Errorf("invalid %s %q", setting.name, value)
+		}
+		setting.set(v)
+	}
+	if params.Memory < 8*uint32(params.Parallelism) {
+		return params, errors.New("ARGON2_MEMORY must be at least 8 KiB per lane of ARGON2_PARALLELISM")
+	}
+	return params, nil
+}
+
+// getEnv returns the environment variable or fallback when it is unset
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
 	}
+	return fallback
 }
 
 // Encrypt encrypts a string using AES-GCM
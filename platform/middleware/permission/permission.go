@@ -0,0 +1,98 @@
+// Package permission declares the module action each route requires, so that
+// routers can be checked at startup for routes nobody thought to protect
+package permission
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Requirement is the module action a route needs in the company it addresses.
+// The zero Requirement declares a route any authenticated user may call.
+type Requirement struct {
+	Module string
+	Action string
+}
+
+func (r Requirement) String() string {
+	if r.Module == "" {
+		return "authenticated"
+	}
+	return r.Module + ":" + r.Action
+}
+
+// ResourceLoader returns the attributes of the resource a request addresses,
+// which conditional grants are evaluated against. Errors are language keys
+// sent back to the caller.
+type ResourceLoader func(r *http.Request) (map[string]any, error)
+
+// Guard builds the middleware enforcing route requirements. It is implemented
+// by rbac.RbacBaseHandler.
+type Guard interface {
+	// RequirePermission lets the request through when the caller holds the
+	// module action in the company the request addresses
+	RequirePermission(moduleName, actionName string) func(http.Handler) http.Handler
+	// RequirePermissionOn is RequirePermission for routes addressing a single
+	// resource, whose attributes load returns
+	RequirePermissionOn(moduleName, actionName string, load ResourceLoader) func(http.Handler) http.Handler
+	// RequireAuthentication declares a route that only acts on the caller's
+	// own data and needs no module action
+	RequireAuthentication() func(http.Handler) http.Handler
+}
+
+// Declare marks next as enforcing req. Guards wrap their handlers with it so
+// that Check can find the declaration.
+func Declare(req Requirement, next http.Handler) http.Handler {
+	return &declared{req: req, next: next}
+}
+
+type declared struct {
+	req  Requirement
+	next http.Handler
+}
+
+func (d *declared) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.next.ServeHTTP(w, r)
+}
+
+// Check fails when a route of the router has no permission declaration among
+// its middlewares
+func Check(router http.Handler) error {
+	routes, ok := router.(chi.Routes)
+	if !ok {
+		return fmt.Errorf("cannot list the routes of %T", router)
+	}
+
+	var missing []string
+	err := chi.Walk(routes, func(method, route string, _ http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		if _, ok := Declared(middlewares); !ok {
+			missing = append(missing, method+" "+route)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("routes without a permission declaration: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// Declared returns the requirement declared by one of the middlewares. Each
+// middleware is applied to a placeholder handler to find the declaration, so
+// middlewares must not have side effects until they serve a request.
+func Declared(middlewares []func(http.Handler) http.Handler) (Requirement, bool) {
+	placeholder := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	for _, mw := range middlewares {
+		if d, ok := mw(placeholder).(*declared); ok {
+			return d.req, true
+		}
+	}
+	return Requirement{}, false
+}
@@ -24,7 +24,6 @@ func New(requestsPerMinute int) func(http.Handler) http.Handler {
 			ip := strings.Split(r.RemoteAddr, ":")[0]
 
 			rl.mu.Lock()
-			defer rl.mu.Unlock()
 
 			// Clean up old requests
 			now := time.Now()
@@ -39,12 +38,14 @@ func New(requestsPerMinute int) func(http.Handler) http.Handler {
 
 			// Check if rate limit exceeded
 			if len(rl.requests[ip]) >= rl.requestsPerMinute {
+				rl.mu.Unlock()
 				http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
 				return
 			}
 
 			// Add current request
 			rl.requests[ip] = append(rl.requests[ip], now)
+			rl.mu.Unlock()
 
 			next.ServeHTTP(w, r)
 		})